@@ -0,0 +1,90 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+// AlphanumericPolicy selects what EncodeText does with text that would fit in
+// the denser alphanumeric mode if it were not for lowercase letters.
+type AlphanumericPolicy int
+
+// Alphanumeric policies.
+const (
+	AlphanumericLenient AlphanumericPolicy = iota // Fall back to byte mode, as EncodeText does by default.
+	AlphanumericStrict                            // Fail with a LowercaseError.
+)
+
+// ModeReport describes the segment mode EncodeText chose.
+type ModeReport struct {
+	Mode      Mode // The mode of the text segment.
+	Lowercase int  // Number of lowercase ASCII letters that kept the text out of alphanumeric mode, or 0 if uppercasing would not have helped.
+	Fallback  bool // Byte mode was used only because of lowercase letters; the uppercased text would have used alphanumeric mode.
+}
+
+// WithAlphanumericPolicy sets how EncodeText treats text that is alphanumeric
+// except for lowercase letters. Under AlphanumericLenient the text is encoded
+// in byte mode, which makes the symbol larger; under AlphanumericStrict
+// EncodeText fails so the caller can uppercase the text (most URLs, for
+// example, accept an uppercase scheme and host). If report is not nil, it
+// receives the mode decision. The policy has no effect with WithForcedMode.
+func WithAlphanumericPolicy(policy AlphanumericPolicy, report *ModeReport) func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.alphanumericPolicy = policy
+		s.modeReport = report
+	}
+}
+
+// checkAlphanumeric applies the alphanumeric policy to text and fills in the
+// mode report.
+func (s *segmentEncoder) checkAlphanumeric(text string) error {
+	report := ModeReport{Mode: Byte}
+	switch {
+	case text == "":
+	case CanEncodeNumeric(text):
+		report.Mode = Numeric
+	case CanEncodeAlphanumeric(text):
+		report.Mode = Alphanumeric
+	default:
+		lower := 0
+		for i := 0; i < len(text); i++ {
+			c := text[i]
+			if 'a' <= c && c <= 'z' {
+				lower++
+			} else if alphanumericIndex[c] < 0 {
+				lower = 0 // Uppercasing would not help.
+				break
+			}
+		}
+		report.Lowercase = lower
+		report.Fallback = lower > 0
+	}
+
+	if s.modeReport != nil {
+		*s.modeReport = report
+	}
+	if report.Fallback && s.alphanumericPolicy == AlphanumericStrict {
+		return &LowercaseError{Lowercase: report.Lowercase}
+	}
+
+	return nil
+}
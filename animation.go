@@ -0,0 +1,113 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AnimationMode selects how ToAnimatedSVGString animates the symbol.
+type AnimationMode int
+
+// Animation modes.
+const (
+	// AnimationFade fades the dark modules in one by one with a CSS
+	// animation, sweeping diagonally from the top left corner.
+	AnimationFade AnimationMode = iota
+	// AnimationDraw traces the outline of the dark modules with a SMIL
+	// animation of the stroke, then fills them in.
+	AnimationDraw
+)
+
+// AnimationOptions controls ToAnimatedSVGString.
+type AnimationOptions struct {
+	Mode     AnimationMode
+	Duration time.Duration // Length of the whole animation (default 1.5s).
+	Border   int           // Quiet zone in modules.
+}
+
+// ToAnimatedSVGString renders the QR code as a standalone SVG document that
+// animates in, for marketing pages. The document's unanimated state is the
+// finished symbol, so viewers without CSS animation or SMIL support (and, for
+// AnimationFade, users who prefer reduced motion) see an ordinary static code;
+// the animations only ever run from hidden to that state.
+func (q *QRCode) ToAnimatedSVGString(opts AnimationOptions) (string, error) {
+	if opts.Border < 0 {
+		return "", fmt.Errorf("border must be non-negative")
+	}
+	duration := opts.Duration
+	if duration == 0 {
+		duration = 1500 * time.Millisecond
+	}
+	if duration < 0 {
+		return "", fmt.Errorf("duration must be positive")
+	}
+	seconds := duration.Seconds()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<svg xmlns=\"http://www.w3.org/2000/svg\" version=\"1.1\" viewBox=\"0 0 %[1]d %[1]d\" stroke=\"none\">\n", q.Size+opts.Border*2)
+	sb.WriteString("\t<rect width=\"100%\" height=\"100%\" fill=\"#FFFFFF\"/>\n")
+
+	switch opts.Mode {
+	case AnimationFade:
+		// Each module starts after a delay proportional to its diagonal, and
+		// the last ones finish at the end of the duration.
+		fade := seconds / 4
+		step := (seconds - fade) / float64(max(1, 2*(q.Size-1)))
+		sb.WriteString("\t<style>\n")
+		sb.WriteString("\t\t@keyframes qr-fade { from { opacity: 0 } to { opacity: 1 } }\n")
+		fmt.Fprintf(&sb, "\t\t.qr-m { animation: qr-fade %ss ease-out both }\n", formatFloat(fade, 4))
+		sb.WriteString("\t\t@media (prefers-reduced-motion: reduce) { .qr-m { animation: none } }\n")
+		sb.WriteString("\t</style>\n")
+		sb.WriteString("\t<g fill=\"#000000\">\n")
+		for y := 0; y < q.Size; y++ {
+			for x := 0; x < q.Size; x++ {
+				if q.Modules[y][x] == 1 {
+					fmt.Fprintf(&sb, "\t\t<rect class=\"qr-m\" x=\"%d\" y=\"%d\" width=\"1\" height=\"1\" style=\"animation-delay:%ss\"/>\n",
+						x+opts.Border, y+opts.Border, formatFloat(float64(x+y)*step, 4))
+				}
+			}
+		}
+		sb.WriteString("\t</g>\n")
+	case AnimationDraw:
+		// pathLength normalizes the outline to 1, so a single dash of length
+		// 1 can be slid into view. The fill fades in, and the outline out,
+		// over the last quarter, leaving the plain symbol.
+		sb.WriteString("\t<path d=\"")
+		q.writeSVGPath(&sb, opts.Border)
+		sb.WriteString("\" fill=\"#000000\" stroke=\"#000000\" stroke-width=\"0.1\" stroke-opacity=\"0\" pathLength=\"1\" stroke-dasharray=\"1\" stroke-dashoffset=\"0\">\n")
+		fmt.Fprintf(&sb, "\t\t<animate attributeName=\"stroke-dashoffset\" values=\"1;0\" keyTimes=\"0;1\" dur=\"%ss\" fill=\"freeze\"/>\n", formatFloat(seconds*0.75, 4))
+		fmt.Fprintf(&sb, "\t\t<animate attributeName=\"stroke-opacity\" values=\"1;1;0\" keyTimes=\"0;0.75;1\" dur=\"%ss\" fill=\"freeze\"/>\n", formatFloat(seconds, 4))
+		fmt.Fprintf(&sb, "\t\t<animate attributeName=\"fill-opacity\" values=\"0;0;1\" keyTimes=\"0;0.75;1\" dur=\"%ss\" fill=\"freeze\"/>\n", formatFloat(seconds, 4))
+		sb.WriteString("\t</path>\n")
+	default:
+		return "", fmt.Errorf("unknown animation mode %d", opts.Mode)
+	}
+	sb.WriteString("</svg>\n")
+
+	return sb.String(), nil
+}
@@ -0,0 +1,201 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes one successfully encoded QR code. It identifies the
+// payload by hash only, so the audit trail does not itself hold the data.
+type AuditRecord struct {
+	Time        time.Time
+	Tag         string   // The caller tag given to WithAudit.
+	PayloadHash [32]byte // SHA-256 of the encoded segment bit stream (modes, counts and data).
+	SymbolHash  [32]byte // QRCode.Hash of the result.
+	Version     Version
+	ECL         ECL // The error correction level actually used, after any boost.
+	Mask        Mask
+}
+
+// AuditHook receives a record for every QR code encoded with WithAudit. If
+// Audit returns an error, the encode fails with that error, so no code is
+// issued without being recorded. Implementations must be safe for concurrent
+// use.
+type AuditHook interface {
+	Audit(AuditRecord) error
+}
+
+// WithAudit reports every successful encode to hook, labeled with the caller
+// tag (for example the name of the issuing service or user).
+func WithAudit(hook AuditHook, tag string) func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.audit = hook
+		s.auditTag = tag
+	}
+}
+
+// auditEncode sends the record for q to the encoder's hook, if any, with the
+// symbol hash computed by symbolHash.
+func (s *segmentEncoder) auditEncode(q *QRCode, symbolHash func() [32]byte, data bitBuffer) error {
+	if s.audit == nil {
+		return nil
+	}
+
+	packed := make([]byte, (len(data)+7)/8)
+	for i, b := range data {
+		packed[i>>3] |= b << (7 - i&7)
+	}
+	err := s.audit.Audit(AuditRecord{
+		Time:        time.Now(),
+		Tag:         s.auditTag,
+		PayloadHash: sha256.Sum256(packed),
+		SymbolHash:  symbolHash(),
+		Version:     q.Version,
+		ECL:         q.ErrorCorrectionLevel,
+		Mask:        q.Mask,
+	})
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	return nil
+}
+
+// AuditLog is a file-based AuditHook writing one JSON object per line. Each
+// line carries the SHA-256 of the previous line ("prev"), so deleting or
+// editing an entry breaks the chain and can be detected with VerifyAuditLog.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+	prev string
+}
+
+// auditLine is the JSON form of an AuditRecord in an AuditLog.
+type auditLine struct {
+	Time        time.Time `json:"time"`
+	Tag         string    `json:"tag,omitempty"`
+	PayloadHash string    `json:"payloadHash"`
+	SymbolHash  string    `json:"symbolHash"`
+	Version     int       `json:"version"`
+	ECL         string    `json:"ecl"`
+	Mask        int       `json:"mask"`
+	Prev        string    `json:"prev"`
+}
+
+// OpenAuditLog opens (creating if needed) an append-only audit log file.
+func OpenAuditLog(name string) (*AuditLog, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	prev, err := readAuditChain(f, func() {})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &AuditLog{file: f, prev: prev}, nil
+}
+
+// Audit implements AuditHook. The line is synced to disk before Audit
+// returns.
+func (l *AuditLog) Audit(r AuditRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	line, err := json.Marshal(auditLine{
+		Time:        r.Time.UTC(),
+		Tag:         r.Tag,
+		PayloadHash: hex.EncodeToString(r.PayloadHash[:]),
+		SymbolHash:  hex.EncodeToString(r.SymbolHash[:]),
+		Version:     int(r.Version),
+		ECL:         r.ECL.String(),
+		Mask:        int(r.Mask),
+		Prev:        l.prev,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.prev = lineHash(line)
+
+	return nil
+}
+
+// Close closes the log file.
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// VerifyAuditLog checks the hash chain of an audit log, returning the number
+// of entries, or an error naming the first line that does not follow from its
+// predecessor.
+func VerifyAuditLog(r io.Reader) (int, error) {
+	var n int
+	_, err := readAuditChain(r, func() { n++ })
+	return n, err
+}
+
+// readAuditChain verifies the hash chain of a log, calling each for every
+// entry, and returns the hash of the last line.
+func readAuditChain(r io.Reader, each func()) (string, error) {
+	prev := ""
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		var line auditLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return "", fmt.Errorf("audit log line %d: %w", lineNo, err)
+		}
+		if line.Prev != prev {
+			return "", fmt.Errorf("audit log line %d: broken hash chain", lineNo)
+		}
+		prev = lineHash(scanner.Bytes())
+		each()
+	}
+
+	return prev, scanner.Err()
+}
+
+func lineHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
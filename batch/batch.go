@@ -0,0 +1,380 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package batch encodes many payloads in parallel and writes the rendered
+// symbols to a Sink, for bulk pre-generation jobs.
+//
+// A Sink only has to create named writers, so object stores are easy to
+// plug in. For example, with the AWS SDK's s3manager.Uploader:
+//
+//	sink := batch.SinkFunc(func(name string) (io.WriteCloser, error) {
+//		r, w := io.Pipe()
+//		done := make(chan error, 1)
+//		go func() {
+//			_, err := uploader.Upload(&s3manager.UploadInput{
+//				Bucket: aws.String("codes"),
+//				Key:    aws.String(name),
+//				Body:   r,
+//			})
+//			r.CloseWithError(err)
+//			done <- err
+//		}()
+//		return batch.WaitCloser(w, done), nil
+//	})
+package batch
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/grkuntzmd/qrcodegen"
+)
+
+// Sink creates the destination for each rendered symbol.
+type Sink interface {
+	Create(name string) (io.WriteCloser, error)
+}
+
+// SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(name string) (io.WriteCloser, error)
+
+// Create implements Sink.
+func (f SinkFunc) Create(name string) (io.WriteCloser, error) {
+	return f(name)
+}
+
+// DirSink writes each symbol to a file under the named directory, creating
+// subdirectories as needed. Names must be relative slash-separated paths (see
+// fs.ValidPath) so that a template cannot write outside the directory.
+type DirSink string
+
+// Create implements Sink.
+func (d DirSink) Create(name string) (io.WriteCloser, error) {
+	if !fs.ValidPath(name) || strings.Contains(name, `\`) {
+		return nil, fmt.Errorf("batch: invalid output name %q", name)
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return nil, fmt.Errorf("batch: invalid output name %q", name)
+		}
+	}
+	path := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	return os.Create(path)
+}
+
+// WaitCloser returns a WriteCloser whose Close closes w and then waits for a
+// result on done, which is useful when a background upload consumes the other
+// end of a pipe.
+func WaitCloser(w io.WriteCloser, done <-chan error) io.WriteCloser {
+	return &waitCloser{WriteCloser: w, done: done}
+}
+
+type waitCloser struct {
+	io.WriteCloser
+	done <-chan error
+}
+
+func (w *waitCloser) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+
+	return <-w.done
+}
+
+// Renderer writes a QR code in some output format.
+type Renderer interface {
+	Render(w io.Writer, q *qrcodegen.QRCode) error
+	Ext() string // The file name extension, including the dot.
+}
+
+// SVG renders symbols with ToSVGString.
+type SVG struct {
+	Border int
+}
+
+// Render implements Renderer.
+func (s SVG) Render(w io.Writer, q *qrcodegen.QRCode) error {
+	svg, err := q.ToSVGString(s.Border, true)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, svg)
+
+	return err
+}
+
+// Ext implements Renderer.
+func (SVG) Ext() string {
+	return ".svg"
+}
+
+// PNG renders symbols with WritePNG. The zero value renders at the defaults
+// of PNGOptions.
+type PNG struct {
+	Scale  int // Pixels per module (default 4).
+	Border int // Quiet zone in modules (default 4; negative for none).
+}
+
+// Render implements Renderer.
+func (p PNG) Render(w io.Writer, q *qrcodegen.QRCode) error {
+	return q.WritePNG(w, qrcodegen.PNGOptions{Scale: p.Scale, Border: p.Border})
+}
+
+// Ext implements Renderer.
+func (PNG) Ext() string {
+	return ".png"
+}
+
+// Source supplies payloads to a job. Next returns false when there are no more
+// payloads; Err then reports any error that stopped the iteration.
+type Source interface {
+	Next() (string, bool)
+	Err() error
+}
+
+// Strings returns a Source that yields the given payloads.
+func Strings(payloads []string) Source {
+	return &sliceSource{payloads: payloads}
+}
+
+type sliceSource struct {
+	payloads []string
+	next     int
+}
+
+func (s *sliceSource) Next() (string, bool) {
+	if s.next >= len(s.payloads) {
+		return "", false
+	}
+	s.next++
+
+	return s.payloads[s.next-1], true
+}
+
+func (s *sliceSource) Err() error {
+	return nil
+}
+
+// Lines returns a Source that yields each line of r as a payload, skipping
+// empty lines.
+func Lines(r io.Reader) Source {
+	return &lineSource{scanner: bufio.NewScanner(r)}
+}
+
+type lineSource struct {
+	scanner *bufio.Scanner
+}
+
+func (s *lineSource) Next() (string, bool) {
+	for s.scanner.Scan() {
+		if line := strings.TrimRight(s.scanner.Text(), "\r"); line != "" {
+			return line, true
+		}
+	}
+
+	return "", false
+}
+
+func (s *lineSource) Err() error {
+	return s.scanner.Err()
+}
+
+// Item describes one payload, and is the data passed to the naming template.
+type Item struct {
+	Index   int    // Zero-based position of the payload in the source.
+	Payload string // The payload text.
+	Hash    string // Hex SHA-256 of the payload.
+	Ext     string // The renderer's file name extension.
+}
+
+// Result reports the outcome for one payload.
+type Result struct {
+	Item
+	Name string // The name passed to the sink.
+	Err  error  // Nil on success.
+}
+
+// Stats summarizes a completed job.
+type Stats struct {
+	Succeeded int
+	Failed    int
+}
+
+// Job describes a batch encoding run.
+type Job struct {
+	ECL         qrcodegen.ECL                                   // Error correction level used by the default encoder.
+	Transform   func(payload string) (string, error)            // Optional rewrite applied before encoding, such as payload.Sealer.
+	Encode      func(payload string) (*qrcodegen.QRCode, error) // Encodes one payload (default EncodeText with ECL).
+	Renderer    Renderer                                        // Output format (default SVG with a 4 module border).
+	Sink        Sink                                            // Destination of the rendered symbols.
+	Name        string                                          // text/template for sink names, using the fields of Item (default "{{.Index}}{{.Ext}}").
+	Parallelism int                                             // Number of concurrent workers (default runtime.NumCPU()).
+	OnResult    func(Result)                                    // Called once per payload, from a single goroutine, in completion order.
+}
+
+// Run encodes, renders, and writes every payload from the source. Failures of
+// individual payloads are reported to OnResult and counted in the returned
+// Stats; Run itself fails only if the job is invalid, the source fails, or the
+// context is canceled.
+func (j *Job) Run(ctx context.Context, source Source) (Stats, error) {
+	var stats Stats
+	if j.Sink == nil {
+		return stats, fmt.Errorf("batch: no sink")
+	}
+
+	nameTemplate := j.Name
+	if nameTemplate == "" {
+		nameTemplate = "{{.Index}}{{.Ext}}"
+	}
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return stats, fmt.Errorf("batch: name template: %w", err)
+	}
+	encode := j.Encode
+	if encode == nil {
+		encode = func(payload string) (*qrcodegen.QRCode, error) {
+			return qrcodegen.EncodeText(payload, j.ECL)
+		}
+	}
+	renderer := j.Renderer
+	if renderer == nil {
+		renderer = SVG{Border: 4}
+	}
+	parallelism := j.Parallelism
+	if parallelism < 1 {
+		parallelism = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	items := make(chan Item)
+	results := make(chan Result)
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				results <- j.process(item, tmpl, encode, renderer)
+			}
+		}()
+	}
+
+	// Feed the workers, stopping early if the context is canceled.
+	go func() {
+		defer close(items)
+		for index := 0; ; index++ {
+			payload, ok := source.Next()
+			if !ok {
+				return
+			}
+			sum := sha256.Sum256([]byte(payload))
+			item := Item{Index: index, Payload: payload, Hash: hex.EncodeToString(sum[:]), Ext: renderer.Ext()}
+			select {
+			case items <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for r := range results {
+		if r.Err == nil {
+			stats.Succeeded++
+		} else {
+			stats.Failed++
+		}
+		if j.OnResult != nil {
+			j.OnResult(r)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return stats, err
+	}
+
+	return stats, source.Err()
+}
+
+// process handles a single payload.
+func (j *Job) process(item Item, tmpl *template.Template, encode func(string) (*qrcodegen.QRCode, error), renderer Renderer) Result {
+	result := Result{Item: item}
+
+	var name strings.Builder
+	if result.Err = tmpl.Execute(&name, item); result.Err != nil {
+		return result
+	}
+	result.Name = name.String()
+
+	text := item.Payload
+	if j.Transform != nil {
+		var err error
+		if text, err = j.Transform(text); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	q, err := encode(text)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	w, err := j.Sink.Create(result.Name)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if err := renderer.Render(w, q); err != nil {
+		w.Close()
+		result.Err = err
+		return result
+	}
+	result.Err = w.Close()
+
+	return result
+}
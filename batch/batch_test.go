@@ -0,0 +1,257 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package batch
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grkuntzmd/qrcodegen"
+	"github.com/stretchr/testify/assert"
+)
+
+// memorySink keeps the written objects in memory.
+type memorySink struct {
+	mu      sync.Mutex
+	objects map[string]*bytes.Buffer
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func (m *memorySink) Create(name string) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	buf := new(bytes.Buffer)
+	m.objects[name] = buf
+	return nopCloser{buf}, nil
+}
+
+func TestRun(t *testing.T) {
+	sink := &memorySink{objects: make(map[string]*bytes.Buffer)}
+	var failed []Result
+	job := Job{
+		ECL:         qrcodegen.High,
+		Sink:        sink,
+		Renderer:    PNG{Scale: 2, Border: 1},
+		Name:        "codes/{{.Index}}-{{printf \"%.8s\" .Hash}}{{.Ext}}",
+		Parallelism: 3,
+		OnResult: func(r Result) {
+			if r.Err != nil {
+				failed = append(failed, r)
+			}
+		},
+	}
+
+	payloads := "ALPHA\nBRAVO\n\n" + strings.Repeat("x", 5000) + "\nCHARLIE\n"
+	stats, err := job.Run(context.Background(), Lines(strings.NewReader(payloads)))
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Succeeded: 3, Failed: 1}, stats)
+	assert.Len(t, sink.objects, 3)
+	assert.Len(t, failed, 1)
+	assert.Equal(t, 2, failed[0].Index)
+
+	for name, buf := range sink.objects {
+		assert.True(t, strings.HasPrefix(name, "codes/"))
+		assert.True(t, strings.HasSuffix(name, ".png"))
+		assert.True(t, buf.Len() > 0)
+	}
+}
+
+func TestPNGDefaults(t *testing.T) {
+	q, err := qrcodegen.EncodeText("HELLO", qrcodegen.Low)
+	assert.NoError(t, err)
+	for _, tc := range []struct {
+		renderer PNG
+		size     int
+	}{
+		{PNG{}, (21 + 8) * 4},
+		{PNG{Scale: 2, Border: -1}, 21 * 2},
+	} {
+		var buf bytes.Buffer
+		assert.NoError(t, tc.renderer.Render(&buf, q))
+		img, err := png.Decode(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.size, img.Bounds().Dx())
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	job := Job{Sink: &memorySink{objects: make(map[string]*bytes.Buffer)}}
+	_, err := job.Run(ctx, Strings([]string{"a", "b", "c"}))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestRunTransform(t *testing.T) {
+	var mu sync.Mutex
+	var encoded []string
+	job := Job{
+		Sink:      &memorySink{objects: make(map[string]*bytes.Buffer)},
+		Transform: func(payload string) (string, error) { return "https://example.com/" + payload, nil },
+		Encode: func(payload string) (*qrcodegen.QRCode, error) {
+			mu.Lock()
+			encoded = append(encoded, payload)
+			mu.Unlock()
+			return qrcodegen.EncodeText(payload, qrcodegen.Low)
+		},
+	}
+
+	stats, err := job.Run(context.Background(), Strings([]string{"a"}))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.Succeeded)
+	assert.Equal(t, []string{"https://example.com/a"}, encoded)
+}
+
+func TestPackSink(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewPackSink(&out)
+	job := Job{Sink: sink, Name: "{{.Payload}}{{.Ext}}", Parallelism: 4}
+	payloads := []string{"a", "b", "c", "d", "e"}
+	stats, err := job.Run(context.Background(), Strings(payloads))
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Succeeded: 5}, stats)
+	assert.NoError(t, sink.Close())
+
+	_, err = sink.Create("late.svg")
+	assert.Error(t, err)
+
+	pack, err := OpenPack(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	assert.NoError(t, err)
+	assert.Len(t, pack.Names(), 5)
+	for _, p := range payloads {
+		r, err := pack.Open(p + ".svg")
+		assert.NoError(t, err)
+		data, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(data), "<?xml"))
+	}
+	_, err = pack.Open("missing.svg")
+	assert.Error(t, err)
+
+	_, err = OpenPack(bytes.NewReader(out.Bytes()[:out.Len()-1]), int64(out.Len()-1))
+	assert.Error(t, err)
+}
+
+func TestPackSinkDuplicate(t *testing.T) {
+	sink := NewPackSink(io.Discard)
+	_, err := sink.Create("x")
+	assert.NoError(t, err)
+	_, err = sink.Create("x")
+	assert.Error(t, err)
+	_, err = sink.Create(strings.Repeat("x", 1<<16+1))
+	assert.Error(t, err)
+}
+
+func TestPackSinkLateWriter(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewPackSink(&out)
+	w, err := sink.Create("late.svg")
+	assert.NoError(t, err)
+	_, err = io.WriteString(w, "<svg/>")
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Close())
+	assert.Error(t, w.Close())
+
+	pack, err := OpenPack(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	assert.NoError(t, err)
+	assert.Empty(t, pack.Names())
+}
+
+func TestDirSink(t *testing.T) {
+	dir, err := os.MkdirTemp("", "batch")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sink := DirSink(filepath.Join(dir, "out"))
+
+	w, err := sink.Create("a/b.svg")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	_, err = os.Stat(filepath.Join(dir, "out", "a", "b.svg"))
+	assert.NoError(t, err)
+
+	for _, name := range []string{"../escape.svg", "a/../../escape.svg", "/etc/escape.svg", "", "./a.svg", `..\escape.svg`} {
+		_, err := sink.Create(name)
+		assert.Error(t, err, name)
+	}
+	_, err = os.Stat(filepath.Join(dir, "escape.svg"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSerials(t *testing.T) {
+	opts := SerialOptions{Count: 200, Length: 8, Prefix: "TKT-", Check: true, Seed: []byte("event")}
+	source := Serials(opts)
+	seen := make(map[string]bool)
+	var first []string
+	for {
+		serial, ok := source.Next()
+		if !ok {
+			break
+		}
+		assert.False(t, seen[serial])
+		seen[serial] = true
+		first = append(first, serial)
+		assert.Len(t, serial, 13)
+		assert.True(t, opts.Valid(serial))
+		assert.True(t, qrcodegen.CanEncodeAlphanumeric(serial))
+	}
+	assert.NoError(t, source.Err())
+	assert.Len(t, seen, 200)
+
+	// The same seed gives the same serials.
+	again, _ := Serials(opts).Next()
+	assert.Equal(t, first[0], again)
+
+	// A single changed character fails the check.
+	serial := []byte(first[0])
+	if serial[6] == '0' {
+		serial[6] = '1'
+	} else {
+		serial[6] = '0'
+	}
+	assert.False(t, opts.Valid(string(serial)))
+
+	// Serials feed straight into a job.
+	job := Job{Sink: &memorySink{objects: make(map[string]*bytes.Buffer)}, Name: "{{.Payload}}{{.Ext}}"}
+	stats, err := job.Run(context.Background(), Serials(SerialOptions{Count: 5}))
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Succeeded: 5}, stats)
+
+	for _, bad := range []SerialOptions{{Count: 1, Alphabet: "abc"}, {Count: 1, Alphabet: "AA"}, {Count: 1, Prefix: "x"}, {Count: -1}, {Count: 5, Length: 2, Alphabet: "01"}} {
+		_, ok := Serials(bad).Next()
+		assert.False(t, ok)
+		assert.Error(t, Serials(bad).Err())
+	}
+}
@@ -0,0 +1,239 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// A pack file stores many rendered symbols in one file:
+//
+//	header  "QRPACK1\n"
+//	records uint32 big-endian length, then the blob, for each symbol
+//	index   for each symbol: uvarint name length, name, uvarint blob offset,
+//	        uvarint blob length
+//	footer  uint64 big-endian offset of the index, then "QRPACKIX"
+const (
+	packMagic       = "QRPACK1\n"
+	packFooterMagic = "QRPACKIX"
+	packFooterSize  = 8 + len(packFooterMagic)
+	maxPackName     = 1 << 16 // The longest entry name, in bytes.
+)
+
+// PackSink is a Sink that appends every rendered symbol to a single pack
+// file, avoiding millions of small files during massive generation runs. The
+// symbols can be read back with OpenPack. Each symbol is buffered in memory
+// until its writer is closed, then appended; Close writes the index, so every
+// writer must be closed before it (a writer closed later returns an error).
+type PackSink struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	offset int64
+	index  []packEntry
+	names  map[string]bool
+	err    error
+}
+
+type packEntry struct {
+	name           string
+	offset, length int64
+}
+
+// NewPackSink starts a pack file on w.
+func NewPackSink(w io.Writer) *PackSink {
+	p := &PackSink{w: bufio.NewWriter(w), names: make(map[string]bool)}
+	p.write([]byte(packMagic))
+	return p
+}
+
+func (p *PackSink) write(b []byte) {
+	if p.err != nil {
+		return
+	}
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	p.err = err
+}
+
+// Create implements Sink.
+func (p *PackSink) Create(name string) (io.WriteCloser, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.names == nil {
+		return nil, fmt.Errorf("batch: pack is closed")
+	}
+	if len(name) > maxPackName {
+		return nil, fmt.Errorf("batch: pack entry name of %d bytes is longer than %d", len(name), maxPackName)
+	}
+	if p.names[name] {
+		return nil, fmt.Errorf("batch: duplicate pack entry %q", name)
+	}
+	p.names[name] = true
+
+	return &packWriter{sink: p, name: name}, nil
+}
+
+// append adds one blob to the pack.
+func (p *PackSink) append(name string, blob []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.names == nil {
+		return fmt.Errorf("batch: pack entry %q closed after the pack", name)
+	}
+	if len(blob) > 1<<32-1 {
+		return fmt.Errorf("batch: pack entry %q too large", name)
+	}
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(blob)))
+	p.write(length[:])
+	p.index = append(p.index, packEntry{name: name, offset: p.offset, length: int64(len(blob))})
+	p.write(blob)
+
+	return p.err
+}
+
+// Close writes the index and footer and flushes the pack. It does not close
+// the underlying writer.
+func (p *PackSink) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.names == nil {
+		return p.err
+	}
+	p.names = nil
+
+	indexOffset := p.offset
+	var buf [binary.MaxVarintLen64]byte
+	for _, e := range p.index {
+		p.write(buf[:binary.PutUvarint(buf[:], uint64(len(e.name)))])
+		p.write([]byte(e.name))
+		p.write(buf[:binary.PutUvarint(buf[:], uint64(e.offset))])
+		p.write(buf[:binary.PutUvarint(buf[:], uint64(e.length))])
+	}
+	var footer [8]byte
+	binary.BigEndian.PutUint64(footer[:], uint64(indexOffset))
+	p.write(footer[:])
+	p.write([]byte(packFooterMagic))
+	if p.err != nil {
+		return p.err
+	}
+
+	return p.w.Flush()
+}
+
+// packWriter buffers one symbol until it is closed.
+type packWriter struct {
+	bytes.Buffer
+	sink *PackSink
+	name string
+}
+
+func (w *packWriter) Close() error {
+	return w.sink.append(w.name, w.Bytes())
+}
+
+// Pack reads a pack file written by PackSink. It only needs an io.ReaderAt,
+// so an *os.File or a memory-mapped file (for example from
+// golang.org/x/exp/mmap) can be served without loading it.
+type Pack struct {
+	r     io.ReaderAt
+	names []string
+	index map[string]packEntry
+}
+
+// OpenPack reads the index of a pack file of the given size.
+func OpenPack(r io.ReaderAt, size int64) (*Pack, error) {
+	errCorrupt := errors.New("batch: corrupt pack file")
+	if size < int64(len(packMagic)+packFooterSize) {
+		return nil, errCorrupt
+	}
+	header := make([]byte, len(packMagic))
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	footer := make([]byte, packFooterSize)
+	if _, err := r.ReadAt(footer, size-int64(packFooterSize)); err != nil {
+		return nil, err
+	}
+	if string(header) != packMagic || string(footer[8:]) != packFooterMagic {
+		return nil, errCorrupt
+	}
+	indexOffset := int64(binary.BigEndian.Uint64(footer))
+	indexEnd := size - int64(packFooterSize)
+	if indexOffset < int64(len(packMagic)) || indexOffset > indexEnd {
+		return nil, errCorrupt
+	}
+
+	br := bufio.NewReader(io.NewSectionReader(r, indexOffset, indexEnd-indexOffset))
+	p := &Pack{r: r, index: make(map[string]packEntry)}
+	for {
+		nameLen, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil || nameLen > maxPackName {
+			return nil, errCorrupt
+		}
+		name := make([]byte, nameLen)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return nil, errCorrupt
+		}
+		offset, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, errCorrupt
+		}
+		length, err := binary.ReadUvarint(br)
+		if err != nil || offset+length > uint64(indexOffset) {
+			return nil, errCorrupt
+		}
+		e := packEntry{name: string(name), offset: int64(offset), length: int64(length)}
+		p.names = append(p.names, e.name)
+		p.index[e.name] = e
+	}
+
+	return p, nil
+}
+
+// Names returns the names of the entries in the order they were written.
+func (p *Pack) Names() []string {
+	return p.names
+}
+
+// Open returns a reader for the named entry.
+func (p *Pack) Open(name string) (*io.SectionReader, error) {
+	e, ok := p.index[name]
+	if !ok {
+		return nil, fmt.Errorf("batch: pack entry %q not found", name)
+	}
+
+	return io.NewSectionReader(p.r, e.offset, e.length), nil
+}
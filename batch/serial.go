@@ -0,0 +1,196 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package batch
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/grkuntzmd/qrcodegen"
+)
+
+// DefaultSerialAlphabet is the alphanumeric mode characters without the
+// easily confused I and O.
+const DefaultSerialAlphabet = "0123456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// SerialOptions controls Serials.
+type SerialOptions struct {
+	Count    int    // Number of serials to generate.
+	Length   int    // Random characters per serial, before the check character (default 12).
+	Alphabet string // Characters to draw from, all in the QR alphanumeric set (default DefaultSerialAlphabet).
+	Prefix   string // Fixed text before the random characters, also alphanumeric.
+	Check    bool   // Append a Luhn mod N check character over the random characters.
+
+	// Seed, if not nil, makes the serials deterministic: they are drawn
+	// from HMAC-SHA256 keyed with the seed, so the same seed and options
+	// always give the same serials, and without the seed they cannot be
+	// guessed. Without a seed a random one is used.
+	Seed []byte
+}
+
+// Serials returns a Source of Count unique, unguessable serial payloads. The
+// serials use only alphanumeric mode characters, so they encode in the
+// densest mode that holds letters. Err reports invalid options.
+func Serials(opts SerialOptions) Source {
+	s := &serialSource{opts: opts, seen: make(map[string]bool)}
+	s.err = s.opts.normalize()
+	if s.err == nil && s.opts.Seed == nil {
+		s.opts.Seed = make([]byte, 32)
+		_, s.err = rand.Read(s.opts.Seed)
+	}
+
+	return s
+}
+
+func (opts *SerialOptions) normalize() error {
+	if opts.Length == 0 {
+		opts.Length = 12
+	}
+	if opts.Alphabet == "" {
+		opts.Alphabet = DefaultSerialAlphabet
+	}
+	if opts.Count < 0 || opts.Length < 1 {
+		return fmt.Errorf("batch: serial count must be non-negative and length positive")
+	}
+	if len(opts.Alphabet) < 2 || !qrcodegen.CanEncodeAlphanumeric(opts.Alphabet) || !qrcodegen.CanEncodeAlphanumeric(opts.Prefix) {
+		return fmt.Errorf("batch: serial alphabet and prefix must be alphanumeric mode characters")
+	}
+	for i := range opts.Alphabet {
+		if strings.IndexByte(opts.Alphabet[i+1:], opts.Alphabet[i]) >= 0 {
+			return fmt.Errorf("batch: serial alphabet repeats %q", opts.Alphabet[i])
+		}
+	}
+	capacity := 1
+	for i := 0; i < opts.Length && capacity < opts.Count; i++ {
+		capacity *= len(opts.Alphabet)
+	}
+	if capacity < opts.Count {
+		return fmt.Errorf("batch: %d serials do not fit in %d characters of %q", opts.Count, opts.Length, opts.Alphabet)
+	}
+
+	return nil
+}
+
+// Valid reports whether serial has the prefix, length, alphabet, and (with
+// Check) check character of serials generated with the options. It does not
+// tell whether the serial was actually issued.
+func (opts SerialOptions) Valid(serial string) bool {
+	opts.Count = 0
+	if opts.normalize() != nil || !strings.HasPrefix(serial, opts.Prefix) {
+		return false
+	}
+	body := serial[len(opts.Prefix):]
+	if len(body) != opts.Length+bToI(opts.Check) {
+		return false
+	}
+	for i := 0; i < len(body); i++ {
+		if strings.IndexByte(opts.Alphabet, body[i]) < 0 {
+			return false
+		}
+	}
+
+	return !opts.Check || luhnCheck(body[:opts.Length], opts.Alphabet) == body[opts.Length]
+}
+
+type serialSource struct {
+	opts    SerialOptions
+	seen    map[string]bool
+	block   []byte // Unused bytes of the current HMAC block.
+	counter uint64
+	err     error
+}
+
+func (s *serialSource) Next() (string, bool) {
+	if s.err != nil || len(s.seen) >= s.opts.Count {
+		return "", false
+	}
+
+	for {
+		body := make([]byte, s.opts.Length)
+		for i := range body {
+			body[i] = s.opts.Alphabet[s.uniform(len(s.opts.Alphabet))]
+		}
+		serial := s.opts.Prefix + string(body)
+		if s.opts.Check {
+			serial += string(luhnCheck(string(body), s.opts.Alphabet))
+		}
+		if !s.seen[serial] {
+			s.seen[serial] = true
+			return serial, true
+		}
+	}
+}
+
+func (s *serialSource) Err() error {
+	return s.err
+}
+
+// uniform returns a number in [0, n) drawn without bias from the HMAC
+// stream, rejecting the bytes that would favor the low values.
+func (s *serialSource) uniform(n int) int {
+	limit := 256 - 256%n
+	for {
+		if len(s.block) == 0 {
+			mac := hmac.New(sha256.New, s.opts.Seed)
+			var counter [8]byte
+			binary.BigEndian.PutUint64(counter[:], s.counter)
+			mac.Write(counter[:])
+			s.block = mac.Sum(nil)
+			s.counter++
+		}
+		b := int(s.block[0])
+		s.block = s.block[1:]
+		if b < limit {
+			return b % n
+		}
+	}
+}
+
+// luhnCheck returns the Luhn mod N check character of s, whose characters
+// are taken from the alphabet. It catches every single character error and
+// most transpositions of adjacent characters.
+func luhnCheck(s, alphabet string) byte {
+	n := len(alphabet)
+	sum, factor := 0, 2
+	for i := len(s) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(alphabet, s[i])
+		sum += addend/n + addend%n
+		factor = 3 - factor
+	}
+
+	return alphabet[(n-sum%n)%n]
+}
+
+func bToI(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,190 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// CatalogPage is one page of a PDF catalog: the payload to encode and the
+// caption printed under it. The caption may contain newlines.
+type CatalogPage struct {
+	Payload string
+	Caption string
+}
+
+// CatalogOptions controls WriteCatalogPDF.
+type CatalogOptions struct {
+	Page     PageSize                              // Page size (default PageA4).
+	Margin   float64                               // Page margin in points (default 36, half an inch).
+	Border   int                                   // Quiet zone in modules (default 4).
+	FontSize float64                               // Caption size in points (default 12).
+	Encode   func(payload string) (*QRCode, error) // Encodes each payload (default EncodeText at Medium).
+
+	// Caption is a text/template for the printed captions, using the fields
+	// of CatalogCaption, so that pages identify themselves to fulfillment
+	// teams (default "{{.Caption}}", the page's own caption).
+	Caption string
+	// Serial returns the serial number of the page with the given
+	// zero-based index (default the page number, zero-padded to 6 digits).
+	Serial func(index int) string
+}
+
+// CatalogCaption is the data passed to the caption template of a catalog.
+type CatalogCaption struct {
+	Index   int    // Zero-based position of the page.
+	Payload string // The encoded payload.
+	Caption string // The caption given with the page.
+	Serial  string // The serial number of the page.
+}
+
+// WriteCatalogPDF writes a PDF with one page per item returned by next, each
+// holding a QR code as large as fits and its caption in Helvetica, and
+// returns the number of pages. next returns false when there are no more
+// pages. Pages are written as they are produced, so memory use does not grow
+// with the size of the catalog beyond a few bytes per page for the PDF
+// cross-reference table. Captions are limited to Latin-1 characters.
+func WriteCatalogPDF(w io.Writer, next func() (CatalogPage, bool, error), opts CatalogOptions) (int, error) {
+	if opts.Page == (PageSize{}) {
+		opts.Page = PageA4
+	}
+	if opts.Margin == 0 {
+		opts.Margin = 36
+	}
+	if opts.Border == 0 {
+		opts.Border = 4
+	}
+	if opts.FontSize == 0 {
+		opts.FontSize = 12
+	}
+	if opts.Encode == nil {
+		opts.Encode = func(payload string) (*QRCode, error) {
+			return EncodeText(payload, Medium)
+		}
+	}
+	if opts.Caption == "" {
+		opts.Caption = "{{.Caption}}"
+	}
+	if opts.Serial == nil {
+		opts.Serial = func(index int) string {
+			return fmt.Sprintf("%06d", index+1)
+		}
+	}
+	if opts.Margin < 0 || opts.Border < 0 || opts.FontSize < 0 || opts.Page.Width <= 2*opts.Margin || opts.Page.Height <= 2*opts.Margin {
+		return 0, fmt.Errorf("invalid catalog layout")
+	}
+	captions, err := template.New("caption").Option("missingkey=error").Parse(opts.Caption)
+	if err != nil {
+		return 0, fmt.Errorf("caption template: %w", err)
+	}
+
+	// Objects 1 to 3 are shared; page i uses objects 4+2i (page) and 5+2i
+	// (content), so the page tree can be written last from the count alone.
+	const (
+		catalogObject = 1
+		pagesObject   = 2
+		fontObject    = 3
+		firstPage     = 4
+	)
+	p := newPDFWriter(w)
+	p.object(catalogObject, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesObject))
+	p.object(fontObject, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+
+	pages := 0
+	for {
+		page, ok, err := next()
+		if err != nil {
+			return pages, err
+		}
+		if !ok {
+			break
+		}
+		q, err := opts.Encode(page.Payload)
+		if err != nil {
+			return pages, fmt.Errorf("page %d: %w", pages+1, err)
+		}
+
+		var caption strings.Builder
+		data := CatalogCaption{Index: pages, Payload: page.Payload, Caption: page.Caption, Serial: opts.Serial(pages)}
+		if err := captions.Execute(&caption, data); err != nil {
+			return pages, fmt.Errorf("page %d: caption: %w", pages+1, err)
+		}
+
+		n := firstPage + 2*pages
+		p.object(n, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>",
+			pagesObject, formatFloat(opts.Page.Width, 3), formatFloat(opts.Page.Height, 3), fontObject, n+1))
+		p.stream(n+1, "", []byte(catalogPageContent(q, caption.String(), opts)))
+		if p.err != nil {
+			return pages, p.err
+		}
+		pages++
+	}
+
+	var kids strings.Builder
+	for i := 0; i < pages; i++ {
+		fmt.Fprintf(&kids, "%d 0 R ", firstPage+2*i)
+	}
+	p.object(pagesObject, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.TrimSpace(kids.String()), pages))
+
+	return pages, p.finish(catalogObject)
+}
+
+// catalogPageContent returns the content stream of one catalog page.
+func catalogPageContent(q *QRCode, caption string, opts CatalogOptions) string {
+	var lines []string
+	if caption != "" {
+		lines = strings.Split(caption, "\n")
+	}
+	leading := opts.FontSize * 1.2
+	captionHeight := 0.0
+	if len(lines) > 0 {
+		captionHeight = opts.FontSize + float64(len(lines))*leading
+	}
+
+	width := opts.Page.Width - 2*opts.Margin
+	height := opts.Page.Height - 2*opts.Margin - captionHeight
+	side := width
+	if height < side {
+		side = height
+	}
+	module := side / float64(q.Size+2*opts.Border)
+	left := opts.Margin + (width-side)/2 + float64(opts.Border)*module
+	top := opts.Page.Height - opts.Margin - float64(opts.Border)*module
+
+	var sb strings.Builder
+	pdfModules(&sb, q, left, top, module)
+
+	baseline := opts.Page.Height - opts.Margin - side - opts.FontSize
+	for _, line := range lines {
+		baseline -= leading
+		x := opts.Page.Width/2 - helveticaWidth(line, opts.FontSize)/2
+		fmt.Fprintf(&sb, "BT /F1 %s Tf %s %s Td %s Tj ET\n", formatFloat(opts.FontSize, 3), formatFloat(x, 3), formatFloat(baseline, 3), pdfString(line))
+	}
+
+	return sb.String()
+}
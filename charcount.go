@@ -0,0 +1,171 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// CharCounts reports how many characters a string counts as in each mode, as
+// used for the character count field and the capacity of a symbol.
+type CharCounts struct {
+	Numeric      int // Number of digits, or -1 if the text is not all digits.
+	Alphanumeric int // Number of characters, or -1 if the text is not all in the alphanumeric set.
+	Kanji        int // Number of Shift JIS double-byte characters, or -1 if some character cannot be encoded in kanji mode.
+	Bytes        int // Number of UTF-8 bytes.
+}
+
+// ModeVersions holds the minimal version that can hold some text as a single
+// segment in each mode, or 0 if the text cannot be encoded in that mode or
+// does not fit in any version.
+type ModeVersions struct {
+	Numeric      Version
+	Alphanumeric Version
+	Kanji        Version
+	Bytes        Version
+}
+
+// CountChars counts the characters of text in each mode, so that a user
+// interface can show how close the text is to the capacity of a version in
+// each mode.
+func CountChars(text string) CharCounts {
+	c := CharCounts{Numeric: -1, Alphanumeric: -1, Kanji: kanjiCount(text), Bytes: len(text)}
+	if CanEncodeNumeric(text) {
+		c.Numeric = len(text)
+	}
+	if CanEncodeAlphanumeric(text) {
+		c.Alphanumeric = len(text)
+	}
+
+	return c
+}
+
+// Versions returns the minimal version that holds the counted text as a
+// single segment of each mode at the given error correction level.
+func (c CharCounts) Versions(ecl ECL) ModeVersions {
+	return ModeVersions{
+		Numeric:      fitCount(Numeric, c.Numeric, ecl),
+		Alphanumeric: fitCount(Alphanumeric, c.Alphanumeric, ecl),
+		Kanji:        fitCount(kanji, c.Kanji, ecl),
+		Bytes:        fitCount(Byte, c.Bytes, ecl),
+	}
+}
+
+// fitCount returns the minimal version that holds numChars characters of the
+// mode, or 0 if numChars is negative or no version is large enough.
+func fitCount(mode Mode, numChars int, ecl ECL) Version {
+	if numChars < 0 {
+		return 0
+	}
+	for version := MinVersion; version <= MaxVersion; version++ {
+		used := estimateBits(mode, numChars, version)
+		if used != -1 && used <= numDataCodewords[ecl][version]*8 {
+			return version
+		}
+	}
+
+	return 0
+}
+
+// kanjiCount returns the number of characters of text, or -1 if any of them
+// cannot be encoded in kanji mode: each must be a double-byte Shift JIS
+// character in the range 0x8140-0x9FFC or 0xE040-0xEBBF.
+func kanjiCount(text string) int {
+	encoder := japanese.ShiftJIS.NewEncoder()
+	count := 0
+	for _, r := range text {
+		if _, ok := kanjiCode(encoder, r); !ok {
+			return -1
+		}
+		count++
+	}
+
+	return count
+}
+
+// kanjiCode returns the double-byte Shift JIS code of r, and whether kanji
+// mode can represent it.
+func kanjiCode(encoder *encoding.Encoder, r rune) (int, bool) {
+	var buf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(buf[:], r)
+	sjis, err := encoder.Bytes(buf[:n])
+	if err != nil || len(sjis) != 2 {
+		return 0, false
+	}
+	code := int(sjis[0])<<8 | int(sjis[1])
+	if !(0x8140 <= code && code <= 0x9FFC) && !(0xE040 <= code && code <= 0xEBBF) {
+		return 0, false
+	}
+
+	return code, true
+}
+
+// CanEncodeNumeric reports whether text can be encoded in numeric mode, that
+// is, whether it consists only of the digits 0-9.
+func CanEncodeNumeric(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if uint8(alphanumericIndex[text[i]]) >= 10 { // -1 becomes 255.
+			return false
+		}
+	}
+
+	return true
+}
+
+// CanEncodeAlphanumeric reports whether text can be encoded in alphanumeric
+// mode: digits, uppercase letters, space, and $%*+-./:.
+func CanEncodeAlphanumeric(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if alphanumericIndex[text[i]] < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CanEncodeKanji reports whether every character of text has a double-byte
+// Shift JIS encoding that kanji mode can represent.
+func CanEncodeKanji(text string) bool {
+	return kanjiCount(text) >= 0
+}
+
+// CanEncodeLatin1 reports whether text is valid UTF-8 consisting only of
+// characters in ISO 8859-1, the default character set of byte mode in the
+// original QR code standard.
+func CanEncodeLatin1(text string) bool {
+	for i := 0; i < len(text); {
+		r, n := utf8.DecodeRuneInString(text[i:])
+		if r > 0xFF || (r == utf8.RuneError && n == 1) {
+			return false
+		}
+		i += n
+	}
+
+	return true
+}
@@ -0,0 +1,404 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ChartOptions configures the stitch chart renderers.
+type ChartOptions struct {
+	Border    int      // Quiet zone in cells (stitched in the background color, or left blank).
+	CellSize  int      // Pixels per chart cell in ChartImage, at least 6 (0 is treated as 16).
+	GridEvery int      // Draw a heavy grid line every GridEvery cells (0 is treated as 10).
+	Dark      rune     // Symbol for dark stitches in WriteChartText and the legend of WriteChartPDF (0 is treated as 'X').
+	Light     rune     // Symbol for light stitches in WriteChartText and the legend of WriteChartPDF (0 is treated as '.').
+	Page      PageSize // Page size of WriteChartPDF (default PageA4).
+}
+
+// StitchCounts reports the number of dark stitches per row and column of a
+// chart (including the border), and the totals.
+type StitchCounts struct {
+	Rows    []int
+	Columns []int
+	Dark    int
+	Light   int
+}
+
+// StitchRun is a horizontal run of dark stitches in one chart row.
+type StitchRun struct {
+	Row     int  // Chart row (including the border).
+	Start   int  // First chart column of the run.
+	End     int  // Last chart column of the run (inclusive).
+	Reverse bool // The run is worked from End to Start.
+}
+
+var chartPalette = color.Palette{
+	color.White,
+	color.Black,
+	color.Gray{Y: 0xB0}, // Light grid lines.
+	color.Gray{Y: 0x40}, // Heavy grid lines.
+}
+
+func (opts ChartOptions) withDefaults() ChartOptions {
+	if opts.CellSize == 0 {
+		opts.CellSize = 16
+	}
+	if opts.GridEvery == 0 {
+		opts.GridEvery = 10
+	}
+	if opts.Dark == 0 {
+		opts.Dark = 'X'
+	}
+	if opts.Light == 0 {
+		opts.Light = '.'
+	}
+
+	return opts
+}
+
+// chartCell reports whether the chart cell at (x, y), including the border, is
+// a dark stitch.
+func (q *QRCode) chartCell(x, y, border int) bool {
+	x -= border
+	y -= border
+	return 0 <= x && x < q.Size && 0 <= y && y < q.Size && q.Modules[y][x] == 1
+}
+
+// StitchCounts counts the dark stitches of the chart.
+func (q *QRCode) StitchCounts(border int) StitchCounts {
+	n := q.Size + border*2
+	counts := StitchCounts{Rows: make([]int, n), Columns: make([]int, n)}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if q.chartCell(x, y, border) {
+				counts.Rows[y]++
+				counts.Columns[x]++
+				counts.Dark++
+			}
+		}
+	}
+	counts.Light = n*n - counts.Dark
+
+	return counts
+}
+
+// StitchRuns returns the runs of dark stitches row by row from the top,
+// alternating direction (boustrophedon) so that an embroidery machine or
+// digitizer can work each row without jumping back across the design.
+func (q *QRCode) StitchRuns(border int) []StitchRun {
+	n := q.Size + border*2
+	var runs []StitchRun
+	for y := 0; y < n; y++ {
+		var row []StitchRun
+		for x := 0; x < n; {
+			if !q.chartCell(x, y, border) {
+				x++
+				continue
+			}
+			start := x
+			for x < n && q.chartCell(x, y, border) {
+				x++
+			}
+			row = append(row, StitchRun{Row: y, Start: start, End: x - 1})
+		}
+		if y%2 == 1 {
+			for i, j := 0, len(row)-1; i < j; i, j = i+1, j-1 {
+				row[i], row[j] = row[j], row[i]
+			}
+			for i := range row {
+				row[i].Reverse = true
+			}
+		}
+		runs = append(runs, row...)
+	}
+
+	return runs
+}
+
+// chartGlyphs are the 3x5 pixel glyphs of the digits, then '=', used for the
+// counts and the legend in ChartImage.
+var chartGlyphs = [11][5]string{
+	{"###", "#.#", "#.#", "#.#", "###"},
+	{".#.", "##.", ".#.", ".#.", "###"},
+	{"###", "..#", "###", "#..", "###"},
+	{"###", "..#", "###", "..#", "###"},
+	{"#.#", "#.#", "###", "..#", "..#"},
+	{"###", "#..", "###", "..#", "###"},
+	{"###", "#..", "###", "#.#", "###"},
+	{"###", "..#", "..#", "..#", "..#"},
+	{"###", "#.#", "###", "#.#", "###"},
+	{"###", "#.#", "###", "..#", "###"},
+	{"...", "###", "...", "###", "..."},
+}
+
+// ChartImage renders a stitch chart: a grid with a cross in every dark cell and
+// heavier lines every GridEvery cells, counted from the top-left corner. The
+// dark stitch count of each row is drawn to its right, that of each column
+// below it (one digit under the other), and a legend below the chart shows
+// the dark (crossed) and light (blank) cells with their totals.
+func (q *QRCode) ChartImage(opts ChartOptions) (*image.Paletted, error) {
+	opts = opts.withDefaults()
+	if opts.Border < 0 || opts.CellSize < 6 || opts.GridEvery < 1 {
+		return nil, fmt.Errorf("invalid chart options")
+	}
+
+	n := q.Size + opts.Border*2
+	cell := opts.CellSize
+	counts := q.StitchCounts(opts.Border)
+
+	// Glyphs are scaled by s, advance 4s across and 6s down, and are
+	// separated from the chart by a gap of 2s.
+	s := max(1, cell/8)
+	gap := 2 * s
+	digits := len(strconv.Itoa(n))
+	grid := n*cell + 1
+	dark, light := "="+strconv.Itoa(counts.Dark), "="+strconv.Itoa(counts.Light)
+	legendTop := grid + gap + digits*6*s + gap
+	lightCell := cell + gap + len(dark)*4*s + 2*gap
+	width := max(grid+gap+digits*4*s, lightCell+cell+gap+len(light)*4*s)
+	height := legendTop + cell + 1
+	img := image.NewPaletted(image.Rect(0, 0, width, height), chartPalette)
+
+	// Grid lines.
+	for i := 0; i <= n; i++ {
+		index := uint8(2)
+		if i%opts.GridEvery == 0 || i == n {
+			index = 3
+		}
+		for p := 0; p < grid; p++ {
+			img.Pix[i*cell*img.Stride+p] = index
+			img.Pix[p*img.Stride+i*cell] = index
+		}
+	}
+
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if q.chartCell(x, y, opts.Border) {
+				drawChartCross(img, x*cell, y*cell, cell)
+			}
+		}
+	}
+
+	// Counts.
+	for y, c := range counts.Rows {
+		drawChartText(img, strconv.Itoa(c), grid+gap, y*cell+(cell-5*s)/2, s, 4*s, 0)
+	}
+	for x, c := range counts.Columns {
+		drawChartText(img, strconv.Itoa(c), x*cell+(cell-3*s)/2, grid+gap, s, 0, 6*s)
+	}
+
+	// Legend.
+	textTop := legendTop + (cell-5*s)/2
+	drawChartBox(img, 0, legendTop, cell)
+	drawChartCross(img, 0, legendTop, cell)
+	drawChartText(img, dark, cell+gap, textTop, s, 4*s, 0)
+	drawChartBox(img, lightCell, legendTop, cell)
+	drawChartText(img, light, lightCell+cell+gap, textTop, s, 4*s, 0)
+
+	return img, nil
+}
+
+// drawChartCross draws the cross of a dark cell with its top-left corner at
+// (x0, y0), inset from the grid lines.
+func drawChartCross(img *image.Paletted, x0, y0, cell int) {
+	inset := cell / 5
+	thickness := max(1, cell/8)
+	for d := inset; d <= cell-inset-thickness; d++ {
+		for t := 0; t < thickness; t++ {
+			img.Pix[(y0+d)*img.Stride+x0+d+t] = 1
+			img.Pix[(y0+d)*img.Stride+x0+cell-d-t] = 1
+		}
+	}
+}
+
+// drawChartBox draws the heavy outline of a legend cell.
+func drawChartBox(img *image.Paletted, x0, y0, cell int) {
+	for p := 0; p <= cell; p++ {
+		img.Pix[y0*img.Stride+x0+p] = 3
+		img.Pix[(y0+cell)*img.Stride+x0+p] = 3
+		img.Pix[(y0+p)*img.Stride+x0] = 3
+		img.Pix[(y0+p)*img.Stride+x0+cell] = 3
+	}
+}
+
+// drawChartText draws text made of digits and '=' from chartGlyphs at scale s,
+// with its first glyph's top-left corner at (x, y), moving each following
+// glyph by (dx, dy).
+func drawChartText(img *image.Paletted, text string, x, y, s, dx, dy int) {
+	for _, c := range text {
+		g := 10
+		if '0' <= c && c <= '9' {
+			g = int(c - '0')
+		}
+		for row, bits := range chartGlyphs[g] {
+			for col, b := range bits {
+				if b != '#' {
+					continue
+				}
+				for py := 0; py < s; py++ {
+					for px := 0; px < s; px++ {
+						img.Pix[(y+row*s+py)*img.Stride+x+col*s+px] = 1
+					}
+				}
+			}
+		}
+		x += dx
+		y += dy
+	}
+}
+
+// WriteChartPDF writes the stitch chart as a one-page vector PDF, scaled to fit
+// within half-inch margins of the page: the grid with a cross in every dark
+// cell and heavier lines every GridEvery cells, the dark stitch count of each
+// row to its right and of each column below it, and a legend with the totals.
+func (q *QRCode) WriteChartPDF(w io.Writer, opts ChartOptions) error {
+	opts = opts.withDefaults()
+	if opts.Page == (PageSize{}) {
+		opts.Page = PageA4
+	}
+	const margin = 36.0
+	width, height := opts.Page.Width-2*margin, opts.Page.Height-2*margin
+	if opts.Border < 0 || opts.GridEvery < 1 || width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid chart options")
+	}
+
+	n := q.Size + opts.Border*2
+	counts := q.StitchCounts(opts.Border)
+
+	// Leave two cells to the right for the row counts, and three below for
+	// the column counts and the legend.
+	cell := math.Min(width/float64(n+2), height/float64(n+3))
+	font := 0.55 * cell
+	left, top := margin, opts.Page.Height-margin
+	right, bottom := left+float64(n)*cell, top-float64(n)*cell
+	f := func(v float64) string { return formatFloat(v, 3) }
+
+	var sb strings.Builder
+	for _, heavy := range []bool{false, true} {
+		if heavy {
+			fmt.Fprintf(&sb, "0.25 G %s w\n", f(cell/16))
+		} else {
+			fmt.Fprintf(&sb, "0.7 G %s w\n", f(cell/40))
+		}
+		for i := 0; i <= n; i++ {
+			if (i%opts.GridEvery == 0 || i == n) != heavy {
+				continue
+			}
+			d := float64(i) * cell
+			fmt.Fprintf(&sb, "%s %s m %s %s l\n", f(left+d), f(top), f(left+d), f(bottom))
+			fmt.Fprintf(&sb, "%s %s m %s %s l\n", f(left), f(top-d), f(right), f(top-d))
+		}
+		sb.WriteString("S\n")
+	}
+
+	// cross adds the cross of the cell with its top-left corner at (x, y).
+	cross := func(x, y float64) {
+		inset := cell / 5
+		fmt.Fprintf(&sb, "%s %s m %s %s l\n", f(x+inset), f(y-inset), f(x+cell-inset), f(y-cell+inset))
+		fmt.Fprintf(&sb, "%s %s m %s %s l\n", f(x+cell-inset), f(y-inset), f(x+inset), f(y-cell+inset))
+	}
+	fmt.Fprintf(&sb, "0 G %s w\n", f(cell/8))
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if q.chartCell(x, y, opts.Border) {
+				cross(left+float64(x)*cell, top-float64(y)*cell)
+			}
+		}
+	}
+	legendTop := bottom - 1.8*cell
+	cross(left, legendTop)
+	sb.WriteString("S\n0 g\n")
+
+	text := func(s string, x, y float64) {
+		fmt.Fprintf(&sb, "BT /F1 %s Tf %s %s Td %s Tj ET\n", f(font), f(x), f(y), pdfString(s))
+	}
+	for y, c := range counts.Rows {
+		text(strconv.Itoa(c), right+0.3*cell, top-float64(y+1)*cell+(cell-0.7*font)/2)
+	}
+	for x, c := range counts.Columns {
+		// Set upward, ending just below the column.
+		s := strconv.Itoa(c)
+		fmt.Fprintf(&sb, "BT /F1 %s Tf 0 1 -1 0 %s %s Tm %s Tj ET\n", f(font),
+			f(left+(float64(x)+0.5)*cell+0.35*font), f(bottom-0.3*cell-helveticaWidth(s, font)), pdfString(s))
+	}
+
+	// Legend.
+	baseline := legendTop - (cell+0.7*font)/2
+	dark := fmt.Sprintf("dark stitches (%c): %d", opts.Dark, counts.Dark)
+	text(dark, left+1.3*cell, baseline)
+	lightLeft := left + 2.3*cell + helveticaWidth(dark, font)
+	text(fmt.Sprintf("light stitches (%c): %d", opts.Light, counts.Light), lightLeft+1.3*cell, baseline)
+	fmt.Fprintf(&sb, "0.25 G %s w\n", f(cell/16))
+	fmt.Fprintf(&sb, "%s %s %[3]s %[3]s re %s %s %[3]s %[3]s re S\n", f(left), f(legendTop-cell), f(cell), f(lightLeft), f(legendTop-cell))
+
+	p := newPDFWriter(w)
+	p.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	p.object(2, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	p.object(3, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+		f(opts.Page.Width), f(opts.Page.Height)))
+	p.stream(4, "", []byte(sb.String()))
+	p.object(5, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+
+	return p.finish(1)
+}
+
+// WriteChartText writes a plain text stitch chart with one symbol per cell,
+// the row number on the left, and the dark stitch count of each row on the
+// right, followed by the totals.
+func (q *QRCode) WriteChartText(w io.Writer, opts ChartOptions) error {
+	opts = opts.withDefaults()
+	if opts.Border < 0 {
+		return fmt.Errorf("border must be non-negative")
+	}
+
+	n := q.Size + opts.Border*2
+	counts := q.StitchCounts(opts.Border)
+	bw := bufio.NewWriter(w)
+	width := len(fmt.Sprint(n))
+	for y := 0; y < n; y++ {
+		fmt.Fprintf(bw, "%*d |", width, y+1)
+		for x := 0; x < n; x++ {
+			bw.WriteByte(' ')
+			if q.chartCell(x, y, opts.Border) {
+				bw.WriteRune(opts.Dark)
+			} else {
+				bw.WriteRune(opts.Light)
+			}
+		}
+		fmt.Fprintf(bw, " | %d\n", counts.Rows[y])
+	}
+	fmt.Fprintf(bw, "%s\n", strings.Repeat("-", width+2+n*2+2))
+	fmt.Fprintf(bw, "%d x %d cells, %d %c, %d %c\n", n, n, counts.Dark, opts.Dark, counts.Light, opts.Light)
+
+	return bw.Flush()
+}
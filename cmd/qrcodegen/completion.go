@@ -0,0 +1,197 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/grkuntzmd/qrcodegen/payload"
+)
+
+// setupCompletion defines "qrcodegen completion": it prints a completion
+// script for bash, zsh, or fish, generated from the commands and their flags.
+//
+//	source <(qrcodegen completion bash)
+//	qrcodegen completion zsh > "${fpath[1]}/_qrcodegen"
+//	qrcodegen completion fish > ~/.config/fish/completions/qrcodegen.fish
+func setupCompletion(fs *flag.FlagSet, o *output) func(args []string) int {
+	return func(args []string) int {
+		if len(args) != 1 {
+			return o.usageError()
+		}
+		var write func(w io.Writer)
+		switch args[0] {
+		case "bash":
+			write = writeBashCompletion
+		case "zsh":
+			write = writeZshCompletion
+		case "fish":
+			write = writeFishCompletion
+		default:
+			return o.report(&diagnostics{}, exitUsage, "unsupported shell %q", args[0])
+		}
+		if o.json {
+			return o.report(&diagnostics{}, exitUsage, "completion scripts have no JSON form")
+		}
+		write(o.stdout)
+
+		return exitOK
+	}
+}
+
+// commandFlags returns the flags of the named command, in sorted order.
+func commandFlags(name string) []*flag.Flag {
+	c := commands[name]
+	o := &output{command: name, stdout: io.Discard, stderr: io.Discard}
+	fs := newFlagSet(name, c, o)
+	c.setup(fs, o)
+	var result []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		result = append(result, f)
+	})
+
+	return result
+}
+
+// isBoolFlag reports whether a flag takes no value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// flagValues returns the values a flag can take, for flags that take one of
+// a known set, such as the registered payload kinds of --kind.
+func flagValues(f *flag.Flag) []string {
+	if f.Name == "kind" {
+		return payload.Kinds()
+	}
+
+	return nil
+}
+
+func writeBashCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# bash completion for qrcodegen")
+	fmt.Fprintln(w, "_qrcodegen() {")
+	fmt.Fprintln(w, "\tlocal cur=${COMP_WORDS[COMP_CWORD]}")
+	fmt.Fprintln(w, "\tif [ \"$COMP_CWORD\" -eq 1 ]; then")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W \"help %s\" -- \"$cur\"))\n", strings.Join(commandNames(), " "))
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tcase ${COMP_WORDS[1]}:${COMP_WORDS[COMP_CWORD-1]} in")
+	for _, name := range commandNames() {
+		for _, f := range commandFlags(name) {
+			if values := flagValues(f); values != nil {
+				fmt.Fprintf(w, "\t%s:--%s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")); return ;;\n", name, f.Name, strings.Join(values, " "))
+			}
+		}
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "\tcase ${COMP_WORDS[1]} in")
+	for _, name := range commandNames() {
+		var words []string
+		for _, f := range commandFlags(name) {
+			words = append(words, "--"+f.Name)
+		}
+		if name == "completion" {
+			fmt.Fprintf(w, "\tcompletion) COMPREPLY=($(compgen -W \"bash zsh fish %s\" -- \"$cur\")) ;;\n", strings.Join(words, " "))
+			continue
+		}
+		fmt.Fprintf(w, "\t%s) [[ $cur == -* ]] && COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", name, strings.Join(words, " "))
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o default -F _qrcodegen qrcodegen")
+}
+
+// zshQuote quotes s for a single-quoted zsh _arguments spec.
+func zshQuote(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+func writeZshCompletion(w io.Writer) {
+	fmt.Fprintln(w, "#compdef qrcodegen")
+	fmt.Fprintln(w, "_qrcodegen() {")
+	fmt.Fprintln(w, "\tlocal -a commands")
+	fmt.Fprintln(w, "\tcommands=(")
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "\t\t'%s:%s'\n", name, zshQuote(commands[name].summary))
+	}
+	fmt.Fprintln(w, "\t)")
+	fmt.Fprintln(w, "\tif (( CURRENT == 2 )); then")
+	fmt.Fprintln(w, "\t\t_describe 'command' commands")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tlocal cmd=$words[2]")
+	fmt.Fprintln(w, "\tshift words")
+	fmt.Fprintln(w, "\t(( CURRENT-- ))")
+	fmt.Fprintln(w, "\tcase $cmd in")
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "\t%s)\n\t\t_arguments", name)
+		for _, f := range commandFlags(name) {
+			spec := fmt.Sprintf("--%s[%s]", f.Name, zshQuote(f.Usage))
+			if values := flagValues(f); values != nil {
+				spec += fmt.Sprintf(":%s:(%s)", f.Name, strings.Join(values, " "))
+			} else if !isBoolFlag(f) {
+				spec += ":value:_files"
+			}
+			fmt.Fprintf(w, " \\\n\t\t\t'%s'", spec)
+		}
+		if name == "completion" {
+			fmt.Fprint(w, " \\\n\t\t\t'1:shell:(bash zsh fish)'")
+		}
+		fmt.Fprintln(w, "\n\t\t;;")
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "_qrcodegen \"$@\"")
+}
+
+// fishQuote quotes s for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# fish completion for qrcodegen")
+	fmt.Fprintln(w, "complete -c qrcodegen -f")
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "complete -c qrcodegen -n __fish_use_subcommand -a %s -d %s\n", name, fishQuote(commands[name].summary))
+	}
+	for _, name := range commandNames() {
+		for _, f := range commandFlags(name) {
+			fmt.Fprintf(w, "complete -c qrcodegen -n '__fish_seen_subcommand_from %s' -l %s -d %s", name, f.Name, fishQuote(f.Usage))
+			if values := flagValues(f); values != nil {
+				fmt.Fprintf(w, " -r -a %s", fishQuote(strings.Join(values, " ")))
+			} else if !isBoolFlag(f) {
+				fmt.Fprint(w, " -r -F")
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprintln(w, "complete -c qrcodegen -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'")
+}
@@ -0,0 +1,209 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/grkuntzmd/qrcodegen"
+	"github.com/grkuntzmd/qrcodegen/payload"
+)
+
+// setupGenerate defines "qrcodegen generate": it encodes the text, or a
+// structured payload of a kind registered with the payload package built from
+// --field values, and writes the symbol as SVG, PNG, or PDF, plain or (except
+// PDF) styled with a theme.
+func setupGenerate(fs *flag.FlagSet, o *output) func(args []string) int {
+	text := fs.String("text", "", "payload to encode")
+	kind := fs.String("kind", "", "structured payload kind to build instead of --text ("+strings.Join(payload.Kinds(), ", ")+")")
+	fields := url.Values{}
+	fs.Var(fieldsFlag(fields), "field", "name=value field of the --kind payload (repeatable)")
+	out := fs.String("out", "", "file to write (- for standard output)")
+	format := fs.String("format", "", "svg, png, or pdf (default from the --out extension, else svg)")
+	ecl := fs.String("ecl", "M", "error correction level (L, M, Q, or H)")
+	maxVersion := fs.Int("max-version", int(qrcodegen.MaxVersion), "largest version to use")
+	border := fs.Int("border", 4, "quiet zone in modules, without a theme")
+	scale := fs.Int("scale", 8, "pixels per module of PNG output")
+	theme := fs.String("theme", "", "built-in theme name or theme file (JSON or YAML) to style the symbol with")
+
+	return func(args []string) int {
+		if *out == "" || len(args) != 0 {
+			return o.usageError()
+		}
+		d := &diagnostics{Output: *out}
+		if *format == "" {
+			*format = "svg"
+			switch ext := strings.ToLower(filepath.Ext(*out)); ext {
+			case ".png", ".pdf":
+				*format = ext[1:]
+			}
+		}
+		if *format != "svg" && *format != "png" && *format != "pdf" {
+			return o.report(d, exitUsage, "unsupported format %q", *format)
+		}
+		level, err := qrcodegen.ParseECL(*ecl)
+		if err != nil {
+			return o.report(d, exitUsage, "%v", err)
+		}
+		if *border < 0 || *scale < 1 {
+			return o.report(d, exitUsage, "border must be non-negative and scale positive")
+		}
+		var t *qrcodegen.Theme
+		if *theme != "" {
+			loaded, err := loadTheme(*theme)
+			if err != nil {
+				return o.report(d, exitUsage, "%v", err)
+			}
+			t = &loaded
+		}
+		if t != nil && *format == "pdf" {
+			return o.report(d, exitUsage, "themes are not supported for PDF output")
+		}
+
+		if *kind != "" {
+			if *text != "" {
+				return o.report(d, exitUsage, "--text and --kind are mutually exclusive")
+			}
+			if *text, err = buildPayload(*kind, fields); err != nil {
+				return o.report(d, exitUsage, "%v", err)
+			}
+		} else if len(fields) > 0 {
+			return o.report(d, exitUsage, "--field needs --kind")
+		}
+
+		q, err := qrcodegen.EncodeText(*text, level, qrcodegen.WithMaxVersion(qrcodegen.Version(*maxVersion)))
+		var tooLong *qrcodegen.DataTooLongError
+		var tooLarge *qrcodegen.InputTooLargeError
+		if errors.As(err, &tooLong) || errors.As(err, &tooLarge) {
+			return o.report(d, exitCapacity, "%v", err)
+		} else if err != nil {
+			return o.report(d, exitUsage, "%v", err)
+		}
+		mask := int(q.Mask)
+		d.Version, d.ECL, d.Mask = int(q.Version), q.ErrorCorrectionLevel.String(), &mask
+
+		data, err := render(q, *format, t, *border, *scale)
+		if err == nil {
+			if *out == "-" {
+				_, err = o.stdout.Write(data)
+			} else {
+				err = os.WriteFile(*out, data, 0o644)
+			}
+		}
+		if err != nil {
+			return o.report(d, exitRender, "%v", err)
+		}
+		if *out == "-" && !o.json {
+			return exitOK
+		}
+
+		return o.report(d, exitOK, "%s: version %d, ECL %s, mask %d", *out, q.Version, q.ErrorCorrectionLevel, q.Mask)
+	}
+}
+
+// fieldsFlag collects repeated name=value flags.
+type fieldsFlag url.Values
+
+func (f fieldsFlag) String() string {
+	return ""
+}
+
+func (f fieldsFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("field %q is not name=value", s)
+	}
+	url.Values(f).Add(s[:i], s[i+1:])
+
+	return nil
+}
+
+// buildPayload returns the text of the payload of the given kind with the
+// fields set, as the HTTP service does for /v1/generate/payload/ links.
+func buildPayload(kind string, fields url.Values) (string, error) {
+	b, err := payload.New(kind)
+	if err != nil {
+		return "", err
+	}
+	if err := payload.SetFromQuery(b, fields); err != nil {
+		return "", err
+	}
+
+	return b.Payload()
+}
+
+// render renders q in the format, with the theme if it is not nil.
+func render(q *qrcodegen.QRCode, format string, theme *qrcodegen.Theme, border, scale int) ([]byte, error) {
+	var buf bytes.Buffer
+	switch {
+	case format == "svg" && theme != nil:
+		svg, err := theme.ToSVGString(q, true)
+		buf.WriteString(svg)
+		return buf.Bytes(), err
+	case format == "svg":
+		svg, err := q.ToSVGString(border, true)
+		buf.WriteString(svg)
+		return buf.Bytes(), err
+	case format == "pdf":
+		if border == 0 {
+			border = -1 // PDFOptions takes 0 as the default border.
+		}
+		err := q.WritePDF(&buf, qrcodegen.PDFOptions{Border: border})
+		return buf.Bytes(), err
+	case theme != nil:
+		img, err := theme.ToImage(q, scale)
+		if err != nil {
+			return nil, err
+		}
+		err = png.Encode(&buf, img)
+		return buf.Bytes(), err
+	}
+	if border == 0 {
+		border = -1 // PNGOptions takes 0 as the default border.
+	}
+	err := q.WritePNG(&buf, qrcodegen.PNGOptions{Scale: scale, Border: border})
+
+	return buf.Bytes(), err
+}
+
+// loadTheme returns the named built-in theme or the theme in the named file.
+func loadTheme(name string) (qrcodegen.Theme, error) {
+	if t, err := qrcodegen.LookupTheme(name); err == nil {
+		return t, nil
+	}
+	if _, err := os.Stat(name); err != nil {
+		return qrcodegen.Theme{}, fmt.Errorf("%q is neither a built-in theme nor a theme file", name)
+	}
+
+	return qrcodegen.LoadTheme(name)
+}
@@ -0,0 +1,225 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Command qrcodegen generates and checks QR codes from the command line.
+//
+// Usage:
+//
+//	qrcodegen generate --text "payload" --out code.svg
+//	qrcodegen serve --watch payloads.txt
+//	qrcodegen verify --in code.svg --expect "payload"
+//	qrcodegen completion bash|zsh|fish
+//
+// The exit status tells the kind of failure: 1 when verify finds another
+// payload or no symbol, 2 for invalid options, 3 when the payload does not fit
+// in a symbol, and 4 when the symbol cannot be rendered or written.
+//
+// Every command accepts --json, which replaces the human-readable output with
+// one JSON object per line describing the outcome. Run "qrcodegen help" for
+// the list of commands.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Exit statuses, so that scripts can branch on the kind of failure. They are
+// listed by "qrcodegen help".
+const (
+	exitOK       = 0
+	exitMismatch = 1 // verify: the symbol is unreadable or holds another payload.
+	exitUsage    = 2 // Invalid options or arguments, including input files that cannot be opened.
+	exitCapacity = 3 // The payload does not fit in a symbol under the given constraints.
+	exitRender   = 4 // The symbol could not be rendered or written.
+)
+
+// exitReasons names the failure statuses in --json output.
+var exitReasons = map[int]string{
+	exitMismatch: "verify-mismatch",
+	exitUsage:    "invalid-options",
+	exitCapacity: "capacity-exceeded",
+	exitRender:   "render-failure",
+}
+
+// command is a qrcodegen subcommand.
+type command struct {
+	summary string
+	usage   string // Synopsis of the flags and arguments.
+	// setup defines the command's flags on fs and returns the function that
+	// runs the command once they are parsed.
+	setup func(fs *flag.FlagSet, o *output) func(args []string) int
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"completion": {"print a shell completion script", "bash|zsh|fish", setupCompletion},
+		"generate":   {"encode a payload as an SVG, PNG, or PDF file", "--text PAYLOAD --out FILE [--ecl L|M|Q|H] [--theme NAME|FILE]", setupGenerate},
+		"serve":      {"serve a live-reloading preview of the payloads in a file", "--watch FILE [--addr ADDR] [--theme NAME|FILE] [--ecl L|M|Q|H]", setupServe},
+		"verify":     {"decode a rendered symbol and compare it with the expected payload", "--in FILE --expect PAYLOAD [--scale N]", setupVerify},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stdout)
+		return exitOK
+	}
+
+	name := args[0]
+	o := &output{command: name, stdout: stdout, stderr: stderr}
+	for _, arg := range args[1:] {
+		if arg == "--json" || arg == "-json" || arg == "--json=true" || arg == "-json=true" {
+			o.json = true
+		}
+	}
+	c, ok := commands[name]
+	if !ok {
+		if !o.json {
+			defer usage(stderr)
+		}
+		return o.report(&diagnostics{}, exitUsage, "unknown command %q", name)
+	}
+
+	fs := newFlagSet(name, c, o)
+	exec := c.setup(fs, o)
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		if o.json {
+			return o.report(&diagnostics{}, exitUsage, "%v", err)
+		}
+		return exitUsage // The flag package has printed the error.
+	}
+
+	return exec(fs.Args())
+}
+
+// newFlagSet returns the flag set of a command with the flags shared by all
+// commands.
+func newFlagSet(name string, c command, o *output) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(o.stderr)
+	if o.json {
+		fs.SetOutput(io.Discard)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: qrcodegen %s %s\n\nflags:\n", name, c.usage)
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&o.json, "json", o.json, "print the outcome as a JSON object")
+
+	return fs
+}
+
+// usage writes the list of commands.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: qrcodegen <command> [flags]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w, "\nexit statuses:")
+	fmt.Fprintf(w, "  %d  success\n", exitOK)
+	for _, status := range []int{exitMismatch, exitUsage, exitCapacity, exitRender} {
+		fmt.Fprintf(w, "  %d  %s\n", status, exitReasons[status])
+	}
+	fmt.Fprintln(w, "\nRun \"qrcodegen <command> -h\" for the flags of a command.")
+}
+
+// commandNames returns the command names in sorted order.
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// diagnostics describes the outcome of a command; it is what --json prints.
+// Fields that do not apply to a command are omitted.
+type diagnostics struct {
+	Command  string `json:"command"`
+	OK       bool   `json:"ok"`
+	Exit     int    `json:"exit"`
+	Reason   string `json:"reason,omitempty"` // The kind of failure, such as "capacity-exceeded".
+	Error    string `json:"error,omitempty"`
+	Input    string `json:"input,omitempty"`    // The file read.
+	Output   string `json:"output,omitempty"`   // The file written.
+	Payload  string `json:"payload,omitempty"`  // The decoded payload.
+	Expected string `json:"expected,omitempty"` // The expected payload.
+	Version  int    `json:"version,omitempty"`
+	ECL      string `json:"ecl,omitempty"`
+	Mask     *int   `json:"mask,omitempty"`
+	URL      string `json:"url,omitempty"` // Where a server listens.
+}
+
+// output writes the results of a command, as text or as JSON.
+type output struct {
+	command        string
+	stdout, stderr io.Writer
+	json           bool
+}
+
+// report completes d with the exit status and prints it: with --json as a
+// JSON object on stdout, otherwise as the formatted message, on stdout for
+// success and as an error on stderr for failure. It returns status.
+func (o *output) report(d *diagnostics, status int, format string, args ...interface{}) int {
+	message := fmt.Sprintf(format, args...)
+	d.Command, d.OK, d.Exit = o.command, status == exitOK, status
+	if !d.OK {
+		d.Reason, d.Error = exitReasons[status], message
+	}
+
+	switch {
+	case o.json:
+		json.NewEncoder(o.stdout).Encode(d)
+	case d.OK:
+		fmt.Fprintln(o.stdout, message)
+	default:
+		fmt.Fprintf(o.stderr, "qrcodegen %s: %s\n", o.command, strings.TrimSuffix(message, "\n"))
+	}
+
+	return status
+}
+
+// usageError reports incorrect arguments to the command.
+func (o *output) usageError() int {
+	return o.report(&diagnostics{}, exitUsage, "usage: qrcodegen %s %s", o.command, commands[o.command].usage)
+}
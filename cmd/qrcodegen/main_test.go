@@ -0,0 +1,348 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grkuntzmd/qrcodegen"
+	"github.com/grkuntzmd/qrcodegen/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitOK, run(nil, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "verify")
+	assert.Equal(t, exitUsage, run([]string{"frobnicate"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), `unknown command "frobnicate"`)
+}
+
+func TestVerify(t *testing.T) {
+	const text = "https://example.com/verify?id=42"
+	q, err := qrcodegen.EncodeText(text, qrcodegen.Medium)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+	plain, err := q.ToSVGString(4, true)
+	assert.NoError(t, err)
+	navy := qrcodegen.ThemeClassic
+	navy.Dark = "#1B2A49"
+	themed, err := navy.ToSVGString(q, false)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	img, err := q.ToImage(3, 4)
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(&buf, img))
+
+	for _, path := range []string{
+		write("plain.svg", plain),
+		write("themed.svg", themed),
+		write("code.png", buf.String()),
+	} {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, exitOK, run([]string{"verify", "--in", path, "--expect", text}, &stdout, &stderr), stderr.String())
+		assert.Contains(t, stdout.String(), "ok (version 3, ECL Quartile)")
+
+		stderr.Reset()
+		assert.Equal(t, exitMismatch, run([]string{"verify", "--in", path, "--expect", "https://example.com/"}, &stdout, &stderr))
+		assert.Contains(t, stderr.String(), "expected \"https://example.com/\"")
+	}
+
+	var stdout, stderr bytes.Buffer
+	blank := write("blank.svg", `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><rect width="100%" height="100%" fill="#fff"/></svg>`)
+	assert.Equal(t, exitMismatch, run([]string{"verify", "--in", blank, "--expect", text}, &stdout, &stderr))
+	assert.Equal(t, exitUsage, run([]string{"verify", "--in", filepath.Join(dir, "missing.svg"), "--expect", text}, &stdout, &stderr))
+	assert.Equal(t, exitUsage, run([]string{"verify", "--expect", text}, &stdout, &stderr))
+	assert.Equal(t, exitMismatch, run([]string{"verify", "--in", write("bad.svg", "<svg><path d=\"M0,0 X\"/></svg>"), "--expect", text}, &stdout, &stderr))
+	huge := write("huge.svg", `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 1e300 1e300"/>`)
+	assert.Equal(t, exitMismatch, run([]string{"verify", "--in", huge, "--expect", text}, &stdout, &stderr))
+}
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"--out", filepath.Join(dir, "plain.svg")},
+		{"--out", filepath.Join(dir, "plain.png"), "--border", "0"},
+		{"--out", filepath.Join(dir, "themed.svg"), "--theme", "dots"},
+		{"--out", filepath.Join(dir, "themed.png"), "--theme", "classic", "--ecl", "H"},
+		{"--out", filepath.Join(dir, "plain.pdf")},
+	} {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, exitOK, run(append([]string{"generate", "--text", "HELLO"}, args...), &stdout, &stderr), stderr.String())
+		assert.Contains(t, stdout.String(), "version 1")
+	}
+	var stdout, stderr bytes.Buffer
+	path := filepath.Join(dir, "plain.png")
+	assert.Equal(t, exitOK, run([]string{"verify", "--in", path, "--expect", "HELLO"}, &stdout, &stderr), stderr.String())
+	path = filepath.Join(dir, "plain.svg")
+	assert.Equal(t, exitOK, run([]string{"verify", "--in", path, "--expect", "HELLO"}, &stdout, &stderr), stderr.String())
+
+	stdout.Reset()
+	assert.Equal(t, exitOK, run([]string{"generate", "--text", "HELLO", "--out", "-"}, &stdout, &stderr))
+	assert.True(t, strings.HasPrefix(stdout.String(), "<?xml"))
+	data, err := os.ReadFile(filepath.Join(dir, "plain.pdf"))
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte("%PDF-")))
+}
+
+// ticket is a custom payload kind registered by the tests.
+type ticket struct {
+	Seat string `json:"seat"`
+}
+
+func (t *ticket) Payload() (string, error) {
+	if t.Seat == "" {
+		return "", errors.New("ticket: missing seat")
+	}
+	return "TICKET:" + t.Seat, nil
+}
+
+func TestGenerateKind(t *testing.T) {
+	payload.Register("test-ticket", func() payload.Builder { return &ticket{} })
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--kind", "wifi", "--field", "ssid=Home", "--field", "password=secret"}, "WIFI:T:WPA;S:Home;P:secret;;"},
+		{[]string{"--kind", "test-ticket", "--field", "seat=12A"}, "TICKET:12A"},
+	} {
+		out := filepath.Join(dir, "kind.png")
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, exitOK, run(append([]string{"generate", "--out", out}, tc.args...), &stdout, &stderr), stderr.String())
+		assert.Equal(t, exitOK, run([]string{"verify", "--in", out, "--expect", tc.want}, &stdout, &stderr), stderr.String())
+	}
+
+	out := filepath.Join(dir, "bad.svg")
+	for _, args := range [][]string{
+		{"--kind", "fax"},
+		{"--kind", "wifi", "--field", "colour=red"},
+		{"--kind", "wifi", "--field", "ssid"},
+		{"--kind", "test-ticket"},
+		{"--kind", "wifi", "--text", "x"},
+		{"--field", "ssid=Home"},
+	} {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, exitUsage, run(append([]string{"generate", "--out", out}, args...), &stdout, &stderr), args)
+	}
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, exitOK, run([]string{"completion", shell}, &stdout, &stderr))
+		assert.Contains(t, stdout.String(), "email geo sms tel test-ticket url vcard wifi", shell)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "code.svg")
+	pale := filepath.Join(dir, "pale.yaml")
+	assert.NoError(t, os.WriteFile(pale, []byte("dark: \"#EEEEEE\"\n"), 0o644))
+	for _, tc := range []struct {
+		args   []string
+		status int
+	}{
+		{[]string{"generate", "--text", "HELLO", "--out", out, "--ecl", "X"}, exitUsage},
+		{[]string{"generate", "--text", "HELLO"}, exitUsage},
+		{[]string{"generate", "--text", "HELLO", "--out", out, "--theme", "no-such-theme"}, exitUsage},
+		{[]string{"generate", "--text", "HELLO", "--out", out, "--format", "pdf", "--theme", "dots"}, exitUsage},
+		{[]string{"generate", "--text", strings.Repeat("x", 100), "--out", out, "--max-version", "2"}, exitCapacity},
+		{[]string{"generate", "--text", "HELLO", "--out", out, "--theme", pale}, exitRender},
+		{[]string{"generate", "--text", "HELLO", "--out", filepath.Join(dir, "missing", "code.svg")}, exitRender},
+		{[]string{"verify", "--in", filepath.Join(dir, "missing.svg"), "--expect", "HELLO"}, exitUsage},
+	} {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, tc.status, run(tc.args, &stdout, &stderr), tc.args)
+
+		stdout.Reset()
+		assert.Equal(t, tc.status, run(append(tc.args, "--json"), &stdout, &stderr), tc.args)
+		var d diagnostics
+		assert.NoError(t, json.Unmarshal(stdout.Bytes(), &d))
+		assert.Equal(t, exitReasons[tc.status], d.Reason)
+	}
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitOK, run([]string{"help"}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "3  capacity-exceeded")
+}
+
+func TestJSONOutput(t *testing.T) {
+	q, err := qrcodegen.EncodeText("HELLO", qrcodegen.Low)
+	assert.NoError(t, err)
+	svg, err := q.ToSVGString(4, false)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "code.svg")
+	assert.NoError(t, os.WriteFile(path, []byte(svg), 0o644))
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitMismatch, run([]string{"verify", "--json", "--in", path, "--expect", "GOODBYE"}, &stdout, &stderr))
+	assert.Empty(t, stderr.String())
+	var d diagnostics
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &d))
+	assert.Equal(t, "verify", d.Command)
+	assert.False(t, d.OK)
+	assert.Equal(t, exitMismatch, d.Exit)
+	assert.Equal(t, "verify-mismatch", d.Reason)
+	assert.Equal(t, "HELLO", d.Payload)
+	assert.Equal(t, "GOODBYE", d.Expected)
+	assert.Equal(t, 1, d.Version)
+	assert.Equal(t, int(q.Mask), *d.Mask)
+
+	stdout.Reset()
+	assert.Equal(t, exitOK, run([]string{"verify", "--in", path, "--expect", "HELLO", "--json"}, &stdout, &stderr))
+	d = diagnostics{}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &d))
+	assert.True(t, d.OK)
+	assert.Empty(t, d.Error)
+
+	for _, args := range [][]string{{"verify", "--json", "--bogus"}, {"verify", "--json"}, {"nope", "--json"}} {
+		stdout.Reset()
+		assert.Equal(t, exitUsage, run(args, &stdout, &stderr))
+		d = diagnostics{}
+		assert.NoError(t, json.Unmarshal(stdout.Bytes(), &d), args)
+		assert.NotEmpty(t, d.Error)
+	}
+	assert.Empty(t, stderr.String())
+}
+
+func TestCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, exitOK, run([]string{"completion", shell}, &stdout, &stderr))
+		for _, name := range []string{"serve", "verify", "expect", "watch", "json"} {
+			assert.Contains(t, stdout.String(), name, shell)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitUsage, run([]string{"completion", "powershell"}, &stdout, &stderr))
+	assert.Equal(t, exitUsage, run([]string{"completion"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "usage: qrcodegen completion bash|zsh|fish")
+}
+
+func TestRasterizeSVG(t *testing.T) {
+	// A 4x2 document: a unit square at (1, 0) drawn with relative commands, a
+	// circle of radius 1 drawn with arcs centered at (3, 1), and an even-odd
+	// hole.
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 4 2">
+	<title>test</title>
+	<g fill="#000">
+		<path d="m1 0h1v1h-1z"/>
+		<path d="M2,1a1,1 0 1,0 2,0a1,1 0 1,0 -2,0z" fill-rule="evenodd"/>
+	</g>
+</svg>`
+	img, err := rasterizeSVG(strings.NewReader(svg), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 40, img.Bounds().Dx())
+	assert.Equal(t, 20, img.Bounds().Dy())
+	assert.Equal(t, uint8(0xFF), img.GrayAt(5, 5).Y)
+	assert.Equal(t, uint8(0), img.GrayAt(15, 5).Y)
+	assert.Equal(t, uint8(0xFF), img.GrayAt(15, 15).Y)
+	assert.Equal(t, uint8(0), img.GrayAt(30, 10).Y)
+	assert.Equal(t, uint8(0xFF), img.GrayAt(21, 1).Y)
+
+	_, err = rasterizeSVG(strings.NewReader(`<html/>`), 1)
+	assert.Error(t, err)
+	for _, viewBox := range []string{"0 0 1e300 1e300", "0 0 1e10 1", "0 0 Inf 1", "0 0 NaN 1"} {
+		_, err = rasterizeSVG(strings.NewReader(`<svg viewBox="`+viewBox+`"/>`), 1)
+		assert.Error(t, err, viewBox)
+	}
+	_, err = rasterizeSVG(strings.NewReader(`<svg viewBox="0 0 1 1"><rect width="1" height="1" fill="red-ish"/></svg>`), 1)
+	assert.Error(t, err)
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "payloads.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# Comment\nHELLO\n\n<b>&</b>\n"), 0o644))
+
+	_, err := newPreview(path, "no-such-theme", "M")
+	assert.Error(t, err)
+	_, err = newPreview(path, "classic", "X")
+	assert.Error(t, err)
+	p, err := newPreview(path, "dots", "M")
+	assert.NoError(t, err)
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, 2, strings.Count(string(body), "<figure><svg"))
+	assert.Contains(t, string(body), "&lt;b&gt;&amp;&lt;/b&gt;")
+	assert.NotContains(t, string(body), "Comment")
+
+	// A change to the file is pushed to the open pages.
+	resp, err = http.Get(server.URL + "/events")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	p.check()
+	assert.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", 3000)+"\n"), 0o644))
+	p.check()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "data: reload\n", line)
+
+	resp, err = http.Get(server.URL + "/")
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, 0, strings.Count(string(body), "<figure><svg"))
+	assert.Contains(t, string(body), "class=\"error\"")
+
+	// Theme files are read on every page and keep the last good theme.
+	themePath := filepath.Join(dir, "theme.yaml")
+	assert.NoError(t, os.WriteFile(themePath, []byte("name: mine\ndark: \"#204060\"\n"), 0o644))
+	assert.NoError(t, os.WriteFile(path, []byte("HELLO\n"), 0o644))
+	p, err = newPreview(path, themePath, "L")
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, w.Body.String(), "#204060")
+	assert.NoError(t, os.WriteFile(themePath, []byte("dark: [\n"), 0o644))
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, w.Body.String(), "#204060")
+	assert.Contains(t, w.Body.String(), "theme: ")
+}
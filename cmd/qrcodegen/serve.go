@@ -0,0 +1,287 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grkuntzmd/qrcodegen"
+)
+
+// setupServe defines "qrcodegen serve": it serves an HTML grid previewing a
+// symbol for every payload in the watched file, and reloads the page in the
+// browser whenever the file (or the theme file) changes.
+func setupServe(fs *flag.FlagSet, o *output) func(args []string) int {
+	watch := fs.String("watch", "", "file of payloads to preview, one per line (# starts a comment)")
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	theme := fs.String("theme", "classic", "built-in theme name or theme file (JSON or YAML)")
+	ecl := fs.String("ecl", "M", "error correction level (L, M, Q, or H)")
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often to check the files for changes")
+
+	return func(args []string) int {
+		if *watch == "" || len(args) != 0 {
+			return o.usageError()
+		}
+		d := &diagnostics{Input: *watch}
+		p, err := newPreview(*watch, *theme, *ecl)
+		if err != nil {
+			return o.report(d, exitUsage, "%v", err)
+		}
+		listener, err := net.Listen("tcp", *addr)
+		if err != nil {
+			return o.report(d, exitUsage, "%v", err)
+		}
+		go func() {
+			for range time.Tick(*interval) {
+				p.check()
+			}
+		}()
+
+		d.URL = "http://" + listener.Addr().String() + "/"
+		o.report(d, exitOK, "previewing %s at %s", *watch, d.URL)
+		err = http.Serve(listener, p)
+
+		return o.report(&diagnostics{Input: *watch}, exitRender, "%v", err)
+	}
+}
+
+// preview serves the live preview of a payload file.
+type preview struct {
+	path      string
+	themePath string               // Theme file, if the theme is not built in.
+	themeFile *qrcodegen.ThemeFile // Reads themePath.
+	theme     qrcodegen.Theme      // The built-in theme, if themeFile is nil.
+	ecl       qrcodegen.ECL
+	mux       *http.ServeMux
+
+	mu      sync.Mutex
+	stamp   string        // Sizes and modification times of the watched files.
+	changed chan struct{} // Closed when the watched files change.
+}
+
+// newPreview returns a preview of the payloads in path, rendered with the
+// named built-in theme or the theme file at theme.
+func newPreview(path, theme, ecl string) (*preview, error) {
+	level, err := qrcodegen.ParseECL(ecl)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	p := &preview{path: path, ecl: level, mux: http.NewServeMux(), changed: make(chan struct{})}
+	if t, err := qrcodegen.LookupTheme(theme); err == nil {
+		p.theme = t
+	} else {
+		if _, err := os.Stat(theme); err != nil {
+			return nil, fmt.Errorf("%q is neither a built-in theme nor a theme file", theme)
+		}
+		p.themePath, p.themeFile = theme, qrcodegen.NewThemeFile(theme)
+	}
+	p.stamp = p.currentStamp()
+	p.mux.HandleFunc("/", p.handlePage)
+	p.mux.HandleFunc("/events", p.handleEvents)
+
+	return p, nil
+}
+
+func (p *preview) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mux.ServeHTTP(w, r)
+}
+
+// currentStamp describes the state of the watched files.
+func (p *preview) currentStamp() string {
+	var sb strings.Builder
+	for _, path := range []string{p.path, p.themePath} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&sb, "%d/%d;", info.Size(), info.ModTime().UnixNano())
+		} else {
+			sb.WriteString("missing;")
+		}
+	}
+
+	return sb.String()
+}
+
+// check notifies the open pages if the watched files have changed.
+func (p *preview) check() {
+	stamp := p.currentStamp()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if stamp != p.stamp {
+		p.stamp = stamp
+		close(p.changed)
+		p.changed = make(chan struct{})
+	}
+}
+
+// handleEvents streams a "reload" server-sent event when the watched files
+// change.
+func (p *preview) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	p.mu.Lock()
+	changed := p.changed
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	select {
+	case <-changed:
+		fmt.Fprint(w, "data: reload\n\n")
+		flusher.Flush()
+	case <-r.Context().Done():
+	}
+}
+
+// previewCell is one payload of the preview page.
+type previewCell struct {
+	Payload string
+	SVG     template.HTML
+	Info    string
+	Error   string
+}
+
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Path}}</title>
+<style>
+body{font-family:sans-serif;margin:1em;background:#eee}
+.grid{display:grid;grid-template-columns:repeat(auto-fill,minmax(220px,1fr));gap:1em}
+figure{margin:0;padding:.5em;background:#fff;border-radius:4px}
+figure svg{width:100%;height:auto}
+figcaption{font-size:12px;overflow-wrap:anywhere}
+.info{color:#666}.error{color:#b00}
+</style>
+</head>
+<body>
+<h1>{{.Path}}</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<div class="grid">
+{{range .Cells}}<figure>{{.SVG}}<figcaption>{{.Payload}}{{if .Info}} <span class="info">{{.Info}}</span>{{end}}{{if .Error}}<br><span class="error">{{.Error}}</span>{{end}}</figcaption></figure>
+{{end}}</div>
+<script>new EventSource("/events").onmessage = function() { location.reload(); };</script>
+</body>
+</html>
+`))
+
+// handlePage renders the preview grid.
+func (p *preview) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := struct {
+		Path  string
+		Error string
+		Cells []previewCell
+	}{Path: p.path}
+	theme := p.theme
+	if p.themeFile != nil {
+		// On error the last good theme is kept, so the grid stays usable
+		// while the theme file is being edited.
+		var err error
+		if theme, err = p.themeFile.Theme(); err != nil {
+			data.Error = "theme: " + err.Error()
+		}
+	}
+	payloads, err := readPayloads(p.path)
+	if err != nil {
+		data.Error = err.Error()
+	}
+	for _, payload := range payloads {
+		data.Cells = append(data.Cells, p.cell(payload, theme))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	previewPage.Execute(w, data)
+}
+
+// cell renders one payload.
+func (p *preview) cell(payload string, theme qrcodegen.Theme) previewCell {
+	c := previewCell{Payload: payload}
+	q, err := qrcodegen.EncodeText(payload, p.ecl)
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	// Show the problems of themes that refuse to render instead of hiding
+	// the cell.
+	theme.Strictness = qrcodegen.StrictnessWarn
+	theme.Warn = func(err error) { c.Error = err.Error() }
+	svg, err := theme.ToSVGString(q, false)
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	c.SVG = template.HTML(svg)
+	c.Info = fmt.Sprintf("version %d, ECL %s, mask %d", q.Version, q.ErrorCorrectionLevel, q.Mask)
+
+	return c
+}
+
+// readPayloads reads the non-empty, non-comment lines of a payload file.
+func readPayloads(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var result []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			result = append(result, line)
+		}
+	}
+
+	return result, scanner.Err()
+}
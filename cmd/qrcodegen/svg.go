@@ -0,0 +1,663 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rasterizeSVG renders the filled shapes of an SVG document (rect, circle, and
+// path elements inside svg and g elements) in grayscale at scale pixels per
+// user unit of the outermost svg element, on a white background. It is not a
+// general SVG renderer: strokes, text, images, gradients, CSS, and transform
+// attributes are ignored. That is enough for flat vector artwork such as the
+// output of the qrcodegen renderers.
+func rasterizeSVG(r io.Reader, scale float64) (*image.Gray, error) {
+	var (
+		img   *image.Gray
+		stack []svgState
+	)
+
+	decoder := xml.NewDecoder(r)
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SVG: %v", err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if img == nil && tok.Name.Local != "svg" {
+				return nil, fmt.Errorf("invalid SVG: root element is %q", tok.Name.Local)
+			}
+			var st svgState
+			if len(stack) > 0 {
+				st = stack[len(stack)-1]
+			} else {
+				st = svgState{fill: color.Gray{}, scaleX: scale, scaleY: scale}
+			}
+			attrs := map[string]string{}
+			for _, a := range tok.Attr {
+				attrs[a.Name.Local] = a.Value
+			}
+			if err := st.inherit(attrs); err != nil {
+				return nil, err
+			}
+
+			var shape [][]svgPoint
+			switch tok.Name.Local {
+			case "svg":
+				if img == nil {
+					if img, err = st.root(attrs, scale); err != nil {
+						return nil, err
+					}
+				} else if err := st.nested(attrs); err != nil {
+					return nil, err
+				}
+			case "g", "a":
+			case "rect":
+				shape, err = st.rect(attrs)
+			case "circle":
+				shape, err = st.circle(attrs)
+			case "path":
+				shape, err = parsePath(attrs["d"])
+			default:
+				// Skip the content of elements that are not drawn directly
+				// (defs, symbol, style, text, ...).
+				if err := decoder.Skip(); err != nil {
+					return nil, fmt.Errorf("invalid SVG: %v", err)
+				}
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if shape != nil && !st.noFill {
+				st.fillPolygons(img, shape)
+			}
+			stack = append(stack, st)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if img == nil {
+		return nil, fmt.Errorf("invalid SVG: no svg element")
+	}
+
+	return img, nil
+}
+
+// svgPoint is a point in user units.
+type svgPoint struct {
+	x, y float64
+}
+
+// svgState holds the inherited properties and coordinate system of an element.
+type svgState struct {
+	fill            color.Gray
+	noFill, evenOdd bool
+	// Pixel = user unit * scale + offset.
+	scaleX, scaleY, offsetX, offsetY float64
+	// Size of the viewport in user units, for percentages.
+	width, height float64
+}
+
+// inherit applies the fill properties of an element.
+func (st *svgState) inherit(attrs map[string]string) error {
+	if v, ok := attrs["fill"]; ok {
+		if v == "none" || v == "transparent" {
+			st.noFill = true
+		} else {
+			c, err := parseSVGColor(v)
+			if err != nil {
+				return err
+			}
+			st.fill, st.noFill = c, false
+		}
+	}
+	if v, ok := attrs["fill-rule"]; ok {
+		st.evenOdd = v == "evenodd"
+	}
+
+	return nil
+}
+
+// maxSVGPixels bounds the canvas that rasterizeSVG draws on.
+const maxSVGPixels = 1 << 26
+
+// root sets up the coordinate system of the outermost svg element and returns
+// the white canvas it is drawn on.
+func (st *svgState) root(attrs map[string]string, scale float64) (*image.Gray, error) {
+	minX, minY, w, h, err := parseViewBox(attrs["viewBox"])
+	if err != nil {
+		return nil, err
+	}
+	if w == 0 {
+		w, _ = parseLength(attrs["width"], 0)
+		h, _ = parseLength(attrs["height"], 0)
+	}
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("invalid SVG: the size of the svg element is unknown")
+	}
+	// Check the size as a float, before converting, since a huge viewBox
+	// overflows int.
+	fw, fh := math.Ceil(w*scale), math.Ceil(h*scale)
+	if !(fw*fh <= maxSVGPixels) {
+		return nil, fmt.Errorf("SVG is too large to rasterize at scale %g", scale)
+	}
+	width, height := int(fw), int(fh)
+
+	st.offsetX, st.offsetY = -minX*scale, -minY*scale
+	st.width, st.height = w, h
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+
+	return img, nil
+}
+
+// nested maps the viewBox of a nested svg element onto its viewport.
+func (st *svgState) nested(attrs map[string]string) error {
+	x, err := parseLength(attrs["x"], st.width)
+	if err != nil {
+		return err
+	}
+	y, err := parseLength(attrs["y"], st.height)
+	if err != nil {
+		return err
+	}
+	w, h := st.width, st.height
+	if v, ok := attrs["width"]; ok {
+		if w, err = parseLength(v, st.width); err != nil {
+			return err
+		}
+	}
+	if v, ok := attrs["height"]; ok {
+		if h, err = parseLength(v, st.height); err != nil {
+			return err
+		}
+	}
+	st.offsetX += x * st.scaleX
+	st.offsetY += y * st.scaleY
+	st.width, st.height = w, h
+
+	minX, minY, vw, vh, err := parseViewBox(attrs["viewBox"])
+	if err != nil || vw == 0 {
+		return err
+	}
+	// Scale uniformly and center, as preserveAspectRatio="xMidYMid meet".
+	s := math.Min(w/vw, h/vh)
+	st.offsetX += ((w-vw*s)/2 - minX*s) * st.scaleX
+	st.offsetY += ((h-vh*s)/2 - minY*s) * st.scaleY
+	st.scaleX *= s
+	st.scaleY *= s
+	st.width, st.height = vw, vh
+
+	return nil
+}
+
+// rect returns the outline of a rect element. Rounded corners are ignored.
+func (st *svgState) rect(attrs map[string]string) ([][]svgPoint, error) {
+	var v [4]float64
+	for i, name := range []string{"x", "y", "width", "height"} {
+		ref := st.width
+		if i%2 == 1 {
+			ref = st.height
+		}
+		var err error
+		if v[i], err = parseLength(attrs[name], ref); err != nil {
+			return nil, err
+		}
+	}
+	x, y, w, h := v[0], v[1], v[2], v[3]
+
+	return [][]svgPoint{{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}}, nil
+}
+
+// circle returns the outline of a circle element.
+func (st *svgState) circle(attrs map[string]string) ([][]svgPoint, error) {
+	var v [3]float64
+	for i, name := range []string{"cx", "cy", "r"} {
+		var err error
+		if v[i], err = parseLength(attrs[name], math.Hypot(st.width, st.height)/math.Sqrt2); err != nil {
+			return nil, err
+		}
+	}
+	var poly []svgPoint
+	for i := 0; i < 64; i++ {
+		a := float64(i) * 2 * math.Pi / 64
+		poly = append(poly, svgPoint{v[0] + v[2]*math.Cos(a), v[1] + v[2]*math.Sin(a)})
+	}
+
+	return [][]svgPoint{poly}, nil
+}
+
+// fillPolygons fills the closed polygons, sampling each pixel at its center.
+func (st *svgState) fillPolygons(img *image.Gray, polys [][]svgPoint) {
+	type edge struct {
+		x0, y0, x1, y1 float64
+		dir            int
+	}
+	var edges []edge
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, poly := range polys {
+		for i, p := range poly {
+			q := poly[(i+1)%len(poly)]
+			e := edge{p.x*st.scaleX + st.offsetX, p.y*st.scaleY + st.offsetY, q.x*st.scaleX + st.offsetX, q.y*st.scaleY + st.offsetY, 1}
+			if e.y0 == e.y1 {
+				continue
+			}
+			if e.y0 > e.y1 {
+				e.x0, e.y0, e.x1, e.y1, e.dir = e.x1, e.y1, e.x0, e.y0, -1
+			}
+			edges = append(edges, e)
+			minY, maxY = math.Min(minY, e.y0), math.Max(maxY, e.y1)
+		}
+	}
+	if len(edges) == 0 {
+		return
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].y0 < edges[j].y0 })
+
+	type crossing struct {
+		x   float64
+		dir int
+	}
+	bounds := img.Bounds()
+	first := max(bounds.Min.Y, int(math.Floor(minY)))
+	last := min(bounds.Max.Y, int(math.Ceil(maxY)))
+	var crossings []crossing
+	for py := first; py < last; py++ {
+		y := float64(py) + 0.5
+		crossings = crossings[:0]
+		for _, e := range edges {
+			if e.y0 > y {
+				break
+			}
+			if y < e.y1 {
+				crossings = append(crossings, crossing{e.x0 + (y-e.y0)*(e.x1-e.x0)/(e.y1-e.y0), e.dir})
+			}
+		}
+		sort.Slice(crossings, func(i, j int) bool { return crossings[i].x < crossings[j].x })
+
+		winding := 0
+		for i := 0; i+1 < len(crossings); i++ {
+			winding += crossings[i].dir
+			inside := winding != 0
+			if st.evenOdd {
+				inside = (i+1)%2 == 1
+			}
+			if !inside {
+				continue
+			}
+			// Pixels whose centers lie in [x0, x1).
+			x0 := max(bounds.Min.X, int(math.Ceil(crossings[i].x-0.5)))
+			x1 := min(bounds.Max.X, int(math.Ceil(crossings[i+1].x-0.5)))
+			for px := x0; px < x1; px++ {
+				img.SetGray(px, py, st.fill)
+			}
+		}
+	}
+}
+
+// parseViewBox parses a viewBox attribute; an empty one yields zero sizes.
+func parseViewBox(s string) (minX, minY, w, h float64, err error) {
+	if s == "" {
+		return 0, 0, 0, 0, nil
+	}
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(fields) != 4 {
+		return 0, 0, 0, 0, fmt.Errorf("invalid SVG viewBox %q", s)
+	}
+	var v [4]float64
+	for i, f := range fields {
+		if v[i], err = strconv.ParseFloat(f, 64); err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("invalid SVG viewBox %q", s)
+		}
+	}
+	if v[2] < 0 || v[3] < 0 {
+		return 0, 0, 0, 0, fmt.Errorf("invalid SVG viewBox %q", s)
+	}
+
+	return v[0], v[1], v[2], v[3], nil
+}
+
+// parseLength parses a length in user units, a percentage of ref, or a pixel
+// length; an empty string is 0.
+func parseLength(s string, ref float64) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	factor := 1.0
+	if strings.HasSuffix(s, "%") {
+		s, factor = s[:len(s)-1], ref/100
+	} else {
+		s = strings.TrimSuffix(s, "px")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid SVG length %q", s)
+	}
+
+	return v * factor, nil
+}
+
+// parseSVGColor parses a fill color to gray: #RGB, #RRGGBB, or one of a few
+// keywords.
+func parseSVGColor(s string) (color.Gray, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "black", "currentcolor":
+		return color.Gray{}, nil
+	case "white":
+		return color.Gray{Y: 0xFF}, nil
+	}
+	if strings.HasPrefix(s, "#") && (len(s) == 4 || len(s) == 7) {
+		digits := s[1:]
+		if len(digits) == 3 {
+			digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+		}
+		if v, err := strconv.ParseUint(digits, 16, 32); err == nil {
+			c := color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xFF}
+			return color.GrayModel.Convert(c).(color.Gray), nil
+		}
+	}
+
+	return color.Gray{}, fmt.Errorf("unsupported SVG color %q", s)
+}
+
+// pathParser reads SVG path data.
+type pathParser struct {
+	d   string
+	pos int
+}
+
+func (p *pathParser) skipSeparators() {
+	for p.pos < len(p.d) && strings.IndexByte(" \t\r\n,", p.d[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// more reports whether a number follows.
+func (p *pathParser) more() bool {
+	p.skipSeparators()
+	return p.pos < len(p.d) && strings.IndexByte("+-.0123456789", p.d[p.pos]) >= 0
+}
+
+func (p *pathParser) number() (float64, error) {
+	p.skipSeparators()
+	start := p.pos
+	if p.pos < len(p.d) && (p.d[p.pos] == '+' || p.d[p.pos] == '-') {
+		p.pos++
+	}
+	dot := false
+	for p.pos < len(p.d) {
+		c := p.d[p.pos]
+		if c == '.' && !dot {
+			dot = true
+		} else if c == 'e' || c == 'E' {
+			p.pos++
+			if p.pos < len(p.d) && (p.d[p.pos] == '+' || p.d[p.pos] == '-') {
+				p.pos++
+			}
+			continue
+		} else if c < '0' || c > '9' {
+			break
+		}
+		p.pos++
+	}
+	v, err := strconv.ParseFloat(p.d[start:p.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid SVG path data at offset %d", start)
+	}
+
+	return v, nil
+}
+
+// flag reads an arc flag, which may be written without a separator.
+func (p *pathParser) flag() (bool, error) {
+	p.skipSeparators()
+	if p.pos < len(p.d) && (p.d[p.pos] == '0' || p.d[p.pos] == '1') {
+		p.pos++
+		return p.d[p.pos-1] == '1', nil
+	}
+
+	return false, fmt.Errorf("invalid SVG path data at offset %d", p.pos)
+}
+
+// numbers reads n numbers.
+func (p *pathParser) numbers(n int) ([]float64, error) {
+	result := make([]float64, n)
+	for i := range result {
+		var err error
+		if result[i], err = p.number(); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// parsePath flattens SVG path data into closed polygons. Curves and arcs are
+// approximated by line segments; open subpaths are closed, as for filling.
+func parsePath(d string) ([][]svgPoint, error) {
+	p := &pathParser{d: d}
+	var (
+		polys      [][]svgPoint
+		cur        []svgPoint
+		pos, start svgPoint
+		cmd        byte
+	)
+	closePath := func() {
+		if len(cur) > 2 {
+			polys = append(polys, cur)
+		}
+		cur = nil
+		pos = start
+	}
+
+	for {
+		p.skipSeparators()
+		if p.pos >= len(p.d) {
+			break
+		}
+		if c := p.d[p.pos]; strings.IndexByte("MmLlHhVvCcQqAaZz", c) >= 0 {
+			cmd = c
+			p.pos++
+		} else if cmd == 0 || cmd == 'Z' || cmd == 'z' {
+			return nil, fmt.Errorf("invalid SVG path data at offset %d", p.pos)
+		}
+		if cur == nil && cmd != 'M' && cmd != 'm' {
+			// A drawing command directly after closepath starts at its end.
+			cur = []svgPoint{pos}
+		}
+		relative := cmd >= 'a'
+		var origin svgPoint
+		if relative {
+			origin = pos
+		}
+
+		switch cmd {
+		case 'M', 'm':
+			v, err := p.numbers(2)
+			if err != nil {
+				return nil, err
+			}
+			if len(cur) > 2 {
+				polys = append(polys, cur)
+			}
+			pos = svgPoint{origin.x + v[0], origin.y + v[1]}
+			start, cur = pos, []svgPoint{pos}
+			// Further coordinate pairs are implicit line commands.
+			cmd = 'L' + cmd - 'M'
+		case 'L', 'l':
+			v, err := p.numbers(2)
+			if err != nil {
+				return nil, err
+			}
+			pos = svgPoint{origin.x + v[0], origin.y + v[1]}
+			cur = append(cur, pos)
+		case 'H', 'h':
+			v, err := p.number()
+			if err != nil {
+				return nil, err
+			}
+			pos.x = origin.x + v
+			cur = append(cur, pos)
+		case 'V', 'v':
+			v, err := p.number()
+			if err != nil {
+				return nil, err
+			}
+			pos.y = origin.y + v
+			cur = append(cur, pos)
+		case 'C', 'c', 'Q', 'q':
+			n := 6
+			if cmd == 'Q' || cmd == 'q' {
+				n = 4
+			}
+			v, err := p.numbers(n)
+			if err != nil {
+				return nil, err
+			}
+			ctrl := []svgPoint{pos}
+			for i := 0; i < n; i += 2 {
+				ctrl = append(ctrl, svgPoint{origin.x + v[i], origin.y + v[i+1]})
+			}
+			for i := 1; i <= 16; i++ {
+				cur = append(cur, bezierPoint(ctrl, float64(i)/16))
+			}
+			pos = ctrl[len(ctrl)-1]
+		case 'A', 'a':
+			radii, err := p.numbers(3)
+			if err != nil {
+				return nil, err
+			}
+			large, err := p.flag()
+			if err != nil {
+				return nil, err
+			}
+			sweep, err := p.flag()
+			if err != nil {
+				return nil, err
+			}
+			v, err := p.numbers(2)
+			if err != nil {
+				return nil, err
+			}
+			end := svgPoint{origin.x + v[0], origin.y + v[1]}
+			cur = append(cur, arcPoints(pos, end, radii[0], radii[1], radii[2], large, sweep)...)
+			pos = end
+		case 'Z', 'z':
+			closePath()
+			continue
+		}
+	}
+	if len(cur) > 2 {
+		polys = append(polys, cur)
+	}
+
+	return polys, nil
+}
+
+// bezierPoint evaluates the Bézier curve with the given control points at t.
+func bezierPoint(ctrl []svgPoint, t float64) svgPoint {
+	pts := append([]svgPoint(nil), ctrl...)
+	for n := len(pts) - 1; n > 0; n-- {
+		for i := 0; i < n; i++ {
+			pts[i] = svgPoint{pts[i].x + (pts[i+1].x-pts[i].x)*t, pts[i].y + (pts[i+1].y-pts[i].y)*t}
+		}
+	}
+
+	return pts[0]
+}
+
+// arcPoints flattens an elliptical arc from p0 to p1, excluding p0, following
+// the endpoint to center conversion of the SVG specification (appendix F.6).
+func arcPoints(p0, p1 svgPoint, rx, ry, angle float64, large, sweep bool) []svgPoint {
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 || p0 == p1 {
+		return []svgPoint{p1}
+	}
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	dx, dy := (p0.x-p1.x)/2, (p0.y-p1.y)/2
+	x1, y1 := cos*dx+sin*dy, -sin*dx+cos*dy
+	if l := x1*x1/(rx*rx) + y1*y1/(ry*ry); l > 1 {
+		rx, ry = rx*math.Sqrt(l), ry*math.Sqrt(l)
+	}
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	k := math.Sqrt(math.Max(0, num/den))
+	if large == sweep {
+		k = -k
+	}
+	cx1, cy1 := k*rx*y1/ry, -k*ry*x1/rx
+	cx, cy := cos*cx1-sin*cy1+(p0.x+p1.x)/2, sin*cx1+cos*cy1+(p0.y+p1.y)/2
+
+	theta := math.Atan2((y1-cy1)/ry, (x1-cx1)/rx)
+	delta := math.Atan2((-y1-cy1)/ry, (-x1-cx1)/rx) - theta
+	if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	} else if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	}
+
+	steps := int(math.Ceil(math.Abs(delta) / (math.Pi / 16)))
+	result := make([]svgPoint, 0, steps)
+	for i := 1; i < steps; i++ {
+		a := theta + delta*float64(i)/float64(steps)
+		x, y := rx*math.Cos(a), ry*math.Sin(a)
+		result = append(result, svgPoint{cos*x - sin*y + cx, sin*x + cos*y + cy})
+	}
+
+	return append(result, p1)
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,101 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"image"
+	_ "image/gif"  // Register the GIF decoder.
+	_ "image/jpeg" // Register the JPEG decoder.
+	_ "image/png"  // Register the PNG decoder.
+	"io"
+	"os"
+
+	"github.com/grkuntzmd/qrcodegen"
+)
+
+// setupVerify defines "qrcodegen verify": it rasterizes the input (SVG, PNG,
+// JPEG, or GIF), decodes the symbol, and fails unless the payload is the
+// expected one, so that printing pipelines can gate on it.
+func setupVerify(fs *flag.FlagSet, o *output) func(args []string) int {
+	in := fs.String("in", "", "rendered symbol to check (SVG, PNG, JPEG, or GIF; - for standard input)")
+	expect := fs.String("expect", "", "payload the symbol must hold")
+	scale := fs.Float64("scale", 4, "pixels per SVG user unit when rasterizing vector input")
+
+	return func(args []string) int {
+		if *in == "" || len(args) != 0 {
+			return o.usageError()
+		}
+		d := &diagnostics{Input: *in, Expected: *expect}
+		if *scale <= 0 {
+			return o.report(d, exitUsage, "scale must be positive")
+		}
+
+		img, err := readInput(*in, *scale)
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			return o.report(d, exitUsage, "%v", err)
+		} else if err != nil {
+			return o.report(d, exitMismatch, "%s: %v", *in, err)
+		}
+		result, err := qrcodegen.DecodeImage(img)
+		if err != nil {
+			return o.report(d, exitMismatch, "%s: %v", *in, err)
+		}
+		mask := int(result.Mask)
+		d.Payload, d.Version, d.ECL, d.Mask = string(result.Data), int(result.Version), result.ErrorCorrectionLevel.String(), &mask
+		if d.Payload != *expect {
+			return o.report(d, exitMismatch, "%s: payload is %q, expected %q", *in, d.Payload, *expect)
+		}
+
+		return o.report(d, exitOK, "%s: ok (version %d, ECL %s)", *in, result.Version, result.ErrorCorrectionLevel)
+	}
+}
+
+// readInput reads the image in the named file, rasterizing it at scale pixels
+// per unit if it is SVG.
+func readInput(name string, scale float64) (image.Image, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512)
+	if bytes.HasPrefix(bytes.TrimSpace(head), []byte("<")) {
+		return rasterizeSVG(br, scale)
+	}
+	img, _, err := image.Decode(br)
+
+	return img, err
+}
@@ -0,0 +1,91 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// DataURIFormat selects the image format of DataURI.
+type DataURIFormat int8
+
+// Data URI formats.
+const (
+	// DataURIPNG is a base64 PNG image.
+	DataURIPNG DataURIFormat = iota
+	// DataURISVG is a percent-encoded SVG image, smaller than base64 since
+	// most of the markup needs no escaping.
+	DataURISVG
+)
+
+// DataURIOptions controls DataURI. Only the options of the chosen format are
+// used. The SVG DocType option is ignored, since a data URI is never a
+// standalone file.
+type DataURIOptions struct {
+	PNG PNGOptions
+	SVG SVGOptions
+}
+
+// DataURI returns the QR code as a data: URI (data:image/png;base64,... or
+// data:image/svg+xml;utf8,...) that can be used as the src of an HTML img
+// element, or in CSS, without serving a separate file. The URI contains no
+// double quotes, so it can be placed in a double-quoted attribute as it is.
+func (q *QRCode) DataURI(format DataURIFormat, opts DataURIOptions) (string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case DataURIPNG:
+		if err := q.WritePNG(&buf, opts.PNG); err != nil {
+			return "", err
+		}
+		return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+	case DataURISVG:
+		opts.SVG.DocType = false
+		if err := q.WriteSVG(&buf, opts.SVG); err != nil {
+			return "", err
+		}
+		return "data:image/svg+xml;utf8," + dataURIEscape(strings.TrimSpace(buf.String())), nil
+	default:
+		return "", fmt.Errorf("unknown data URI format %d", format)
+	}
+}
+
+// dataURIEscape percent-encodes the bytes of s that are not allowed in a URI
+// or would end an HTML attribute, leaving the rest readable.
+func dataURIEscape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < ' ' || c >= 0x7F || strings.IndexByte(`"%#<>&[\]^`+"`{|}", c) >= 0 {
+			fmt.Fprintf(&sb, "%%%02X", c)
+			continue
+		}
+		sb.WriteByte(c)
+	}
+
+	return sb.String()
+}
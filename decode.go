@@ -0,0 +1,528 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// DecodedSegment is one segment read back from a QR code symbol.
+type DecodedSegment struct {
+	Mode            // The mode of the segment (numeric, alphanumeric, byte, kanji, or ECI).
+	NumChars int    // The character count read from the segment header.
+	Data     []byte // The decoded bytes (Shift JIS for kanji segments, empty for ECI segments).
+	ECI      int    // The assignment value of an ECI segment.
+}
+
+// DecodeResult is the content of a decoded QR code symbol.
+type DecodeResult struct {
+	Version                               // The version inferred from the symbol size.
+	ErrorCorrectionLevel ECL              // The error correction level read from the format bits.
+	Mask                                  // The mask read from the format bits.
+	Data                 []byte           // The concatenated data of all non-ECI segments.
+	Segments             []DecodedSegment // The segments in the order they appear in the symbol.
+	CorrectedErrors      int              // The number of codewords repaired by error correction.
+}
+
+var (
+	gfExp [512]byte // Powers of the generator 0x02 in GF(2^8/0x11D), repeated so that products of logs need no modulo.
+	gfLog [256]int  // Discrete logarithms (base 0x02) of the nonzero field elements.
+)
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfExp[i+255] = x
+		gfLog[x] = i
+		x = reedSolomonMultiply(x, 0x02)
+	}
+}
+
+// Decode reads the data back out of the modules of a QR code symbol. Only the
+// Modules field of q is used; the version is inferred from the size and the
+// error correction level and mask are read from the format bits. Damaged
+// codewords are repaired with Reed-Solomon error correction when possible.
+func Decode(q *QRCode) (*DecodeResult, error) {
+	size := len(q.Modules)
+	if size < 21 || size > 177 || (size-17)%4 != 0 {
+		return nil, fmt.Errorf("invalid symbol size %d", size)
+	}
+	for _, row := range q.Modules {
+		if len(row) != size {
+			return nil, fmt.Errorf("symbol is not square")
+		}
+	}
+
+	ecl, mask, err := readFormatBits(q.Modules)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rebuild the function pattern map for this version, then copy the data
+	// modules over it and remove the mask.
+	version := Version((size - 17) / 4)
+	work := newQRCodeFromTemplate(version, ecl)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if !work.isFunction[y][x] {
+				work.Modules[y][x] = q.Modules[y][x] & 1
+			}
+		}
+	}
+	work.applyMask(mask)
+
+	dataCodeWords, corrected, err := work.readCodewords()
+	if err != nil {
+		return nil, err
+	}
+
+	segs, err := parseSegments(dataCodeWords, version)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DecodeResult{
+		Version:              version,
+		ErrorCorrectionLevel: ecl,
+		Mask:                 mask,
+		Data:                 []byte{},
+		Segments:             segs,
+		CorrectedErrors:      corrected,
+	}
+	for _, seg := range segs {
+		result.Data = append(result.Data, seg.Data...)
+	}
+
+	return result, nil
+}
+
+// newBlankQRCode allocates the module and function maps for a QR code of the
+// given version, with every module white.
+func newBlankQRCode(version Version, ecl ECL) *QRCode {
+	size := int(version)*4 + 17
+	q := &QRCode{
+		Version:              version,
+		Size:                 size,
+		ErrorCorrectionLevel: ecl,
+		Modules:              make([][]Module, size),
+		isFunction:           make([][]bool, size),
+	}
+	for i := 0; i < size; i++ {
+		q.Modules[i] = make([]Module, size)
+		q.isFunction[i] = make([]bool, size)
+	}
+
+	return q
+}
+
+// readFormatBits reads both copies of the format bits and returns the error
+// correction level and mask of the closest valid format word.
+func readFormatBits(modules [][]Module) (ECL, Mask, error) {
+	size := len(modules)
+	bit := func(x, y int) int {
+		return int(modules[y][x] & 1)
+	}
+
+	// The same module positions written by drawFormatBits.
+	first, second := 0, 0
+	for i := 0; i <= 5; i++ {
+		first |= bit(8, i) << i
+	}
+	first |= bit(8, 7) << 6
+	first |= bit(8, 8) << 7
+	first |= bit(7, 8) << 8
+	for i := 9; i < 15; i++ {
+		first |= bit(14-i, 8) << i
+	}
+	for i := 0; i < 8; i++ {
+		second |= bit(size-1-i, 8) << i
+	}
+	for i := 8; i < 15; i++ {
+		second |= bit(8, size-15+i) << i
+	}
+
+	bestDistance, bestData := 16, -1
+	for data := 0; data < 32; data++ {
+		word := formatWord(data)
+		for _, read := range []int{first, second} {
+			if d := bits.OnesCount(uint(word ^ read)); d < bestDistance {
+				bestDistance, bestData = d, data
+			}
+		}
+	}
+	if bestDistance > 3 {
+		return 0, 0, fmt.Errorf("format bits are unreadable")
+	}
+
+	var ecl ECL
+	for e := Low; e <= High; e++ {
+		if e.formatBits() == bestData>>3 {
+			ecl = e
+		}
+	}
+
+	return ecl, Mask(bestData & 7), nil
+}
+
+// formatWord returns the 15 bit format word (with its error correction code and
+// mask pattern) for the 5 bits of format data.
+func formatWord(data int) int {
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ rem>>9*0x537
+	}
+
+	return data<<10 | rem ^ 0x5412
+}
+
+// readCodewords reads the codewords in the zig-zag order used by
+// drawCodewords, splits them into blocks, corrects errors, and returns the
+// data codewords and the number of corrected codewords.
+func (q *QRCode) readCodewords() ([]byte, int, error) {
+	raw := make([]byte, numRawDataModules[q.Version]/8)
+	plan := codewordPlan(q.Version)
+	for i := 0; i < len(raw)*8; i++ {
+		p := plan[i]
+		raw[i>>3] |= byte(q.Modules[p.y][p.x]) << (7 - i&7)
+	}
+
+	// Undo the interleaving done by addECCAndInterleave.
+	numBlocks := numErrorCorrectionBlocks[q.ErrorCorrectionLevel][q.Version]
+	blockECCLen := eccCodeWordsPerBlock[q.ErrorCorrectionLevel][q.Version]
+	rawCodeWords := len(raw)
+	numShortBlocks := numBlocks - rawCodeWords%numBlocks
+	shortBlockLen := rawCodeWords / numBlocks
+
+	blocks := make([][]byte, numBlocks)
+	for j := range blocks {
+		blocks[j] = make([]byte, shortBlockLen+1)
+	}
+	for i, k := 0, 0; i < shortBlockLen+1; i++ {
+		for j := 0; j < numBlocks; j++ {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				blocks[j][i] = raw[k]
+				k++
+			}
+		}
+	}
+
+	result := make([]byte, 0, numDataCodewords[q.ErrorCorrectionLevel][q.Version])
+	corrected := 0
+	for j, block := range blocks {
+		if j < numShortBlocks { // Remove the padding byte.
+			pad := shortBlockLen - blockECCLen
+			block = append(block[:pad], block[pad+1:]...)
+		}
+		n, err := reedSolomonCorrect(block, blockECCLen)
+		if err != nil {
+			return nil, 0, fmt.Errorf("block %d: %w", j, err)
+		}
+		corrected += n
+		result = append(result, block[:len(block)-blockECCLen]...)
+	}
+
+	return result, corrected, nil
+}
+
+// reedSolomonCorrect corrects errors in place in a block of data followed by
+// numECC error correction codewords, and returns the number of codewords that
+// were corrected.
+func reedSolomonCorrect(block []byte, numECC int) (int, error) {
+	n := len(block)
+
+	// Evaluate the syndromes S_j = block(r^j), j in [0, numECC).
+	syndromes := make([]byte, numECC)
+	clean := true
+	for j := range syndromes {
+		var s byte
+		for _, b := range block {
+			s = gfMul(s, gfExp[j]) ^ b
+		}
+		syndromes[j] = s
+		clean = clean && s == 0
+	}
+	if clean {
+		return 0, nil
+	}
+
+	// Berlekamp-Massey: find the error locator polynomial (lowest power first).
+	locator := []byte{1}
+	prev := []byte{1}
+	numErrors, shift, prevDiscrepancy := 0, 1, byte(1)
+	for k := 0; k < numECC; k++ {
+		discrepancy := syndromes[k]
+		for i := 1; i <= numErrors && i < len(locator); i++ {
+			discrepancy ^= gfMul(locator[i], syndromes[k-i])
+		}
+		if discrepancy == 0 {
+			shift++
+			continue
+		}
+		scale := gfDiv(discrepancy, prevDiscrepancy)
+		next := make([]byte, max(len(locator), len(prev)+shift))
+		copy(next, locator)
+		for i, c := range prev {
+			next[i+shift] ^= gfMul(scale, c)
+		}
+		if 2*numErrors <= k {
+			prev = locator
+			numErrors = k + 1 - numErrors
+			prevDiscrepancy = discrepancy
+			shift = 1
+		} else {
+			shift++
+		}
+		locator = next
+	}
+	if 2*numErrors > numECC {
+		return 0, fmt.Errorf("too many errors to correct")
+	}
+
+	// Chien search: an error at byte index i (power p = n-1-i) makes
+	// locator(r^-p) zero.
+	var positions []int
+	for i := 0; i < n; i++ {
+		p := n - 1 - i
+		if gfEval(locator, gfExp[(255-p%255)%255]) == 0 {
+			positions = append(positions, i)
+		}
+	}
+	if len(positions) != numErrors {
+		return 0, fmt.Errorf("too many errors to correct")
+	}
+
+	// Forney: the error value at locator X is X * omega(X^-1) / locator'(X^-1),
+	// where omega = syndromes * locator mod x^numECC.
+	omega := make([]byte, numECC)
+	for i, s := range syndromes {
+		for j, l := range locator {
+			if i+j < numECC {
+				omega[i+j] ^= gfMul(s, l)
+			}
+		}
+	}
+	derivative := make([]byte, len(locator))
+	for i := 1; i < len(locator); i += 2 {
+		derivative[i-1] = locator[i]
+	}
+	for _, i := range positions {
+		p := n - 1 - i
+		x := gfExp[p%255]
+		xInv := gfExp[(255-p%255)%255]
+		denominator := gfEval(derivative, xInv)
+		if denominator == 0 {
+			return 0, fmt.Errorf("too many errors to correct")
+		}
+		block[i] ^= gfMul(x, gfDiv(gfEval(omega, xInv), denominator))
+	}
+
+	return numErrors, nil
+}
+
+func gfMul(x, y byte) byte {
+	if x == 0 || y == 0 {
+		return 0
+	}
+
+	return gfExp[gfLog[x]+gfLog[y]]
+}
+
+func gfDiv(x, y byte) byte {
+	if y == 0 {
+		panic("division by zero")
+	}
+	if x == 0 {
+		return 0
+	}
+
+	return gfExp[gfLog[x]+255-gfLog[y]]
+}
+
+// gfEval evaluates the polynomial (lowest power first) at x.
+func gfEval(poly []byte, x byte) byte {
+	var result byte
+	for i := len(poly) - 1; i >= 0; i-- {
+		result = gfMul(result, x) ^ poly[i]
+	}
+
+	return result
+}
+
+// parseSegments reads the segments from the data codewords of a symbol.
+func parseSegments(data []byte, version Version) ([]DecodedSegment, error) {
+	r := bitReader{data: data}
+	var segs []DecodedSegment
+	for r.remaining() >= 4 {
+		modeBits := r.read(4)
+		if modeBits == 0 { // Terminator.
+			break
+		}
+
+		var seg DecodedSegment
+		switch modeBits {
+		case int(Numeric.modeBits):
+			seg.Mode = Numeric
+		case int(Alphanumeric.modeBits):
+			seg.Mode = Alphanumeric
+		case int(Byte.modeBits):
+			seg.Mode = Byte
+		case int(kanji.modeBits):
+			seg.Mode = kanji
+		case int(ECI.modeBits):
+			seg.Mode = ECI
+			value, err := r.readECI()
+			if err != nil {
+				return nil, err
+			}
+			seg.ECI = value
+			segs = append(segs, seg)
+			continue
+		default:
+			return nil, fmt.Errorf("unsupported segment mode %d", modeBits)
+		}
+
+		ccBits := int(seg.Mode.numCharCountBits(version))
+		if r.remaining() < ccBits {
+			return nil, fmt.Errorf("truncated segment header")
+		}
+		seg.NumChars = r.read(ccBits)
+
+		var err error
+		seg.Data, err = r.readSegmentData(seg.Mode, seg.NumChars)
+		if err != nil {
+			return nil, err
+		}
+		segs = append(segs, seg)
+	}
+
+	return segs, nil
+}
+
+// bitReader reads big-endian bit fields from a byte slice.
+type bitReader struct {
+	data []byte
+	pos  int // Bit position of the next read.
+}
+
+func (r *bitReader) remaining() int {
+	return len(r.data)*8 - r.pos
+}
+
+func (r *bitReader) read(n int) int {
+	result := 0
+	for i := 0; i < n; i++ {
+		result = result<<1 | int(r.data[r.pos>>3]>>(7-r.pos&7)&1)
+		r.pos++
+	}
+
+	return result
+}
+
+func (r *bitReader) readECI() (int, error) {
+	if r.remaining() < 8 {
+		return 0, fmt.Errorf("truncated ECI segment")
+	}
+	first := r.read(8)
+	switch {
+	case first&0x80 == 0:
+		return first, nil
+	case first&0xC0 == 0x80 && r.remaining() >= 8:
+		return (first&0x3F)<<8 | r.read(8), nil
+	case first&0xE0 == 0xC0 && r.remaining() >= 16:
+		return (first&0x1F)<<16 | r.read(16), nil
+	default:
+		return 0, fmt.Errorf("invalid ECI designator")
+	}
+}
+
+func (r *bitReader) readSegmentData(mode Mode, numChars int) ([]byte, error) {
+	truncated := fmt.Errorf("truncated segment data")
+	var sb strings.Builder
+	switch mode {
+	case Numeric:
+		for n := numChars; n > 0; n -= 3 {
+			digits := min(n, 3)
+			width := digits*3 + 1
+			if r.remaining() < width {
+				return nil, truncated
+			}
+			v := r.read(width)
+			if v >= []int{0, 10, 100, 1000}[digits] {
+				return nil, fmt.Errorf("invalid numeric value")
+			}
+			fmt.Fprintf(&sb, "%0*d", digits, v)
+		}
+	case Alphanumeric:
+		for n := numChars; n > 0; n -= 2 {
+			if n == 1 {
+				if r.remaining() < 6 {
+					return nil, truncated
+				}
+				v := r.read(6)
+				if v >= len(alphanumericCharset) {
+					return nil, fmt.Errorf("invalid alphanumeric value")
+				}
+				sb.WriteByte(alphanumericCharset[v])
+				break
+			}
+			if r.remaining() < 11 {
+				return nil, truncated
+			}
+			v := r.read(11)
+			if v >= 45*45 {
+				return nil, fmt.Errorf("invalid alphanumeric value")
+			}
+			sb.WriteByte(alphanumericCharset[v/45])
+			sb.WriteByte(alphanumericCharset[v%45])
+		}
+	case Byte:
+		if r.remaining() < numChars*8 {
+			return nil, truncated
+		}
+		for i := 0; i < numChars; i++ {
+			sb.WriteByte(byte(r.read(8)))
+		}
+	case kanji:
+		if r.remaining() < numChars*13 {
+			return nil, truncated
+		}
+		for i := 0; i < numChars; i++ {
+			v := r.read(13)
+			word := v/0xC0<<8 | v%0xC0
+			if word+0x8140 <= 0x9FFC {
+				word += 0x8140
+			} else {
+				word += 0xC140
+			}
+			sb.WriteByte(byte(word >> 8))
+			sb.WriteByte(byte(word))
+		}
+	}
+
+	return []byte(sb.String()), nil
+}
@@ -0,0 +1,156 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"image"
+	"sync"
+)
+
+// EncodeConfig holds organization-wide encoding defaults. See SetDefaults.
+type EncodeConfig struct {
+	ECL        ECL     // Error correction level used by Encoder.
+	Border     int     // Quiet zone, in modules, used by Encoder's renderers.
+	BoostECL   bool    // Raise the error correction level when it does not increase the version.
+	MinVersion Version // Smallest version to use.
+	MaxVersion Version // Largest version to use.
+	Mask       Mask    // Mask to use, or -1 for automatic selection.
+	MaxInput   int     // Largest input, in bytes, accepted by EncodeText and EncodeBinary (0 for no limit).
+}
+
+// Validate reports whether the configuration is usable.
+func (c EncodeConfig) Validate() error {
+	if c.ECL < Low || High < c.ECL {
+		return fmt.Errorf("invalid error correction level %d", c.ECL)
+	}
+	if c.Border < 0 {
+		return fmt.Errorf("border must be non-negative")
+	}
+	if c.MinVersion < MinVersion || MaxVersion < c.MaxVersion || c.MaxVersion < c.MinVersion {
+		return fmt.Errorf("invalid segment versions")
+	}
+	if c.Mask < -1 || c.Mask > 7 {
+		return fmt.Errorf("mask value out of range")
+	}
+	if c.MaxInput < 0 {
+		return fmt.Errorf("maximum input size must be non-negative")
+	}
+
+	return nil
+}
+
+// FactoryDefaults is the configuration in effect until SetDefaults is called.
+var FactoryDefaults = EncodeConfig{
+	ECL:        Medium,
+	Border:     4,
+	BoostECL:   true,
+	MinVersion: MinVersion,
+	MaxVersion: MaxVersion,
+	Mask:       -1,
+}
+
+var (
+	defaultsMu sync.RWMutex
+	defaults   = FactoryDefaults
+)
+
+// SetDefaults replaces the package-wide defaults. BoostECL, MinVersion,
+// MaxVersion, Mask and MaxInput become the starting point of every
+// EncodeSegments, EncodeText and EncodeBinary call (options passed to those
+// functions still override them); ECL and Border are used by DefaultEncoder.
+// SetDefaults is safe to call concurrently with encoding, but is meant to be
+// called once at start-up.
+func SetDefaults(c EncodeConfig) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	defaultsMu.Lock()
+	defaults = c
+	defaultsMu.Unlock()
+
+	return nil
+}
+
+// Defaults returns the current package-wide defaults.
+func Defaults() EncodeConfig {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	return defaults
+}
+
+// Encoder encodes and renders with a fixed configuration.
+type Encoder struct {
+	EncodeConfig
+	Tracer Tracer // Receives the encoding and rendering stages, if not nil.
+}
+
+// DefaultEncoder returns an Encoder using a snapshot of the current
+// package-wide defaults.
+func DefaultEncoder() Encoder {
+	return Encoder{EncodeConfig: Defaults()}
+}
+
+// options returns the encoder options equivalent to the configuration.
+func (e Encoder) options(extra []func(*segmentEncoder)) []func(*segmentEncoder) {
+	return append([]func(*segmentEncoder){
+		WithBoostECL(e.BoostECL),
+		WithMinVersion(e.MinVersion),
+		WithMaxVersion(e.MaxVersion),
+		WithMask(e.Mask),
+		WithMaxInput(e.MaxInput),
+		WithTracer(e.Tracer),
+	}, extra...)
+}
+
+// EncodeText is like the package-level EncodeText, using the encoder's error
+// correction level and settings. Additional options override the settings.
+func (e Encoder) EncodeText(text string, options ...func(*segmentEncoder)) (*QRCode, error) {
+	return EncodeText(text, e.ECL, e.options(options)...)
+}
+
+// EncodeBinary encodes data in byte mode with the encoder's settings.
+func (e Encoder) EncodeBinary(data []byte, options ...func(*segmentEncoder)) (*QRCode, error) {
+	return EncodeBinary(data, e.ECL, e.options(options)...)
+}
+
+// EncodeSegments is like the package-level EncodeSegments, using the
+// encoder's error correction level and settings.
+func (e Encoder) EncodeSegments(segs []*QRSegment, options ...func(*segmentEncoder)) (*QRCode, error) {
+	return EncodeSegments(segs, e.ECL, e.options(options)...)
+}
+
+// ToSVGString renders q as SVG with the encoder's border.
+func (e Encoder) ToSVGString(q *QRCode, includeDocType bool) (string, error) {
+	defer startStage(e.Tracer, StageRender)()
+	return q.ToSVGString(e.Border, includeDocType)
+}
+
+// ToImage renders q as a raster image with the encoder's border.
+func (e Encoder) ToImage(q *QRCode, scale int) (*image.Paletted, error) {
+	defer startStage(e.Tracer, StageRender)()
+	return q.ToImage(scale, e.Border)
+}
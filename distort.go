@@ -0,0 +1,289 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+// Matrix is a 3x3 projective transformation of the plane, applied to column
+// vectors (x, y, 1). It can express scaling, skewing, rotation, and the
+// perspective pre-distortion needed when a code is printed on a surface that
+// is viewed at an angle.
+type Matrix [3][3]float64
+
+// Point is a point in the plane.
+type Point struct {
+	X, Y float64
+}
+
+// Distortion describes how modules are pre-distorted when rendering for
+// curved or angled surfaces. The zero value renders square modules without
+// distortion.
+type Distortion struct {
+	AspectRatio float64 // Module width divided by module height (0 is treated as 1).
+	Matrix      Matrix  // Transformation applied after the aspect ratio, in module units (the zero matrix is treated as the identity).
+}
+
+// IdentityMatrix returns the transformation that changes nothing.
+func IdentityMatrix() Matrix {
+	return Matrix{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+}
+
+// SkewMatrix returns a transformation that skews x by the angle xDegrees (as y
+// increases) and y by the angle yDegrees (as x increases).
+func SkewMatrix(xDegrees, yDegrees float64) Matrix {
+	return Matrix{
+		{1, math.Tan(xDegrees * math.Pi / 180), 0},
+		{math.Tan(yDegrees * math.Pi / 180), 1, 0},
+		{0, 0, 1},
+	}
+}
+
+// SquareToQuadMatrix returns the projective transformation that maps the
+// rectangle (0, 0)-(width, height) onto the quadrilateral with the given
+// corners (top-left, top-right, bottom-right, bottom-left). Use it to
+// pre-distort a symbol so that it appears square when viewed in perspective.
+func SquareToQuadMatrix(width, height float64, quad [4]Point) (Matrix, error) {
+	if width <= 0 || height <= 0 {
+		return Matrix{}, fmt.Errorf("width and height must be positive")
+	}
+
+	// Heckbert's closed form for the unit square to a quadrilateral.
+	x0, y0 := quad[0].X, quad[0].Y
+	x1, y1 := quad[1].X, quad[1].Y
+	x2, y2 := quad[2].X, quad[2].Y
+	x3, y3 := quad[3].X, quad[3].Y
+	sx := x0 - x1 + x2 - x3
+	sy := y0 - y1 + y2 - y3
+	var m Matrix
+	if sx == 0 && sy == 0 { // Affine.
+		m = Matrix{
+			{x1 - x0, x3 - x0, x0},
+			{y1 - y0, y3 - y0, y0},
+			{0, 0, 1},
+		}
+	} else {
+		dx1, dx2 := x1-x2, x3-x2
+		dy1, dy2 := y1-y2, y3-y2
+		det := dx1*dy2 - dx2*dy1
+		if det == 0 {
+			return Matrix{}, fmt.Errorf("degenerate quadrilateral")
+		}
+		g := (sx*dy2 - dx2*sy) / det
+		h := (dx1*sy - sx*dy1) / det
+		m = Matrix{
+			{x1 - x0 + g*x1, x3 - x0 + h*x3, x0},
+			{y1 - y0 + g*y1, y3 - y0 + h*y3, y0},
+			{g, h, 1},
+		}
+	}
+
+	return m.Mul(Matrix{{1 / width, 0, 0}, {0, 1 / height, 0}, {0, 0, 1}}), nil
+}
+
+// Mul returns the transformation that applies n and then m.
+func (m Matrix) Mul(n Matrix) Matrix {
+	var result Matrix
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				result[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+
+	return result
+}
+
+// Apply transforms a point.
+func (m Matrix) Apply(p Point) Point {
+	w := m[2][0]*p.X + m[2][1]*p.Y + m[2][2]
+	return Point{
+		X: (m[0][0]*p.X + m[0][1]*p.Y + m[0][2]) / w,
+		Y: (m[1][0]*p.X + m[1][1]*p.Y + m[1][2]) / w,
+	}
+}
+
+// Inverse returns the inverse transformation.
+func (m Matrix) Inverse() (Matrix, error) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if det == 0 {
+		return Matrix{}, fmt.Errorf("matrix is not invertible")
+	}
+
+	var result Matrix
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			// Cofactor of m[j][i], divided by the determinant.
+			a, b := (j+1)%3, (j+2)%3
+			c, d := (i+1)%3, (i+2)%3
+			result[i][j] = (m[a][c]*m[b][d] - m[a][d]*m[b][c]) / det
+		}
+	}
+
+	return result, nil
+}
+
+// matrix returns the complete transformation from bordered module coordinates
+// to output coordinates.
+func (d Distortion) matrix() Matrix {
+	aspect := d.AspectRatio
+	if aspect == 0 {
+		aspect = 1
+	}
+	m := d.Matrix
+	if m == (Matrix{}) {
+		m = IdentityMatrix()
+	}
+
+	return m.Mul(Matrix{{aspect, 0, 0}, {0, 1, 0}, {0, 0, 1}})
+}
+
+// distortedBounds returns the transformation and the bounding box of the
+// bordered symbol after distortion.
+func (q *QRCode) distortedBounds(border int, d Distortion) (Matrix, Point, Point, error) {
+	if border < 0 {
+		return Matrix{}, Point{}, Point{}, fmt.Errorf("border must be non-negative")
+	}
+	if d.AspectRatio < 0 {
+		return Matrix{}, Point{}, Point{}, fmt.Errorf("aspect ratio must be positive")
+	}
+
+	m := d.matrix()
+	n := float64(q.Size + border*2)
+	minP := Point{math.Inf(1), math.Inf(1)}
+	maxP := Point{math.Inf(-1), math.Inf(-1)}
+	var sign float64
+	for _, c := range []Point{{0, 0}, {n, 0}, {n, n}, {0, n}} {
+		// The projective divisor w is affine in x and y, so it keeps one sign
+		// over the whole square exactly when it has that sign at every
+		// corner; otherwise part of the symbol passes through infinity.
+		w := m[2][0]*c.X + m[2][1]*c.Y + m[2][2]
+		if w == 0 || sign != 0 && (w > 0) != (sign > 0) {
+			return Matrix{}, Point{}, Point{}, fmt.Errorf("distortion maps the symbol through infinity")
+		}
+		sign = w
+		p := m.Apply(c)
+		if math.IsNaN(p.X) || math.IsInf(p.X, 0) || math.IsNaN(p.Y) || math.IsInf(p.Y, 0) {
+			return Matrix{}, Point{}, Point{}, fmt.Errorf("distortion maps the symbol to infinity")
+		}
+		minP = Point{math.Min(minP.X, p.X), math.Min(minP.Y, p.Y)}
+		maxP = Point{math.Max(maxP.X, p.X), math.Max(maxP.Y, p.Y)}
+	}
+
+	return m, minP, maxP, nil
+}
+
+// ToDistortedSVGString returns an SVG representation of the QR code in which
+// every module is drawn as the quadrilateral produced by the distortion.
+func (q *QRCode) ToDistortedSVGString(border int, d Distortion, includeDocType bool) (string, error) {
+	m, minP, maxP, err := q.distortedBounds(border, d)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if includeDocType {
+		sb.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+		sb.WriteString("<!DOCTYPE svg PUBLIC \"-//W3C//DTD SVG 1.1//EN\" \"http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd\">\n")
+	}
+	fmt.Fprintf(&sb, "<svg xmlns=\"http://www.w3.org/2000/svg\" version=\"1.1\" viewBox=\"0 0 %s %s\" stroke=\"none\">\n",
+		formatFloat(maxP.X-minP.X, 3), formatFloat(maxP.Y-minP.Y, 3))
+	sb.WriteString("\t<rect width=\"100%\" height=\"100%\" fill=\"#FFFFFF\"/>\n")
+	sb.WriteString("\t<path d=\"")
+	first := true
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.Modules[y][x] != 1 {
+				continue
+			}
+			if !first {
+				sb.WriteString(" ")
+			}
+			first = false
+			for i, c := range []Point{{0, 0}, {1, 0}, {1, 1}, {0, 1}} {
+				p := m.Apply(Point{float64(x+border) + c.X, float64(y+border) + c.Y})
+				if i == 0 {
+					sb.WriteString("M")
+				} else {
+					sb.WriteString("L")
+				}
+				fmt.Fprintf(&sb, "%s,%s", formatFloat(p.X-minP.X, 3), formatFloat(p.Y-minP.Y, 3))
+			}
+			sb.WriteString("z")
+		}
+	}
+	sb.WriteString("\" fill=\"#000000\"/>\n")
+	sb.WriteString("</svg>\n")
+
+	return sb.String(), nil
+}
+
+// maxDistortedPixels bounds the images made by ToDistortedImage, since a
+// strong perspective can stretch a small symbol over a huge area.
+const maxDistortedPixels = 1 << 26
+
+// ToDistortedImage returns a raster image of the distorted QR code, with
+// scale pixels per output unit (one unit is one module height before the
+// distortion matrix is applied). Pixels outside the symbol are white. The
+// image may have at most 1<<26 pixels.
+func (q *QRCode) ToDistortedImage(scale float64, border int, d Distortion) (*image.Paletted, error) {
+	if scale <= 0 {
+		return nil, fmt.Errorf("scale must be positive")
+	}
+	m, minP, maxP, err := q.distortedBounds(border, d)
+	if err != nil {
+		return nil, err
+	}
+	inverse, err := m.Inverse()
+	if err != nil {
+		return nil, err
+	}
+
+	w, h := math.Ceil((maxP.X-minP.X)*scale), math.Ceil((maxP.Y-minP.Y)*scale)
+	if w*h > maxDistortedPixels {
+		return nil, fmt.Errorf("distorted image of %gx%g pixels is larger than %d pixels", w, h, maxDistortedPixels)
+	}
+	width, height := int(w), int(h)
+	img := image.NewPaletted(image.Rect(0, 0, width, height), monochromePalette)
+	for py := 0; py < height; py++ {
+		for px := 0; px < width; px++ {
+			p := inverse.Apply(Point{(float64(px)+0.5)/scale + minP.X, (float64(py)+0.5)/scale + minP.Y})
+			x := int(math.Floor(p.X)) - border
+			y := int(math.Floor(p.Y)) - border
+			if 0 <= x && x < q.Size && 0 <= y && y < q.Size {
+				img.Pix[py*img.Stride+px] = uint8(q.Modules[y][x])
+			}
+		}
+	}
+
+	return img, nil
+}
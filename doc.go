@@ -0,0 +1,52 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package qrcodegen generates QR code symbols and renders them as SVG, images,
+// and other formats.
+//
+// # Concurrency
+//
+// Encoding and rendering are reentrant: EncodeText, EncodeBinary,
+// EncodeSegments, Decode, and the rendering methods of QRCode may be called
+// from any number of goroutines at once. The only package-level state they
+// read is the set of lookup tables built during package initialization, which
+// are never written afterwards, plus the following, each of which is
+// synchronized:
+//
+//   - the per-version function pattern templates, built once on first use;
+//   - the pool of Reed-Solomon scratch buffers;
+//   - the process-wide defaults set by SetDefaults.
+//
+// Given the same inputs and options, encoding is deterministic; the only
+// source of randomness is the rand.Source passed to WithRandomPadding, which
+// must not be shared between goroutines unless it is itself safe for
+// concurrent use.
+//
+// A QRCode is not copied by its methods, so a symbol that is being modified
+// (for example by writing to Modules) must not be rendered concurrently.
+// PreparedSegments and AuditLog may be shared between goroutines. The exported
+// Mode values and the package-level option defaults such as
+// DefaultVariantStyles and DefaultNormalizeOptions are treated as constants
+// and must not be modified.
+package qrcodegen
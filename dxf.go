@@ -0,0 +1,189 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"regexp"
+)
+
+// DXFOptions controls WriteDXF.
+type DXFOptions struct {
+	ModuleSize float64 // Side of a module in millimeters (default 1).
+	Border     int     // Quiet zone in modules (default 4; negative for none).
+	Layer      string  // Layer of the module outlines (default "QRCODE").
+	Outline    bool    // Also draw the outer edge of the quiet zone, on the layer Layer+"-OUTLINE", for cutting the tag out.
+}
+
+var dxfLayer = regexp.MustCompile(`^[A-Za-z0-9_$-]+$`)
+
+// WriteDXF writes the QR code to w as an AutoCAD DXF (R12) drawing in
+// millimeters, for laser cutters, engravers, and CNC routers. Each connected
+// group of dark modules becomes one closed polyline along its outline
+// (counter-clockwise, with light holes inside it clockwise), and modules that
+// only touch at a corner are kept apart, so the drawing cuts or engraves
+// without overlapping paths. The origin is the bottom left corner of the quiet
+// zone, with y up.
+func (q *QRCode) WriteDXF(w io.Writer, opts DXFOptions) error {
+	if opts.ModuleSize == 0 {
+		opts.ModuleSize = 1
+	}
+	if opts.Border == 0 {
+		opts.Border = 4
+	} else if opts.Border < 0 {
+		opts.Border = 0
+	}
+	if opts.Layer == "" {
+		opts.Layer = "QRCODE"
+	}
+	if opts.ModuleSize < 0 {
+		return fmt.Errorf("module size must be positive")
+	}
+	if !dxfLayer.MatchString(opts.Layer) {
+		return fmt.Errorf("invalid DXF layer name %q", opts.Layer)
+	}
+
+	grid := q.borderedGrid(opts.Border)
+	bw := bufio.NewWriter(w)
+	bw.WriteString("0\nSECTION\n2\nHEADER\n9\n$INSUNITS\n70\n4\n9\n$MEASUREMENT\n70\n1\n0\nENDSEC\n0\nSECTION\n2\nENTITIES\n")
+	polyline := func(layer string, points []image.Point) {
+		fmt.Fprintf(bw, "0\nPOLYLINE\n8\n%s\n66\n1\n70\n1\n10\n0\n20\n0\n30\n0\n", layer)
+		for i := len(points) - 1; i >= 0; i-- {
+			// Reverse the clockwise paths and flip them to y up.
+			p := points[i]
+			x := float64(p.X) * opts.ModuleSize
+			y := float64(grid.size-p.Y) * opts.ModuleSize
+			fmt.Fprintf(bw, "0\nVERTEX\n8\n%s\n10\n%s\n20\n%s\n30\n0\n", layer, formatFloat(x, -1), formatFloat(y, -1))
+		}
+		fmt.Fprintf(bw, "0\nSEQEND\n8\n%s\n", layer)
+	}
+	if opts.Outline {
+		polyline(opts.Layer+"-OUTLINE", []image.Point{{0, 0}, {grid.size, 0}, {grid.size, grid.size}, {0, grid.size}})
+	}
+	for _, outline := range grid.outlines() {
+		polyline(opts.Layer, outline)
+	}
+	bw.WriteString("0\nENDSEC\n0\nEOF\n")
+
+	return bw.Flush()
+}
+
+// outlines returns the boundaries of the connected groups of dark cells as
+// closed paths of grid corners, clockwise around dark cells (with y down), so
+// that holes run the other way. Only the corners where a path turns are
+// included. Cells that touch only at a corner belong to separate paths.
+func (g moduleGrid) outlines() [][]image.Point {
+	dark := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < g.size && y < g.size && g.cells[y*g.size+x] == 1
+	}
+
+	// Collect the boundary edges of the dark cells, directed so that the dark
+	// cell is on the right, keyed by their start corner.
+	up, right, down, left := image.Pt(0, -1), image.Pt(1, 0), image.Pt(0, 1), image.Pt(-1, 0)
+	edges := map[image.Point][]image.Point{}
+	var order []image.Point // Start corners in scan order, for deterministic output.
+	add := func(from, dir image.Point) {
+		if len(edges[from]) == 0 {
+			order = append(order, from)
+		}
+		edges[from] = append(edges[from], dir)
+	}
+	for y := 0; y < g.size; y++ {
+		for x := 0; x < g.size; x++ {
+			if !dark(x, y) {
+				continue
+			}
+			if !dark(x, y-1) {
+				add(image.Pt(x, y), right)
+			}
+			if !dark(x+1, y) {
+				add(image.Pt(x+1, y), down)
+			}
+			if !dark(x, y+1) {
+				add(image.Pt(x+1, y+1), left)
+			}
+			if !dark(x-1, y) {
+				add(image.Pt(x, y+1), up)
+			}
+		}
+	}
+
+	// take removes and returns the edge leaving p that turns furthest toward
+	// the dark side of the incoming direction: right, then straight, then
+	// left. Turning right at a corner shared by two diagonal cells keeps the
+	// path around the cell it came from.
+	take := func(p, dir image.Point) (image.Point, bool) {
+		turnRight := image.Pt(-dir.Y, dir.X)
+		turnLeft := image.Pt(dir.Y, -dir.X)
+		for _, want := range []image.Point{turnRight, dir, turnLeft} {
+			for i, d := range edges[p] {
+				if d == want {
+					edges[p] = append(edges[p][:i], edges[p][i+1:]...)
+					return d, true
+				}
+			}
+		}
+		return image.Point{}, false
+	}
+
+	var result [][]image.Point
+	for _, start := range order {
+		for len(edges[start]) > 0 {
+			first := edges[start][0]
+			edges[start] = edges[start][1:]
+			var path []image.Point
+			p, dir := start.Add(first), first
+			for {
+				if p == start {
+					// Offer the first edge again: the path only closes if
+					// it is the one taken, which matters where two paths
+					// share a corner.
+					edges[start] = append(edges[start], first)
+				}
+				next, ok := take(p, dir)
+				if !ok {
+					panic("open outline")
+				}
+				if next != dir {
+					path = append(path, p)
+				}
+				if p == start {
+					if next == first {
+						break
+					}
+					edges[start] = edges[start][:len(edges[start])-1]
+				}
+				dir = next
+				p = p.Add(dir)
+			}
+			result = append(result, path)
+		}
+	}
+
+	return result
+}
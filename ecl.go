@@ -23,6 +23,11 @@
  */
 package qrcodegen
 
+import (
+	"fmt"
+	"strings"
+)
+
 // ECL represents the error correction level of the QR code.
 type ECL int8
 
@@ -34,6 +39,39 @@ const (
 	High                // High error correction level (recovers 30% of data).
 )
 
+// ParseECL parses an error correction level from its name ("Low", "Medium",
+// "Quartile", or "High") or initial letter, ignoring case.
+func ParseECL(s string) (ECL, error) {
+	switch strings.ToLower(s) {
+	case "l", "low":
+		return Low, nil
+	case "m", "medium":
+		return Medium, nil
+	case "q", "quartile":
+		return Quartile, nil
+	case "h", "high":
+		return High, nil
+	default:
+		return 0, fmt.Errorf("unknown error correction level %q", s)
+	}
+}
+
+// String returns the name of the error correction level.
+func (e ECL) String() string {
+	switch e {
+	case Low:
+		return "Low"
+	case Medium:
+		return "Medium"
+	case Quartile:
+		return "Quartile"
+	case High:
+		return "High"
+	default:
+		return fmt.Sprintf("ECL(%d)", int8(e))
+	}
+}
+
 func (e ECL) formatBits() int {
 	switch e {
 	case Low:
@@ -48,3 +86,55 @@ func (e ECL) formatBits() int {
 		panic("unknown ECC level")
 	}
 }
+
+// Environment describes where and how a symbol will be used, for
+// RecommendECL.
+type Environment struct {
+	Outdoor        bool // Exposed to sunlight, rain, and dirt.
+	Laminated      bool // Behind a laminate, glass, or glossy coating.
+	ExpectedDamage bool // Likely to be scratched, torn, folded, or partly covered.
+	LogoOverlay    bool // A logo will be placed over the center (see QRCode.WithLogo).
+}
+
+// ECLRecommendation is the error correction level suggested by RecommendECL.
+type ECLRecommendation struct {
+	ECL       ECL
+	Rationale []string // One sentence for each factor considered, in the order of the Environment fields.
+}
+
+// RecommendECL suggests an error correction level for a symbol used in env,
+// with the reasons behind it. A higher level makes the symbol larger (or holds
+// less data at the same size), so the suggestion is the lowest level that
+// covers every factor: Medium for clean indoor use, Quartile for weathering or
+// glare, and High for physical damage, a logo, or weathering and glare
+// together.
+func RecommendECL(env Environment) ECLRecommendation {
+	r := ECLRecommendation{ECL: Medium}
+	raise := func(ecl ECL, reason string) {
+		if ecl > r.ECL {
+			r.ECL = ecl
+		}
+		r.Rationale = append(r.Rationale, reason)
+	}
+
+	if env.Outdoor {
+		raise(Quartile, "Outdoor symbols fade in sunlight and collect dirt, so Quartile is the minimum.")
+	}
+	if env.Laminated {
+		raise(Quartile, "Laminates and glossy coatings reflect light into the camera, and glare wipes out patches of modules, so Quartile is the minimum.")
+	}
+	if env.Outdoor && env.Laminated {
+		raise(High, "Fading and glare together often exceed what Quartile can correct, so High is recommended.")
+	}
+	if env.ExpectedDamage {
+		raise(High, "Scratches, tears, and stickers destroy whole groups of codewords, so High is recommended.")
+	}
+	if env.LogoOverlay {
+		raise(High, "A logo removes codewords by design and should use at most half of the correction capacity, so High is recommended.")
+	}
+	if len(r.Rationale) == 0 {
+		r.Rationale = append(r.Rationale, "Medium suits clean indoor print and screens; Low only pays off when the symbol must be as small as possible and is displayed on a screen.")
+	}
+
+	return r
+}
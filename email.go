@@ -0,0 +1,122 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// EmailImageOptions controls EmailImage.
+type EmailImageOptions struct {
+	PNGOptions
+	ContentID string // Content-ID without angle brackets (default a random ID at "qrcodegen.invalid").
+	Filename  string // File name offered by mail clients that show the image as an attachment (default "qrcode.png").
+	Alt       string // Alternative text for the HTML snippet.
+}
+
+// EmailImage is a PNG rendering of a QR code ready to embed in an HTML email
+// as an inline MIME part of a multipart/related message.
+type EmailImage struct {
+	ContentID string               // The Content-ID, without angle brackets.
+	Header    textproto.MIMEHeader // The headers of the MIME part.
+	Body      []byte               // The base64 body, in lines of 76 characters.
+	HTML      string               // An img element that displays the part.
+}
+
+// EmailImage renders the QR code as an inline email image. Most mail clients
+// block data URIs and remote images, but show inline parts referenced with
+// cid: URLs:
+//
+//	img, _ := q.EmailImage(qrcodegen.EmailImageOptions{Alt: "Your ticket"})
+//	img.WritePart(related) // related is the *multipart.Writer of the multipart/related body; put img.HTML in the HTML part.
+func (q *QRCode) EmailImage(opts EmailImageOptions) (*EmailImage, error) {
+	if opts.ContentID == "" {
+		var id [16]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			return nil, err
+		}
+		opts.ContentID = hex.EncodeToString(id[:]) + "@qrcodegen.invalid"
+	}
+	if strings.ContainsAny(opts.ContentID, "<>\r\n \"") {
+		return nil, fmt.Errorf("invalid Content-ID %q", opts.ContentID)
+	}
+	if opts.Filename == "" {
+		opts.Filename = "qrcode.png"
+	}
+
+	var png bytes.Buffer
+	if err := q.WritePNG(&png, opts.PNGOptions); err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(png.Bytes())
+	var body bytes.Buffer
+	for len(encoded) > 76 {
+		body.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	body.WriteString(encoded)
+
+	// Give the image its size in the HTML unless MaxBytes may have reduced
+	// the scale.
+	sized := opts.PNGOptions
+	sized.normalize(q.Size)
+	pixels := (q.Size + 2*sized.Border) * sized.Scale
+	if opts.MaxBytes > 0 {
+		pixels = 0
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", "image/png")
+	header.Set("Content-Transfer-Encoding", "base64")
+	header.Set("Content-ID", "<"+opts.ContentID+">")
+	header.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": opts.Filename}))
+
+	img := fmt.Sprintf(`<img src="cid:%s" alt="%s"`, html.EscapeString(opts.ContentID), html.EscapeString(opts.Alt))
+	if pixels > 0 {
+		img += fmt.Sprintf(` width="%[1]d" height="%[1]d"`, pixels)
+	}
+
+	return &EmailImage{ContentID: opts.ContentID, Header: header, Body: body.Bytes(), HTML: img + ">"}, nil
+}
+
+// WritePart adds the image to w as a new part.
+func (e *EmailImage) WritePart(w *multipart.Writer) error {
+	part, err := w.CreatePart(e.Header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(e.Body)
+
+	return err
+}
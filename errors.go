@@ -0,0 +1,167 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrEmptyPayload is returned by the encoding functions given WithRejectEmpty
+// when there is no data to encode.
+var ErrEmptyPayload = errors.New("empty payload")
+
+// DataTooLongError is returned by EncodeSegments when the segments do not fit
+// in any version allowed by the version constraints at the requested error
+// correction level. The suggestion fields describe the smallest change that
+// would allow the data to fit.
+type DataTooLongError struct {
+	DataBits     int     // Number of bits needed for the data, or -1 if the data cannot be counted at the largest allowed version.
+	CapacityBits int     // Number of data bits available at the largest allowed version and requested error correction level.
+	MaxVersion   Version // The largest version that was allowed.
+	ECL          ECL     // The requested error correction level.
+
+	SuggestedVersion Version // The minimal version (at the requested error correction level) that would fit the data, or 0 if no version fits.
+	SuggestedECL     ECL     // The highest error correction level that would fit the data within MaxVersion, or -1 if none fits.
+}
+
+func (e *DataTooLongError) Error() string {
+	var sb strings.Builder
+	if e.DataBits == -1 {
+		sb.WriteString("data too long")
+	} else {
+		fmt.Fprintf(&sb, "data length = %d bits, max capacity = %d bits", e.DataBits, e.CapacityBits)
+	}
+
+	var hints []string
+	if e.SuggestedVersion != 0 {
+		hints = append(hints, fmt.Sprintf("version %d", e.SuggestedVersion))
+	}
+	if e.SuggestedECL != -1 {
+		hints = append(hints, fmt.Sprintf("ECL %s", e.SuggestedECL))
+	}
+	if len(hints) > 0 {
+		fmt.Fprintf(&sb, " (needs %s)", strings.Join(hints, " or "))
+	}
+
+	return sb.String()
+}
+
+// InputTooLargeError is returned by EncodeText and EncodeBinary when the input
+// exceeds the limit set with WithMaxInput or EncodeConfig.MaxInput.
+type InputTooLargeError struct {
+	Size  int // The size of the input in bytes.
+	Limit int // The largest size allowed.
+}
+
+func (e *InputTooLargeError) Error() string {
+	return fmt.Sprintf("input size = %d bytes, limit = %d bytes", e.Size, e.Limit)
+}
+
+// LowercaseError is returned by EncodeText under AlphanumericStrict when text
+// would fit in alphanumeric mode if its lowercase letters were uppercased.
+type LowercaseError struct {
+	Lowercase int // Number of lowercase letters.
+}
+
+func (e *LowercaseError) Error() string {
+	return fmt.Sprintf("text has %d lowercase letters and would need byte mode; uppercase it to use the denser alphanumeric mode", e.Lowercase)
+}
+
+// ScannabilityError is returned when a Theme would render a symbol that is
+// unlikely to scan.
+type ScannabilityError struct {
+	Theme    string   // The name of the theme.
+	Problems []string // What failed, in human-readable form.
+}
+
+func (e *ScannabilityError) Error() string {
+	return fmt.Sprintf("theme %q is not scannable: %s", e.Theme, strings.Join(e.Problems, "; "))
+}
+
+// ProfileError is returned by ScannerProfile.Check when a symbol is beyond
+// the capabilities of the profile's scanners.
+type ProfileError struct {
+	Profile  string   // The name of the scanner profile.
+	Problems []string // What failed, in human-readable form.
+}
+
+func (e *ProfileError) Error() string {
+	return fmt.Sprintf("not readable by scanner profile %q: %s", e.Profile, strings.Join(e.Problems, "; "))
+}
+
+// LogoError is returned by QRCode.WithLogo when a logo would cover more
+// codewords of a block than the logo's share of its error correction allows.
+type LogoError struct {
+	Block   int // The index of the first block over budget.
+	Damaged int // The number of codewords of the block under the logo.
+	Budget  int // The number of codewords the logo may cover in each block.
+}
+
+func (e *LogoError) Error() string {
+	return fmt.Sprintf("logo covers %d codewords of block %d, more than the %d its error correction can spare", e.Damaged, e.Block, e.Budget)
+}
+
+// OutputTooLargeError is returned by renderers given a byte budget when even
+// the most degraded rendering exceeds it.
+type OutputTooLargeError struct {
+	Limit    int // The byte budget.
+	Smallest int // The size of the smallest rendering produced.
+}
+
+func (e *OutputTooLargeError) Error() string {
+	return fmt.Sprintf("smallest rendering is %d bytes, over the limit of %d", e.Smallest, e.Limit)
+}
+
+// PrivacyError is returned by EncodeText with WithPrivacyCheck when the text
+// appears to contain personal data or secrets.
+type PrivacyError struct {
+	Findings []PrivacyFinding
+}
+
+func (e *PrivacyError) Error() string {
+	kinds := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		kinds[i] = string(f.Kind)
+	}
+
+	return fmt.Sprintf("payload may contain sensitive data: %s", strings.Join(kinds, ", "))
+}
+
+// SpoofError is returned by EncodeText with WithSpoofCheck when the text
+// contains URLs with lookalike hosts.
+type SpoofError struct {
+	Findings []SpoofFinding
+}
+
+func (e *SpoofError) Error() string {
+	hosts := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		hosts[i] = fmt.Sprintf("%s (%s, looks like %s)", f.Host, f.Kind, f.Skeleton)
+	}
+
+	return fmt.Sprintf("payload may contain lookalike hosts: %s", strings.Join(hosts, ", "))
+}
@@ -0,0 +1,96 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// ESCPOSOptions controls WriteESCPOS.
+type ESCPOSOptions struct {
+	Scale  int  // Printer dots per module (default the largest that fits Width, or 4 without a Width).
+	Width  int  // Printable width of the paper in dots, for example 384 for 58 mm or 576 for 80 mm rolls (0 for no limit).
+	Border int  // Quiet zone in modules (default 4; negative for none).
+	Center bool // Center the image on the paper with ESC a, then restore left alignment.
+}
+
+// WriteESCPOS writes the QR code to w as an ESC/POS raster bit image command
+// (GS v 0) for receipt printers, so that a payment or loyalty code can be
+// sent straight to the printer along with the receipt text. Each row is
+// padded to whole bytes with the most significant bit leftmost, and set bits
+// are printed. If Width is given, the symbol must fit in it: without a Scale
+// the scale is chosen to fill as much of the width as possible.
+func (q *QRCode) WriteESCPOS(w io.Writer, opts ESCPOSOptions) error {
+	if opts.Border == 0 {
+		opts.Border = 4
+	} else if opts.Border < 0 {
+		opts.Border = 0
+	}
+	if opts.Width < 0 {
+		return fmt.Errorf("width must not be negative")
+	}
+	size := q.Size + opts.Border*2
+	if opts.Scale == 0 {
+		opts.Scale = 4
+		if opts.Width > 0 {
+			opts.Scale = opts.Width / size
+		}
+	}
+	if opts.Scale < 1 {
+		return fmt.Errorf("symbol of %d modules does not fit in %d dots", size, opts.Width)
+	}
+	side := size * opts.Scale
+	if opts.Width > 0 && side > opts.Width {
+		return fmt.Errorf("symbol of %d dots does not fit in %d dots", side, opts.Width)
+	}
+	rowBytes := (side + 7) / 8
+	if side > 0xFFFF {
+		return fmt.Errorf("symbol of %d dots is too large for a raster bit image", side)
+	}
+
+	grid := q.borderedGrid(opts.Border)
+	bw := bufio.NewWriter(w)
+	if opts.Center {
+		bw.Write([]byte{0x1B, 'a', 1})
+	}
+	bw.Write([]byte{0x1D, 'v', '0', 0, byte(rowBytes), byte(rowBytes >> 8), byte(side), byte(side >> 8)})
+	row := make([]byte, rowBytes)
+	for y := 0; y < side; y++ {
+		for i := range row {
+			row[i] = 0
+		}
+		for x := 0; x < side; x++ {
+			row[x/8] |= grid.cells[y/opts.Scale*grid.size+x/opts.Scale] << (7 - x%8)
+		}
+		bw.Write(row)
+	}
+	if opts.Center {
+		bw.Write([]byte{0x1B, 'a', 0})
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,109 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+// EstimateVersion returns the minimal version that EncodeText would choose
+// for text at the given error correction level when called without options,
+// so the package-wide defaults (see SetDefaults) limit the input size and the
+// range of versions. Options that change the segments, such as
+// WithNormalization, WithForcedMode or WithOptimalSegments, are not taken
+// into account. It performs only the mode detection and bit counting steps
+// (no segments, matrix, or error correction codewords are built), so it is
+// cheap enough to call on every keystroke.
+func EstimateVersion(text string, ecl ECL) (Version, error) {
+	d := Defaults()
+	if d.MaxInput > 0 && len(text) > d.MaxInput {
+		return 0, &InputTooLargeError{Size: len(text), Limit: d.MaxInput}
+	}
+
+	mode := Byte
+	if text == "" {
+		// EncodeText encodes empty text as an empty byte-mode segment.
+	} else if CanEncodeNumeric(text) {
+		mode = Numeric
+	} else if CanEncodeAlphanumeric(text) {
+		mode = Alphanumeric
+	}
+
+	if version := estimateFit(mode, len(text), ecl, d.MinVersion, d.MaxVersion); version != 0 {
+		return version, nil
+	}
+
+	err := &DataTooLongError{
+		DataBits:     estimateBits(mode, len(text), d.MaxVersion),
+		CapacityBits: numDataCodewords[ecl][d.MaxVersion] * 8,
+		MaxVersion:   d.MaxVersion,
+		ECL:          ecl,
+		SuggestedECL: -1,
+	}
+	if d.MaxVersion < MaxVersion {
+		err.SuggestedVersion = estimateFit(mode, len(text), ecl, d.MaxVersion+1, MaxVersion)
+	}
+	for e := ecl - 1; e >= Low; e-- {
+		if estimateFit(mode, len(text), e, d.MinVersion, d.MaxVersion) != 0 {
+			err.SuggestedECL = e
+			break
+		}
+	}
+
+	return 0, err
+}
+
+// estimateFit returns the minimal version in [minVersion, maxVersion] that can
+// hold numChars characters in the given mode, or 0 if none can.
+func estimateFit(mode Mode, numChars int, ecl ECL, minVersion, maxVersion Version) Version {
+	for v := minVersion; v <= maxVersion; v++ {
+		used := estimateBits(mode, numChars, v)
+		if used != -1 && used <= numDataCodewords[ecl][v]*8 {
+			return v
+		}
+	}
+
+	return 0
+}
+
+// estimateBits returns the number of bits needed to encode a single segment of
+// numChars characters in the given mode, or -1 if the character count does not
+// fit in the count field for the version.
+func estimateBits(mode Mode, numChars int, version Version) int {
+	ccBits := mode.numCharCountBits(version)
+	if numChars >= 1<<ccBits {
+		return -1
+	}
+
+	var dataBits int
+	switch mode {
+	case Numeric:
+		dataBits = numChars/3*10 + [3]int{0, 4, 7}[numChars%3]
+	case Alphanumeric:
+		dataBits = numChars/2*11 + numChars%2*6
+	case kanji:
+		dataBits = numChars * 13
+	default:
+		dataBits = numChars * 8
+	}
+
+	return 4 + int(ccBits) + dataBits
+}
@@ -0,0 +1,163 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"strings"
+)
+
+// GalleryOptions controls the contact sheets made by WriteGallerySVG and
+// GalleryImage.
+type GalleryOptions struct {
+	Themes  []Theme       // Base themes (default the built-in themes in ThemeNames order).
+	Shapes  []ModuleShape // Module shapes to combine with each theme (default all).
+	Eyes    []EyeShape    // Eye shapes to combine with each theme (default all).
+	Columns int           // Cells per row (default the number of shape and eye combinations).
+	Gap     int           // Space between cells in modules (default 2).
+	Scale   int           // Pixels per module for GalleryImage (default 4).
+}
+
+func (opts GalleryOptions) withDefaults() GalleryOptions {
+	if len(opts.Themes) == 0 {
+		for _, name := range ThemeNames() {
+			opts.Themes = append(opts.Themes, themes[name])
+		}
+	}
+	if len(opts.Shapes) == 0 {
+		opts.Shapes = []ModuleShape{ShapeSquare, ShapeDot, ShapeRounded}
+	}
+	if len(opts.Eyes) == 0 {
+		opts.Eyes = []EyeShape{EyeSquare, EyeRounded, EyeCircle}
+	}
+	if opts.Columns <= 0 {
+		opts.Columns = len(opts.Shapes) * len(opts.Eyes)
+	}
+	if opts.Gap <= 0 {
+		opts.Gap = 2
+	}
+	if opts.Scale <= 0 {
+		opts.Scale = 4
+	}
+
+	return opts
+}
+
+// GalleryThemes returns the themes shown by a gallery: every base theme
+// combined with every module and eye shape, in row-major order. Each is named
+// "theme/shape/eye".
+func GalleryThemes(opts GalleryOptions) []Theme {
+	opts = opts.withDefaults()
+	var result []Theme
+	for _, base := range opts.Themes {
+		for _, shape := range opts.Shapes {
+			for _, eye := range opts.Eyes {
+				t := base
+				t.Name = fmt.Sprintf("%s/%s/%s", base.Name, shape, eye)
+				t.Shape, t.Eye = shape, eye
+				result = append(result, t)
+			}
+		}
+	}
+
+	return result
+}
+
+// galleryLayout returns the side of a cell in modules (the largest themed
+// symbol) and the number of rows.
+func galleryLayout(q *QRCode, cells []Theme, opts GalleryOptions) (cell, rows int) {
+	for _, t := range cells {
+		cell = max(cell, q.Size+2*t.margin())
+	}
+
+	return cell, (len(cells) + opts.Columns - 1) / opts.Columns
+}
+
+// WriteGallerySVG writes a contact sheet of q rendered with every theme of
+// GalleryThemes, each captioned with its name, as a standalone SVG document.
+// It is meant for choosing a style and for checking the styling code for
+// regressions; themes that fail their scannability checks stop it with an
+// error unless their Strictness allows them.
+func WriteGallerySVG(w io.Writer, q *QRCode, opts GalleryOptions) error {
+	opts = opts.withDefaults()
+	cells := GalleryThemes(opts)
+	cell, rows := galleryLayout(q, cells, opts)
+	captionHeight := 3 // Modules below each cell for the caption.
+	pitchX, pitchY := cell+opts.Gap, cell+captionHeight+opts.Gap
+	width := opts.Columns*pitchX + opts.Gap
+	height := rows*pitchY + opts.Gap
+
+	var sb strings.Builder
+	sb.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(&sb, "<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\" version=\"1.1\" viewBox=\"0 0 %d %d\">\n", width, height)
+	sb.WriteString("\t<rect width=\"100%\" height=\"100%\" fill=\"#FFFFFF\"/>\n")
+	for i, t := range cells {
+		svg, err := t.ToSVGString(q, false)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.Name, err)
+		}
+		side := q.Size + 2*t.margin()
+		x := opts.Gap + i%opts.Columns*pitchX + (cell-side)/2
+		y := opts.Gap + i/opts.Columns*pitchY + (cell-side)/2
+		// Position the theme's document as a nested <svg> element.
+		svg = strings.Replace(svg, "<svg ", fmt.Sprintf("<svg x=\"%d\" y=\"%d\" width=\"%[3]d\" height=\"%[3]d\" ", x, y, side), 1)
+		sb.WriteString(svg)
+		fmt.Fprintf(&sb, "\t<text x=\"%s\" y=\"%d\" font-family=\"sans-serif\" font-size=\"1.6\" text-anchor=\"middle\">%s</text>\n",
+			formatFloat(float64(opts.Gap+i%opts.Columns*pitchX)+float64(cell)/2, -1), opts.Gap+i/opts.Columns*pitchY+cell+2, html.EscapeString(t.Name))
+	}
+	sb.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// GalleryImage renders the same contact sheet as WriteGallerySVG as a raster
+// image, without captions; the cells are in GalleryThemes order.
+func GalleryImage(q *QRCode, opts GalleryOptions) (*image.NRGBA, error) {
+	opts = opts.withDefaults()
+	cells := GalleryThemes(opts)
+	cell, rows := galleryLayout(q, cells, opts)
+	pitch := (cell + opts.Gap) * opts.Scale
+	gap := opts.Gap * opts.Scale
+
+	img := image.NewNRGBA(image.Rect(0, 0, opts.Columns*pitch+gap, rows*pitch+gap))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for i, t := range cells {
+		themed, err := t.ToImage(q, opts.Scale)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Name, err)
+		}
+		offset := (cell*opts.Scale - themed.Bounds().Dx()) / 2
+		origin := image.Pt(gap+i%opts.Columns*pitch+offset, gap+i/opts.Columns*pitch+offset)
+		draw.Draw(img, themed.Bounds().Add(origin), themed, image.Point{}, draw.Src)
+	}
+
+	return img, nil
+}
@@ -1,7 +1,9 @@
 module github.com/grkuntzmd/qrcodegen
 
-go 1.14
+go 1.16
 
 require (
 	github.com/stretchr/testify v1.5.1
+	golang.org/x/text v0.3.8
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,94 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"crypto/sha256"
+	"hash"
+)
+
+// hashFormat identifies the layout of the bytes fed to the hash in Hash. It
+// is bumped if the layout ever changes so that old and new hashes never
+// collide.
+const hashFormat = 1
+
+// Hash returns a SHA-256 digest of the QR code's version, error correction
+// level, mask and modules. Two QR codes have the same hash exactly when they
+// render identically, so the hash can be used as a content address for
+// rendered assets (cache keys, ETags, CDN paths) and to detect when
+// regeneration is actually needed.
+func (q *QRCode) Hash() [32]byte {
+	h := newModuleHasher(q.Version, q.ErrorCorrectionLevel, q.Mask)
+	for _, row := range q.Modules {
+		h.writeRow(row)
+	}
+
+	return h.sum()
+}
+
+// moduleHasher computes Hash incrementally, one row of modules at a time, for
+// encodes that never hold the whole matrix.
+type moduleHasher struct {
+	h   hash.Hash
+	buf []byte
+	cur byte
+	n   int
+}
+
+// newModuleHasher starts the hash of a QR code with the given header fields.
+func newModuleHasher(version Version, ecl ECL, mask Mask) *moduleHasher {
+	h := &moduleHasher{h: sha256.New()}
+	h.h.Write([]byte{hashFormat, byte(version), byte(ecl), byte(mask)})
+
+	return h
+}
+
+// writeRow adds a row of modules, packed 8 to a byte, most significant bit
+// first, continuing the packing across rows.
+func (h *moduleHasher) writeRow(row []Module) {
+	h.buf = h.buf[:0]
+	for _, m := range row {
+		h.cur = h.cur<<1 | byte(m&1)
+		h.n++
+		if h.n == 8 {
+			h.buf = append(h.buf, h.cur)
+			h.cur, h.n = 0, 0
+		}
+	}
+	h.h.Write(h.buf)
+}
+
+// sum flushes any partial byte and returns the digest.
+func (h *moduleHasher) sum() [32]byte {
+	if h.n > 0 {
+		h.h.Write([]byte{h.cur << (8 - h.n)})
+		h.cur, h.n = 0, 0
+	}
+
+	var digest [32]byte
+	copy(digest[:], h.h.Sum(nil))
+
+	return digest
+}
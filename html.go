@@ -0,0 +1,169 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// HTMLLayout selects the markup written by ToHTML.
+type HTMLLayout int8
+
+// HTML layouts.
+const (
+	// HTMLGrid is a CSS grid of div elements, which scales with the width
+	// of the symbol.
+	HTMLGrid HTMLLayout = iota
+	// HTMLTable is a table of fixed size cells, for email clients without
+	// CSS grid support.
+	HTMLTable
+)
+
+// HTMLOptions controls ToHTML.
+type HTMLOptions struct {
+	Layout     HTMLLayout
+	Border     int    // Quiet zone in modules (default 4; negative for none).
+	ModuleSize int    // Module size in CSS pixels (default 4).
+	Width      string // CSS width of a grid, such as "100%" or "12em" (default the module size times the modules).
+	Dark       string // CSS color of dark modules (default "#000").
+	Light      string // CSS color of light modules (default "#fff").
+
+	// Class, if set, is added to the outer element, and Class-dark and
+	// Class-light to the modules, as hooks for a stylesheet. The inline
+	// styles are still written, so the markup works without one.
+	Class string
+}
+
+var cssLength = regexp.MustCompile(`^[A-Za-z0-9.%() +*/-]+$`)
+
+// ToHTML renders the QR code as HTML elements with inline styles, needing
+// neither images nor a stylesheet. Horizontal runs of modules of one color
+// are merged into a single element spanning them.
+func (q *QRCode) ToHTML(opts HTMLOptions) (string, error) {
+	if opts.Border == 0 {
+		opts.Border = 4
+	} else if opts.Border < 0 {
+		opts.Border = 0
+	}
+	if opts.ModuleSize == 0 {
+		opts.ModuleSize = 4
+	}
+	if opts.Dark == "" {
+		opts.Dark = "#000"
+	}
+	if opts.Light == "" {
+		opts.Light = "#fff"
+	}
+	grid := q.borderedGrid(opts.Border)
+	if opts.Width == "" {
+		opts.Width = fmt.Sprintf("%dpx", grid.size*opts.ModuleSize)
+	}
+	if opts.ModuleSize < 1 {
+		return "", fmt.Errorf("module size must be positive")
+	}
+	if !cssColor.MatchString(opts.Dark) || !cssColor.MatchString(opts.Light) {
+		return "", fmt.Errorf("invalid CSS color")
+	}
+	if !cssLength.MatchString(opts.Width) {
+		return "", fmt.Errorf("invalid CSS width %q", opts.Width)
+	}
+	if opts.Class != "" && !cssClass.MatchString(opts.Class) {
+		return "", fmt.Errorf("invalid CSS class %q", opts.Class)
+	}
+
+	classes := [2]string{}
+	outer := ""
+	if opts.Class != "" {
+		classes = [2]string{fmt.Sprintf(` class="%s-light"`, opts.Class), fmt.Sprintf(` class="%s-dark"`, opts.Class)}
+		outer = fmt.Sprintf(` class="%s"`, opts.Class)
+	}
+
+	var sb strings.Builder
+	switch opts.Layout {
+	case HTMLGrid:
+		fmt.Fprintf(&sb, `<div%s role="img" aria-label="QR code" style="display:grid;grid-template-columns:repeat(%[2]d,1fr);grid-template-rows:repeat(%[2]d,1fr);width:%s;aspect-ratio:1/1;background:%s">`,
+			outer, grid.size, opts.Width, opts.Light)
+		grid.runs(func(_, _, n int, c uint8) {
+			style := ""
+			if n > 1 {
+				style = fmt.Sprintf("grid-column:span %d", n)
+			}
+			if c == 1 {
+				style = strings.TrimPrefix(style+";background:"+opts.Dark, ";")
+			}
+			if style != "" {
+				style = fmt.Sprintf(` style="%s"`, style)
+			}
+			fmt.Fprintf(&sb, "<div%s%s></div>", classes[c], style)
+		}, nil)
+		sb.WriteString("</div>")
+	case HTMLTable:
+		m := opts.ModuleSize
+		fmt.Fprintf(&sb, `<table%s role="img" aria-label="QR code" cellpadding="0" cellspacing="0" border="0" style="border-collapse:collapse;background:%s">`,
+			outer, opts.Light)
+		grid.runs(func(x, _, n int, c uint8) {
+			if x == 0 {
+				sb.WriteString("<tr>")
+			}
+			span := ""
+			if n > 1 {
+				span = fmt.Sprintf(` colspan="%d"`, n)
+			}
+			background := ""
+			if c == 1 {
+				background = ";background:" + opts.Dark
+			}
+			fmt.Fprintf(&sb, `<td%s%s style="width:%dpx;height:%dpx;padding:0%s"></td>`, classes[c], span, n*m, m, background)
+		}, func() {
+			sb.WriteString("</tr>")
+		})
+		sb.WriteString("</table>")
+	default:
+		return "", fmt.Errorf("unknown HTML layout %d", opts.Layout)
+	}
+
+	return sb.String(), nil
+}
+
+// runs calls run for each horizontal run of cells of one color, in order,
+// with its start, length, and color, and endRow, if not nil, after each row.
+func (g moduleGrid) runs(run func(x, y, n int, c uint8), endRow func()) {
+	for y := 0; y < g.size; y++ {
+		row := g.cells[y*g.size : (y+1)*g.size]
+		for x := 0; x < g.size; {
+			n := 1
+			for x+n < g.size && row[x+n] == row[x] {
+				n++
+			}
+			run(x, y, n, row[x])
+			x += n
+		}
+		if endRow != nil {
+			endRow()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ITerm2Options controls ITerm2.
+type ITerm2Options struct {
+	PNGOptions
+
+	// Tmux wraps the sequence in tmux's passthrough escape, which tmux
+	// forwards to iTerm2 if its allow-passthrough option is on.
+	Tmux bool
+}
+
+// ITerm2 writes the QR code to w as a PNG image in iTerm2's inline image
+// escape sequence (OSC 1337), followed by a newline. The image is shown at
+// its own pixel size, so modules stay sharp.
+func (q *QRCode) ITerm2(w io.Writer, opts ITerm2Options) error {
+	var img bytes.Buffer
+	if err := q.WritePNG(&img, opts.PNGOptions); err != nil {
+		return err
+	}
+
+	seq := fmt.Sprintf("\x1b]1337;File=inline=1;size=%d;preserveAspectRatio=1:%s\a",
+		img.Len(), base64.StdEncoding.EncodeToString(img.Bytes()))
+	if opts.Tmux {
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	_, err := io.WriteString(w, seq+"\n")
+
+	return err
+}
@@ -0,0 +1,140 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import "sync"
+
+// modulePos is the position of one module in the matrix.
+type modulePos struct {
+	x, y uint8
+}
+
+// layouts caches the payload-independent parts of each version: the drawn
+// function patterns and the order in which codeword bits are placed.
+var layouts [MaxVersion + 1]struct {
+	once      sync.Once
+	template  *QRCode     // Function patterns drawn with ECL Low and mask 0 format bits.
+	positions []modulePos // The codeword placement plan.
+
+	indexOnce sync.Once
+	index     []uint16 // The inverse of the plan: the bit index of each module, row by row.
+}
+
+// layout computes the cached layout of a version on first use.
+func layout(version Version) *QRCode {
+	l := &layouts[version]
+	l.once.Do(func() {
+		q := newBlankQRCode(version, Low)
+		q.drawFunctionPatterns()
+		l.template = q
+		l.positions = computeCodewordPlan(q)
+	})
+
+	return l.template
+}
+
+// newQRCodeFromTemplate returns a QR code of the given version and error
+// correction level with its function patterns drawn (format bits for mask 0),
+// cloned from the cached template rather than drawn afresh. Rows share two
+// backing arrays, one for modules and one for the function map.
+func newQRCodeFromTemplate(version Version, ecl ECL) *QRCode {
+	t := layout(version)
+	size := t.Size
+	q := &QRCode{
+		Version:              version,
+		Size:                 size,
+		ErrorCorrectionLevel: ecl,
+		Modules:              make([][]Module, size),
+		isFunction:           make([][]bool, size),
+	}
+	modules := make([]Module, size*size)
+	isFunction := make([]bool, size*size)
+	for y := 0; y < size; y++ {
+		q.Modules[y] = modules[y*size : (y+1)*size : (y+1)*size]
+		copy(q.Modules[y], t.Modules[y])
+		q.isFunction[y] = isFunction[y*size : (y+1)*size : (y+1)*size]
+		copy(q.isFunction[y], t.isFunction[y])
+	}
+	if ecl != Low {
+		q.drawFormatBits(0)
+	}
+
+	return q
+}
+
+// codewordPlan returns the positions of the data modules of a version in the
+// zig-zag order in which codeword bits are placed: pairs of columns from the
+// right, alternately upward and downward, skipping the vertical timing
+// pattern and every function module. The plan includes the remainder bits at
+// the end, and is computed once per version.
+func codewordPlan(version Version) []modulePos {
+	layout(version)
+	return layouts[version].positions
+}
+
+// computeCodewordPlan walks the zig-zag scan over q, which must have its
+// function patterns drawn.
+func computeCodewordPlan(q *QRCode) []modulePos {
+	positions := make([]modulePos, 0, numRawDataModules[q.Version])
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < q.Size; vert++ {
+			y := vert
+			if upward {
+				y = q.Size - 1 - vert
+			}
+			for x := right; x >= right-1; x-- {
+				if !q.isFunction[y][x] {
+					positions = append(positions, modulePos{uint8(x), uint8(y)})
+				}
+			}
+		}
+	}
+	if len(positions) != numRawDataModules[q.Version] {
+		panic("incorrect layout plan")
+	}
+
+	return positions
+}
+
+// codewordIndex returns, for each module of a version row by row, the index of
+// the codeword bit placed there by codewordPlan. Entries of function modules
+// are meaningless. The index is computed once per version, and only for
+// versions that are streamed.
+func codewordIndex(version Version) []uint16 {
+	size := layout(version).Size
+	l := &layouts[version]
+	l.indexOnce.Do(func() {
+		l.index = make([]uint16, size*size)
+		for i, p := range l.positions {
+			l.index[int(p.y)*size+int(p.x)] = uint16(i)
+		}
+	})
+
+	return l.index
+}
@@ -0,0 +1,261 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+)
+
+// Logo describes a logo placed in the center of a symbol. The modules under
+// the logo are cleared, and the symbol is read with the help of its error
+// correction, so a logo is only accepted if the codewords it covers stay
+// within the correction capacity of every block.
+type Logo struct {
+	Width, Height int         // Size of the cleared area in modules (default 20% of the symbol width, with the aspect ratio of Image).
+	Image         image.Image // Drawn in the area by LogoSymbol.WritePNG.
+	Href          string      // URL of the logo drawn in the area by LogoSymbol.WriteSVG.
+
+	// MaxDamage is the fraction, in (0, 1], of the correction capacity of
+	// each block that the logo may use (default 0.5). The rest is left for
+	// print defects, glare, and scanning at an angle.
+	MaxDamage float64
+}
+
+// LogoSymbol is a symbol with a centered area cleared for a logo, returned by
+// QRCode.WithLogo.
+type LogoSymbol struct {
+	*QRCode                 // The symbol with the modules under the logo cleared.
+	Logo    Logo            // The logo, with its size filled in.
+	Area    image.Rectangle // The cleared area, in modules.
+	Damage  float64         // The largest fraction of the correction capacity of a block used by the logo.
+}
+
+// WithLogo returns a copy of q with a centered area cleared for the logo. The
+// area is widened by one module where needed to center it exactly. It must not
+// cover the finder, timing, format, or version patterns; covering alignment
+// patterns is allowed. If the codewords under the area exceed the logo's share
+// of the error correction of any block, WithLogo returns a *LogoError, and a
+// higher error correction level or a smaller logo is needed.
+func (q *QRCode) WithLogo(logo Logo) (*LogoSymbol, error) {
+	if q.Micro {
+		return nil, fmt.Errorf("logos are not supported in micro QR symbols")
+	}
+	if logo.MaxDamage == 0 {
+		logo.MaxDamage = 0.5
+	}
+	if logo.MaxDamage < 0 || logo.MaxDamage > 1 {
+		return nil, fmt.Errorf("logo damage must be in (0, 1]")
+	}
+	if logo.Width < 0 || logo.Height < 0 || (logo.Width == 0) != (logo.Height == 0) {
+		return nil, fmt.Errorf("logo width and height must both be positive or both be zero")
+	}
+	if logo.Width == 0 {
+		logo.Width = int(math.Round(0.2 * float64(q.Size)))
+		logo.Height = logo.Width
+		if logo.Image != nil && !logo.Image.Bounds().Empty() {
+			b := logo.Image.Bounds()
+			logo.Height = max(1, int(math.Round(float64(logo.Width*b.Dy())/float64(b.Dx()))))
+		}
+	}
+	logo.Width += (q.Size - logo.Width) & 1
+	logo.Height += (q.Size - logo.Height) & 1
+	if logo.Width > q.Size || logo.Height > q.Size {
+		return nil, fmt.Errorf("logo of %dx%d modules does not fit in a symbol of %d", logo.Width, logo.Height, q.Size)
+	}
+	x0, y0 := (q.Size-logo.Width)/2, (q.Size-logo.Height)/2
+	area := image.Rect(x0, y0, x0+logo.Width, y0+logo.Height)
+
+	template := layout(q.Version)
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if template.isFunction[y][x] && !inAlignmentPattern(q.Version, x, y) {
+				return nil, fmt.Errorf("logo of %dx%d modules covers function patterns", logo.Width, logo.Height)
+			}
+		}
+	}
+
+	damage, err := logoDamage(q.Version, q.ErrorCorrectionLevel, area, logo.MaxDamage)
+	if err != nil {
+		return nil, err
+	}
+
+	cleared := &QRCode{
+		Version:              q.Version,
+		Size:                 q.Size,
+		ErrorCorrectionLevel: q.ErrorCorrectionLevel,
+		Mask:                 q.Mask,
+		Modules:              make([][]Module, q.Size),
+	}
+	for y, row := range q.Modules {
+		cleared.Modules[y] = append([]Module(nil), row...)
+		if y >= area.Min.Y && y < area.Max.Y {
+			for x := area.Min.X; x < area.Max.X; x++ {
+				cleared.Modules[y][x] = 0
+			}
+		}
+	}
+
+	return &LogoSymbol{QRCode: cleared, Logo: logo, Area: area, Damage: damage}, nil
+}
+
+// inAlignmentPattern reports whether module (x, y) belongs to one of the
+// alignment patterns of a version.
+func inAlignmentPattern(version Version, x, y int) bool {
+	positions := alignmentPatternPositions[version]
+	last := len(positions) - 1
+	for i, px := range positions {
+		for j, py := range positions {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue // No alignment pattern on the finder corners.
+			}
+			if abs(x-int(px)) <= 2 && abs(y-int(py)) <= 2 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// logoDamage counts the codewords of each block that have a module in area,
+// and returns the largest fraction of a block's correction capacity (half its
+// error correction codewords) that they use, or a *LogoError if a block
+// exceeds maxDamage of its capacity.
+func logoDamage(version Version, ecl ECL, area image.Rectangle, maxDamage float64) (float64, error) {
+	numBlocks := numErrorCorrectionBlocks[ecl][version]
+	blockECCLen := eccCodeWordsPerBlock[ecl][version]
+	rawCodeWords := numRawDataModules[version] / 8
+	numShortBlocks := numBlocks - rawCodeWords%numBlocks
+	shortBlockLen := rawCodeWords / numBlocks
+
+	// Map each codeword, in placement order, to its block, following the
+	// interleaving of addECCAndInterleave.
+	blockOf := make([]int, 0, rawCodeWords)
+	for i := 0; i < shortBlockLen+1; i++ {
+		for j := 0; j < numBlocks; j++ {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				blockOf = append(blockOf, j)
+			}
+		}
+	}
+
+	damaged := make([]bool, rawCodeWords)
+	for i, p := range codewordPlan(version) {
+		if i>>3 < rawCodeWords && image.Pt(int(p.x), int(p.y)).In(area) {
+			damaged[i>>3] = true
+		}
+	}
+	perBlock := make([]int, numBlocks)
+	for i, d := range damaged {
+		if d {
+			perBlock[blockOf[i]]++
+		}
+	}
+
+	capacity := blockECCLen / 2
+	budget := int(maxDamage * float64(capacity))
+	worst := 0.0
+	for j, n := range perBlock {
+		if n > budget {
+			return 0, &LogoError{Block: j, Damaged: n, Budget: budget}
+		}
+		worst = math.Max(worst, float64(n)/float64(capacity))
+	}
+
+	return worst, nil
+}
+
+// WriteSVG writes the symbol as WriteSVG does for a QRCode, with the logo
+// referenced by Href, if any, fitted into the cleared area.
+func (s *LogoSymbol) WriteSVG(w io.Writer, opts SVGOptions) error {
+	if err := opts.normalize(); err != nil {
+		return err
+	}
+
+	overlay := ""
+	if s.Logo.Href != "" {
+		overlay = fmt.Sprintf("\t<image xmlns:xlink=\"http://www.w3.org/1999/xlink\" x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" xlink:href=\"%s\" preserveAspectRatio=\"xMidYMid meet\"/>\n",
+			s.Area.Min.X+opts.Border, s.Area.Min.Y+opts.Border, s.Area.Dx(), s.Area.Dy(), html.EscapeString(s.Logo.Href))
+	}
+
+	return writeWithinBudget(w, opts.MaxBytes, 1+bToI(opts.DocType), func(w io.Writer, level int) error {
+		bw := bufio.NewWriter(w)
+		opts.DocType = opts.DocType && level == 0
+		s.writeSVG(bw, opts, overlay)
+		return bw.Flush()
+	})
+}
+
+// WritePNG writes the symbol as a PNG image with Image, if any, fitted into
+// the cleared area and composited over the light color.
+func (s *LogoSymbol) WritePNG(w io.Writer, opts PNGOptions) error {
+	if s.Logo.Image == nil {
+		return s.QRCode.WritePNG(w, opts)
+	}
+	if err := opts.normalize(s.Size); err != nil {
+		return err
+	}
+
+	return opts.writeWithinBudget(w, func(w io.Writer, enc *pngEncoder, scale int) error {
+		symbol, err := s.ToImage(scale, opts.Border)
+		if err != nil {
+			return err
+		}
+		symbol.Palette = color.Palette{opts.Light, opts.Dark}
+		img := image.NewNRGBA(symbol.Bounds())
+		draw.Draw(img, img.Bounds(), symbol, image.Point{}, draw.Src)
+		s.drawLogo(img, opts.Border, scale)
+		return enc.Encode(w, img)
+	})
+}
+
+// drawLogo draws Image over the cleared area of img, scaled to fit the area
+// with its aspect ratio kept, and centered.
+func (s *LogoSymbol) drawLogo(img draw.Image, border, scale int) {
+	b := s.Logo.Image.Bounds()
+	if b.Empty() {
+		return
+	}
+	area := s.Area.Add(image.Pt(border, border))
+	area = image.Rectangle{area.Min.Mul(scale), area.Max.Mul(scale)}
+	ratio := math.Min(float64(area.Dx())/float64(b.Dx()), float64(area.Dy())/float64(b.Dy()))
+	width := max(1, int(math.Round(float64(b.Dx())*ratio)))
+	height := max(1, int(math.Round(float64(b.Dy())*ratio)))
+	scaled := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			scaled.Set(x, y, s.Logo.Image.At(b.Min.X+x*b.Dx()/width, b.Min.Y+y*b.Dy()/height))
+		}
+	}
+	origin := area.Min.Add(image.Pt((area.Dx()-width)/2, (area.Dy()-height)/2))
+	draw.Draw(img, scaled.Bounds().Add(origin), scaled, image.Point{}, draw.Over)
+}
@@ -0,0 +1,111 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import "fmt"
+
+// PrintMarks adds print production marks around the artwork (the symbol and
+// its quiet zone) of vector output, so that print vendors need not impose
+// the artwork themselves. Distances are in the units of the output: modules
+// for SVG and points for PDF.
+type PrintMarks struct {
+	Bleed        float64 // Distance the light background extends beyond the trim edge.
+	Crop         bool    // Draw crop marks in line with the trim edges at the corners.
+	Registration bool    // Draw registration targets centered outside each side.
+	Offset       float64 // Gap between the bleed edge and the marks (default 2 modules or 8.5 points, 3 mm).
+	Length       float64 // Length of the crop marks and size of the targets (default 4 modules or 14.17 points, 5 mm).
+	Stroke       float64 // Line width of the marks (default 0.1 modules or 0.25 points).
+}
+
+// markGeometry is the layout of print marks around a trim box, as line
+// segments {x1, y1, x2, y2} and circles {cx, cy, r}.
+type markGeometry struct {
+	extent  float64 // Distance from the trim edge to the outer edge of the marks.
+	lines   [][4]float64
+	circles [][3]float64
+}
+
+// normalize fills in the defaults, given in the units of the output, and
+// checks the distances.
+func (m *PrintMarks) normalize(offset, length, stroke float64) error {
+	if m.Offset == 0 {
+		m.Offset = offset
+	}
+	if m.Length == 0 {
+		m.Length = length
+	}
+	if m.Stroke == 0 {
+		m.Stroke = stroke
+	}
+	if m.Bleed < 0 || m.Offset < 0 || m.Length < 0 || m.Stroke < 0 {
+		return fmt.Errorf("print mark distances must be non-negative")
+	}
+
+	return nil
+}
+
+// geometry lays out the marks around the trim box from (x0, y0) to (x1, y1).
+// The layout is symmetric, so it holds whichever way the y axis points.
+func (m PrintMarks) geometry(x0, y0, x1, y1 float64) markGeometry {
+	g := markGeometry{extent: m.Bleed}
+	if !m.Crop && !m.Registration {
+		return g
+	}
+	near := m.Bleed + m.Offset // Distance from the trim edge to the marks.
+	far := near + m.Length
+	g.extent = far
+
+	if m.Crop {
+		for _, x := range []float64{x0, x1} {
+			for _, y := range []float64{y0, y1} {
+				dx, dy := sign(x-(x0+x1)/2), sign(y-(y0+y1)/2)
+				g.lines = append(g.lines,
+					[4]float64{x + dx*near, y, x + dx*far, y},
+					[4]float64{x, y + dy*near, x, y + dy*far})
+			}
+		}
+	}
+	if m.Registration {
+		mid := near + m.Length/2
+		cx, cy := (x0+x1)/2, (y0+y1)/2
+		for _, c := range [][2]float64{{cx, y0 - mid}, {cx, y1 + mid}, {x0 - mid, cy}, {x1 + mid, cy}} {
+			g.lines = append(g.lines,
+				[4]float64{c[0] - m.Length/2, c[1], c[0] + m.Length/2, c[1]},
+				[4]float64{c[0], c[1] - m.Length/2, c[0], c[1] + m.Length/2})
+			g.circles = append(g.circles, [3]float64{c[0], c[1], m.Length / 4})
+		}
+	}
+
+	return g
+}
+
+// sign returns -1 for negative values and 1 otherwise.
+func sign(v float64) float64 {
+	if v < 0 {
+		return -1
+	}
+
+	return 1
+}
@@ -0,0 +1,213 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MatrixFormat selects a textual layout for DumpMatrix. Every format writes
+// one line per row of modules, top to bottom, without a border.
+type MatrixFormat int8
+
+// Matrix formats.
+const (
+	// MatrixBits writes each module as '1' (dark) or '0' (light).
+	MatrixBits MatrixFormat = iota
+	// MatrixHex packs each row into bytes, most significant bit first, padded
+	// with light modules to a multiple of 8, and writes them as upper-case
+	// hex.
+	MatrixHex
+	// MatrixRLE writes each row as space-separated run lengths of
+	// alternating color, starting with light (so the first run may be 0).
+	MatrixRLE
+)
+
+// ParseMatrixFormat parses a matrix format name: "bits", "hex", or "rle".
+func ParseMatrixFormat(s string) (MatrixFormat, error) {
+	switch strings.ToLower(s) {
+	case "bits", "01":
+		return MatrixBits, nil
+	case "hex":
+		return MatrixHex, nil
+	case "rle":
+		return MatrixRLE, nil
+	default:
+		return 0, fmt.Errorf("unknown matrix format %q", s)
+	}
+}
+
+// String returns the name of the matrix format.
+func (f MatrixFormat) String() string {
+	switch f {
+	case MatrixBits:
+		return "bits"
+	case MatrixHex:
+		return "hex"
+	case MatrixRLE:
+		return "rle"
+	default:
+		return fmt.Sprintf("MatrixFormat(%d)", int8(f))
+	}
+}
+
+// DumpMatrix writes the module matrix in a machine-readable format, for test
+// harnesses and programs in other languages. String remains the format for
+// humans.
+func (q *QRCode) DumpMatrix(w io.Writer, format MatrixFormat) error {
+	bw := bufio.NewWriter(w)
+	for _, row := range q.Modules {
+		switch format {
+		case MatrixBits:
+			for _, m := range row {
+				bw.WriteByte('0' + byte(m))
+			}
+		case MatrixHex:
+			for i := 0; i < len(row); i += 8 {
+				var b byte
+				for j := 0; j < 8; j++ {
+					b <<= 1
+					if i+j < len(row) {
+						b |= byte(row[i+j])
+					}
+				}
+				fmt.Fprintf(bw, "%02X", b)
+			}
+		case MatrixRLE:
+			color, run := Module(0), 0
+			for _, m := range row {
+				if m != color {
+					bw.WriteString(strconv.Itoa(run))
+					bw.WriteByte(' ')
+					color, run = m, 0
+				}
+				run++
+			}
+			bw.WriteString(strconv.Itoa(run))
+		default:
+			return fmt.Errorf("unknown matrix format %d", format)
+		}
+		bw.WriteByte('\n')
+	}
+
+	return bw.Flush()
+}
+
+// ParseMatrix reads a matrix written by DumpMatrix and reconstructs the QR
+// code: the version is inferred from the number of rows, and the error
+// correction level and mask are read from the format bits. Blank lines and
+// lines starting with '#' are ignored, so golden files may carry comments.
+func ParseMatrix(r io.Reader, format MatrixFormat) (*QRCode, error) {
+	var rows []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<16)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		rows = append(rows, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	size := len(rows)
+	if size < 21 || size > 177 || (size-17)%4 != 0 {
+		return nil, fmt.Errorf("invalid symbol size %d", size)
+	}
+
+	q := &QRCode{
+		Version: Version((size - 17) / 4),
+		Size:    size,
+		Modules: make([][]Module, size),
+	}
+	for y, line := range rows {
+		row, err := parseMatrixRow(line, size, format)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", y+1, err)
+		}
+		q.Modules[y] = row
+	}
+
+	ecl, mask, err := readFormatBits(q.Modules)
+	if err != nil {
+		return nil, err
+	}
+	q.ErrorCorrectionLevel = ecl
+	q.Mask = mask
+
+	return q, nil
+}
+
+// parseMatrixRow parses one line of a matrix dump into size modules.
+func parseMatrixRow(line string, size int, format MatrixFormat) ([]Module, error) {
+	row := make([]Module, 0, size)
+	switch format {
+	case MatrixBits:
+		for i := 0; i < len(line); i++ {
+			if line[i] != '0' && line[i] != '1' {
+				return nil, fmt.Errorf("invalid character %q", line[i])
+			}
+			row = append(row, Module(line[i]-'0'))
+		}
+	case MatrixHex:
+		if len(line) != (size+7)/8*2 {
+			return nil, fmt.Errorf("expected %d hex digits, found %d", (size+7)/8*2, len(line))
+		}
+		for i := 0; i < len(line); i += 2 {
+			b, err := strconv.ParseUint(line[i:i+2], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex %q", line[i:i+2])
+			}
+			for j := 7; j >= 0 && len(row) < size; j-- {
+				row = append(row, Module(b>>uint(j)&1))
+			}
+		}
+	case MatrixRLE:
+		color := Module(0)
+		for _, field := range strings.Fields(line) {
+			n, err := strconv.Atoi(field)
+			if err != nil || n < 0 || len(row)+n > size {
+				return nil, fmt.Errorf("invalid run %q", field)
+			}
+			for i := 0; i < n; i++ {
+				row = append(row, color)
+			}
+			color ^= 1
+		}
+	default:
+		return nil, fmt.Errorf("unknown matrix format %d", format)
+	}
+	if len(row) != size {
+		return nil, fmt.Errorf("expected %d modules, found %d", size, len(row))
+	}
+
+	return row, nil
+}
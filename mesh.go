@@ -0,0 +1,540 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MeshOptions configures ToMesh. Lengths are in the units of the printer,
+// usually millimeters.
+type MeshOptions struct {
+	ModuleSize    float64 // Width of a module (0 is treated as 1).
+	BaseThickness float64 // Thickness of the base plate under the whole symbol and border (0 for no plate).
+	ModuleHeight  float64 // Height of the dark modules above the plate (0 is treated as 1).
+	Chamfer       float64 // Inset of the top edges of each raised region (less than half the module size).
+	Border        int     // Quiet zone in modules included in the base plate.
+}
+
+// Mesh is a triangle mesh. Faces index into Vertices and are wound
+// counter-clockwise when seen from outside.
+type Mesh struct {
+	Vertices [][3]float64
+	Faces    [][3]int
+}
+
+// ToMesh extrudes the dark modules into a 3D mesh standing on an optional base
+// plate, for 3D-printing tactile QR tags. Adjacent dark modules are merged into
+// a single solid, so the chamfer follows the outline of each dark region, and
+// the result is one closed, manifold surface (or, with no plate, one per dark
+// region). Coplanar faces are merged to keep the triangle count low. The symbol
+// reads correctly when viewed from above (+z), with x to the right and y up.
+func (q *QRCode) ToMesh(opts MeshOptions) (*Mesh, error) {
+	moduleSize := opts.ModuleSize
+	if moduleSize == 0 {
+		moduleSize = 1
+	}
+	height := opts.ModuleHeight
+	if height == 0 {
+		height = 1
+	}
+	if moduleSize < 0 || height < 0 || opts.BaseThickness < 0 || opts.Border < 0 {
+		return nil, fmt.Errorf("mesh dimensions must be non-negative")
+	}
+	if opts.Chamfer < 0 || opts.Chamfer*2 >= moduleSize {
+		return nil, fmt.Errorf("chamfer must be in [0, module size / 2)")
+	}
+
+	b := newMeshBuilder(q, opts.Border, moduleSize, opts.Chamfer, opts.BaseThickness, height)
+	b.build()
+	b.mesh.splitPinches()
+
+	return b.mesh, nil
+}
+
+// meshBuilder triangulates the top of the symbol as a height field sampled on
+// a lattice with lines at every module edge and at the chamfer inset on either
+// side of it. A lattice point is raised when every module it touches is dark,
+// so the slopes between raised and lowered points form the chamfer. With no
+// chamfer the inset lines coincide with the module edges, the strips between
+// them have zero width, and their triangles become vertical walls.
+type meshBuilder struct {
+	pos       []float64 // Coordinate of each lattice line, along either axis.
+	n         int       // Lattice lines per axis.
+	low, high float64   // Heights of the plate (or 0) and of the dark modules.
+	plate     bool
+	heights   []float64 // Height of each lattice point, row-major with y up.
+	parent    []int     // Union-find over lattice points and then their copies on the bottom.
+	vertex    []int     // Vertex index of each union-find root, or -1.
+	kept      []bool    // Lattice points that are corners of some face.
+	mesh      *Mesh
+}
+
+// meshPiece is a run of lattice cells [a, b) in a strip, which is either level
+// along the strip, rising from height h0 on one side to h1 on the other (flat
+// if they are equal), or a single cell sloping both ways.
+type meshPiece struct {
+	a, b   int
+	level  bool
+	h0, h1 float64
+}
+
+func newMeshBuilder(q *QRCode, border int, moduleSize, chamfer, base, height float64) *meshBuilder {
+	cells := q.Size + border*2
+	b := &meshBuilder{
+		n:     cells*3 + 1,
+		low:   base,
+		high:  base + height,
+		plate: base > 0,
+		mesh:  &Mesh{},
+	}
+	for k := 0; k < cells; k++ {
+		x := float64(k) * moduleSize
+		b.pos = append(b.pos, x, x+chamfer, x+moduleSize-chamfer)
+	}
+	b.pos = append(b.pos, float64(cells)*moduleSize)
+
+	// Lattice line 3k is the edge before cell k; 3k+1 and 3k+2 lie inside it.
+	touched := func(i int) (int, int) {
+		if i%3 == 0 {
+			return i/3 - 1, i / 3
+		}
+		return i / 3, i / 3
+	}
+	dark := func(cx, cy int) bool {
+		x, y := cx-border, cells-1-cy-border // Module row 0 is at the top.
+		return x >= 0 && x < q.Size && y >= 0 && y < q.Size && q.Modules[y][x] == 1
+	}
+	b.heights = make([]float64, b.n*b.n)
+	for j := 0; j < b.n; j++ {
+		y0, y1 := touched(j)
+		for i := 0; i < b.n; i++ {
+			x0, x1 := touched(i)
+			h := b.high
+			for cy := y0; cy <= y1; cy++ {
+				for cx := x0; cx <= x1; cx++ {
+					if !dark(cx, cy) {
+						h = b.low
+					}
+				}
+			}
+			b.heights[j*b.n+i] = h
+		}
+	}
+
+	// Coincident lattice points at the same height are the same vertex, as are
+	// all coincident points on the bottom. With no plate the lowered points
+	// lie on the bottom too.
+	total := b.n * b.n
+	b.parent = make([]int, total*2)
+	for i := range b.parent {
+		b.parent[i] = i
+	}
+	for j := 0; j < b.n; j++ {
+		for i := 0; i < b.n; i++ {
+			p := j*b.n + i
+			if i+1 < b.n && b.pos[i] == b.pos[i+1] {
+				if b.heights[p] == b.heights[p+1] {
+					b.union(p, p+1)
+				}
+				b.union(total+p, total+p+1)
+			}
+			if j+1 < b.n && b.pos[j] == b.pos[j+1] {
+				if b.heights[p] == b.heights[p+b.n] {
+					b.union(p, p+b.n)
+				}
+				b.union(total+p, total+p+b.n)
+			}
+			if !b.plate && b.heights[p] == b.low {
+				b.union(p, total+p)
+			}
+		}
+	}
+	b.vertex = make([]int, total*2)
+	for i := range b.vertex {
+		b.vertex[i] = -1
+	}
+
+	return b
+}
+
+func (b *meshBuilder) find(p int) int {
+	for b.parent[p] != p {
+		b.parent[p] = b.parent[b.parent[p]]
+		p = b.parent[p]
+	}
+	return p
+}
+
+func (b *meshBuilder) union(p, q int) {
+	b.parent[b.find(p)] = b.find(q)
+}
+
+// height returns the height of lattice point (i, j).
+func (b *meshBuilder) height(i, j int) float64 {
+	return b.heights[j*b.n+i]
+}
+
+// pieces splits strip j, between lattice rows j and j+1, into runs of
+// coplanar level cells and single cells sloping both ways.
+func (b *meshBuilder) pieces(j int) []meshPiece {
+	var pieces []meshPiece
+	for i := 0; i+1 < b.n; i++ {
+		h0, h1 := b.height(i, j), b.height(i, j+1)
+		level := h0 == b.height(i+1, j) && h1 == b.height(i+1, j+1)
+		if last := len(pieces) - 1; level && last >= 0 && pieces[last].level && pieces[last].h0 == h0 && pieces[last].h1 == h1 {
+			pieces[last].b = i + 1
+			continue
+		}
+		pieces = append(pieces, meshPiece{a: i, b: i + 1, level: level, h0: h0, h1: h1})
+	}
+
+	return pieces
+}
+
+// footprint merges the pieces of a strip that are raised or sloped into the
+// runs that need a bottom when there is no plate.
+func (b *meshBuilder) footprint(pieces []meshPiece) []meshPiece {
+	var runs []meshPiece
+	for _, p := range pieces {
+		if p.level && p.h0 == b.low && p.h1 == b.low {
+			continue
+		}
+		if last := len(runs) - 1; last >= 0 && runs[last].b == p.a {
+			runs[last].b = p.b
+			continue
+		}
+		runs = append(runs, meshPiece{a: p.a, b: p.b, level: true})
+	}
+
+	return runs
+}
+
+func (b *meshBuilder) build() {
+	strips := make([][]meshPiece, b.n-1)
+	bottoms := make([][]meshPiece, b.n-1)
+	for j := range strips {
+		strips[j] = b.pieces(j)
+		if !b.plate {
+			bottoms[j] = b.footprint(strips[j])
+		}
+	}
+
+	// A lattice point is kept if a piece on either side of its row starts or
+	// ends there. Coincident rows share their kept points so that the faces
+	// on either side of a zero-width strip meet edge to edge.
+	b.kept = make([]bool, b.n*b.n)
+	for j := range strips {
+		for _, list := range [][]meshPiece{strips[j], bottoms[j]} {
+			for _, p := range list {
+				for _, row := range []int{j, j + 1} {
+					b.kept[row*b.n+p.a] = true
+					b.kept[row*b.n+p.b] = true
+				}
+			}
+		}
+	}
+	for j := 0; j+1 < b.n; j++ {
+		if b.pos[j] == b.pos[j+1] {
+			for i := 0; i < b.n; i++ {
+				b.kept[(j+1)*b.n+i] = b.kept[(j+1)*b.n+i] || b.kept[j*b.n+i]
+			}
+		}
+	}
+	for j := b.n - 2; j >= 0; j-- {
+		if b.pos[j] == b.pos[j+1] {
+			for i := 0; i < b.n; i++ {
+				b.kept[j*b.n+i] = b.kept[j*b.n+i] || b.kept[(j+1)*b.n+i]
+			}
+		}
+	}
+
+	total := b.n * b.n
+	for j, pieces := range strips {
+		zero := b.pos[j] == b.pos[j+1]
+		for _, p := range pieces {
+			switch {
+			case !p.level:
+				b.addCell(p.a, j)
+			case p.h0 == p.h1 && (zero || !b.plate && p.h0 == b.low):
+				// Collapsed, or outside the solid.
+			default:
+				bottom, bx := b.chain(j, p.a, p.b, 0)
+				top, tx := b.chain(j+1, p.a, p.b, 0)
+				b.zip(bottom, bx, top, tx, false)
+			}
+		}
+		if zero {
+			continue
+		}
+		for _, p := range bottoms[j] {
+			bottom, bx := b.chain(j, p.a, p.b, total)
+			top, tx := b.chain(j+1, p.a, p.b, total)
+			b.zip(bottom, bx, top, tx, true)
+		}
+	}
+	if !b.plate {
+		return
+	}
+
+	// The plate has a flat bottom and four walls up to the edge of the top,
+	// each chain running counter-clockwise around the plate when seen from
+	// above.
+	last := b.n - 1
+	corners := [4]int{total, total + last, total + last*b.n + last, total + last*b.n}
+	b.addFace(corners[0], corners[3], corners[2])
+	b.addFace(corners[0], corners[2], corners[1])
+	var edges [4][]int
+	var params [4][]float64
+	for k := 0; k <= last; k++ {
+		edges[0] = append(edges[0], k)
+		params[0] = append(params[0], b.pos[k])
+		edges[1] = append(edges[1], k*b.n+last)
+		params[1] = append(params[1], b.pos[k])
+		edges[2] = append(edges[2], last*b.n+last-k)
+		params[2] = append(params[2], -b.pos[last-k])
+		edges[3] = append(edges[3], (last-k)*b.n)
+		params[3] = append(params[3], -b.pos[last-k])
+	}
+	for side := 0; side < 4; side++ {
+		var top []int
+		var tx []float64
+		for k, p := range edges[side] {
+			if b.kept[p] {
+				top = append(top, p)
+				tx = append(tx, params[side][k])
+			}
+		}
+		ends := []float64{params[side][0], params[side][last]}
+		b.zip([]int{corners[side], corners[(side+1)%4]}, ends, top, tx, false)
+	}
+}
+
+// chain returns the kept lattice points of row j from a to b, offset by base
+// to select the bottom copies, with their x coordinates.
+func (b *meshBuilder) chain(j, from, to, base int) ([]int, []float64) {
+	var points []int
+	var xs []float64
+	for i := from; i <= to; i++ {
+		if p := j*b.n + i; b.kept[p] {
+			points = append(points, base+p)
+			xs = append(xs, b.pos[i])
+		}
+	}
+
+	return points, xs
+}
+
+// zip triangulates the planar strip between two parallel chains of points,
+// each ordered by the parameter along it. The faces are counter-clockwise
+// when the bottom chain runs left to right below the top one, or clockwise if
+// flip is set.
+func (b *meshBuilder) zip(bottom []int, bx []float64, top []int, tx []float64, flip bool) {
+	add := b.addFace
+	if flip {
+		add = func(p, q, r int) { b.addFace(p, r, q) }
+	}
+	i, k := 0, 0
+	for i+1 < len(bottom) || k+1 < len(top) {
+		if k+1 == len(top) || i+1 < len(bottom) && bx[i+1] <= tx[k+1] {
+			add(bottom[i], bottom[i+1], top[k])
+			i++
+		} else {
+			add(bottom[i], top[k+1], top[k])
+			k++
+		}
+	}
+}
+
+// addCell adds the two triangles of the lattice cell at (i, j),
+// splitting it along the diagonal through the odd corner out so that chamfered
+// corners are mitred.
+func (b *meshBuilder) addCell(i, j int) {
+	p00, p10, p11, p01 := j*b.n+i, j*b.n+i+1, (j+1)*b.n+i+1, (j+1)*b.n+i
+	var raised [4]bool
+	count := 0
+	for k, p := range [4]int{p00, p10, p11, p01} {
+		if raised[k] = b.heights[p] == b.high; raised[k] {
+			count++
+		}
+	}
+	odd := -1
+	if count%2 == 1 {
+		for k := range raised {
+			if raised[k] == (count == 1) {
+				odd = k
+			}
+		}
+	}
+	if odd == 1 || odd == 3 {
+		b.addFace(p00, p10, p01)
+		b.addFace(p10, p11, p01)
+		return
+	}
+	b.addFace(p00, p10, p11)
+	b.addFace(p00, p11, p01)
+}
+
+// addFace adds a triangle between three lattice points, dropping it if two of
+// them are the same vertex.
+func (b *meshBuilder) addFace(p, q, r int) {
+	var face [3]int
+	for k, node := range [3]int{p, q, r} {
+		root := b.find(node)
+		if b.vertex[root] < 0 {
+			b.vertex[root] = len(b.mesh.Vertices)
+			total := b.n * b.n
+			lattice := root % total
+			z := 0.0
+			if root < total {
+				z = b.heights[lattice]
+			}
+			b.mesh.Vertices = append(b.mesh.Vertices, [3]float64{b.pos[lattice%b.n], b.pos[lattice/b.n], z})
+		}
+		face[k] = b.vertex[root]
+	}
+	if face[0] == face[1] || face[1] == face[2] || face[2] == face[0] {
+		return
+	}
+	b.mesh.Faces = append(b.mesh.Faces, face)
+}
+
+// splitPinches gives each fan of faces around a vertex its own copy of it, so
+// that dark regions touching only at a corner stay separate, manifold solids.
+func (m *Mesh) splitPinches() {
+	fans := make([][]int, len(m.Vertices))
+	for f, face := range m.Faces {
+		for _, v := range face {
+			fans[v] = append(fans[v], f)
+		}
+	}
+	for v, faces := range fans {
+		parent := make([]int, len(faces))
+		for k := range parent {
+			parent[k] = k
+		}
+		find := func(k int) int {
+			for parent[k] != k {
+				k = parent[k]
+			}
+			return k
+		}
+		seen := make(map[int]int)
+		for k, f := range faces {
+			for _, w := range m.Faces[f] {
+				if w == v {
+					continue
+				}
+				if l, ok := seen[w]; ok {
+					parent[find(k)] = find(l)
+				} else {
+					seen[w] = k
+				}
+			}
+		}
+		copies := make(map[int]int)
+		for k, f := range faces {
+			root := find(k)
+			nv, ok := copies[root]
+			if !ok {
+				nv = v
+				if len(copies) > 0 {
+					nv = len(m.Vertices)
+					m.Vertices = append(m.Vertices, m.Vertices[v])
+				}
+				copies[root] = nv
+			}
+			for c := range m.Faces[f] {
+				if m.Faces[f][c] == v {
+					m.Faces[f][c] = nv
+				}
+			}
+		}
+	}
+}
+
+// normal returns the unit normal of a face.
+func (m *Mesh) normal(f [3]int) [3]float64 {
+	a, b, c := m.Vertices[f[0]], m.Vertices[f[1]], m.Vertices[f[2]]
+	u := [3]float64{b[0] - a[0], b[1] - a[1], b[2] - a[2]}
+	v := [3]float64{c[0] - a[0], c[1] - a[1], c[2] - a[2]}
+	n := [3]float64{u[1]*v[2] - u[2]*v[1], u[2]*v[0] - u[0]*v[2], u[0]*v[1] - u[1]*v[0]}
+	length := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2])
+	if length == 0 {
+		return n
+	}
+
+	return [3]float64{n[0] / length, n[1] / length, n[2] / length}
+}
+
+// WriteSTL writes the mesh in binary STL format.
+func (m *Mesh) WriteSTL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var header [80]byte
+	copy(header[:], "qrcodegen")
+	bw.Write(header[:])
+	binary.Write(bw, binary.LittleEndian, uint32(len(m.Faces)))
+
+	var record [50]byte
+	put := func(offset int, v float64) {
+		binary.LittleEndian.PutUint32(record[offset:], math.Float32bits(float32(v)))
+	}
+	for _, f := range m.Faces {
+		n := m.normal(f)
+		for i := 0; i < 3; i++ {
+			put(i*4, n[i])
+		}
+		for k := 0; k < 3; k++ {
+			for i := 0; i < 3; i++ {
+				put(12+k*12+i*4, m.Vertices[f[k]][i])
+			}
+		}
+		if _, err := bw.Write(record[:]); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// WriteOBJ writes the mesh in Wavefront OBJ format.
+func (m *Mesh) WriteOBJ(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# qrcodegen\n")
+	for _, v := range m.Vertices {
+		fmt.Fprintf(bw, "v %s %s %s\n", formatFloat(v[0], -1), formatFloat(v[1], -1), formatFloat(v[2], -1))
+	}
+	for _, f := range m.Faces {
+		if _, err := fmt.Fprintf(bw, "f %d %d %d\n", f[0]+1, f[1]+1, f[2]+1); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
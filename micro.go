@@ -0,0 +1,309 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import "fmt"
+
+// MaxMicroVersion is the largest Micro QR version, M4.
+const MaxMicroVersion = Version(4)
+
+// Micro QR capacities, indexed by version (M1-M4) and error correction level.
+// M1 only detects errors; it is listed under Low. A zero entry means the
+// combination does not exist.
+var (
+	microDataBits = [MaxMicroVersion + 1][3]int{
+		{},
+		{20, 0, 0},
+		{40, 32, 0},
+		{84, 68, 0},
+		{128, 112, 80},
+	}
+	microECCCodewords = [MaxMicroVersion + 1][3]int{
+		{},
+		{2, 0, 0},
+		{5, 6, 0},
+		{6, 8, 0},
+		{8, 10, 14},
+	}
+	microSymbolNumbers = [MaxMicroVersion + 1][3]int{
+		{},
+		{0, 0, 0},
+		{1, 2, 0},
+		{3, 4, 0},
+		{5, 6, 7},
+	}
+)
+
+// microCharCountBits returns the width of the character count field of a
+// segment mode in a Micro QR version, or 0 if the version does not support the
+// mode.
+func microCharCountBits(mode Mode, version Version) int {
+	switch mode {
+	case Numeric:
+		return [...]int{0, 3, 4, 5, 6}[version]
+	case Alphanumeric:
+		return [...]int{0, 0, 3, 4, 5}[version]
+	case Byte:
+		return [...]int{0, 0, 0, 4, 5}[version]
+	}
+
+	return 0
+}
+
+// microModeIndicator returns the mode indicator of a Micro QR segment, which is
+// version-1 bits wide.
+func microModeIndicator(mode Mode) int {
+	switch mode {
+	case Alphanumeric:
+		return 1
+	case Byte:
+		return 2
+	}
+
+	return 0
+}
+
+// EncodeMicro encodes text as a Micro QR symbol (M1 to M4) with the given
+// error correction level, choosing the smallest version that holds the text.
+// Micro QR has a single finder pattern and needs only a 2 module quiet zone,
+// so it suits small payloads printed in little space, but not every scanner
+// reads it. High error correction is not available, Quartile only in M4, and
+// M1 (numeric text of up to 5 digits) detects errors without correcting them;
+// it is only chosen for Low. The result has Micro set, and its Version is the
+// Micro QR version.
+func EncodeMicro(text string, ecl ECL) (*QRCode, error) {
+	q, _, err := encodeMicro(text, ecl)
+	return q, err
+}
+
+// encodeMicro implements EncodeMicro, also returning the segment bit stream
+// (mode, count and data) for the audit record.
+func encodeMicro(text string, ecl ECL) (*QRCode, bitBuffer, error) {
+	if ecl < Low || ecl > Quartile {
+		return nil, nil, fmt.Errorf("micro QR supports error correction levels Low to Quartile, not %s", ecl)
+	}
+	mode := Byte
+	if CanEncodeNumeric(text) {
+		mode = Numeric
+	} else if CanEncodeAlphanumeric(text) {
+		mode = Alphanumeric
+	}
+
+	for version := Version(1); version <= MaxMicroVersion; version++ {
+		if microDataBits[version][ecl] == 0 {
+			continue
+		}
+		ccBits := microCharCountBits(mode, version)
+		if ccBits == 0 || len(text) >= 1<<ccBits {
+			continue
+		}
+		var seg *QRSegment
+		switch mode {
+		case Numeric:
+			seg = MakeNumeric(text)
+		case Alphanumeric:
+			seg = MakeAlphanumeric(text)
+		default:
+			seg = MakeBytes([]byte(text))
+		}
+		if int(version)-1+ccBits+len(seg.Data) <= microDataBits[version][ecl] {
+			q, payload := encodeMicroSegment(seg, version, ecl)
+			return q, payload, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("text does not fit in a micro QR symbol at ECL %s", ecl)
+}
+
+// encodeMicroSegment builds the Micro QR symbol of the given version holding
+// one segment that is known to fit, and returns it with the segment bits.
+func encodeMicroSegment(seg *QRSegment, version Version, ecl ECL) (*QRCode, bitBuffer) {
+	capacity := microDataBits[version][ecl]
+	bb := make(bitBuffer, 0, capacity)
+	bb.appendBits(microModeIndicator(seg.Mode), int8(version-1))
+	bb.appendBits(seg.NumChars, int8(microCharCountBits(seg.Mode, version)))
+	bb = append(bb, seg.Data...)
+	payload := bb[:len(bb):len(bb)]
+
+	// Add the terminator, pad up to a codeword, and fill the remaining
+	// capacity with pad codewords. In M1 and M3 the last data codeword is only
+	// 4 bits wide and is padded with zeros.
+	bb.appendBits(0, int8(min(2*int(version)+1, capacity-len(bb))))
+	for len(bb)%8 != 0 && len(bb) < capacity {
+		bb.appendBits(0, 1)
+	}
+	for padByte := 0xEC; capacity-len(bb) >= 8; padByte ^= 0xEC ^ 0x11 {
+		bb.appendBits(padByte, 8)
+	}
+	bb.appendBits(0, int8(capacity-len(bb)))
+
+	// Pack the data into codewords, the 4-bit one in the high nibble, and
+	// append the error correction codewords.
+	data := make([]byte, (capacity+7)/8)
+	for i, bit := range bb {
+		data[i>>3] |= bit << (7 - i&7)
+	}
+	ecc := reedSolomonComputeRemainder(data, reedSolomonDivisors[microECCCodewords[version][ecl]])
+	stream := append(bb, make(bitBuffer, 0, len(ecc)*8)...)
+	for _, b := range ecc {
+		stream.appendBits(int(b), 8)
+	}
+	if len(stream) != len(bb)+len(ecc)*8 {
+		panic("incorrect micro QR stream length")
+	}
+
+	q := newMicroQRCode(version, ecl)
+	positions := q.microDataPositions()
+	if len(positions) != len(stream) {
+		panic("incorrect micro QR capacity")
+	}
+	for i, p := range positions {
+		q.Modules[p.y][p.x] = Module(stream[i])
+	}
+
+	// Choose the mask that leaves the most dark modules along the right and
+	// bottom edges, where the missing finder patterns would be.
+	best, bestScore := Mask(0), -1
+	for mask := Mask(0); mask < 4; mask++ {
+		q.applyMicroMask(mask)
+		if score := q.microMaskScore(); score > bestScore {
+			best, bestScore = mask, score
+		}
+		q.applyMicroMask(mask)
+	}
+	q.applyMicroMask(best)
+	q.drawMicroFormatBits(best)
+	q.Mask = best
+	q.isFunction = nil
+
+	return q, payload
+}
+
+// newMicroQRCode returns a Micro QR symbol with its function patterns drawn.
+func newMicroQRCode(version Version, ecl ECL) *QRCode {
+	size := 2*int(version) + 9
+	q := &QRCode{
+		Version:              version,
+		Size:                 size,
+		ErrorCorrectionLevel: ecl,
+		Micro:                true,
+		Modules:              make([][]Module, size),
+		isFunction:           make([][]bool, size),
+	}
+	for y := range q.Modules {
+		q.Modules[y] = make([]Module, size)
+		q.isFunction[y] = make([]bool, size)
+	}
+
+	q.drawFinderPattern(3, 3)
+	for i := 8; i < size; i++ {
+		q.setFunctionModule(i, 0, i%2 == 0)
+		q.setFunctionModule(0, i, i%2 == 0)
+	}
+	q.drawMicroFormatBits(0) // Reserve the format area; it is redrawn with the chosen mask.
+
+	return q
+}
+
+// drawMicroFormatBits draws the single copy of the Micro QR format bits.
+func (q *QRCode) drawMicroFormatBits(mask Mask) {
+	data := microSymbolNumbers[q.Version][q.ErrorCorrectionLevel]<<2 | int(mask)
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ rem>>9*0x537
+	}
+	bits := data<<10 | rem ^ 0x4445
+
+	for i := 0; i < 8; i++ {
+		q.setFunctionModule(8, i+1, getBitAsBool(bits, i))
+	}
+	for i := 0; i < 7; i++ {
+		q.setFunctionModule(i+1, 8, getBitAsBool(bits, 14-i))
+	}
+}
+
+// microDataPositions returns the modules that hold the data and error
+// correction bits, in placement order: the same zig-zag scan as QR, which in
+// Micro QR has no timing column to step over. It starts upward from the
+// bottom-right corner and turns at each edge, so the direction of a column
+// pair depends on its distance from the right edge (for QR that is the same
+// as the parity used by codewordPlan, since every QR size is 1 mod 4, but
+// M1 and M3 are 3 mod 4).
+func (q *QRCode) microDataPositions() []modulePos {
+	var result []modulePos
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		upward := (q.Size-1-right)/2%2 == 0
+		for vert := 0; vert < q.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if upward {
+					y = q.Size - 1 - vert
+				}
+				if !q.isFunction[y][x] {
+					result = append(result, modulePos{uint8(x), uint8(y)})
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// applyMicroMask XORs the data modules with one of the four Micro QR masks.
+func (q *QRCode) applyMicroMask(mask Mask) {
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = y%2 == 0
+			case 1:
+				invert = (y/2+x/3)%2 == 0
+			case 2:
+				invert = (y*x%2+y*x%3)%2 == 0
+			case 3:
+				invert = ((y+x)%2+y*x%3)%2 == 0
+			}
+			if invert && !q.isFunction[y][x] {
+				q.Modules[y][x] ^= 1
+			}
+		}
+	}
+}
+
+// microMaskScore evaluates a masked Micro QR symbol; higher is better.
+func (q *QRCode) microMaskScore() int {
+	right, bottom := 0, 0
+	for i := 1; i < q.Size; i++ {
+		right += int(q.Modules[i][q.Size-1])
+		bottom += int(q.Modules[q.Size-1][i])
+	}
+	if right <= bottom {
+		return right*16 + bottom
+	}
+
+	return bottom*16 + right
+}
@@ -0,0 +1,151 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+// NetpbmFormat selects a member of the Netpbm family.
+type NetpbmFormat int
+
+// The Netpbm formats.
+const (
+	PBM NetpbmFormat = iota // Bitmap, one bit per pixel with 1 for dark.
+	PGM                     // Grayscale, one byte per pixel.
+	PPM                     // RGB color, three bytes per pixel.
+)
+
+// NetpbmOptions controls WriteNetpbm.
+type NetpbmOptions struct {
+	Format NetpbmFormat
+	Scale  int         // Pixels per module (default 1, so a PBM image is the module matrix).
+	Border int         // Quiet zone in modules (default 4; negative for none).
+	Dark   color.Color // Color of dark modules in PGM and PPM images (default black).
+	Light  color.Color // Color of light modules in PGM and PPM images (default white).
+	Plain  bool        // Write the ASCII variant (P1, P2, P3) instead of the binary one (P4, P5, P6).
+}
+
+// WriteNetpbm writes the QR code to w as a PBM, PGM, or PPM image, which any
+// Netpbm or ImageMagick tool can read without an image library.
+func (q *QRCode) WriteNetpbm(w io.Writer, opts NetpbmOptions) error {
+	if opts.Scale == 0 {
+		opts.Scale = 1
+	}
+	if opts.Border == 0 {
+		opts.Border = 4
+	} else if opts.Border < 0 {
+		opts.Border = 0
+	}
+	if opts.Dark == nil {
+		opts.Dark = color.Black
+	}
+	if opts.Light == nil {
+		opts.Light = color.White
+	}
+	if opts.Scale < 1 {
+		return fmt.Errorf("scale must be positive")
+	}
+
+	// samples holds the values written for light and dark pixels.
+	var samples [2][]byte
+	magic := 1
+	switch opts.Format {
+	case PBM:
+		samples = [2][]byte{{0}, {1}}
+	case PGM:
+		magic = 2
+		for i, c := range []color.Color{opts.Light, opts.Dark} {
+			samples[i] = []byte{color.GrayModel.Convert(c).(color.Gray).Y}
+		}
+	case PPM:
+		magic = 3
+		for i, c := range []color.Color{opts.Light, opts.Dark} {
+			rgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+			samples[i] = []byte{rgba.R, rgba.G, rgba.B}
+		}
+	default:
+		return fmt.Errorf("unknown Netpbm format %d", opts.Format)
+	}
+	if !opts.Plain {
+		magic += 3
+	}
+
+	grid := q.borderedGrid(opts.Border)
+	side := grid.size * opts.Scale
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "P%d\n%d %d\n", magic, side, side)
+	if opts.Format != PBM {
+		bw.WriteString("255\n")
+	}
+
+	row := make([]byte, 0, side*3)
+	for y := 0; y < side; y++ {
+		row = row[:0]
+		for _, c := range grid.cells[y/opts.Scale*grid.size : (y/opts.Scale+1)*grid.size] {
+			for i := 0; i < opts.Scale; i++ {
+				row = append(row, samples[c]...)
+			}
+		}
+		switch {
+		case opts.Plain:
+			writePlainNetpbmRow(bw, row)
+		case opts.Format == PBM:
+			// Pack eight pixels per byte, most significant bit first, padding
+			// each row to a whole byte.
+			packed := make([]byte, (side+7)/8)
+			for x, b := range row {
+				packed[x/8] |= b << (7 - x%8)
+			}
+			bw.Write(packed)
+		default:
+			bw.Write(row)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writePlainNetpbmRow writes the samples of one row as decimal numbers,
+// keeping lines within the 70 characters the format allows.
+func writePlainNetpbmRow(bw *bufio.Writer, row []byte) {
+	var line []byte
+	for _, s := range row {
+		text := strconv.Itoa(int(s))
+		if len(line) > 0 && len(line)+1+len(text) > 70 {
+			bw.Write(append(line, '\n'))
+			line = line[:0]
+		}
+		if len(line) > 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, text...)
+	}
+	bw.Write(append(line, '\n'))
+}
@@ -0,0 +1,148 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeOptions selects the normalization steps applied to text before it
+// is split into segments. The zero value performs no normalization.
+type NormalizeOptions struct {
+	NFC                bool // Convert the text to Unicode normalization form C.
+	Trim               bool // Remove leading and trailing whitespace.
+	CollapseWhitespace bool // Replace each run of internal whitespace (other than line breaks) with a single space.
+	StripZeroWidth     bool // Remove invisible zero-width characters (ZWSP, word joiner, and byte order mark).
+}
+
+// NormalizeReport describes what a call to Normalize changed.
+type NormalizeReport struct {
+	Changed          bool // The normalized text differs from the original.
+	NFCChanged       bool // Unicode NFC normalization changed the text.
+	ZeroWidthRemoved int  // Number of zero-width characters removed.
+	WhitespaceRuns   int  // Number of internal whitespace runs collapsed to a single space.
+	TrimmedRunes     int  // Number of leading and trailing whitespace characters removed, before any collapsing.
+	OriginalBytes    int  // Length of the original text in bytes.
+	NormalizedBytes  int  // Length of the normalized text in bytes.
+}
+
+// DefaultNormalizeOptions enables every normalization step.
+var DefaultNormalizeOptions = NormalizeOptions{
+	NFC:                true,
+	Trim:               true,
+	CollapseWhitespace: true,
+	StripZeroWidth:     true,
+}
+
+// Normalize applies the selected normalization steps to text and returns the
+// result together with a report of what changed. The steps are applied in the
+// order: zero-width removal, NFC, trimming, and whitespace collapsing, so only
+// internal runs are collapsed. The zero-width non-joiner and joiner (U+200C and
+// U+200D) are kept, since they change how Persian and Indic words and emoji
+// sequences are displayed.
+func Normalize(text string, opts NormalizeOptions) (string, NormalizeReport) {
+	report := NormalizeReport{OriginalBytes: len(text)}
+	result := text
+
+	if opts.StripZeroWidth {
+		result = strings.Map(func(r rune) rune {
+			if isZeroWidth(r) {
+				report.ZeroWidthRemoved++
+				return -1
+			}
+			return r
+		}, result)
+	}
+
+	if opts.NFC && !norm.NFC.IsNormalString(result) {
+		result = norm.NFC.String(result)
+		report.NFCChanged = true
+	}
+
+	if opts.Trim {
+		trimmed := strings.TrimFunc(result, unicode.IsSpace)
+		report.TrimmedRunes = len([]rune(result)) - len([]rune(trimmed))
+		result = trimmed
+	}
+
+	if opts.CollapseWhitespace {
+		var sb strings.Builder
+		sb.Grow(len(result))
+		var run []rune // The current run of collapsible whitespace.
+		flush := func() {
+			if len(run) == 0 {
+				return
+			}
+			if len(run) > 1 || run[0] != ' ' {
+				report.WhitespaceRuns++
+			}
+			sb.WriteByte(' ')
+			run = run[:0]
+		}
+		for _, r := range result {
+			if isCollapsibleSpace(r) {
+				run = append(run, r)
+				continue
+			}
+			flush()
+			sb.WriteRune(r)
+		}
+		flush()
+		result = sb.String()
+	}
+
+	report.NormalizedBytes = len(result)
+	report.Changed = result != text
+
+	return result, report
+}
+
+// WithNormalization normalizes the text passed to EncodeText before it is
+// split into segments. If report is not nil, it receives a description of
+// what changed.
+func WithNormalization(opts NormalizeOptions, report *NormalizeReport) func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.normalize = &opts
+		s.normalizeReport = report
+	}
+}
+
+// isCollapsibleSpace reports whether r is whitespace that may be collapsed.
+// Line breaks are kept so that multi-line payloads (such as vCards) survive.
+func isCollapsibleSpace(r rune) bool {
+	return unicode.IsSpace(r) && r != '\n' && r != '\r'
+}
+
+func isZeroWidth(r rune) bool {
+	switch r {
+	case '\u200b', '\u2060', '\ufeff':
+		return true
+	default:
+		return false
+	}
+}
@@ -29,6 +29,11 @@
 
 package qrcodegen
 
+import (
+	"strconv"
+	"strings"
+)
+
 var (
 	alignmentPatternPositions [41][]byte
 
@@ -56,7 +61,10 @@ var (
 
 	numRawDataModules [41]int
 
-	reedSolomonDivisors = make(map[int][]byte)
+	// reedSolomonDivisors holds the generator polynomial for each number of
+	// error correction codewords per block (at most 30) of QR and Micro QR. Like the other tables
+	// it is filled in by init and never written afterwards.
+	reedSolomonDivisors [31][]byte
 )
 
 func init() {
@@ -90,16 +98,23 @@ func init() {
 		}
 	}
 
-	// Precompute the Reed-Solomon divisor polynomials.
+	// Precompute the Reed-Solomon divisor polynomials, for QR and Micro QR.
 	words := make([]int, 0, 4*40)
 	for e := 0; e < 4; e++ {
 		for v := 1; v <= 40; v++ {
 			words = append(words, eccCodeWordsPerBlock[e][v])
 		}
 	}
+	for v := 1; v <= int(MaxMicroVersion); v++ {
+		for _, w := range microECCCodewords[v] {
+			if w != 0 {
+				words = append(words, w)
+			}
+		}
+	}
 
 	for _, w := range words {
-		if _, ok := reedSolomonDivisors[w]; ok {
+		if reedSolomonDivisors[w] != nil {
 			continue
 		}
 
@@ -160,3 +175,18 @@ func min(a, b int) int {
 
 	return b
 }
+
+// formatFloat formats v for a text format such as SVG or PDF, with at most the
+// given number of decimals (or as many as it needs, if negative) and without
+// trailing zeros or a negative zero.
+func formatFloat(v float64, decimals int) string {
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	if strings.Contains(s, ".") {
+		s = strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+	}
+	if s == "-0" {
+		return "0"
+	}
+
+	return s
+}
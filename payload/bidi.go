@@ -0,0 +1,103 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package payload
+
+import (
+	"fmt"
+	"net/url"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+// bidiControls names the invisible characters that change the display order
+// of text around them.
+var bidiControls = map[rune]string{
+	'\u061C': "ARABIC LETTER MARK",
+	'\u200E': "LEFT-TO-RIGHT MARK",
+	'\u200F': "RIGHT-TO-LEFT MARK",
+	'\u202A': "LEFT-TO-RIGHT EMBEDDING",
+	'\u202B': "RIGHT-TO-LEFT EMBEDDING",
+	'\u202C': "POP DIRECTIONAL FORMATTING",
+	'\u202D': "LEFT-TO-RIGHT OVERRIDE",
+	'\u202E': "RIGHT-TO-LEFT OVERRIDE",
+	'\u2066': "LEFT-TO-RIGHT ISOLATE",
+	'\u2067': "RIGHT-TO-LEFT ISOLATE",
+	'\u2068': "FIRST STRONG ISOLATE",
+	'\u2069': "POP DIRECTIONAL ISOLATE",
+}
+
+// BidiWarnings points out text that a scanner app may display in a different
+// order than it is stored, which can make a payload look like something it is
+// not (a URL ending in "gpj.exe" shown as "exe.jpg", say): bidirectional
+// control characters anywhere in the text, and absolute URLs that mix
+// right-to-left and left-to-right characters in the host or in the rest of the
+// URL. Issuing systems that accept payloads from users may want to reject
+// payloads with warnings.
+func BidiWarnings(text string) []string {
+	var warnings []string
+	seen := map[rune]bool{}
+	for _, r := range text {
+		if name, ok := bidiControls[r]; ok && !seen[r] {
+			seen[r] = true
+			warnings = append(warnings, fmt.Sprintf("bidi: U+%04X %s changes the order in which the text is displayed", r, name))
+		}
+	}
+
+	u, err := url.Parse(text)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return warnings
+	}
+	if hasRTL(u.Host) {
+		warnings = append(warnings, "bidi: the URL host contains right-to-left characters, so its labels may be displayed in a different order than they resolve")
+	}
+	if rest := u.Path + u.RawQuery + u.Fragment; hasRTL(rest) && hasLTR(rest) {
+		warnings = append(warnings, "bidi: the URL path or query mixes right-to-left and left-to-right text, so the displayed URL may not match the link")
+	}
+
+	return warnings
+}
+
+// hasRTL reports whether s has a strong right-to-left character.
+func hasRTL(s string) bool {
+	for _, r := range s {
+		if p, _ := bidi.LookupRune(r); p.Class() == bidi.R || p.Class() == bidi.AL {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasLTR reports whether s has a strong left-to-right character or a digit,
+// either of which is laid out against right-to-left text around it.
+func hasLTR(s string) bool {
+	for _, r := range s {
+		if p, _ := bidi.LookupRune(r); p.Class() == bidi.L || p.Class() == bidi.EN || p.Class() == bidi.AN {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,131 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package payload
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Errors returned by VerifyExpiring.
+var (
+	ErrMalformedToken = errors.New("expiring: malformed token")
+	ErrBadSignature   = errors.New("expiring: bad signature")
+	ErrExpired        = errors.New("expiring: token expired")
+)
+
+// expiringMACSize is the number of bytes of the HMAC-SHA256 kept in a token.
+// 128 bits is plenty for an online check and keeps the symbol small.
+const expiringMACSize = 16
+
+// Expiring is a time-boxed payload for door-access and check-in codes that
+// must stop working after a while. The payload is
+//
+//	Prefix + base64url(expiry || data) + "." + base64url(HMAC-SHA256(key, ...))
+//
+// where expiry is the Unix time in seconds as a varint. Expiring is not
+// registered with New because the key must never come from a request body.
+type Expiring struct {
+	Key     []byte    // HMAC key; required.
+	Prefix  string    // Optional text placed before the token, such as "https://door.example/c/".
+	Data    string    // The application data, for example a booking ID.
+	Expires time.Time // The moment the token stops verifying; required.
+}
+
+// Payload implements Builder.
+func (e *Expiring) Payload() (string, error) {
+	if len(e.Key) == 0 {
+		return "", fmt.Errorf("expiring: missing key")
+	}
+	if e.Expires.IsZero() {
+		return "", fmt.Errorf("expiring: missing expiry")
+	}
+
+	body := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(e.Data))
+	body = append(body[:binary.PutVarint(body, e.Expires.Unix())], e.Data...)
+
+	mac := expiringMAC(e.Key, body)
+
+	return e.Prefix + base64.RawURLEncoding.EncodeToString(body) + "." + base64.RawURLEncoding.EncodeToString(mac), nil
+}
+
+// Sealer returns a function that wraps each payload in an Expiring token
+// valid for ttl from the time it is called (now, or time.Now if nil). It fits
+// batch.Job's Transform field.
+func Sealer(key []byte, prefix string, ttl time.Duration, now func() time.Time) func(string) (string, error) {
+	if now == nil {
+		now = time.Now
+	}
+
+	return func(data string) (string, error) {
+		e := Expiring{Key: key, Prefix: prefix, Data: data, Expires: now().Add(ttl)}
+		return e.Payload()
+	}
+}
+
+// VerifyExpiring checks a token produced by Expiring (with its Prefix already
+// removed) against the key and the current time, returning the data and
+// expiry. The signature is checked before the expiry, so ErrExpired is only
+// reported for genuine tokens.
+func VerifyExpiring(key []byte, token string, now time.Time) (string, time.Time, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return "", time.Time{}, ErrMalformedToken
+	}
+	body, err := base64.RawURLEncoding.DecodeString(token[:i])
+	if err != nil {
+		return "", time.Time{}, ErrMalformedToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil {
+		return "", time.Time{}, ErrMalformedToken
+	}
+	if !hmac.Equal(mac, expiringMAC(key, body)) {
+		return "", time.Time{}, ErrBadSignature
+	}
+
+	unix, n := binary.Varint(body)
+	if n <= 0 {
+		return "", time.Time{}, ErrMalformedToken
+	}
+	expires := time.Unix(unix, 0)
+	if !now.Before(expires) {
+		return "", expires, ErrExpired
+	}
+
+	return string(body[n:]), expires, nil
+}
+
+func expiringMAC(key, body []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(body)
+	return h.Sum(nil)[:expiringMACSize]
+}
@@ -0,0 +1,128 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package payload
+
+import (
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Warner is implemented by builders that can point out fields that some
+// scanners handle poorly. Warnings never stop a payload from being built.
+type Warner interface {
+	Warnings() []string
+}
+
+// Warnings returns the warnings of b if it implements Warner, followed by the
+// BidiWarnings of its payload if it builds.
+func Warnings(b Builder) []string {
+	var warnings []string
+	if w, ok := b.(Warner); ok {
+		warnings = w.Warnings()
+	}
+	if text, err := b.Payload(); err == nil {
+		warnings = append(warnings, BidiWarnings(text)...)
+	}
+
+	return warnings
+}
+
+// Warnings implements Warner.
+func (w *WiFi) Warnings() []string {
+	var warnings []string
+	switch {
+	case !utf8.ValidString(w.SSID):
+		warnings = append(warnings, "wifi: the SSID is not UTF-8, so it is written in hex, which only ZXing-based scanners understand")
+	case !isASCII(w.SSID):
+		warnings = append(warnings, "wifi: the SSID is not ASCII; some older Android scanners read it as Latin-1 and cannot join the network")
+	case isHex(w.SSID):
+		warnings = append(warnings, "wifi: the SSID looks like hex, so it is quoted; a few scanners keep the quotes")
+	}
+	if !isASCII(w.Password) {
+		warnings = append(warnings, "wifi: the password is not ASCII; many devices cannot enter it and some scanners garble it")
+	}
+
+	return warnings
+}
+
+// Warnings implements Warner.
+func (v *VCard) Warnings() []string {
+	for _, s := range []string{v.FirstName, v.LastName, v.Organization, v.Title, v.Address, v.Note} {
+		if !isASCII(s) {
+			return []string{"vcard: non-ASCII fields are marked CHARSET=UTF-8; scanners that ignore it may garble them unless the symbol starts with a UTF-8 ECI segment"}
+		}
+	}
+
+	return nil
+}
+
+// wifiSSID returns the S: field value for an SSID. SSIDs that are not UTF-8
+// are written in hex, and SSIDs that merely look like hex are quoted, as
+// ZXing-based scanners would otherwise decode them.
+func wifiSSID(ssid string) (string, error) {
+	if len(ssid) > 32 {
+		return "", fmt.Errorf("wifi: SSID is longer than 32 bytes")
+	}
+	switch {
+	case !utf8.ValidString(ssid):
+		return hex.EncodeToString([]byte(ssid)), nil
+	case isHex(ssid):
+		return `"` + ssid + `"`, nil
+	}
+
+	return wifiEscape(ssid), nil
+}
+
+// vCardProperty returns the name of a vCard property with the UTF-8 charset
+// parameter if its value is not ASCII. vCard 3.0 has no default charset, so
+// readers would otherwise guess.
+func vCardProperty(name, value string) string {
+	if isASCII(value) {
+		return name
+	}
+
+	return name + ";CHARSET=UTF-8"
+}
+
+// isHex reports whether s is a non-empty, even-length string of hex digits.
+func isHex(s string) bool {
+	if s == "" || len(s)%2 != 0 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+
+	return err == nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,325 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package payload builds the text of common structured QR code payloads (Wi-Fi
+// credentials, contact cards, phone numbers, etc.) following the conventions
+// that smartphone scanners recognize.
+package payload
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Builder is implemented by every payload type. Payload returns the text to
+// encode in the QR code, or an error if the fields are invalid.
+type Builder interface {
+	Payload() (string, error)
+}
+
+var (
+	buildersMu sync.RWMutex
+	builders   = map[string]func() Builder{
+		"email": func() Builder { return &Email{} },
+		"geo":   func() Builder { return &Geo{} },
+		"sms":   func() Builder { return &SMS{} },
+		"tel":   func() Builder { return &Tel{} },
+		"url":   func() Builder { return &URL{} },
+		"vcard": func() Builder { return &VCard{} },
+		"wifi":  func() Builder { return &WiFi{} },
+	}
+)
+
+// Register makes a custom payload kind available through New and Kinds, and
+// therefore through the HTTP service, the command line tool's --kind flag, and
+// any other tool built on them. The factory must return a new pointer on each
+// call so it can be filled in by encoding/json. Like database/sql.Register, it
+// panics if the kind is already registered or the factory is nil; it is meant
+// to be called from an init function.
+func Register(kind string, factory func() Builder) {
+	buildersMu.Lock()
+	defer buildersMu.Unlock()
+	if factory == nil {
+		panic("payload: Register factory is nil")
+	}
+	if _, dup := builders[kind]; dup {
+		panic("payload: Register called twice for kind " + kind)
+	}
+	builders[kind] = factory
+}
+
+// New returns a new, empty builder of the named kind (for example "wifi").
+// The result is a pointer, so it can be filled in by encoding/json.
+func New(kind string) (Builder, error) {
+	buildersMu.RLock()
+	factory, ok := builders[kind]
+	buildersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown payload kind %q", kind)
+	}
+
+	return factory(), nil
+}
+
+// Kinds returns the names of the available payload kinds in sorted order.
+func Kinds() []string {
+	buildersMu.RLock()
+	defer buildersMu.RUnlock()
+	result := make([]string, 0, len(builders))
+	for k := range builders {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// Email is a mailto: payload.
+type Email struct {
+	To      string `json:"to"`
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body,omitempty"`
+}
+
+// Payload implements Builder.
+func (e *Email) Payload() (string, error) {
+	if e.To == "" {
+		return "", fmt.Errorf("email: missing recipient")
+	}
+
+	query := url.Values{}
+	if e.Subject != "" {
+		query.Set("subject", e.Subject)
+	}
+	if e.Body != "" {
+		query.Set("body", e.Body)
+	}
+	result := "mailto:" + e.To
+	if len(query) > 0 {
+		result += "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+	}
+
+	return result, nil
+}
+
+// Geo is a geo: location payload.
+type Geo struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Payload implements Builder.
+func (g *Geo) Payload() (string, error) {
+	if g.Latitude < -90 || g.Latitude > 90 || g.Longitude < -180 || g.Longitude > 180 {
+		return "", fmt.Errorf("geo: coordinates out of range")
+	}
+
+	return fmt.Sprintf("geo:%g,%g", g.Latitude, g.Longitude), nil
+}
+
+// SMS is a text message payload in the SMSTO: form.
+type SMS struct {
+	Number  string `json:"number"`
+	Message string `json:"message,omitempty"`
+	Region  string `json:"region,omitempty"` // If set, the number is normalized with NormalizePhone.
+}
+
+// Payload implements Builder.
+func (s *SMS) Payload() (string, error) {
+	if s.Number == "" {
+		return "", fmt.Errorf("sms: missing number")
+	}
+	number, err := phoneNumber(s.Number, s.Region)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("SMSTO:%s:%s", number, s.Message), nil
+}
+
+// Tel is a tel: phone number payload.
+type Tel struct {
+	Number string `json:"number"`
+	Region string `json:"region,omitempty"` // If set, the number is normalized with NormalizePhone.
+}
+
+// Payload implements Builder.
+func (t *Tel) Payload() (string, error) {
+	if t.Number == "" {
+		return "", fmt.Errorf("tel: missing number")
+	}
+	number, err := phoneNumber(t.Number, t.Region)
+	if err != nil {
+		return "", err
+	}
+
+	return "tel:" + number, nil
+}
+
+// URL is a web link payload.
+type URL struct {
+	URL string `json:"url"`
+}
+
+// Payload implements Builder.
+func (u *URL) Payload() (string, error) {
+	parsed, err := url.Parse(u.URL)
+	if err != nil {
+		return "", fmt.Errorf("url: %w", err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return "", fmt.Errorf("url: %q is not an absolute URL", u.URL)
+	}
+
+	return parsed.String(), nil
+}
+
+// VCard is a vCard 3.0 contact card payload.
+type VCard struct {
+	FirstName    string `json:"firstName,omitempty"`
+	LastName     string `json:"lastName,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Title        string `json:"title,omitempty"`
+	Phone        string `json:"phone,omitempty"`
+	Email        string `json:"email,omitempty"`
+	URL          string `json:"url,omitempty"`
+	Address      string `json:"address,omitempty"`
+	Note         string `json:"note,omitempty"`
+	Region       string `json:"region,omitempty"` // If set, the phone number is normalized with NormalizePhone.
+}
+
+// Payload implements Builder.
+func (v *VCard) Payload() (string, error) {
+	if v.FirstName == "" && v.LastName == "" && v.Organization == "" {
+		return "", fmt.Errorf("vcard: a name or organization is required")
+	}
+	for _, s := range []string{v.FirstName, v.LastName, v.Organization, v.Title, v.Phone, v.Email, v.URL, v.Address, v.Note} {
+		if !utf8.ValidString(s) {
+			return "", fmt.Errorf("vcard: %q is not UTF-8", s)
+		}
+	}
+	phone := v.Phone
+	if phone != "" {
+		var err error
+		if phone, err = phoneNumber(phone, v.Region); err != nil {
+			return "", err
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("BEGIN:VCARD\r\nVERSION:3.0\r\n")
+	fmt.Fprintf(&sb, "%s:%s;%s;;;\r\n", vCardProperty("N", v.LastName+v.FirstName), vCardEscape(v.LastName), vCardEscape(v.FirstName))
+	fullName := strings.TrimSpace(v.FirstName + " " + v.LastName)
+	if fullName == "" {
+		fullName = v.Organization
+	}
+	fmt.Fprintf(&sb, "%s:%s\r\n", vCardProperty("FN", fullName), vCardEscape(fullName))
+	for _, field := range []struct{ name, value string }{
+		{"ORG", v.Organization},
+		{"TITLE", v.Title},
+		{"TEL", phone},
+		{"EMAIL", v.Email},
+		{"URL", v.URL},
+		{"ADR", v.Address},
+		{"NOTE", v.Note},
+	} {
+		if field.value == "" {
+			continue
+		}
+		value := vCardEscape(field.value)
+		if field.name == "ADR" { // The address goes in the street component.
+			value = ";;" + value + ";;;;"
+		}
+		fmt.Fprintf(&sb, "%s:%s\r\n", vCardProperty(field.name, value), value)
+	}
+	sb.WriteString("END:VCARD")
+
+	return sb.String(), nil
+}
+
+// WiFi is a Wi-Fi network configuration payload.
+type WiFi struct {
+	SSID     string `json:"ssid"`
+	Password string `json:"password,omitempty"`
+	Security string `json:"security,omitempty"` // WPA, WEP, or nopass (default WPA if a password is given, otherwise nopass).
+	Hidden   bool   `json:"hidden,omitempty"`
+}
+
+// Payload implements Builder.
+func (w *WiFi) Payload() (string, error) {
+	if w.SSID == "" {
+		return "", fmt.Errorf("wifi: missing SSID")
+	}
+
+	security := strings.ToUpper(w.Security)
+	switch security {
+	case "":
+		security = "nopass"
+		if w.Password != "" {
+			security = "WPA"
+		}
+	case "WPA", "WPA2", "WEP":
+		if w.Password == "" {
+			return "", fmt.Errorf("wifi: %s requires a password", security)
+		}
+	case "NOPASS":
+		security = "nopass"
+	default:
+		return "", fmt.Errorf("wifi: unknown security %q", w.Security)
+	}
+
+	ssid, err := wifiSSID(w.SSID)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "WIFI:T:%s;S:%s;", security, ssid)
+	if security != "nopass" {
+		fmt.Fprintf(&sb, "P:%s;", wifiEscape(w.Password))
+	}
+	if w.Hidden {
+		sb.WriteString("H:true;")
+	}
+	sb.WriteString(";")
+
+	return sb.String(), nil
+}
+
+var (
+	vCardEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`)
+	wifiEscaper  = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, ":", `\:`, `"`, `\"`)
+)
+
+func vCardEscape(s string) string {
+	return vCardEscaper.Replace(s)
+}
+
+func wifiEscape(s string) string {
+	return wifiEscaper.Replace(s)
+}
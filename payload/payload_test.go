@@ -0,0 +1,243 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package payload
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilders(t *testing.T) {
+	cases := []struct {
+		builder Builder
+		want    string
+	}{
+		{&WiFi{SSID: "my;net", Password: "p:w"}, `WIFI:T:WPA;S:my\;net;P:p\:w;;`},
+		{&WiFi{SSID: "open", Hidden: true}, "WIFI:T:nopass;S:open;H:true;;"},
+		{&Email{To: "a@example.com", Subject: "Hi there"}, "mailto:a@example.com?subject=Hi%20there"},
+		{&Geo{Latitude: 40.5, Longitude: -74.25}, "geo:40.5,-74.25"},
+		{&SMS{Number: "+15551234567", Message: "hello"}, "SMSTO:+15551234567:hello"},
+		{&Tel{Number: "+15551234567"}, "tel:+15551234567"},
+		{&URL{URL: "https://example.com/a?b=c"}, "https://example.com/a?b=c"},
+		{&VCard{FirstName: "Ada", LastName: "Lovelace", Organization: "Analytical, Inc."},
+			"BEGIN:VCARD\r\nVERSION:3.0\r\nN:Lovelace;Ada;;;\r\nFN:Ada Lovelace\r\nORG:Analytical\\, Inc.\r\nEND:VCARD"},
+	}
+
+	for _, tc := range cases {
+		got, err := tc.builder.Payload()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.want, got)
+	}
+
+	for _, b := range []Builder{&WiFi{}, &WiFi{SSID: "x", Security: "WEP"}, &Email{}, &Geo{Latitude: 91}, &URL{URL: "example.com"}, &VCard{}} {
+		_, err := b.Payload()
+		assert.Error(t, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	b, err := New("wifi")
+	assert.NoError(t, err)
+	assert.IsType(t, &WiFi{}, b)
+
+	_, err = New("unknown")
+	assert.Error(t, err)
+
+	assert.Contains(t, Kinds(), "vcard")
+}
+
+func TestSetFromQuery(t *testing.T) {
+	var w WiFi
+	assert.NoError(t, SetFromQuery(&w, url.Values{"ssid": {"Home"}, "password": {"pw"}, "hidden": {"1"}}))
+	assert.Equal(t, WiFi{SSID: "Home", Password: "pw", Hidden: true}, w)
+
+	var g Geo
+	assert.NoError(t, SetFromQuery(&g, url.Values{"latitude": {"40.5"}, "longitude": {"-74.25"}}))
+	assert.Equal(t, Geo{Latitude: 40.5, Longitude: -74.25}, g)
+
+	for _, q := range []url.Values{
+		{"ssid": {"a", "b"}},
+		{"SSID": {"a"}},
+		{"hidden": {"maybe"}},
+	} {
+		assert.Error(t, SetFromQuery(&WiFi{}, q), q.Encode())
+	}
+	assert.Error(t, SetFromQuery(&g, url.Values{"latitude": {"north"}}))
+	assert.Error(t, SetFromQuery(&Expiring{}, url.Values{"expires": {"soon"}}))
+}
+
+func TestExpiring(t *testing.T) {
+	key := []byte("secret")
+	now := time.Unix(1700000000, 0)
+
+	seal := Sealer(key, "https://door.example/c/", 10*time.Minute, func() time.Time { return now })
+	text, err := seal("room-42")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(text, "https://door.example/c/"))
+	token := strings.TrimPrefix(text, "https://door.example/c/")
+
+	data, expires, err := VerifyExpiring(key, token, now.Add(9*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "room-42", data)
+	assert.Equal(t, now.Add(10*time.Minute), expires)
+
+	_, _, err = VerifyExpiring(key, token, now.Add(10*time.Minute))
+	assert.True(t, errors.Is(err, ErrExpired))
+	_, _, err = VerifyExpiring([]byte("other"), token, now)
+	assert.True(t, errors.Is(err, ErrBadSignature))
+	_, _, err = VerifyExpiring(key, "x"+token, now)
+	assert.Error(t, err)
+	_, _, err = VerifyExpiring(key, "nodot", now)
+	assert.True(t, errors.Is(err, ErrMalformedToken))
+
+	_, err = (&Expiring{Data: "x", Expires: now}).Payload()
+	assert.Error(t, err)
+}
+
+// ticket is a custom payload kind used to test Register.
+type ticket struct {
+	ID string `json:"id"`
+}
+
+func (t *ticket) Payload() (string, error) {
+	return "TICKET:" + t.ID, nil
+}
+
+func TestRegister(t *testing.T) {
+	Register("test-ticket", func() Builder { return &ticket{} })
+	assert.Contains(t, Kinds(), "test-ticket")
+
+	b, err := New("test-ticket")
+	assert.NoError(t, err)
+	assert.IsType(t, &ticket{}, b)
+
+	assert.Panics(t, func() { Register("test-ticket", func() Builder { return &ticket{} }) })
+	assert.Panics(t, func() { Register("nil", nil) })
+}
+
+func TestNormalizePhone(t *testing.T) {
+	cases := []struct{ number, region, want string }{
+		{"+1 (555) 123-4567", "", "+15551234567"},
+		{"(555) 123-4567", "US", "+15551234567"},
+		{"1-555-123-4567", "us", "+15551234567"},
+		{"011 44 20 7946 0958", "US", "+442079460958"},
+		{"020 7946 0958", "GB", "+442079460958"},
+		{"00 49 30 123456", "GB", "+4930123456"},
+		{"06 12 34 56 78", "FR", "+33612345678"},
+		{"06 1234 5678", "IT", "+390612345678"}, // Italy keeps the leading 0.
+		{"03-1234-5678", "JP", "+81312345678"},
+		{"8 (495) 123-45-67", "RU", "+74951234567"},
+		{"0011 1 555 123 4567", "AU", "+15551234567"},
+	}
+	for _, tc := range cases {
+		got, err := NormalizePhone(tc.number, tc.region)
+		assert.NoError(t, err, tc.number)
+		assert.Equal(t, tc.want, got, tc.number)
+	}
+
+	for _, tc := range []struct{ number, region string }{
+		{"555-1234", "XX"},
+		{"555-1234", ""},
+		{"1-800-FLOWERS", "US"},
+		{"+0 123 4567", ""},
+		{"+1 2345 6789 0123 4567", ""},
+		{"12+34", "US"},
+	} {
+		_, err := NormalizePhone(tc.number, tc.region)
+		assert.Error(t, err, tc.number)
+	}
+
+	text, err := (&Tel{Number: "020 7946 0958", Region: "GB"}).Payload()
+	assert.NoError(t, err)
+	assert.Equal(t, "tel:+442079460958", text)
+	text, err = (&SMS{Number: "(555) 123-4567", Region: "US", Message: "hi"}).Payload()
+	assert.NoError(t, err)
+	assert.Equal(t, "SMSTO:+15551234567:hi", text)
+	text, err = (&VCard{FirstName: "Ada", Phone: "030 123456", Region: "DE"}).Payload()
+	assert.NoError(t, err)
+	assert.Contains(t, text, "\r\nTEL:+4930123456\r\n")
+	_, err = (&Tel{Number: "555", Region: "ZZ"}).Payload()
+	assert.Error(t, err)
+}
+
+func TestInternationalText(t *testing.T) {
+	cases := []struct {
+		builder  Builder
+		want     string
+		warnings int
+	}{
+		{&WiFi{SSID: "Café;Wi-Fi", Password: "pw"}, `WIFI:T:WPA;S:Café\;Wi-Fi;P:pw;;`, 1},
+		{&WiFi{SSID: "CAFE01"}, `WIFI:T:nopass;S:"CAFE01";;`, 1},
+		{&WiFi{SSID: "\xff\x00net"}, "WIFI:T:nopass;S:ff006e6574;;", 1},
+		{&WiFi{SSID: "net", Password: "пароль"}, "WIFI:T:WPA;S:net;P:пароль;;", 1},
+		{&WiFi{SSID: "plain"}, "WIFI:T:nopass;S:plain;;", 0},
+		{&VCard{FirstName: "José", LastName: "Núñez", Organization: "ACME"},
+			"BEGIN:VCARD\r\nVERSION:3.0\r\nN;CHARSET=UTF-8:Núñez;José;;;\r\nFN;CHARSET=UTF-8:José Núñez\r\nORG:ACME\r\nEND:VCARD", 1},
+		{&VCard{LastName: "Smith"}, "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Smith;;;;\r\nFN:Smith\r\nEND:VCARD", 0},
+	}
+	for _, tc := range cases {
+		got, err := tc.builder.Payload()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.want, got)
+		assert.Len(t, Warnings(tc.builder), tc.warnings, tc.want)
+	}
+
+	_, err := (&WiFi{SSID: strings.Repeat("ü", 17)}).Payload()
+	assert.Error(t, err)
+	_, err = (&VCard{FirstName: "\xff"}).Payload()
+	assert.Error(t, err)
+	assert.Nil(t, Warnings(&Geo{}))
+}
+
+func TestBidiWarnings(t *testing.T) {
+	cases := []struct {
+		text     string
+		warnings int
+	}{
+		{"https://example.com/docs?q=1", 0},
+		{"Plain text", 0},
+		{"שלום עולם", 0},
+		{"invoice‮fdp.exe", 1},
+		{"a⁧b⁩c⁧d", 2},
+		{"https://example.com/אבג/page", 1},
+		{"https://example.com/אבג", 0},
+		{"https://אבג.example.com/", 1},
+		{"https://אבג.com/file-‮txt.exe", 2},
+		{"mailto:אב@example.com", 0},
+	}
+	for _, tc := range cases {
+		assert.Len(t, BidiWarnings(tc.text), tc.warnings, tc.text)
+	}
+	assert.Equal(t, []string{"bidi: U+202E RIGHT-TO-LEFT OVERRIDE changes the order in which the text is displayed"}, BidiWarnings("a‮b‮c"))
+
+	assert.Len(t, Warnings(&URL{URL: "https://example.com/אב/x"}), 1)
+	assert.Len(t, Warnings(&SMS{Number: "+15551234567", Message: "pay‮lanoitan"}), 1)
+	assert.Len(t, Warnings(&WiFi{SSID: "Café‏"}), 2)
+}
@@ -0,0 +1,131 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package payload
+
+import (
+	"fmt"
+	"strings"
+)
+
+// phoneRegion holds the dialing conventions of a region.
+type phoneRegion struct {
+	code  string // Country calling code.
+	intl  string // Prefix dialed before a country code to call abroad.
+	trunk string // Prefix dialed before a national number, dropped in E.164 form.
+}
+
+// phoneRegions maps ISO 3166-1 alpha-2 codes to their dialing conventions.
+// Italy and a few others keep their leading 0 in E.164 form, so they have no
+// trunk prefix.
+var phoneRegions = map[string]phoneRegion{
+	"AR": {"54", "00", "0"},
+	"AT": {"43", "00", "0"},
+	"AU": {"61", "0011", "0"},
+	"BE": {"32", "00", "0"},
+	"BR": {"55", "00", "0"},
+	"CA": {"1", "011", "1"},
+	"CH": {"41", "00", "0"},
+	"CN": {"86", "00", "0"},
+	"DE": {"49", "00", "0"},
+	"DK": {"45", "00", ""},
+	"ES": {"34", "00", ""},
+	"FI": {"358", "00", "0"},
+	"FR": {"33", "00", "0"},
+	"GB": {"44", "00", "0"},
+	"HK": {"852", "001", ""},
+	"IE": {"353", "00", "0"},
+	"IL": {"972", "00", "0"},
+	"IN": {"91", "00", "0"},
+	"IT": {"39", "00", ""},
+	"JP": {"81", "010", "0"},
+	"KR": {"82", "001", "0"},
+	"MX": {"52", "00", ""},
+	"NL": {"31", "00", "0"},
+	"NO": {"47", "00", ""},
+	"NZ": {"64", "00", "0"},
+	"PL": {"48", "00", ""},
+	"PT": {"351", "00", ""},
+	"RU": {"7", "810", "8"},
+	"SE": {"46", "00", "0"},
+	"SG": {"65", "000", ""},
+	"TR": {"90", "00", "0"},
+	"US": {"1", "011", "1"},
+	"ZA": {"27", "00", "0"},
+}
+
+// NormalizePhone returns number in E.164 form (a plus sign and at most 15
+// digits), which dialers understand wherever the code is scanned. Spaces,
+// dots, hyphens, slashes, and parentheses are removed. A number written
+// with a plus sign or the region's international prefix is already
+// international; any other number is taken as a national number in the
+// region, given as an ISO 3166-1 alpha-2 code such as "GB", whose trunk
+// prefix is replaced by the country code. This is a normalization, not a
+// full validation: it does not check numbering plans.
+func NormalizePhone(number, region string) (string, error) {
+	var digits strings.Builder
+	for i, r := range strings.TrimSpace(number) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+			digits.WriteRune(r)
+		case strings.ContainsRune(" .-/()\u00a0", r):
+		default:
+			return "", fmt.Errorf("payload: %q is not a phone number", number)
+		}
+	}
+	n := digits.String()
+
+	if !strings.HasPrefix(n, "+") {
+		info, ok := phoneRegions[strings.ToUpper(region)]
+		if !ok {
+			return "", fmt.Errorf("payload: unknown region %q", region)
+		}
+		switch {
+		case strings.HasPrefix(n, info.intl):
+			n = "+" + n[len(info.intl):]
+		case info.trunk != "" && strings.HasPrefix(n, info.trunk):
+			n = "+" + info.code + n[len(info.trunk):]
+		default:
+			n = "+" + info.code + n
+		}
+	}
+
+	if len(n) < 8 || len(n) > 16 || n[1] == '0' {
+		return "", fmt.Errorf("payload: %q is not a valid international number", number)
+	}
+
+	return n, nil
+}
+
+// phoneNumber normalizes number if a region is given, and otherwise returns
+// it unchanged.
+func phoneNumber(number, region string) (string, error) {
+	if region == "" {
+		return number, nil
+	}
+
+	return NormalizePhone(number, region)
+}
@@ -0,0 +1,387 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// PDFOptions controls WritePDF.
+type PDFOptions struct {
+	Page       PageSize    // Page size (default PageA4).
+	Margin     float64     // Page margin in points (default 36, half an inch).
+	Border     int         // Quiet zone in modules (default 4; negative for none).
+	ModuleSize float64     // Module size in points (default as large as fits within the margins).
+	Dark       color.Color // Color of dark modules (default black); a color.CMYK is written in DeviceCMYK.
+	Light      color.Color // Color of light modules and the quiet zone (default none, leaving the paper unprinted); a color.CMYK is written in DeviceCMYK.
+
+	// Marks, if not nil, adds print marks around the quiet zone, with
+	// distances in points, and sets the trim and bleed boxes of the page.
+	// The marks are drawn in the All separation, so they print on every
+	// plate, and count towards the margins.
+	Marks *PrintMarks
+
+	// Spot, if not nil, paints the dark modules in a spot color, a
+	// Separation color space that prints on its own plate, instead of Dark.
+	Spot *SpotColor
+}
+
+// SpotColor names a spot ink, such as a Pantone color or a foil, for PDF
+// output.
+type SpotColor struct {
+	Name      string     // The ink name the printer uses, such as "PANTONE 286 C".
+	Alternate color.CMYK // Process approximation for screens and printers without the ink.
+	Tint      float64    // Ink coverage in (0, 1] (default 1).
+}
+
+// WritePDF writes the QR code to w as a one-page vector PDF, centered within
+// the page margins. Dark modules are filled as merged rectangles, so the
+// symbol stays sharp at any print resolution. For print runs that reject RGB
+// artwork, give the colors as color.CMYK (the default black is DeviceRGB).
+func (q *QRCode) WritePDF(w io.Writer, opts PDFOptions) error {
+	if opts.Page == (PageSize{}) {
+		opts.Page = PageA4
+	}
+	if opts.Margin == 0 {
+		opts.Margin = 36
+	}
+	if opts.Border == 0 {
+		opts.Border = 4
+	} else if opts.Border < 0 {
+		opts.Border = 0
+	}
+	if opts.Dark == nil {
+		opts.Dark = color.Black
+	}
+	if opts.Spot != nil {
+		spot := *opts.Spot
+		if spot.Tint == 0 {
+			spot.Tint = 1
+		}
+		if spot.Name == "" || spot.Tint < 0 || spot.Tint > 1 {
+			return fmt.Errorf("spot color needs a name and a tint in (0, 1]")
+		}
+		opts.Spot = &spot
+	}
+	extent := 0.0
+	if opts.Marks != nil {
+		marks := *opts.Marks
+		if err := marks.normalize(8.5, 14.17, 0.25); err != nil {
+			return err
+		}
+		opts.Marks = &marks
+		extent = marks.geometry(0, 0, 0, 0).extent
+	}
+	width, height := opts.Page.Width-2*opts.Margin-2*extent, opts.Page.Height-2*opts.Margin-2*extent
+	if opts.Margin < 0 || opts.ModuleSize < 0 || width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid PDF layout")
+	}
+	modules := float64(q.Size + 2*opts.Border)
+	if opts.ModuleSize == 0 {
+		opts.ModuleSize = width / modules
+		if height < width {
+			opts.ModuleSize = height / modules
+		}
+	}
+	side := opts.ModuleSize * modules
+	if side > width+1e-9 || side > height+1e-9 {
+		return fmt.Errorf("symbol of %s points does not fit within the page margins", formatFloat(side, 3))
+	}
+
+	left := (opts.Page.Width - side) / 2
+	top := (opts.Page.Height + side) / 2
+	bleed := 0.0
+	var extra, colorSpaces string // Page dictionary entries and named color spaces.
+	if opts.Marks != nil {
+		bleed = opts.Marks.Bleed
+		extra = fmt.Sprintf(" /TrimBox [%s] /BleedBox [%s]", pdfBox(left, top-side, side, 0), pdfBox(left, top-side, side, bleed))
+		// Marks are drawn in the All separation, which prints on every plate.
+		colorSpaces += " /All " + pdfSeparation("All", color.CMYK{0xFF, 0xFF, 0xFF, 0xFF})
+	}
+	dark := pdfFillColor(opts.Dark)
+	if opts.Spot != nil {
+		colorSpaces += " /Spot " + pdfSeparation(opts.Spot.Name, opts.Spot.Alternate)
+		dark = fmt.Sprintf("/Spot cs %s scn", formatFloat(opts.Spot.Tint, 3))
+	}
+	if colorSpaces != "" {
+		extra += fmt.Sprintf(" /Resources << /ColorSpace <<%s >> >>", colorSpaces)
+	}
+
+	var sb strings.Builder
+	if opts.Light != nil {
+		fmt.Fprintf(&sb, "%s\n%s %s %[4]s %[4]s re\nf\n", pdfFillColor(opts.Light), formatFloat(left-bleed, 3), formatFloat(top-side-bleed, 3), formatFloat(side+2*bleed, 3))
+	}
+	fmt.Fprintf(&sb, "%s\n", dark)
+	border := float64(opts.Border) * opts.ModuleSize
+	pdfModules(&sb, q, left+border, top-border, opts.ModuleSize)
+	if opts.Marks != nil {
+		g := opts.Marks.geometry(left, top-side, left+side, top)
+		if len(g.lines) > 0 {
+			fmt.Fprintf(&sb, "/All CS 1 SCN %s w\n", formatFloat(opts.Marks.Stroke, 3))
+			for _, l := range g.lines {
+				fmt.Fprintf(&sb, "%s %s m %s %s l\n", formatFloat(l[0], 3), formatFloat(l[1], 3), formatFloat(l[2], 3), formatFloat(l[3], 3))
+			}
+			for _, c := range g.circles {
+				pdfCircle(&sb, c[0], c[1], c[2])
+			}
+			sb.WriteString("S\n")
+		}
+	}
+
+	p := newPDFWriter(w)
+	p.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	p.object(2, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	p.object(3, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s]%s /Contents 4 0 R >>",
+		formatFloat(opts.Page.Width, 3), formatFloat(opts.Page.Height, 3), extra))
+	p.stream(4, "", []byte(sb.String()))
+
+	return p.finish(1)
+}
+
+// pdfSeparation returns a Separation color space for the named ink, whose
+// tints map linearly onto the alternate process color.
+func pdfSeparation(name string, alternate color.CMYK) string {
+	f := func(v uint8) string { return formatFloat(float64(v)/255, 3) }
+	return fmt.Sprintf("[/Separation %s /DeviceCMYK << /FunctionType 2 /Domain [0 1] /C0 [0 0 0 0] /C1 [%s %s %s %s] /N 1 >>]",
+		pdfName(name), f(alternate.C), f(alternate.M), f(alternate.Y), f(alternate.K))
+}
+
+// pdfName returns s as a PDF name, escaping whitespace, delimiters, and
+// bytes outside printable ASCII as #XX.
+func pdfName(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('/')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x21 || c > 0x7E || strings.IndexByte("#()<>[]{}/%", c) >= 0 {
+			fmt.Fprintf(&sb, "#%02X", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String()
+}
+
+// pdfBox returns the corners of the square at (x, y) with the given side,
+// grown by d on every side, as the contents of a PDF rectangle.
+func pdfBox(x, y, side, d float64) string {
+	return fmt.Sprintf("%s %s %s %s", formatFloat(x-d, 3), formatFloat(y-d, 3), formatFloat(x+side+d, 3), formatFloat(y+side+d, 3))
+}
+
+// pdfCircle appends a circle, as four Bézier curves, to the current path.
+func pdfCircle(sb *strings.Builder, cx, cy, r float64) {
+	k := 0.5523 * r // Control point distance for a quarter circle.
+	f := func(v float64) string { return formatFloat(v, 3) }
+	fmt.Fprintf(sb, "%s %s m\n", f(cx+r), f(cy))
+	fmt.Fprintf(sb, "%s %s %s %s %s %s c\n", f(cx+r), f(cy+k), f(cx+k), f(cy+r), f(cx), f(cy+r))
+	fmt.Fprintf(sb, "%s %s %s %s %s %s c\n", f(cx-k), f(cy+r), f(cx-r), f(cy+k), f(cx-r), f(cy))
+	fmt.Fprintf(sb, "%s %s %s %s %s %s c\n", f(cx-r), f(cy-k), f(cx-k), f(cy-r), f(cx), f(cy-r))
+	fmt.Fprintf(sb, "%s %s %s %s %s %s c\n", f(cx+k), f(cy-r), f(cx+r), f(cy-k), f(cx+r), f(cy))
+}
+
+// pdfFillColor returns the operator setting c as the fill color: in
+// DeviceCMYK for color.CMYK values, so that print artwork keeps the exact ink
+// percentages, and in DeviceRGB otherwise.
+func pdfFillColor(c color.Color) string {
+	if k, ok := c.(color.CMYK); ok {
+		return fmt.Sprintf("%s %s %s %s k", formatFloat(float64(k.C)/255, 3), formatFloat(float64(k.M)/255, 3), formatFloat(float64(k.Y)/255, 3), formatFloat(float64(k.K)/255, 3))
+	}
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+
+	return fmt.Sprintf("%s %s %s rg", formatFloat(float64(n.R)/255, 3), formatFloat(float64(n.G)/255, 3), formatFloat(float64(n.B)/255, 3))
+}
+
+// pdfWriter writes a PDF file object by object, remembering only the byte
+// offset of each object for the cross-reference table.
+type pdfWriter struct {
+	w       *bufio.Writer
+	offset  int64
+	offsets []int64 // Offset of each object, indexed by object number (entry 0 is unused).
+	err     error
+}
+
+func newPDFWriter(w io.Writer) *pdfWriter {
+	p := &pdfWriter{w: bufio.NewWriter(w), offsets: []int64{0}}
+	// The binary comment tells transfer programs that the file is not text.
+	p.printf("%%PDF-1.4\n%%\xE2\xE3\xCF\xD3\n")
+	return p
+}
+
+func (p *pdfWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(p.w, format, args...)
+	p.offset += int64(n)
+	p.err = err
+}
+
+func (p *pdfWriter) write(b []byte) {
+	if p.err != nil {
+		return
+	}
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	p.err = err
+}
+
+// object writes object number n with the given body (a dictionary or other
+// direct object).
+func (p *pdfWriter) object(n int, body string) {
+	p.startObject(n)
+	p.printf("%s\nendobj\n", body)
+}
+
+// stream writes object number n as a Flate-compressed stream with the given
+// extra dictionary entries.
+func (p *pdfWriter) stream(n int, dict string, data []byte) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(data)
+	zw.Close()
+
+	p.startObject(n)
+	p.printf("<< /Length %d /Filter /FlateDecode%s >>\nstream\n", compressed.Len(), dict)
+	p.write(compressed.Bytes())
+	p.printf("\nendstream\nendobj\n")
+}
+
+func (p *pdfWriter) startObject(n int) {
+	for len(p.offsets) <= n {
+		p.offsets = append(p.offsets, -1)
+	}
+	p.offsets[n] = p.offset
+	p.printf("%d 0 obj\n", n)
+}
+
+// finish writes the cross-reference table and trailer and flushes the output.
+// root is the object number of the document catalog.
+func (p *pdfWriter) finish(root int) error {
+	xref := p.offset
+	p.printf("xref\n0 %d\n0000000000 65535 f \n", len(p.offsets))
+	for _, off := range p.offsets[1:] {
+		if off < 0 {
+			p.printf("0000000000 65535 f \n")
+			continue
+		}
+		p.printf("%010d 00000 n \n", off)
+	}
+	p.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.offsets), root, xref)
+	if p.err != nil {
+		return p.err
+	}
+
+	return p.w.Flush()
+}
+
+// pdfModules appends PDF path operators filling the dark modules of q, with
+// the top-left corner of the symbol (excluding the border) at (x, y) in PDF
+// coordinates (y grows upward) and each module size points square.
+// Horizontal runs of dark modules become a single rectangle.
+func pdfModules(sb *strings.Builder, q *QRCode, x, y, size float64) {
+	for row := 0; row < q.Size; row++ {
+		for col := 0; col < q.Size; {
+			if q.Modules[row][col] == 0 {
+				col++
+				continue
+			}
+			start := col
+			for col < q.Size && q.Modules[row][col] == 1 {
+				col++
+			}
+			fmt.Fprintf(sb, "%s %s %s %s re\n",
+				formatFloat(x+float64(start)*size, 3), formatFloat(y-float64(row+1)*size, 3),
+				formatFloat(float64(col-start)*size, 3), formatFloat(size, 3))
+		}
+	}
+	sb.WriteString("f\n")
+}
+
+// pdfString returns s as a PDF literal string in WinAnsiEncoding. Characters
+// outside Latin-1 are replaced with '?'.
+func pdfString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r < 0x20:
+			sb.WriteByte(' ')
+		case r < 0x7F || (0xA0 <= r && r <= 0xFF):
+			sb.WriteByte(byte(r))
+		default:
+			sb.WriteByte('?')
+		}
+	}
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
+// PageSize is a PDF page size in points (1/72 inch).
+type PageSize struct {
+	Width, Height float64
+}
+
+// Common page sizes.
+var (
+	PageA4     = PageSize{595.28, 841.89}
+	PageLetter = PageSize{612, 792}
+)
+
+// helveticaWidths are the advance widths of the printable ASCII characters in
+// the standard Helvetica font, in thousandths of the font size.
+var helveticaWidths = [95]int16{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 to ?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ to O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P to _
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` to o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p to ~
+}
+
+// helveticaWidth returns the width of s set in Helvetica at the given size.
+// Characters outside ASCII are assumed to be as wide as a digit.
+func helveticaWidth(s string, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		if 0x20 <= r && r < 0x7F {
+			total += int(helveticaWidths[r-0x20])
+		} else {
+			total += 556
+		}
+	}
+
+	return float64(total) * size / 1000
+}
@@ -0,0 +1,136 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"image/png"
+	"sort"
+	"strings"
+)
+
+// PictureOptions configures ToPictureHTML.
+type PictureOptions struct {
+	Border      int                             // Border (quiet zone) width in modules.
+	Widths      []int                           // Displayed widths in CSS pixels (default 128, 256, and 512).
+	Densities   []int                           // Pixel density multipliers (default 1 and 2).
+	Alt         string                          // Alternative text for the img element.
+	Sizes       string                          // The img sizes attribute (default lets the image grow to the largest width).
+	Class       string                          // Optional class attribute for the img element.
+	IncludeSVG  bool                            // Add a <source> offering the SVG rendering ahead of the PNG renditions.
+	URL         func(pixels int) (string, bool) // If not nil, returns the URL of the PNG rendition of the given pixel size instead of embedding a data URI; return false to embed that size.
+	Supersample int                             // If above 1, renditions whose size is not a multiple of the modules are drawn with ToSupersampledImage at this many samples.
+}
+
+// ToPictureHTML returns a complete <picture> element whose img srcset lists a
+// PNG rendition for every combination of opts.Widths and opts.Densities. The
+// renditions are embedded as data URIs unless opts.URL supplies a URL for
+// them.
+func (q *QRCode) ToPictureHTML(opts PictureOptions) (string, error) {
+	widths := opts.Widths
+	if len(widths) == 0 {
+		widths = []int{128, 256, 512}
+	}
+	densities := opts.Densities
+	if len(densities) == 0 {
+		densities = []int{1, 2}
+	}
+
+	images, err := q.RenderScales(opts.Border, widths, densities...)
+	if err != nil {
+		return "", err
+	}
+
+	// Collect the distinct pixel sizes in ascending order.
+	sources := make(map[int]string)
+	for _, si := range images {
+		pixels := si.Image.Bounds().Dx()
+		if _, ok := sources[pixels]; ok {
+			continue
+		}
+		if opts.URL != nil {
+			if url, ok := opts.URL(pixels); ok {
+				sources[pixels] = url
+				continue
+			}
+		}
+		img := si.Image
+		if opts.Supersample > 1 && pixels%(q.Size+2*opts.Border) != 0 {
+			if img, err = q.ToSupersampledImage(pixels, opts.Border, opts.Supersample); err != nil {
+				return "", err
+			}
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return "", err
+		}
+		sources[pixels] = "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+	pixelSizes := make([]int, 0, len(sources))
+	for p := range sources {
+		pixelSizes = append(pixelSizes, p)
+	}
+	sort.Ints(pixelSizes)
+
+	srcset := make([]string, len(pixelSizes))
+	for i, p := range pixelSizes {
+		srcset[i] = fmt.Sprintf("%s %dw", sources[p], p)
+	}
+
+	minWidth, maxWidth := widths[0], widths[0]
+	for _, w := range widths {
+		minWidth = min(minWidth, w)
+		maxWidth = max(maxWidth, w)
+	}
+	sizes := opts.Sizes
+	if sizes == "" {
+		sizes = fmt.Sprintf("(max-width: %[1]dpx) 100vw, %[1]dpx", maxWidth)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<picture>\n")
+	if opts.IncludeSVG {
+		svg, err := q.ToSVGString(opts.Border, false)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "\t<source type=\"image/svg+xml\" srcset=\"data:image/svg+xml;base64,%s\">\n",
+			base64.StdEncoding.EncodeToString([]byte(svg)))
+	}
+	fmt.Fprintf(&sb, "\t<source type=\"image/png\" srcset=\"%s\" sizes=\"%s\">\n",
+		html.EscapeString(strings.Join(srcset, ", ")), html.EscapeString(sizes))
+	fmt.Fprintf(&sb, "\t<img src=\"%s\" width=\"%[2]d\" height=\"%[2]d\" alt=\"%s\"",
+		html.EscapeString(sources[pixelSizes[0]]), minWidth, html.EscapeString(opts.Alt))
+	if opts.Class != "" {
+		fmt.Fprintf(&sb, " class=\"%s\"", html.EscapeString(opts.Class))
+	}
+	sb.WriteString(">\n")
+	sb.WriteString("</picture>\n")
+
+	return sb.String(), nil
+}
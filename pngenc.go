@@ -0,0 +1,248 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// PNGFilter selects the filter applied to each row of a PNG image before
+// compression.
+type PNGFilter int
+
+// The PNG filters. For two-color images no filter is usually smallest, since
+// the bits of a byte predict each other poorly; try them on your own images.
+const (
+	PNGFilterDefault  PNGFilter = iota // As image/png: none for palette images, adaptive for others.
+	PNGFilterNone                      // No filter.
+	PNGFilterSub                       // Difference from the pixel to the left.
+	PNGFilterUp                        // Difference from the pixel above.
+	PNGFilterAverage                   // Difference from the mean of the left and upper pixels.
+	PNGFilterPaeth                     // Difference from the Paeth predictor.
+	PNGFilterAdaptive                  // The filter with the smallest sum of absolute differences, chosen per row.
+)
+
+// pngEncoder encodes images with the compression settings of PNGOptions. With
+// the default filter and compressor it is image/png.
+type pngEncoder struct {
+	level   png.CompressionLevel
+	filter  PNGFilter
+	deflate func(w io.Writer, data []byte) error
+}
+
+// Encode writes img to w. Besides the defaults, it handles the palette and
+// NRGBA images that the PNG renderers draw.
+func (e *pngEncoder) Encode(w io.Writer, img image.Image) error {
+	if e.filter == PNGFilterDefault && e.deflate == nil {
+		return (&png.Encoder{CompressionLevel: e.level}).Encode(w, img)
+	}
+
+	b := img.Bounds()
+	var colorType, depth, bpp byte
+	var palette color.Palette
+	var rowBytes int
+	switch img := img.(type) {
+	case *image.Paletted:
+		palette = img.Palette
+		colorType, depth = 3, 8
+		for _, d := range []byte{1, 2, 4} {
+			if len(palette) <= 1<<d {
+				depth = d
+				break
+			}
+		}
+		bpp = 1
+		rowBytes = (b.Dx()*int(depth) + 7) / 8
+	case *image.NRGBA:
+		colorType, depth, bpp = 2, 8, 3
+		if !img.Opaque() {
+			colorType, bpp = 6, 4
+		}
+		rowBytes = b.Dx() * int(bpp)
+	default:
+		return fmt.Errorf("cannot filter a %T", img)
+	}
+
+	// Build the filtered rows, each prefixed by its filter type.
+	raw := make([]byte, 0, (1+rowBytes)*b.Dy())
+	prev, cur := make([]byte, rowBytes), make([]byte, rowBytes)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for i := range cur {
+			cur[i] = 0
+		}
+		switch img := img.(type) {
+		case *image.Paletted:
+			for x := 0; x < b.Dx(); x++ {
+				bit := x * int(depth)
+				cur[bit/8] |= img.ColorIndexAt(b.Min.X+x, y) << (8 - int(depth) - bit%8)
+			}
+		case *image.NRGBA:
+			row := img.Pix[img.PixOffset(b.Min.X, y):]
+			for x := 0; x < b.Dx(); x++ {
+				copy(cur[x*int(bpp):(x+1)*int(bpp)], row[x*4:])
+			}
+		}
+		raw = appendFilteredRow(raw, e.filter, int(bpp), cur, prev)
+		prev, cur = cur, prev
+	}
+
+	var data bytes.Buffer
+	if e.deflate != nil {
+		if err := e.deflate(&data, raw); err != nil {
+			return err
+		}
+	} else {
+		zw, err := zlib.NewWriterLevel(&data, zlibLevel(e.level))
+		if err != nil {
+			return err
+		}
+		zw.Write(raw)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("\x89PNG\r\n\x1a\n")
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(header[4:], uint32(b.Dy()))
+	header[8], header[9] = depth, colorType
+	writePNGChunk(&out, "IHDR", header)
+	if palette != nil {
+		plte := make([]byte, 0, 3*len(palette))
+		trns := make([]byte, 0, len(palette))
+		opaque := true
+		for _, c := range palette {
+			nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+			plte = append(plte, nc.R, nc.G, nc.B)
+			trns = append(trns, nc.A)
+			opaque = opaque && nc.A == 0xFF
+		}
+		writePNGChunk(&out, "PLTE", plte)
+		if !opaque {
+			writePNGChunk(&out, "tRNS", trns)
+		}
+	}
+	writePNGChunk(&out, "IDAT", data.Bytes())
+	writePNGChunk(&out, "IEND", nil)
+	_, err := w.Write(out.Bytes())
+
+	return err
+}
+
+// appendFilteredRow appends the filter type and the filtered bytes of cur,
+// whose previous row is prev, to dst.
+func appendFilteredRow(dst []byte, filter PNGFilter, bpp int, cur, prev []byte) []byte {
+	if filter == PNGFilterAdaptive {
+		best, bestSum := PNGFilterNone, -1
+		for f := PNGFilterNone; f <= PNGFilterPaeth; f++ {
+			sum := 0
+			for _, b := range appendFilteredRow(nil, f, bpp, cur, prev)[1:] {
+				sum += abs(int(int8(b)))
+			}
+			if bestSum < 0 || sum < bestSum {
+				best, bestSum = f, sum
+			}
+		}
+		filter = best
+	}
+	if filter == PNGFilterDefault {
+		filter = PNGFilterNone
+	}
+
+	dst = append(dst, byte(filter-PNGFilterNone))
+	for i, x := range cur {
+		var a, c byte // The bytes to the left and upper left.
+		if i >= bpp {
+			a, c = cur[i-bpp], prev[i-bpp]
+		}
+		up := prev[i]
+		switch filter {
+		case PNGFilterSub:
+			x -= a
+		case PNGFilterUp:
+			x -= up
+		case PNGFilterAverage:
+			x -= byte((int(a) + int(up)) / 2)
+		case PNGFilterPaeth:
+			x -= paeth(a, up, c)
+		}
+		dst = append(dst, x)
+	}
+
+	return dst
+}
+
+// paeth returns whichever of a (left), b (up), and c (upper left) is closest
+// to a + b - c.
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+
+	return c
+}
+
+func writePNGChunk(w *bytes.Buffer, name string, data []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	w.Write(length[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(name))
+	crc.Write(data)
+	w.WriteString(name)
+	w.Write(data)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	w.Write(sum[:])
+}
+
+// zlibLevel maps an image/png compression level to a compress/zlib one.
+func zlibLevel(level png.CompressionLevel) int {
+	switch level {
+	case png.NoCompression:
+		return zlib.NoCompression
+	case png.BestSpeed:
+		return zlib.BestSpeed
+	case png.BestCompression:
+		return zlib.BestCompression
+	}
+
+	return zlib.DefaultCompression
+}
@@ -0,0 +1,122 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+)
+
+// PointCloudOptions configures the physical layout of the points produced by
+// DarkModuleCenters and the point cloud writers.
+type PointCloudOptions struct {
+	ModuleSize float64 // Distance between module centers in physical units (0 is treated as 1).
+	Border     int     // Quiet zone in modules between Origin and the first module.
+	Origin     Point   // Physical position of the outer corner of the quiet zone.
+	Units      string  // Name of the physical unit, recorded in the JSON output (for example "mm").
+	FlipY      bool    // Measure y upward from the bottom edge (machine coordinates) instead of downward from the top.
+	Serpentine bool    // Reverse every other row so that a marking head does not travel back across the symbol.
+}
+
+// DarkModuleCenters returns the physical coordinates of the center of every
+// dark module, row by row, for dot-peen marking machines and drilling rigs
+// that mark a symbol point by point.
+func (q *QRCode) DarkModuleCenters(opts PointCloudOptions) []Point {
+	moduleSize := opts.ModuleSize
+	if moduleSize == 0 {
+		moduleSize = 1
+	}
+	total := float64(q.Size+opts.Border*2) * moduleSize
+
+	var result []Point
+	for y := 0; y < q.Size; y++ {
+		reverse := opts.Serpentine && y%2 == 1
+		for i := 0; i < q.Size; i++ {
+			x := i
+			if reverse {
+				x = q.Size - 1 - i
+			}
+			if q.Modules[y][x] != 1 {
+				continue
+			}
+			p := Point{
+				X: (float64(x+opts.Border) + 0.5) * moduleSize,
+				Y: (float64(y+opts.Border) + 0.5) * moduleSize,
+			}
+			if opts.FlipY {
+				p.Y = total - p.Y
+			}
+			result = append(result, Point{p.X + opts.Origin.X, p.Y + opts.Origin.Y})
+		}
+	}
+
+	return result
+}
+
+// WritePointsCSV writes the dark module centers as CSV with an "x,y" header
+// row.
+func (q *QRCode) WritePointsCSV(w io.Writer, opts PointCloudOptions) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"x", "y"}); err != nil {
+		return err
+	}
+	for _, p := range q.DarkModuleCenters(opts) {
+		if err := cw.Write([]string{formatFloat(p.X, -1), formatFloat(p.Y, -1)}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// pointCloud is the JSON form written by WritePointsJSON.
+type pointCloud struct {
+	Units      string       `json:"units,omitempty"`
+	ModuleSize float64      `json:"moduleSize"`
+	Count      int          `json:"count"`
+	Points     [][2]float64 `json:"points"`
+}
+
+// WritePointsJSON writes the dark module centers as a JSON object with the
+// units, module size, point count, and an array of [x, y] pairs.
+func (q *QRCode) WritePointsJSON(w io.Writer, opts PointCloudOptions) error {
+	points := q.DarkModuleCenters(opts)
+	cloud := pointCloud{
+		Units:      opts.Units,
+		ModuleSize: opts.ModuleSize,
+		Count:      len(points),
+		Points:     make([][2]float64, len(points)),
+	}
+	if cloud.ModuleSize == 0 {
+		cloud.ModuleSize = 1
+	}
+	for i, p := range points {
+		cloud.Points[i] = [2]float64{p.X, p.Y}
+	}
+
+	return json.NewEncoder(w).Encode(cloud)
+}
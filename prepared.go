@@ -0,0 +1,89 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import "sync"
+
+// PreparedSegments holds segments together with their data bit string (mode
+// indicators, character counts, and data), so that the same payload can be
+// encoded at several error correction levels or version ranges, as when
+// searching for the best fit, without rebuilding it. The bit string depends
+// only on the version's character count width, so at most three are built.
+// A PreparedSegments is safe for concurrent use.
+type PreparedSegments struct {
+	segs []*QRSegment
+
+	mu   sync.Mutex
+	bits [3]bitBuffer // By versionClass; nil until built.
+}
+
+// PrepareSegments wraps segments for repeated encoding. The segments must not
+// be modified afterwards.
+func PrepareSegments(segs []*QRSegment) *PreparedSegments {
+	return &PreparedSegments{segs: segs}
+}
+
+// PrepareText segments text as EncodeText does and wraps the segments for
+// repeated encoding.
+func PrepareText(text string) *PreparedSegments {
+	return PrepareSegments(MakeSegments(text))
+}
+
+// Segments returns the prepared segments.
+func (p *PreparedSegments) Segments() []*QRSegment {
+	return p.segs
+}
+
+// Encode is EncodeSegments for the prepared segments.
+func (p *PreparedSegments) Encode(ecl ECL, options ...func(*segmentEncoder)) (*QRCode, error) {
+	return encodePrepared(p, ecl, options)
+}
+
+// versionClass returns the index of the character count width range that
+// contains the version: 1 to 9, 10 to 26, or 27 to 40 (the same index as
+// Mode.numCharCountBits).
+func versionClass(version Version) int {
+	return int((version + 7) / 17)
+}
+
+// bitstream returns the data bit string for the version. The result is shared
+// and must not be modified.
+func (p *PreparedSegments) bitstream(version Version) bitBuffer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	class := versionClass(version)
+	if p.bits[class] == nil {
+		bb := make(bitBuffer, 0, getTotalBits(p.segs, version))
+		for _, seg := range p.segs {
+			bb.appendBits(int(seg.modeBits), 4)
+			bb.appendBits(seg.NumChars, seg.Mode.numCharCountBits(version))
+			bb = append(bb, seg.Data...)
+		}
+		p.bits[class] = bb
+	}
+
+	return p.bits[class]
+}
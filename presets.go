@@ -0,0 +1,147 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Preset bundles encoding and rendering settings tuned for one use. Presets
+// are versioned: when the tuning of a preset changes, its Revision is bumped,
+// and configuration files may pin a revision as "name@revision".
+type Preset struct {
+	Name     string
+	Revision int
+	EncodeConfig
+	Scale       int     // Pixels per module for raster output.
+	ModuleMM    float64 // Printed module size in millimeters (0 for screen use).
+	MaxSymbolMM float64 // Largest printed width, quiet zone included, the preset guarantees (0 for no limit).
+	Description string
+}
+
+// Built-in presets.
+var (
+	PresetBusinessCard = Preset{
+		Name:         "business-card",
+		Revision:     1,
+		EncodeConfig: EncodeConfig{ECL: Quartile, Border: 4, BoostECL: true, MinVersion: 1, MaxVersion: 10, Mask: -1},
+		Scale:        12,
+		ModuleMM:     0.4,
+		MaxSymbolMM:  30,
+		Description:  "Offset-printed cards scanned at arm's length; extra error correction for glossy stock and small logos.",
+	}
+	PresetLabel25mm = Preset{
+		Name:         "label-25mm",
+		Revision:     1,
+		EncodeConfig: EncodeConfig{ECL: Medium, Border: 4, BoostECL: true, MinVersion: 1, MaxVersion: 6, Mask: -1},
+		Scale:        6,
+		ModuleMM:     0.5,
+		MaxSymbolMM:  25,
+		Description:  "Square 25 mm labels from thermal-transfer label printers.",
+	}
+	PresetScreenDisplay = Preset{
+		Name:         "screen-display",
+		Revision:     1,
+		EncodeConfig: EncodeConfig{ECL: Medium, Border: 4, BoostECL: true, MinVersion: 1, MaxVersion: 25, Mask: -1},
+		Scale:        8,
+		Description:  "Codes shown on phones, monitors, and kiosks, where contrast is high but the display may be small.",
+	}
+	PresetReceiptPrinter = Preset{
+		Name:         "receipt-printer",
+		Revision:     1,
+		EncodeConfig: EncodeConfig{ECL: Medium, Border: 4, BoostECL: true, MinVersion: 1, MaxVersion: 8, Mask: -1},
+		Scale:        6,
+		ModuleMM:     0.75,
+		MaxSymbolMM:  48,
+		Description:  "203 dpi thermal receipt printers with 48 mm of printable width; 6 dots per module survive fading paper.",
+	}
+)
+
+var presets = map[string]Preset{
+	PresetBusinessCard.Name:   PresetBusinessCard,
+	PresetLabel25mm.Name:      PresetLabel25mm,
+	PresetScreenDisplay.Name:  PresetScreenDisplay,
+	PresetReceiptPrinter.Name: PresetReceiptPrinter,
+}
+
+// LookupPreset returns the named built-in preset. The name may carry a
+// revision ("label-25mm@1"), in which case it must match the current one, so
+// that a configuration file never silently picks up retuned settings.
+func LookupPreset(name string) (Preset, error) {
+	revision := 0
+	if i := strings.IndexByte(name, '@'); i >= 0 {
+		r, err := strconv.Atoi(name[i+1:])
+		if err != nil || r < 1 {
+			return Preset{}, fmt.Errorf("invalid preset revision in %q", name)
+		}
+		name, revision = name[:i], r
+	}
+
+	p, ok := presets[name]
+	if !ok {
+		return Preset{}, fmt.Errorf("unknown preset %q", name)
+	}
+	if revision != 0 && revision != p.Revision {
+		return Preset{}, fmt.Errorf("preset %q is at revision %d, not %d", name, p.Revision, revision)
+	}
+
+	return p, nil
+}
+
+// PresetNames returns the names of the built-in presets in sorted order.
+func PresetNames() []string {
+	result := make([]string, 0, len(presets))
+	for name := range presets {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// Encoder returns an Encoder with the preset's settings.
+func (p Preset) Encoder() Encoder {
+	return Encoder{EncodeConfig: p.EncodeConfig}
+}
+
+// MarshalText implements encoding.TextMarshaler, producing "name@revision".
+func (p Preset) MarshalText() ([]byte, error) {
+	return []byte(p.Name + "@" + strconv.Itoa(p.Revision)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler using LookupPreset, so a
+// preset can be selected by name in JSON, YAML, or TOML configuration.
+func (p *Preset) UnmarshalText(text []byte) error {
+	preset, err := LookupPreset(string(text))
+	if err != nil {
+		return err
+	}
+	*p = preset
+
+	return nil
+}
@@ -0,0 +1,178 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"regexp"
+	"sort"
+)
+
+// PrivacyKind identifies a category of sensitive data found by ScanPrivacy.
+type PrivacyKind string
+
+// The kinds of sensitive data recognized by ScanPrivacy.
+const (
+	PrivacyEmail        PrivacyKind = "email"
+	PrivacyPhone        PrivacyKind = "phone"
+	PrivacyCardNumber   PrivacyKind = "card-number"
+	PrivacyAWSAccessKey PrivacyKind = "aws-access-key"
+	PrivacyAWSSecretKey PrivacyKind = "aws-secret-key"
+	PrivacyJWT          PrivacyKind = "jwt"
+	PrivacyPrivateKey   PrivacyKind = "private-key"
+)
+
+// PrivacyFinding is one likely piece of personal or secret data in a payload.
+type PrivacyFinding struct {
+	Kind     PrivacyKind
+	Start    int    // Byte offset of the match in the text.
+	End      int    // Byte offset just past the match.
+	Redacted string // The first few characters of the match followed by "...", safe to log.
+}
+
+// privacyPatterns are checked in order; a later match that overlaps an
+// earlier finding is dropped, so card numbers are not also reported as phone
+// numbers.
+var privacyPatterns = []struct {
+	kind  PrivacyKind
+	re    *regexp.Regexp
+	group int                     // Submatch holding the sensitive part.
+	check func(match string) bool // Optional extra validation.
+}{
+	{PrivacyPrivateKey, regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`), 0, nil},
+	{PrivacyJWT, regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), 0, nil},
+	{PrivacyAWSAccessKey, regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), 0, nil},
+	{PrivacyAWSSecretKey, regexp.MustCompile(`(?i)aws.{0,20}?[=:"' ]\s*([A-Za-z0-9/+]{40})\b`), 1, nil},
+	{PrivacyEmail, regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), 0, nil},
+	{PrivacyCardNumber, regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), 0, luhnValid},
+	{PrivacyPhone, regexp.MustCompile(`\+?\(?\d[\d\s().-]{6,}\d`), 0, isPhoneLength},
+}
+
+// ScanPrivacy looks for data that probably should not be baked into a widely
+// distributed QR code: email addresses, phone numbers, payment card numbers,
+// AWS keys, JSON Web Tokens, and PEM private keys. The findings are sorted by
+// position. The checks are heuristics; a clean result is not a guarantee.
+func ScanPrivacy(text string) []PrivacyFinding {
+	var findings []PrivacyFinding
+	overlaps := func(start, end int) bool {
+		for _, f := range findings {
+			if start < f.End && f.Start < end {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, p := range privacyPatterns {
+		for _, loc := range p.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := loc[2*p.group], loc[2*p.group+1]
+			match := text[start:end]
+			if (p.check != nil && !p.check(match)) || overlaps(start, end) {
+				continue
+			}
+			findings = append(findings, PrivacyFinding{Kind: p.kind, Start: start, End: end, Redacted: redact(match)})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Start < findings[j].Start })
+
+	return findings
+}
+
+// WithPrivacyCheck makes EncodeText scan the text with ScanPrivacy and fail
+// with a *PrivacyError if anything is found, except findings of the ignored
+// kinds (for example PrivacyPhone when encoding a tel: payload on purpose).
+func WithPrivacyCheck(ignore ...PrivacyKind) func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.privacyCheck = true
+		s.privacyIgnore = ignore
+	}
+}
+
+// checkPrivacy returns a *PrivacyError for the findings in text that are not
+// of an ignored kind.
+func checkPrivacy(text string, ignore []PrivacyKind) error {
+	var findings []PrivacyFinding
+outer:
+	for _, f := range ScanPrivacy(text) {
+		for _, k := range ignore {
+			if f.Kind == k {
+				continue outer
+			}
+		}
+		findings = append(findings, f)
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+
+	return &PrivacyError{Findings: findings}
+}
+
+func redact(s string) string {
+	const keep = 4
+	if len(s) <= keep*2 {
+		return "..."
+	}
+
+	return s[:keep] + "..."
+}
+
+// isPhoneLength reports whether s has as many digits as a phone number: at
+// least 9, and at most the 15 allowed by E.164.
+func isPhoneLength(s string) bool {
+	n := countDigits(s)
+	return 9 <= n && n <= 15
+}
+
+func countDigits(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if '0' <= s[i] && s[i] <= '9' {
+			n++
+		}
+	}
+
+	return n
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum used by
+// payment card numbers.
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || '9' < s[i] {
+			continue
+		}
+		d := int(s[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
@@ -0,0 +1,234 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"sync"
+)
+
+// ScannerProfile describes the capabilities of the scanners that will read a
+// symbol. EncodeAuto uses it to choose the symbol, and Check reports whether a
+// rendered symbol is within its limits.
+type ScannerProfile struct {
+	Name        string
+	MicroQR     bool    // The scanners read Micro QR symbols.
+	MaxVersion  Version // Largest QR version the scanners resolve (0 for no limit).
+	MinModuleMM float64 // Smallest printed module, in millimeters, the scanners resolve (0 for no limit).
+	Inverted    bool    // The scanners read light modules on a dark background.
+	Colors      bool    // The scanners read colored symbols; otherwise only shades of gray.
+	Description string
+}
+
+// Built-in scanner profiles.
+var (
+	ProfileSmartphone = ScannerProfile{
+		Name:        "generic-smartphone",
+		MaxVersion:  25,
+		MinModuleMM: 0.25,
+		Inverted:    true,
+		Colors:      true,
+		Description: "Camera apps on current phones; most do not read Micro QR, and dense symbols need steady hands.",
+	}
+	ProfileIndustrialLaser = ScannerProfile{
+		Name:        "industrial-laser",
+		MicroQR:     true,
+		MaxVersion:  10,
+		MinModuleMM: 0.1,
+		Inverted:    true,
+		Description: "Fixed-mount industrial readers of laser-marked parts, which may be etched light on dark.",
+	}
+	ProfileEmbeddedCCD = ScannerProfile{
+		Name:        "embedded-ccd",
+		MaxVersion:  7,
+		MinModuleMM: 0.33,
+		Description: "Low-resolution monochrome CCD engines built into kiosks, lockers, and turnstiles.",
+	}
+)
+
+var (
+	scannerProfilesMu sync.RWMutex
+	scannerProfiles   = map[string]ScannerProfile{
+		ProfileSmartphone.Name:      ProfileSmartphone,
+		ProfileIndustrialLaser.Name: ProfileIndustrialLaser,
+		ProfileEmbeddedCCD.Name:     ProfileEmbeddedCCD,
+	}
+)
+
+// RegisterScannerProfile adds a profile to the registry, or replaces the one
+// with the same name, so that it can be found with LookupScannerProfile and is
+// considered by ReadableBy. It is safe for concurrent use.
+func RegisterScannerProfile(p ScannerProfile) error {
+	if p.Name == "" {
+		return fmt.Errorf("scanner profile has no name")
+	}
+	if p.MaxVersion != 0 && (p.MaxVersion < MinVersion || MaxVersion < p.MaxVersion) {
+		return fmt.Errorf("invalid maximum version %d", p.MaxVersion)
+	}
+	if p.MinModuleMM < 0 {
+		return fmt.Errorf("minimum module size must be non-negative")
+	}
+
+	scannerProfilesMu.Lock()
+	scannerProfiles[p.Name] = p
+	scannerProfilesMu.Unlock()
+
+	return nil
+}
+
+// LookupScannerProfile returns the named registered profile.
+func LookupScannerProfile(name string) (ScannerProfile, error) {
+	scannerProfilesMu.RLock()
+	p, ok := scannerProfiles[name]
+	scannerProfilesMu.RUnlock()
+	if !ok {
+		return ScannerProfile{}, fmt.Errorf("unknown scanner profile %q", name)
+	}
+
+	return p, nil
+}
+
+// ScannerProfileNames returns the names of the registered profiles in sorted
+// order.
+func ScannerProfileNames() []string {
+	scannerProfilesMu.RLock()
+	result := make([]string, 0, len(scannerProfiles))
+	for name := range scannerProfiles {
+		result = append(result, name)
+	}
+	scannerProfilesMu.RUnlock()
+	sort.Strings(result)
+
+	return result
+}
+
+// EncodeAuto encodes text as the smallest standard-compliant symbol that the
+// profile's scanners can read: a Micro QR symbol (see EncodeMicro) when the
+// profile allows it and the text fits, and a regular QR code of at most the
+// profile's MaxVersion otherwise. The error correction level comes from the
+// package-wide defaults (see SetDefaults).
+//
+// The input limit, normalization, privacy, spoofing, alphanumeric policy,
+// empty payload and audit options apply to both kinds of symbol. Micro QR
+// cannot honour WithForcedMode, WithOptimalSegments, WithMask, WithPadding or
+// WithRowCallback, so a regular QR code is produced when any of them is given.
+func EncodeAuto(text string, profile ScannerProfile, options ...func(*segmentEncoder)) (*QRCode, error) {
+	d := Defaults()
+	s := segmentEncoder{maxInput: d.MaxInput, mask: d.Mask}
+	for _, o := range options {
+		o(&s)
+	}
+
+	microOK := s.forcedMode == nil && !s.optimalSegments && s.mask == d.Mask &&
+		s.padding == nil && s.rowCallback == nil
+	if profile.MicroQR && d.ECL <= Quartile && microOK {
+		if s.maxInput > 0 && len(text) > s.maxInput {
+			return nil, &InputTooLargeError{Size: len(text), Limit: s.maxInput}
+		}
+		checked, err := s.checkText(text)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkAlphanumeric(checked); err != nil {
+			return nil, err
+		}
+		if s.rejectEmpty && checked == "" {
+			return nil, ErrEmptyPayload
+		}
+		if q, payload, err := encodeMicro(checked, d.ECL); err == nil {
+			if err := s.auditEncode(q, q.Hash, payload); err != nil {
+				return nil, err
+			}
+			return q, nil
+		}
+	}
+
+	if profile.MaxVersion != 0 {
+		options = append(options, func(s *segmentEncoder) {
+			if s.maxVersion > profile.MaxVersion {
+				s.maxVersion = profile.MaxVersion
+			}
+		})
+	}
+
+	return EncodeText(text, d.ECL, options...)
+}
+
+// Check reports, as a *ProfileError, the ways in which q rendered with theme
+// (nil for black on white) at moduleMM millimeters per module (0 if unknown)
+// exceeds the capabilities of the profile's scanners.
+func (p ScannerProfile) Check(q *QRCode, theme *Theme, moduleMM float64) error {
+	var problems []string
+	if q.Micro && !p.MicroQR {
+		problems = append(problems, "micro QR is not supported")
+	}
+	if !q.Micro && p.MaxVersion != 0 && q.Version > p.MaxVersion {
+		problems = append(problems, fmt.Sprintf("version %d exceeds the maximum of %d", q.Version, p.MaxVersion))
+	}
+	if moduleMM != 0 && moduleMM < p.MinModuleMM {
+		problems = append(problems, fmt.Sprintf("module size %gmm is below the minimum of %gmm", moduleMM, p.MinModuleMM))
+	}
+
+	if theme != nil {
+		c, err := theme.colors()
+		if err != nil {
+			return err
+		}
+		if !p.Inverted && relativeLuminance(c.dark) > relativeLuminance(c.light) {
+			problems = append(problems, "inverted symbols are not supported")
+		}
+		if !p.Colors {
+			for _, col := range []color.NRGBA{c.dark, c.light, c.eye} {
+				if col.R != col.G || col.G != col.B {
+					problems = append(problems, "colored symbols are not supported")
+					break
+				}
+			}
+		}
+	}
+
+	if len(problems) != 0 {
+		return &ProfileError{Profile: p.Name, Problems: problems}
+	}
+
+	return nil
+}
+
+// ReadableBy returns the names of the registered scanner profiles whose Check
+// accepts q rendered with theme at moduleMM millimeters per module, in sorted
+// order, to advise which scanners a symbol can be deployed to.
+func ReadableBy(q *QRCode, theme *Theme, moduleMM float64) []string {
+	var result []string
+	for _, name := range ScannerProfileNames() {
+		p, err := LookupScannerProfile(name)
+		if err == nil && p.Check(q, theme, moduleMM) == nil {
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
@@ -25,9 +25,15 @@
 package qrcodegen
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"math"
+	"math/bits"
+	"math/rand"
 	"strings"
+	"sync"
 )
 
 // QRCode represents a QR code symbol, which is a type of two-dimensional
@@ -37,6 +43,7 @@ type QRCode struct {
 	Size                 int        // The width and height of the square QR code symbol as measured in "modules" (smallest square, either black or white, in a QR code).
 	ErrorCorrectionLevel ECL        // The error correction level used in this QR code.
 	Mask                            // The type of mask [0, 7] used in this QR code.
+	Micro                bool       // The symbol is a Micro QR code (see EncodeMicro), whose Version is in [1, 4] and Mask in [0, 3].
 	Modules              [][]Module // The modules ("pixels") that make up this QR code (black = 1, white = 0)
 	isFunction           [][]bool   // Indicates that a module is a "function" (contains metadata and does not represent part of the message of the QR code).
 }
@@ -55,19 +62,34 @@ const (
 	penaltyN4 = 10
 )
 
-// EncodeBinary encodes a byte slice into a QR code symbol with the given error correction level.
-func EncodeBinary(data []byte, ecl ECL) (*QRCode, error) {
+// EncodeBinary encodes a byte slice into a QR code symbol with the given error
+// correction level. Empty data is encoded as a single zero-length byte-mode
+// segment, unless WithRejectEmpty is given.
+func EncodeBinary(data []byte, ecl ECL, options ...func(*segmentEncoder)) (*QRCode, error) {
+	if err := checkInputSize(len(data), options); err != nil {
+		return nil, err
+	}
+
 	seg := MakeBytes(data)
-	return EncodeSegments([]*QRSegment{seg}, ecl)
+	return EncodeSegments([]*QRSegment{seg}, ecl, options...)
 }
 
 // EncodeSegments creates the QR code structure from one or more QR segments.
+// Settings not given as options come from the package-wide defaults (see
+// SetDefaults).
 func EncodeSegments(segs []*QRSegment, ecl ECL, options ...func(*segmentEncoder)) (*QRCode, error) {
+	return encodePrepared(&PreparedSegments{segs: segs}, ecl, options)
+}
+
+// encodePrepared implements EncodeSegments and PreparedSegments.Encode.
+func encodePrepared(p *PreparedSegments, ecl ECL, options []func(*segmentEncoder)) (*QRCode, error) {
+	segs := p.segs
+	d := Defaults()
 	s := segmentEncoder{
-		boostECL:   true,
-		mask:       -1, // Set to automatic mask selection.
-		maxVersion: 40,
-		minVersion: 1,
+		boostECL:   d.BoostECL,
+		mask:       d.Mask,
+		maxVersion: d.MaxVersion,
+		minVersion: d.MinVersion,
 	}
 	for _, o := range options {
 		o(&s)
@@ -81,8 +103,13 @@ func EncodeSegments(segs []*QRSegment, ecl ECL, options ...func(*segmentEncoder)
 		return nil, fmt.Errorf("mask value out of range")
 	}
 
+	if s.rejectEmpty && isEmpty(segs) {
+		return nil, ErrEmptyPayload
+	}
+
 	// Find the minimal version number to use.
-	version := MinVersion
+	endVersion := s.trace(StageVersion)
+	version := s.minVersion
 	var dataUsedBits int
 	for {
 		dataCapacityBits := numDataCodewords[ecl][version] * 8 // Number of data bits available.
@@ -90,11 +117,9 @@ func EncodeSegments(segs []*QRSegment, ecl ECL, options ...func(*segmentEncoder)
 		if dataUsedBits != -1 && dataUsedBits <= dataCapacityBits {
 			break // This version number is suitable.
 		}
-		if version >= MaxVersion { // All versions in the range could not fit the given data.
-			if dataUsedBits != -1 {
-				return nil, fmt.Errorf("data length = %d bits, max capacity = %d bits", dataUsedBits, dataCapacityBits)
-			}
-			return nil, fmt.Errorf("data too long")
+		if version >= s.maxVersion { // All versions in the range could not fit the given data.
+			endVersion()
+			return nil, newDataTooLongError(segs, ecl, s.minVersion, s.maxVersion, dataUsedBits, dataCapacityBits)
 		}
 		version++
 	}
@@ -109,20 +134,16 @@ func EncodeSegments(segs []*QRSegment, ecl ECL, options ...func(*segmentEncoder)
 			ecl = newEcl
 		}
 	}
+	endVersion()
 
-	// Concatenate all segments to create the data bit string.
-	bb := make(bitBuffer, 0)
-	for _, seg := range segs {
-		bb.appendBits(int(seg.modeBits), 4)
-		bb.appendBits(seg.NumChars, seg.Mode.numCharCountBits(version))
-		bb = append(bb, seg.Data...)
-	}
+	// Start from the concatenated segments' data bit string.
+	dataCapacityBits := numDataCodewords[ecl][version] * 8
+	bb := append(make(bitBuffer, 0, dataCapacityBits), p.bitstream(version)...)
 	if len(bb) != dataUsedBits {
 		panic("incorrect data size calculation")
 	}
 
 	// Add the terminator and pad up to a byte if applicable.
-	dataCapacityBits := numDataCodewords[ecl][version] * 8
 	if len(bb) > dataCapacityBits {
 		panic("incorrect data size calculation")
 	}
@@ -132,7 +153,13 @@ func EncodeSegments(segs []*QRSegment, ecl ECL, options ...func(*segmentEncoder)
 		panic("incorrect data size calculation")
 	}
 
-	// Pad with alternating bytes until data capacity is reached.
+	// Pad with alternating bytes (or random ones) until data capacity is reached.
+	if s.padding != nil {
+		r := rand.New(s.padding)
+		for len(bb) < dataCapacityBits {
+			bb.appendBits(r.Intn(256), 8)
+		}
+	}
 	for padByte := int16(0xec); len(bb) < dataCapacityBits; padByte ^= 0xec ^ 0x11 {
 		bb.appendBits(int(padByte), 8)
 	}
@@ -140,45 +167,212 @@ func EncodeSegments(segs []*QRSegment, ecl ECL, options ...func(*segmentEncoder)
 	// Pack bits into bytes in big endian order.
 	dataCodeWords := make([]byte, len(bb)/8)
 	for i := 0; i < len(bb); i++ {
-		// if i >= 70 && i <= 73 {
-		// 	fmt.Printf("i: %d, dataCodeWords[i>>3]: %d, i >> 3: %d, bb[i]: %d, bb[i] << (7 - i&7): %d: dataCodeWords[i>>3] | bb[i] << (7 - i&7): %d\n",
-		// 		i, dataCodeWords[i>>3], i>>3, bb[i], bb[i]<<(7-i&7), dataCodeWords[i>>3]|bb[i]<<(7-i&7))
-		// }
 		dataCodeWords[i>>3] |= bb[i] << (7 - i&7)
 	}
 
-	size := int(version)*4 + 17
-	qrCode := QRCode{
-		Version:              version,
-		Size:                 size,
-		ErrorCorrectionLevel: ecl,
-		Modules:              make([][]Module, size),
-		isFunction:           make([][]bool, size),
+	if s.rowCallback != nil && s.mask != -1 {
+		return s.encodeStreaming(version, ecl, dataCodeWords, bb[:dataUsedBits])
 	}
 
-	for i := 0; i < size; i++ {
-		qrCode.Modules[i] = make([]Module, size)
-		qrCode.isFunction[i] = make([]bool, size)
-	}
-
-	qrCode.drawFunctionPatterns()
-	allCodeWords := qrCode.addECCAndInterleave(dataCodeWords)
+	qrCode := newQRCodeFromTemplate(version, ecl)
+	endECC := s.trace(StageECC)
+	allCodeWords := qrCode.addECCAndInterleave(dataCodeWords, s.eccParallelism)
+	endECC()
+	endMask := s.trace(StageMask)
 	qrCode.drawCodewords(allCodeWords)
-	qrCode.Mask = qrCode.handleConstructorMasking(s.mask)
+	qrCode.Mask = qrCode.handleConstructorMasking(s.mask, s.fastMask)
+	endMask()
 
 	qrCode.isFunction = nil
 
-	return &qrCode, nil
+	if s.rowCallback != nil {
+		for y, row := range qrCode.Modules {
+			if err := s.rowCallback(y, row); err != nil {
+				return nil, fmt.Errorf("row %d: %w", y, err)
+			}
+		}
+	}
+
+	if err := s.auditEncode(qrCode, qrCode.Hash, bb[:dataUsedBits]); err != nil {
+		return nil, err
+	}
+
+	return qrCode, nil
 }
 
 // EncodeText encodes text as a QR code symbol with the given error correction
-// level.
-func EncodeText(text string, ecl ECL) (*QRCode, error) {
-	segs := MakeSegments(text)
-	return EncodeSegments(segs, ecl)
+// level. The options are the same as those accepted by EncodeSegments. Empty
+// text is encoded like EncodeBinary(nil), unless WithRejectEmpty is given.
+func EncodeText(text string, ecl ECL, options ...func(*segmentEncoder)) (*QRCode, error) {
+	d := Defaults()
+	s := segmentEncoder{maxInput: d.MaxInput, minVersion: d.MinVersion, maxVersion: d.MaxVersion}
+	for _, o := range options {
+		o(&s)
+	}
+
+	if s.maxInput > 0 && len(text) > s.maxInput {
+		return nil, &InputTooLargeError{Size: len(text), Limit: s.maxInput}
+	}
+
+	end := s.trace(StageSegment)
+	segs, err := s.textSegments(text, ecl)
+	end()
+	if err != nil {
+		return nil, err
+	}
+
+	return EncodeSegments(segs, ecl, options...)
+}
+
+// textSegments normalizes and checks text for EncodeText and splits it into
+// segments for the error correction level.
+func (s *segmentEncoder) textSegments(text string, ecl ECL) ([]*QRSegment, error) {
+	text, err := s.checkText(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.forcedMode != nil {
+		seg, err := makeForcedSegment(text, *s.forcedMode)
+		if err != nil {
+			return nil, err
+		}
+		return []*QRSegment{seg}, nil
+	}
+	if err := s.checkAlphanumeric(text); err != nil {
+		return nil, err
+	}
+	if text == "" {
+		// MakeSegments returns no segments for empty text; encode an explicit
+		// empty byte-mode segment so that the symbol has the same structure
+		// as EncodeBinary(nil).
+		return []*QRSegment{MakeBytes(nil)}, nil
+	}
+	if s.optimalSegments {
+		return MakeSegmentsOptimally(text, ecl, s.minVersion, s.maxVersion)
+	}
+
+	return MakeSegments(text), nil
+}
+
+// checkText applies the normalization, privacy and spoofing options to text
+// and returns the text to encode.
+func (s *segmentEncoder) checkText(text string) (string, error) {
+	if s.normalize != nil {
+		var report NormalizeReport
+		text, report = Normalize(text, *s.normalize)
+		if s.normalizeReport != nil {
+			*s.normalizeReport = report
+		}
+	}
+	if s.privacyCheck {
+		if err := checkPrivacy(text, s.privacyIgnore); err != nil {
+			return "", err
+		}
+	}
+	if s.spoofCheck {
+		if findings := ScanSpoofing(text); len(findings) > 0 {
+			return "", &SpoofError{Findings: findings}
+		}
+	}
+
+	return text, nil
+}
+
+// makeForcedSegment encodes text as a single segment in the given mode.
+func makeForcedSegment(text string, mode Mode) (*QRSegment, error) {
+	switch mode {
+	case Numeric:
+		if !CanEncodeNumeric(text) {
+			return nil, fmt.Errorf("text cannot be encoded in numeric mode")
+		}
+		return MakeNumeric(text), nil
+	case Alphanumeric:
+		if !CanEncodeAlphanumeric(text) {
+			return nil, fmt.Errorf("text cannot be encoded in alphanumeric mode")
+		}
+		return MakeAlphanumeric(text), nil
+	case Byte:
+		return MakeBytes([]byte(text)), nil
+	default:
+		return nil, fmt.Errorf("mode 0x%x cannot be forced", mode.modeBits)
+	}
 }
 
-func (q *QRCode) addECCAndInterleave(data []byte) []byte {
+// checkInputSize enforces the WithMaxInput limit on an input of the given
+// size.
+func checkInputSize(size int, options []func(*segmentEncoder)) error {
+	s := segmentEncoder{maxInput: Defaults().MaxInput}
+	for _, o := range options {
+		o(&s)
+	}
+	if s.maxInput > 0 && size > s.maxInput {
+		return &InputTooLargeError{Size: size, Limit: s.maxInput}
+	}
+
+	return nil
+}
+
+// isEmpty reports whether the segments hold no characters. ECI segments carry
+// no data of their own.
+func isEmpty(segs []*QRSegment) bool {
+	for _, seg := range segs {
+		if seg.Mode != ECI && seg.NumChars > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fitVersion returns the minimal version in [minVersion, maxVersion] that can
+// hold the segments at the given error correction level, or 0 if none can.
+func fitVersion(segs []*QRSegment, ecl ECL, minVersion, maxVersion Version) Version {
+	for v := minVersion; v <= maxVersion; v++ {
+		used := getTotalBits(segs, v)
+		if used != -1 && used <= numDataCodewords[ecl][v]*8 {
+			return v
+		}
+	}
+
+	return 0
+}
+
+// newDataTooLongError builds the error returned when the segments do not fit
+// in [minVersion, maxVersion], including the minimal version and error
+// correction level under which they would fit.
+func newDataTooLongError(segs []*QRSegment, ecl ECL, minVersion, maxVersion Version, dataUsedBits, dataCapacityBits int) error {
+	err := &DataTooLongError{
+		DataBits:     dataUsedBits,
+		CapacityBits: dataCapacityBits,
+		MaxVersion:   maxVersion,
+		ECL:          ecl,
+		SuggestedECL: -1,
+	}
+
+	if maxVersion < MaxVersion {
+		err.SuggestedVersion = fitVersion(segs, ecl, maxVersion+1, MaxVersion)
+	}
+	for e := ecl - 1; e >= Low; e-- {
+		if fitVersion(segs, e, minVersion, maxVersion) != 0 {
+			err.SuggestedECL = e
+			break
+		}
+	}
+
+	return err
+}
+
+// eccScratchPool holds the scratch buffers used by addECCAndInterleave.
+var eccScratchPool = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
+// minParallelECCBlocks is the fewest blocks for which addECCAndInterleave
+// spreads the work over goroutines; below it the overhead outweighs the gain.
+const minParallelECCBlocks = 8
+
+func (q *QRCode) addECCAndInterleave(data []byte, parallelism int) []byte {
 	if len(data) != numDataCodewords[q.ErrorCorrectionLevel][q.Version] {
 		panic("data is not correct length")
 	}
@@ -190,27 +384,53 @@ func (q *QRCode) addECCAndInterleave(data []byte) []byte {
 	numShortBlocks := numBlocks - rawCodeWords%numBlocks
 	shortBlockLen := rawCodeWords / numBlocks
 
-	// Split data into blocks and append ECC to each block.
-	blocks := make([][]byte, numBlocks)
+	// Split data into blocks and append ECC to each block. The blocks live in
+	// one pooled scratch buffer, blockLen bytes apiece, so that bursts of
+	// encodes do not allocate a fresh set per symbol.
+	blockLen := shortBlockLen + 1
+	scratch := eccScratchPool.Get().(*[]byte)
+	defer eccScratchPool.Put(scratch)
+	if cap(*scratch) < numBlocks*blockLen {
+		*scratch = make([]byte, numBlocks*blockLen)
+	}
+	blocks := (*scratch)[:numBlocks*blockLen]
 	rsDiv := reedSolomonDivisors[blockECCLen]
-	for i, k := 0, 0; i < numBlocks; i++ {
-		dat := data[k : k+shortBlockLen-blockECCLen+bToI(i >= numShortBlocks)]
-		k += len(dat)
-		block := make([]byte, shortBlockLen+1)
+	shortDataLen := shortBlockLen - blockECCLen
+	encodeBlock := func(i int) {
+		start := i*shortDataLen + max(0, i-numShortBlocks) // Long blocks follow the short ones.
+		dat := data[start : start+shortDataLen+bToI(i >= numShortBlocks)]
+		block := blocks[i*blockLen : (i+1)*blockLen]
 		copy(block, dat)
-		ecc := reedSolomonComputeRemainder(dat, rsDiv)
-		copy(block[(len(block)-len(ecc)):], ecc)
-		blocks[i] = block
+		reedSolomonRemainderInto(dat, rsDiv, block[blockLen-blockECCLen:])
+	}
+	if parallelism > 1 && numBlocks >= minParallelECCBlocks {
+		// Each worker takes every parallelism'th block; the blocks occupy
+		// disjoint parts of the scratch buffer.
+		var wg sync.WaitGroup
+		for w := 0; w < parallelism && w < numBlocks; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := w; i < numBlocks; i += parallelism {
+					encodeBlock(i)
+				}
+			}(w)
+		}
+		wg.Wait()
+	} else {
+		for i := 0; i < numBlocks; i++ {
+			encodeBlock(i)
+		}
 	}
 
 	// Interleave (not concatenate) the bytes from every block into a single
 	// sequence.
 	result := make([]byte, rawCodeWords)
-	for i, k := 0, 0; i < len(blocks[0]); i++ {
-		for j := 0; j < len(blocks); j++ {
+	for i, k := 0, 0; i < blockLen; i++ {
+		for j := 0; j < numBlocks; j++ {
 			// Skip the padding byte in short blocks.
 			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
-				result[k] = blocks[j][i]
+				result[k] = blocks[j*blockLen+i]
 				k++
 			}
 		}
@@ -219,47 +439,6 @@ func (q *QRCode) addECCAndInterleave(data []byte) []byte {
 	return result
 }
 
-// func (q *QRCode) String() string {
-// 	var sb strings.Builder
-// 	sb.WriteString("QRCode\n")
-// 	fmt.Fprintf(&sb, "\tVersion: %d\n", q.Version)
-// 	fmt.Fprintf(&sb, "\tSize: %d\n", q.Size)
-// 	fmt.Fprintf(&sb, "\tErrorCorrectionLevel: %d\n", q.ErrorCorrectionLevel)
-// 	fmt.Fprintf(&sb, "\tMask: %d\n", q.Mask)
-// 	sb.WriteString("\tModules\n")
-// 	for y := 0; y < q.Size; y++ {
-// 		sb.WriteString("\t\t")
-// 		for x := 0; x < q.Size; x++ {
-// 			if q.Modules[y][x] == 1 {
-// 				sb.WriteString("░")
-// 			} else {
-// 				sb.WriteString("▓")
-// 			}
-// 			// fmt.Fprintf(&sb, "%d", q.Modules[y][x])
-// 		}
-// 		sb.WriteString("\n")
-// 	}
-// 	sb.WriteString("\tIsFunction")
-// 	if q.IsFunction == nil {
-// 		sb.WriteString(" nil\n")
-// 	} else {
-// 		sb.WriteString("\n")
-// 		for y := 0; y < q.Size; y++ {
-// 			sb.WriteString("\t\t")
-// 			for x := 0; x < q.Size; x++ {
-// 				if q.IsFunction[y][x] {
-// 					sb.WriteString("1")
-// 				} else {
-// 					sb.WriteString("0")
-// 				}
-// 			}
-// 			sb.WriteString("\n")
-// 		}
-// 	}
-
-// 	return sb.String()
-// }
-
 // ToSVGString returns a scalable vector graphics (SVG) representation of the QR
 // code.
 func (q *QRCode) ToSVGString(border int, includeDocType bool) (string, error) {
@@ -268,27 +447,233 @@ func (q *QRCode) ToSVGString(border int, includeDocType bool) (string, error) {
 	}
 
 	var sb strings.Builder
-	if includeDocType {
-		sb.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
-		sb.WriteString("<!DOCTYPE svg PUBLIC \"-//W3C//DTD SVG 1.1//EN\" \"http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd\">\n")
+	q.writeSVG(&sb, SVGOptions{Border: border, DocType: includeDocType, Dark: "#000000", Light: "#FFFFFF"}, "")
+
+	return sb.String(), nil
+}
+
+// SVGOptions controls WriteSVG.
+type SVGOptions struct {
+	Border  int    // Quiet zone in modules (default 4; negative for none).
+	DocType bool   // Begin with the XML declaration and SVG 1.1 doctype.
+	Dark    string // CSS color of dark modules (default "#000000").
+	Light   string // CSS color of light modules (default "#FFFFFF").
+
+	// Marks, if not nil, adds print marks around the quiet zone, with
+	// distances in modules.
+	Marks *PrintMarks
+
+	// MaxBytes, if positive, is the largest document to write. A document
+	// over the limit is written again without the XML declaration and
+	// doctype; if it is still too large, nothing is written and an
+	// *OutputTooLargeError is returned.
+	MaxBytes int
+
+	// Version pins the revision of the output, for callers that compare
+	// documents byte for byte with golden files. The default, SVGLatest,
+	// follows improvements in later releases.
+	Version SVGVersion
+}
+
+// SVGVersion identifies a revision of the SVG output. A revision's bytes for
+// given options never change; improvements that change them add a revision.
+type SVGVersion int8
+
+// SVG output revisions.
+const (
+	// SVGLatest is the newest revision, currently SVGv2.
+	SVGLatest SVGVersion = iota
+	// SVGv1 draws each dark module as its own unit square.
+	SVGv1
+	// SVGv2 merges adjacent dark modules into rectangles.
+	SVGv2
+)
+
+// WriteSVG writes the same document as ToSVGString to w, streaming the path
+// data as it is generated instead of building the document in memory, so
+// that large symbols can be written directly to HTTP responses or files.
+// With MaxBytes the document is built in memory to be measured.
+func (q *QRCode) WriteSVG(w io.Writer, opts SVGOptions) error {
+	if err := opts.normalize(); err != nil {
+		return err
 	}
-	fmt.Fprintf(&sb, "<svg xmlns=\"http://www.w3.org/2000/svg\" version=\"1.1\" viewBox=\"0 0 %[1]d %[1]d\" stroke=\"none\">\n", q.Size+border*2)
-	sb.WriteString("\t<rect width=\"100%\" height=\"100%\" fill=\"#FFFFFF\"/>\n")
-	sb.WriteString("\t<path d=\"")
+
+	return writeWithinBudget(w, opts.MaxBytes, 1+bToI(opts.DocType), func(w io.Writer, level int) error {
+		bw := bufio.NewWriter(w)
+		opts.DocType = opts.DocType && level == 0
+		q.writeSVG(bw, opts, "")
+		return bw.Flush()
+	})
+}
+
+// writeWithinBudget writes the rendering of the first of levels degradation
+// levels (0 for none) whose output fits in maxBytes. If maxBytes is not
+// positive, level 0 is written directly; otherwise each rendering is buffered
+// to be measured, and if none fits an *OutputTooLargeError is returned.
+func writeWithinBudget(w io.Writer, maxBytes, levels int, render func(w io.Writer, level int) error) error {
+	if maxBytes <= 0 {
+		return render(w, 0)
+	}
+
+	var buf bytes.Buffer
+	smallest := 0
+	for level := 0; level < levels; level++ {
+		buf.Reset()
+		if err := render(&buf, level); err != nil {
+			return err
+		}
+		if buf.Len() <= maxBytes {
+			_, err := buf.WriteTo(w)
+			return err
+		}
+		if smallest == 0 || buf.Len() < smallest {
+			smallest = buf.Len()
+		}
+	}
+
+	return &OutputTooLargeError{Limit: maxBytes, Smallest: smallest}
+}
+
+// normalize fills in the defaults and checks the colors.
+func (opts *SVGOptions) normalize() error {
+	if opts.Border == 0 {
+		opts.Border = 4
+	} else if opts.Border < 0 {
+		opts.Border = 0
+	}
+	if opts.Dark == "" {
+		opts.Dark = "#000000"
+	}
+	if opts.Light == "" {
+		opts.Light = "#FFFFFF"
+	}
+	if !cssColor.MatchString(opts.Dark) || !cssColor.MatchString(opts.Light) {
+		return fmt.Errorf("invalid SVG color")
+	}
+	if opts.Version < SVGLatest || opts.Version > SVGv2 {
+		return fmt.Errorf("unknown SVG version %d", opts.Version)
+	}
+	if opts.Marks != nil {
+		marks := *opts.Marks
+		if err := marks.normalize(2, 4, 0.1); err != nil {
+			return err
+		}
+		opts.Marks = &marks
+	}
+
+	return nil
+}
+
+// writeSVG writes the SVG document of ToSVGString and WriteSVG for normalized
+// options, with the overlay elements, if any, drawn over the modules.
+func (q *QRCode) writeSVG(w io.Writer, opts SVGOptions, overlay string) {
+	if opts.DocType {
+		io.WriteString(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+		io.WriteString(w, "<!DOCTYPE svg PUBLIC \"-//W3C//DTD SVG 1.1//EN\" \"http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd\">\n")
+	}
+	side := q.Size + opts.Border*2
+	if opts.Marks == nil {
+		fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" version=\"1.1\" viewBox=\"0 0 %[1]d %[1]d\" stroke=\"none\">\n", side)
+		fmt.Fprintf(w, "\t<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", opts.Light)
+	} else {
+		// The trim box keeps the origin, and the bleed and marks lie at
+		// negative coordinates and beyond the side.
+		g := opts.Marks.geometry(0, 0, float64(side), float64(side))
+		fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" version=\"1.1\" viewBox=\"%[1]s %[1]s %[2]s %[2]s\" stroke=\"none\">\n",
+			formatFloat(-g.extent, 4), formatFloat(float64(side)+2*g.extent, 4))
+		fmt.Fprintf(w, "\t<rect x=\"%[1]s\" y=\"%[1]s\" width=\"%[2]s\" height=\"%[2]s\" fill=\"%[3]s\"/>\n",
+			formatFloat(-opts.Marks.Bleed, 4), formatFloat(float64(side)+2*opts.Marks.Bleed, 4), opts.Light)
+		if len(g.lines) > 0 {
+			var sb strings.Builder
+			for _, l := range g.lines {
+				fmt.Fprintf(&sb, "M%s,%sL%s,%s", formatFloat(l[0], 4), formatFloat(l[1], 4), formatFloat(l[2], 4), formatFloat(l[3], 4))
+			}
+			for _, c := range g.circles {
+				writeCirclePath(&sb, c[0], c[1], c[2])
+			}
+			fmt.Fprintf(w, "\t<path d=\"%s\" fill=\"none\" stroke=\"#000000\" stroke-width=\"%s\"/>\n", sb.String(), formatFloat(opts.Marks.Stroke, 4))
+		}
+	}
+	io.WriteString(w, "\t<path d=\"")
+	if opts.Version == SVGv1 {
+		q.writeSVGPathV1(w, opts.Border)
+	} else {
+		q.writeSVGPath(w, opts.Border)
+	}
+	fmt.Fprintf(w, "\" fill=\"%s\"/>\n", opts.Dark)
+	io.WriteString(w, overlay)
+	io.WriteString(w, "</svg>\n")
+}
+
+// writeSVGPath writes SVG path data covering the dark modules, offset by the
+// border.
+func (q *QRCode) writeSVGPath(w io.Writer, border int) {
+	writeRectPath(w, q.Size, border, func(x, y int) bool {
+		return q.Modules[y][x] == 1
+	})
+}
+
+// writeSVGPathV1 writes the path data of SVGv1, one unit square per dark
+// module. It reproduces that revision exactly, including its omission of the
+// space before squares in the first row or column.
+func (q *QRCode) writeSVGPathV1(w io.Writer, border int) {
 	for y := 0; y < q.Size; y++ {
 		for x := 0; x < q.Size; x++ {
 			if q.Modules[y][x] == 1 {
 				if x != 0 && y != 0 {
-					sb.WriteString(" ")
+					io.WriteString(w, " ")
 				}
-				fmt.Fprintf(&sb, "M%d,%dh1v1h-1z", x+border, y+border)
+				fmt.Fprintf(w, "M%d,%dh1v1h-1z", x+border, y+border)
 			}
 		}
 	}
-	sb.WriteString("\" fill=\"#000000\"/>\n")
-	sb.WriteString("</svg>\n")
+}
 
-	return sb.String(), nil
+// writeRectPath writes SVG path data covering the cells of a size x size grid
+// for which dark returns true, offset by (offset, offset), as rectangles
+// instead of one square per cell, which makes large symbols several times
+// smaller. The rectangles are found greedily: each takes the longest run of
+// cells to the right of the first uncovered dark cell in scan order, and
+// extends down for as long as the rows below repeat the run.
+func writeRectPath(w io.Writer, size, offset int, dark func(x, y int) bool) {
+	covered := make([]bool, size*size)
+	free := func(x, y int) bool {
+		return !covered[y*size+x] && dark(x, y)
+	}
+
+	first := true
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if !free(x, y) {
+				continue
+			}
+			width := 1
+			for x+width < size && free(x+width, y) {
+				width++
+			}
+			height := 1
+		extend:
+			for y+height < size {
+				for i := x; i < x+width; i++ {
+					if !free(i, y+height) {
+						break extend
+					}
+				}
+				height++
+			}
+			for j := y; j < y+height; j++ {
+				for i := x; i < x+width; i++ {
+					covered[j*size+i] = true
+				}
+			}
+
+			if !first {
+				io.WriteString(w, " ")
+			}
+			first = false
+			fmt.Fprintf(w, "M%d,%dh%dv%dh-%dz", x+offset, y+offset, width, height, width)
+		}
+	}
 }
 
 // applyMask XOR's the codeword modules (not functions) in this QR code with the
@@ -297,32 +682,36 @@ func (q *QRCode) ToSVGString(border int, includeDocType bool) (string, error) {
 func (q *QRCode) applyMask(mask Mask) {
 	for y := 0; y < q.Size; y++ {
 		for x := 0; x < q.Size; x++ {
-			var invert bool
-			switch mask {
-			case 0:
-				invert = (x+y)%2 == 0
-			case 1:
-				invert = y%2 == 0
-			case 2:
-				invert = x%3 == 0
-			case 3:
-				invert = (x+y)%3 == 0
-			case 4:
-				invert = (x/3+y/2)%2 == 0
-			case 5:
-				invert = x*y%2+x*y%3 == 0
-			case 6:
-				invert = (x*y%2+x*y%3)%2 == 0
-			case 7:
-				invert = ((x+y)%2+x*y%3)%2 == 0
-			default:
-				panic("illegal mask value")
-			}
-			q.Modules[y][x] ^= Module(bToI(invert && !q.isFunction[y][x]))
+			q.Modules[y][x] ^= Module(bToI(maskBit(mask, x, y) && !q.isFunction[y][x]))
 		}
 	}
 }
 
+// maskBit reports whether a mask inverts the module at (x, y), before function
+// modules are excluded.
+func maskBit(mask Mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	case 7:
+		return ((x+y)%2+x*y%3)%2 == 0
+	default:
+		panic("illegal mask value")
+	}
+}
+
 // drawAlignmentPattern draws a 5*5 alignment pattern, with the center module at
 // (x, y).
 func (q *QRCode) drawAlignmentPattern(x, y int) {
@@ -341,38 +730,13 @@ func (q *QRCode) drawCodewords(data []byte) {
 		panic("incorrect data length")
 	}
 
-	i := 0 // Bit index into the data.
-
-	// Do the funny zig-zag scan.
-	for right := q.Size - 1; right >= 1; right -= 2 {
-		if right == 6 {
-			right = 5
-		}
-		for vert := 0; vert < q.Size; vert++ {
-			for j := 0; j < 2; j++ {
-				x := right - j // Actual x coordinate.
-				upward := (right+1)&2 == 0
-
-				var y int
-				if upward {
-					y = q.Size - 1 - vert
-				} else {
-					y = vert
-				} // Actual y coordinate.
-
-				if !q.isFunction[y][x] && i < len(data)*8 {
-					q.Modules[y][x] = Module(getBit(int(data[i>>3]), 7-(i&7)))
-					i++
-				}
-				// If this QR code has any remainder bits (0 to 7), they were
-				// assigned as 0/false/white during construction and are left
-				// unchanged.
-			}
-		}
-	}
-
-	if i != len(data)*8 {
-		panic("incorrect length")
+	// Place the bits along the precomputed zig-zag scan. If this QR code has
+	// any remainder bits (0 to 7), they were assigned as 0/false/white during
+	// construction and are left unchanged.
+	plan := codewordPlan(q.Version)
+	for i := 0; i < len(data)*8; i++ {
+		p := plan[i]
+		q.Modules[p.y][p.x] = Module(getBit(int(data[i>>3]), 7-(i&7)))
 	}
 }
 
@@ -395,8 +759,21 @@ func (q *QRCode) drawFinderPattern(x, y int) {
 // correction code), based on the given mask and this object's error correction
 // level.
 func (q *QRCode) drawFormatBits(mask Mask) {
-	// Calculate error correction code and pack bits.
-	data := q.ErrorCorrectionLevel.formatBits()<<3 | int(mask)
+	bits := formatBits(q.ErrorCorrectionLevel, mask)
+
+	// Draw both copies.
+	for i, pair := range formatBitPositions(q.Size) {
+		for _, p := range pair {
+			q.setFunctionModule(int(p.x), int(p.y), getBitAsBool(bits, i))
+		}
+	}
+	q.setFunctionModule(8, q.Size-8, true) // Always black.
+}
+
+// formatBits returns the 15 format bits (with their error correction code and
+// mask pattern) of an error correction level and mask.
+func formatBits(ecl ECL, mask Mask) int {
+	data := ecl.formatBits()<<3 | int(mask)
 	rem := data
 	for i := 0; i < 10; i++ {
 		rem = rem<<1 ^ rem>>9*0x537
@@ -406,25 +783,35 @@ func (q *QRCode) drawFormatBits(mask Mask) {
 		panic("incorrect format bits calculation")
 	}
 
-	// Draw first copy.
-	for i := 0; i <= 5; i++ {
-		q.setFunctionModule(8, i, getBitAsBool(bits, i))
-	}
-	q.setFunctionModule(8, 7, getBitAsBool(bits, 6))
-	q.setFunctionModule(8, 8, getBitAsBool(bits, 7))
-	q.setFunctionModule(7, 8, getBitAsBool(bits, 8))
-	for i := 9; i < 15; i++ {
-		q.setFunctionModule(14-i, 8, getBitAsBool(bits, i))
-	}
+	return bits
+}
 
-	// Draw second copy.
-	for i := 0; i < 8; i++ {
-		q.setFunctionModule(q.Size-1-i, 8, getBitAsBool(bits, i))
-	}
-	for i := 8; i < 15; i++ {
-		q.setFunctionModule(8, q.Size-15+i, getBitAsBool(bits, i))
+// formatBitPositions returns the two modules, one in each copy, that hold each
+// format bit in a symbol of the given size.
+func formatBitPositions(size int) [15][2]modulePos {
+	var p [15][2]modulePos
+	for i := 0; i < 15; i++ {
+		// First copy, around the top left finder pattern.
+		switch {
+		case i <= 5:
+			p[i][0] = modulePos{8, uint8(i)}
+		case i <= 7:
+			p[i][0] = modulePos{8, uint8(i + 1)}
+		case i == 8:
+			p[i][0] = modulePos{7, 8}
+		default:
+			p[i][0] = modulePos{uint8(14 - i), 8}
+		}
+
+		// Second copy, split between the other two finder patterns.
+		if i < 8 {
+			p[i][1] = modulePos{uint8(size - 1 - i), 8}
+		} else {
+			p[i][1] = modulePos{8, uint8(size - 15 + i)}
+		}
 	}
-	q.setFunctionModule(8, q.Size-8, true) // Always black.
+
+	return p
 }
 
 // drawFunctionPatterns draws (set to black) all modules that correspond to
@@ -548,11 +935,29 @@ func getAlignmentPatternPositions(version Version) []byte {
 // code's current modules. Masking that results in lower penalties are designed
 // to improve the chances of a scanner successfuly scanning the QR code.
 func (q *QRCode) getPenaltyScore() int {
+	return q.runPenalty(1) + q.blockAndBalancePenalty()
+}
+
+// getFastPenaltyScore estimates getPenaltyScore in a fraction of the time by
+// applying the run-length and finder-like pattern rules (N1 and N3) to every
+// fastMaskStride'th row and column only, scaled up, while still applying the
+// cheap block and balance rules (N2 and N4) to the whole symbol.
+func (q *QRCode) getFastPenaltyScore() int {
+	return q.runPenalty(fastMaskStride)*fastMaskStride + q.blockAndBalancePenalty()
+}
+
+// fastMaskStride is the row and column sampling interval of
+// getFastPenaltyScore.
+const fastMaskStride = 8
+
+// runPenalty computes the run-length and finder-like pattern penalties (N1
+// and N3) over every step'th row and column.
+func (q *QRCode) runPenalty(step int) int {
 	result := 0
 
 	// Adjacent modules in a row having the same color, and finder-like
 	// patterns.
-	for y := 0; y < q.Size; y++ {
+	for y := 0; y < q.Size; y += step {
 		runColor := Module(0)
 		runX := 0
 		var runHistory [7]int
@@ -578,7 +983,7 @@ func (q *QRCode) getPenaltyScore() int {
 
 	// Adjacent modules in a column having the same color, and finder-like
 	// patterns.
-	for x := 0; x < q.Size; x++ {
+	for x := 0; x < q.Size; x += step {
 		runColor := Module(0)
 		runY := 0
 		var runHistory [7]int
@@ -602,27 +1007,27 @@ func (q *QRCode) getPenaltyScore() int {
 		result += q.finderPenaltyTerminateAndCount(runColor, runY, &runHistory) * penaltyN3
 	}
 
-	// 2*2 blocks of modules having the same color.
-	for y := 0; y < q.Size-1; y++ {
-		for x := 0; x < q.Size-1; x++ {
-			color := q.Modules[y][x]
-			if color == q.Modules[y][x+1] &&
-				color == q.Modules[y+1][x] &&
-				color == q.Modules[y+1][x+1] {
-				result += penaltyN2
-			}
-		}
-	}
+	return result
+}
 
-	// Balance of black and white modules.
+// blockAndBalancePenalty computes the 2*2 block and balance penalties (N2 and
+// N4).
+func (q *QRCode) blockAndBalancePenalty() int {
+	result := 0
+
+	// 2*2 blocks of modules having the same color, and the balance of black
+	// and white modules, computed on rows packed 64 modules to a word.
+	rows := q.packedRows()
 	black := 0
-	for _, rows := range q.Modules {
-		for _, color := range rows {
-			if color == 1 {
-				black++
-			}
+	for y, row := range rows {
+		for _, w := range row {
+			black += bits.OnesCount64(w)
+		}
+		if y > 0 {
+			result += sameColorBlocks(&rows[y-1], &rows[y], q.Size) * penaltyN2
 		}
 	}
+
 	total := q.Size * q.Size // Note that the size is always odd, so black / total will never = 1/2.
 	// Compute the smallest integer k >= 0 such that (45 - 5 * k)% <= black /
 	// total <= (55 + 5 * k)%
@@ -632,17 +1037,64 @@ func (q *QRCode) getPenaltyScore() int {
 	return result
 }
 
+// packedRow holds one row of modules, module x in bit x%64 of word x/64.
+type packedRow [(177 + 63) / 64]uint64
+
+// packedRows packs the module matrix for the bitwise penalty computations.
+func (q *QRCode) packedRows() []packedRow {
+	rows := make([]packedRow, q.Size)
+	for y, row := range q.Modules {
+		for x, m := range row {
+			rows[y][x>>6] |= uint64(m) << (x & 63)
+		}
+	}
+
+	return rows
+}
+
+// sameColorBlocks counts the 2*2 blocks of one color whose top-left module is
+// in row a and whose bottom-left module is in row b.
+func sameColorBlocks(a, b *packedRow, size int) int {
+	count := 0
+	for w := range a {
+		// Bit x of next* is module x+1.
+		nextA, nextB := a[w]>>1, b[w]>>1
+		if w+1 < len(a) {
+			nextA |= a[w+1] << 63
+			nextB |= b[w+1] << 63
+		}
+		same := ^(a[w] ^ nextA) & ^(b[w] ^ nextB) & ^(a[w] ^ b[w])
+
+		// Only blocks starting at x < size-1 exist.
+		if valid := size - 1 - w*64; valid < 64 {
+			if valid <= 0 {
+				break
+			}
+			same &= 1<<uint(valid) - 1
+		}
+		count += bits.OnesCount64(same)
+	}
+
+	return count
+}
+
 // handleConstructorMasking is used during construction of the QR code
 // structure. This method takes a given mask (or -1 for "auto") and applies the
 // mask to the QR code. If auto is chosen, the method selects the mask that
-// results in the lowest penalty.
-func (q *QRCode) handleConstructorMasking(mask Mask) Mask {
+// results in the lowest penalty, estimated with getFastPenaltyScore if fast is
+// set.
+func (q *QRCode) handleConstructorMasking(mask Mask, fast bool) Mask {
+	score := q.getPenaltyScore
+	if fast {
+		score = q.getFastPenaltyScore
+	}
+
 	if mask == -1 { // Automatically choose the best mask.
 		minPenalty := math.MaxInt32
 		for i := Mask(0); i < 8; i++ {
 			q.applyMask(i)
 			q.drawFormatBits(i)
-			penalty := q.getPenaltyScore()
+			penalty := score()
 			if penalty < minPenalty {
 				mask = i
 				minPenalty = penalty
@@ -710,6 +1162,16 @@ func reedSolomonMultiply(x, y byte) byte {
 // codeword for the given data and divisor polynomials.
 func reedSolomonComputeRemainder(data, divisor []byte) []byte {
 	result := make([]byte, len(divisor))
+	reedSolomonRemainderInto(data, divisor, result)
+	return result
+}
+
+// reedSolomonRemainderInto is reedSolomonComputeRemainder writing into result,
+// which must be len(divisor) bytes long.
+func reedSolomonRemainderInto(data, divisor, result []byte) {
+	for i := range result {
+		result[i] = 0
+	}
 	for _, b := range data { // Polynomial division.
 		factor := b ^ result[0]
 		copy(result[0:], result[1:])
@@ -718,8 +1180,6 @@ func reedSolomonComputeRemainder(data, divisor []byte) []byte {
 			result[i] ^= byte(reedSolomonMultiply(divisor[i], factor))
 		}
 	}
-
-	return result
 }
 
 func (q *QRCode) setFunctionModule(x, y int, isBlack bool) {
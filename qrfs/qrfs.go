@@ -0,0 +1,307 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package qrfs provides a read-only fs.FS of rendered QR codes. Opening
+// "<ecl>/<format>/<payload-hash>.<format>" (for example
+// "M/svg/2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824.svg")
+// encodes and renders the payload on demand, so static-site generators and
+// http.FileServer can serve codes without custom handlers:
+//
+//	http.Handle("/qr/", http.StripPrefix("/qr/", http.FileServer(http.FS(qrfs.New(payloads)))))
+package qrfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image/png"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grkuntzmd/qrcodegen"
+)
+
+// FS is a read-only file system of rendered QR codes.
+type FS struct {
+	lookup  func(hash string) (string, bool)
+	hashes  []string // Sorted hashes of the known payloads, or nil if they cannot be listed.
+	border  int
+	scale   int
+	modTime time.Time
+}
+
+var (
+	eclDirs = []string{"H", "L", "M", "Q"}
+	formats = []string{"png", "svg"}
+)
+
+// Hash returns the name under which a payload is found: the hex SHA-256 of
+// the payload.
+func Hash(payload string) string {
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:])
+}
+
+// New returns an FS serving the given payloads. Its directories can be
+// listed.
+func New(payloads []string, options ...func(*FS)) *FS {
+	byHash := make(map[string]string, len(payloads))
+	for _, p := range payloads {
+		byHash[Hash(p)] = p
+	}
+	f := NewLookup(func(hash string) (string, bool) {
+		p, ok := byHash[hash]
+		return p, ok
+	}, options...)
+	f.hashes = make([]string, 0, len(byHash))
+	for h := range byHash {
+		f.hashes = append(f.hashes, h)
+	}
+	sort.Strings(f.hashes)
+
+	return f
+}
+
+// NewLookup returns an FS that resolves payload hashes with lookup, for
+// payload sets that are too large or dynamic to list. The directories of the
+// result are empty when read.
+func NewLookup(lookup func(hash string) (string, bool), options ...func(*FS)) *FS {
+	f := &FS{
+		lookup: lookup,
+		border: 4,
+		scale:  8,
+	}
+	for _, o := range options {
+		o(f)
+	}
+
+	return f
+}
+
+// WithBorder sets the border (quiet zone) in modules (default 4).
+func WithBorder(border int) func(*FS) {
+	return func(f *FS) {
+		f.border = border
+	}
+}
+
+// WithScale sets the pixels per module of PNG files (default 8).
+func WithScale(scale int) func(*FS) {
+	return func(f *FS) {
+		f.scale = scale
+	}
+}
+
+// WithModTime sets the modification time reported for every file and
+// directory (default the zero time).
+func WithModTime(t time.Time) func(*FS) {
+	return func(f *FS) {
+		f.modTime = t
+	}
+}
+
+// Open implements fs.FS.
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	parts := strings.Split(name, "/")
+	if name == "." {
+		parts = nil
+	}
+	if len(parts) > 0 && !contains(eclDirs, parts[0]) || len(parts) > 1 && !contains(formats, parts[1]) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	switch len(parts) {
+	case 0:
+		return f.dir(name, eclDirs, ""), nil
+	case 1:
+		return f.dir(name, formats, ""), nil
+	case 2:
+		return f.dir(name, f.hashes, "."+parts[1]), nil
+	case 3:
+		data, err := f.render(parts[0], parts[1], parts[2])
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &file{
+			Reader: bytes.NewReader(data),
+			info:   fileInfo{name: parts[2], size: int64(len(data)), modTime: f.modTime},
+		}, nil
+	default:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+}
+
+// render encodes and renders the payload whose file name is base.
+func (f *FS) render(eclName, format, base string) ([]byte, error) {
+	if path.Ext(base) != "."+format {
+		return nil, fs.ErrNotExist
+	}
+	payload, ok := f.lookup(strings.TrimSuffix(base, "."+format))
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+
+	ecl, err := qrcodegen.ParseECL(eclName)
+	if err != nil {
+		return nil, fs.ErrNotExist
+	}
+	q, err := qrcodegen.EncodeText(payload, ecl, qrcodegen.WithBoostECL(false))
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "svg" {
+		svg, err := q.ToSVGString(f.border, true)
+		return []byte(svg), err
+	}
+	img, err := q.ToImage(f.scale, f.border)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+
+	return buf.Bytes(), err
+}
+
+func (f *FS) dir(name string, entries []string, ext string) *dir {
+	d := &dir{info: fileInfo{name: path.Base(name), dir: true, modTime: f.modTime}}
+	for _, e := range entries {
+		if ext == "" {
+			d.entries = append(d.entries, fs.FileInfoToDirEntry(fileInfo{name: e, dir: true, modTime: f.modTime}))
+		} else {
+			d.entries = append(d.entries, &fileEntry{fsys: f, name: path.Join(name, e+ext)})
+		}
+	}
+
+	return d
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// file is a rendered code.
+type file struct {
+	*bytes.Reader
+	info fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+// dir is a directory listing.
+type dir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	next    int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := len(d.entries) - d.next
+	if n > 0 && remaining == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > remaining {
+		n = remaining
+	}
+	result := d.entries[d.next : d.next+n]
+	d.next += n
+
+	return result, nil
+}
+
+// fileEntry is the directory entry of a code; its size is only known once the
+// code is rendered, so Info renders it.
+type fileEntry struct {
+	fsys *FS
+	name string
+}
+
+func (e *fileEntry) Name() string      { return path.Base(e.name) }
+func (e *fileEntry) IsDir() bool       { return false }
+func (e *fileEntry) Type() fs.FileMode { return 0 }
+
+func (e *fileEntry) Info() (fs.FileInfo, error) {
+	f, err := e.fsys.Open(e.name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.Stat()
+}
+
+// fileInfo implements fs.FileInfo for files and directories.
+type fileInfo struct {
+	name    string
+	size    int64
+	dir     bool
+	modTime time.Time
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) ModTime() time.Time { return i.modTime }
+func (i fileInfo) IsDir() bool        { return i.dir }
+func (i fileInfo) Sys() interface{}   { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+
+	return 0444
+}
@@ -0,0 +1,70 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrfs
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFS(t *testing.T) {
+	payloads := []string{"HELLO", "https://example.com/"}
+	f := New(payloads, WithBorder(2))
+
+	var expected []string
+	for _, ecl := range eclDirs {
+		for _, format := range formats {
+			for _, p := range payloads {
+				expected = append(expected, ecl+"/"+format+"/"+Hash(p)+"."+format)
+			}
+		}
+	}
+	assert.NoError(t, fstest.TestFS(f, expected...))
+
+	data, err := fs.ReadFile(f, "H/svg/"+Hash("HELLO")+".svg")
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "<svg")
+
+	_, err = fs.ReadFile(f, "H/svg/"+Hash("unknown")+".svg")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	_, err = fs.ReadFile(f, "H/png/"+Hash("HELLO")+".svg")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	_, err = fs.ReadFile(f, "X/svg/"+Hash("HELLO")+".svg")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestFileServer(t *testing.T) {
+	server := http.FileServer(http.FS(New([]string{"HELLO"})))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/L/png/"+Hash("HELLO")+".png", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+}
@@ -27,7 +27,6 @@ package qrcodegen
 import (
 	"fmt"
 	"math"
-	"regexp"
 	"strconv"
 	"strings"
 )
@@ -42,10 +41,18 @@ type QRSegment struct {
 
 const alphanumericCharset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
 
-var (
-	alphanumericRegexp = regexp.MustCompile(`^[A-Z0-9 $%*+./:-]*$`)
-	numericRegexp      = regexp.MustCompile(`^[0-9]*$`)
-)
+// alphanumericIndex holds the index of each byte in alphanumericCharset, or
+// -1 if not present. The digits come first, so indexes below 10 are numeric.
+var alphanumericIndex [256]int8
+
+func init() {
+	for i := range alphanumericIndex {
+		alphanumericIndex[i] = -1
+	}
+	for i := 0; i < len(alphanumericCharset); i++ {
+		alphanumericIndex[alphanumericCharset[i]] = int8(i)
+	}
+}
 
 func getTotalBits(segs []*QRSegment, version Version) int {
 	result := int64(0)
@@ -67,7 +74,7 @@ func getTotalBits(segs []*QRSegment, version Version) int {
 // MakeAlphanumeric creates an alphanumeric segment from the given text
 // (uppercase letters, digits, some symbols).
 func MakeAlphanumeric(text string) *QRSegment {
-	if !alphanumericRegexp.MatchString(text) {
+	if !CanEncodeAlphanumeric(text) {
 		panic("string contains non-alphanumeric characters")
 	}
 
@@ -129,14 +136,14 @@ func MakeECI(assignValue int) (*QRSegment, error) {
 
 // MakeNumeric creates a numeric segment from the given digit string.
 func MakeNumeric(digits string) *QRSegment {
-	if !numericRegexp.MatchString(digits) {
+	if !CanEncodeNumeric(digits) {
 		panic("string contains non-numeric characters")
 	}
 
 	bb := make(bitBuffer, 0, len(digits)*3+(len(digits)+2)/3)
 	for i := 0; i < len(digits); {
 		n := min(len(digits)-i, 3)
-		d, _ := strconv.Atoi(digits[i : i+n]) // We can safely ignore the possible conversion error because we have confirmed that the string contains only digits in the regexp above.
+		d, _ := strconv.Atoi(digits[i : i+n]) // We can safely ignore the possible conversion error because we have confirmed that the string contains only digits above.
 		bb.appendBits(d, int8(n*3+1))
 		i += n
 	}
@@ -155,11 +162,11 @@ func MakeSegments(text string) []*QRSegment {
 		return []*QRSegment{}
 	}
 
-	if numericRegexp.MatchString(text) {
+	if CanEncodeNumeric(text) {
 		return []*QRSegment{MakeNumeric(text)}
 	}
 
-	if alphanumericRegexp.MatchString(text) {
+	if CanEncodeAlphanumeric(text) {
 		return []*QRSegment{MakeAlphanumeric(text)}
 	}
 
@@ -0,0 +1,154 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grkuntzmd/qrcodegen"
+	"github.com/grkuntzmd/qrcodegen/payload"
+)
+
+// maxExpiringTTL is the longest lifetime a client may request for an
+// expiring code.
+const maxExpiringTTL = 24 * time.Hour
+
+// WithExpiringKey enables the /v1/verify/expiring endpoint, which checks
+// time-boxed payloads signed with key. The prefix (for example
+// "https://door.example/c/") is placed before each token. Payloads are issued
+// only when WithExpiringIssuer is also given.
+func WithExpiringKey(key []byte, prefix string) func(*Server) {
+	return func(s *Server) {
+		s.expiringKey = key
+		s.expiringPrefix = prefix
+	}
+}
+
+// WithExpiringIssuer enables the /v1/generate/expiring endpoint, which issues
+// expiring payloads signed with the key given to WithExpiringKey. Anyone who
+// can reach it can mint valid payloads, so each request must carry token in
+// an "Authorization: Bearer" header, which only the issuing backend should
+// know; an empty token leaves the endpoint disabled.
+func WithExpiringIssuer(token string) func(*Server) {
+	return func(s *Server) {
+		s.issuerToken = token
+	}
+}
+
+// expiringRequest is the body of a generate/expiring request.
+type expiringRequest struct {
+	Data string `json:"data"`
+	TTL  int    `json:"ttl"` // Seconds.
+}
+
+// verifyRequest is the body of a verify/expiring request.
+type verifyRequest struct {
+	Token string `json:"token"`
+}
+
+// verifyResponse is the body of a verify/expiring response.
+type verifyResponse struct {
+	Valid   bool       `json:"valid"`
+	Data    string     `json:"data,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+func (s *Server) handleGenerateExpiring(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.issuerToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, errors.New("missing or invalid issuer token"))
+		return
+	}
+
+	opts, err := s.parseRenderOptions(r)
+	if err != nil {
+		writeOptionsError(w, err)
+		return
+	}
+	body, err := s.readBody(w, r)
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	req := expiringRequest{TTL: 300}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ttl := time.Duration(req.TTL) * time.Second
+	if ttl <= 0 || ttl > maxExpiringTTL {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("ttl must be in [1, %d] seconds", int(maxExpiringTTL.Seconds())))
+		return
+	}
+
+	e := payload.Expiring{Key: s.expiringKey, Prefix: s.expiringPrefix, Data: req.Data, Expires: time.Now().Add(ttl)}
+	text, err := e.Payload()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.encodeAndWrite(w, r, qrcodegen.MakeSegments(text), opts)
+}
+
+func (s *Server) handleVerifyExpiring(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := s.readBody(w, r)
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	var req verifyRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	data, expires, err := payload.VerifyExpiring(s.expiringKey, strings.TrimPrefix(req.Token, s.expiringPrefix), time.Now())
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, verifyResponse{Valid: true, Data: data, Expires: &expires})
+	case errors.Is(err, payload.ErrExpired):
+		writeJSON(w, http.StatusForbidden, verifyResponse{Expires: &expires, Error: err.Error()})
+	default:
+		writeJSON(w, http.StatusForbidden, verifyResponse{Error: err.Error()})
+	}
+}
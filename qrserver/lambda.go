@@ -0,0 +1,191 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Request is a serverless HTTP request event. Its JSON form matches the API
+// Gateway REST (payload version 1.0) and HTTP API (payload version 2.0) proxy
+// events delivered to AWS Lambda, so it can be passed directly to
+// lambda.Start; other function platforms can fill in the fields themselves.
+type Request struct {
+	HTTPMethod                      string              `json:"httpMethod"`
+	Path                            string              `json:"path"`
+	RawPath                         string              `json:"rawPath"`
+	RawQueryString                  string              `json:"rawQueryString"`
+	QueryStringParameters           map[string]string   `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	Headers                         map[string]string   `json:"headers"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+	Body                            string              `json:"body"`
+	IsBase64Encoded                 bool                `json:"isBase64Encoded"`
+	RequestContext                  struct {
+		HTTP struct {
+			Method string `json:"method"`
+		} `json:"http"`
+	} `json:"requestContext"`
+}
+
+// Response is a serverless HTTP response, matching the API Gateway proxy
+// response format.
+type Response struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// LambdaHandler adapts an http.Handler (usually a Server) to a function of the
+// form accepted by serverless runtimes:
+//
+//	lambda.Start(qrserver.LambdaHandler(qrserver.New()))
+//
+// Binary responses (such as PNG images) are returned base64 encoded, and
+// responses to HEAD requests have no body.
+func LambdaHandler(h http.Handler) func(context.Context, Request) (Response, error) {
+	return func(ctx context.Context, req Request) (Response, error) {
+		r, err := req.httpRequest(ctx)
+		if err != nil {
+			return Response{}, err
+		}
+
+		w := &responseBuffer{header: make(http.Header)}
+		h.ServeHTTP(w, r)
+
+		resp := Response{
+			StatusCode:        w.statusCode(),
+			Headers:           make(map[string]string, len(w.header)),
+			MultiValueHeaders: make(map[string][]string, len(w.header)),
+		}
+		for k, v := range w.header {
+			resp.Headers[k] = strings.Join(v, ", ")
+			resp.MultiValueHeaders[k] = v
+		}
+		switch {
+		case r.Method == http.MethodHead:
+			// Like net/http's server, send the headers of a GET without its
+			// body.
+		case isTextContent(w.header.Get("Content-Type")):
+			resp.Body = w.body.String()
+		default:
+			resp.Body = base64.StdEncoding.EncodeToString(w.body.Bytes())
+			resp.IsBase64Encoded = true
+		}
+
+		return resp, nil
+	}
+}
+
+// httpRequest converts the event into an *http.Request.
+func (req *Request) httpRequest(ctx context.Context) (*http.Request, error) {
+	method := req.HTTPMethod
+	if method == "" {
+		method = req.RequestContext.HTTP.Method
+	}
+	path := req.Path
+	if path == "" {
+		path = req.RawPath
+	}
+
+	query := req.RawQueryString
+	if query == "" {
+		values := url.Values{}
+		for k, v := range req.QueryStringParameters {
+			values.Set(k, v)
+		}
+		for k, v := range req.MultiValueQueryStringParameters {
+			values[k] = v
+		}
+		query = values.Encode()
+	}
+
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(req.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := http.NewRequest(method, (&url.URL{Path: path, RawQuery: query}).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range req.Headers {
+		r.Header.Set(k, v)
+	}
+	for k, v := range req.MultiValueHeaders {
+		r.Header[http.CanonicalHeaderKey(k)] = v
+	}
+
+	return r.WithContext(ctx), nil
+}
+
+// responseBuffer is an http.ResponseWriter that keeps the response in memory.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseBuffer) Header() http.Header {
+	return w.header
+}
+
+func (w *responseBuffer) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.body.Write(p)
+}
+
+func (w *responseBuffer) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseBuffer) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+
+	return w.status
+}
+
+func isTextContent(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.HasPrefix(contentType, "application/json") ||
+		strings.HasPrefix(contentType, "image/svg+xml")
+}
@@ -0,0 +1,150 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrserver
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grkuntzmd/qrcodegen"
+)
+
+// cacheMaxAge is the lifetime given to caches of GET responses. Symbols
+// depend only on the request, but a day lets renderer changes reach clients.
+const cacheMaxAge = 24 * time.Hour
+
+// errNotAcceptable is returned by parseRenderOptions when the Accept header
+// allows none of the formats.
+var errNotAcceptable = errors.New("none of the accepted media types can be produced (image/svg+xml, image/png, application/json)")
+
+// formatTypes maps the output formats to their media types, in order of
+// preference when the client accepts several equally.
+var formatTypes = []struct {
+	format, mediaType string
+}{
+	{"svg", "image/svg+xml"},
+	{"png", "image/png"},
+	{"json", "application/json"},
+}
+
+// negotiateFormat chooses the format with the highest quality in an Accept
+// header; an empty header accepts anything.
+func negotiateFormat(accept string) (string, error) {
+	if strings.TrimSpace(accept) == "" {
+		return formatTypes[0].format, nil
+	}
+
+	best, bestQ := "", 0.0
+	for _, ft := range formatTypes {
+		if q := acceptQuality(accept, ft.mediaType); q > bestQ {
+			best, bestQ = ft.format, q
+		}
+	}
+	if best == "" {
+		return "", errNotAcceptable
+	}
+
+	return best, nil
+}
+
+// acceptQuality returns the quality an Accept header gives to a media type,
+// taken from its most specific matching range.
+func acceptQuality(accept, mediaType string) float64 {
+	typ := mediaType[:strings.IndexByte(mediaType, '/')]
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		rng := strings.ToLower(strings.TrimSpace(params[0]))
+		s := -1
+		switch rng {
+		case mediaType:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		quality := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil && v >= 0 && v <= 1 {
+					quality = v
+				}
+			}
+		}
+		q, specificity = quality, s
+	}
+
+	return q
+}
+
+// writeOptionsError reports an error from parseRenderOptions.
+func writeOptionsError(w http.ResponseWriter, err error) {
+	if err == errNotAcceptable {
+		w.Header().Add("Vary", "Accept")
+		writeError(w, http.StatusNotAcceptable, err)
+		return
+	}
+	writeError(w, http.StatusBadRequest, err)
+}
+
+// etag returns an entity tag identifying the response to a request for the
+// segments with the options.
+func (opts renderOptions) etag(segs []*qrcodegen.QRSegment) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "v2 %s %d %d %d %t\n", opts.format, opts.ecl, opts.border, opts.scale, opts.boost)
+	for _, seg := range segs {
+		fmt.Fprintf(h, "%d %d ", seg.Mode, seg.NumChars)
+		for _, b := range seg.Data {
+			h.Write([]byte{'0' + b})
+		}
+		h.Write([]byte{'\n'})
+	}
+
+	return `"` + base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:18]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using
+// the weak comparison that RFC 7232 prescribes for it.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
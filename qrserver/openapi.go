@@ -0,0 +1,333 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrserver
+
+// openAPISpec is the OpenAPI 3 description of the API served by Server.
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "qrcodegen",
+    "description": "Generate, validate, and decode QR codes.",
+    "license": {"name": "MIT"},
+    "version": "1.0.0"
+  },
+  "paths": {
+    "/healthz": {
+      "get": {
+        "summary": "Run the library self-test: an encode and decode round trip, each renderer, and checksums of the encoding tables.",
+        "operationId": "healthz",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Health"},
+          "503": {"$ref": "#/components/responses/Health"}
+        }
+      }
+    },
+    "/v1/generate": {
+      "get": {
+        "summary": "Encode text as a QR code. Responses carry ETag and Cache-Control headers; HEAD is also supported.",
+        "operationId": "generate",
+        "parameters": [
+          {"name": "text", "in": "query", "required": true, "schema": {"type": "string", "minLength": 1}},
+          {"name": "expires", "in": "query", "schema": {"type": "integer"}, "description": "Unix time until which the signature is valid. Required when the server has a signing key."},
+          {"name": "sig", "in": "query", "schema": {"type": "string"}, "description": "Base64url HMAC-SHA256 of the text and expires. Required when the server has a signing key."},
+          {"$ref": "#/components/parameters/ecl"},
+          {"$ref": "#/components/parameters/format"},
+          {"$ref": "#/components/parameters/border"},
+          {"$ref": "#/components/parameters/scale"},
+          {"$ref": "#/components/parameters/boost"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Code"},
+          "304": {"description": "The symbol matches the If-None-Match entity tag."},
+          "400": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "406": {"$ref": "#/components/responses/Error"},
+          "413": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/generate/binary": {
+      "post": {
+        "summary": "Encode the request body as a byte-mode QR code.",
+        "operationId": "generateBinary",
+        "parameters": [
+          {"$ref": "#/components/parameters/ecl"},
+          {"$ref": "#/components/parameters/format"},
+          {"$ref": "#/components/parameters/border"},
+          {"$ref": "#/components/parameters/scale"},
+          {"$ref": "#/components/parameters/boost"}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {"application/octet-stream": {"schema": {"type": "string", "format": "binary"}}}
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Code"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "413": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/generate/payload/{kind}": {
+      "get": {
+        "summary": "Build a structured payload from query parameters named like the JSON fields of the kind (for example /v1/generate/payload/wifi?ssid=Home&password=secret) and encode it. Not served when the server has a signing key.",
+        "operationId": "generatePayloadFromQuery",
+        "parameters": [
+          {"name": "kind", "in": "path", "required": true, "schema": {"type": "string"}, "description": "A payload kind listed by /v1/payloads."},
+          {"$ref": "#/components/parameters/ecl"},
+          {"$ref": "#/components/parameters/format"},
+          {"$ref": "#/components/parameters/border"},
+          {"$ref": "#/components/parameters/scale"},
+          {"$ref": "#/components/parameters/boost"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Code"},
+          "304": {"description": "The symbol matches the If-None-Match entity tag."},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "406": {"$ref": "#/components/responses/Error"},
+          "413": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Build a structured payload (Wi-Fi, vCard, etc.) and encode it.",
+        "operationId": "generatePayload",
+        "parameters": [
+          {"name": "kind", "in": "path", "required": true, "schema": {"type": "string"}, "description": "A payload kind listed by /v1/payloads."},
+          {"$ref": "#/components/parameters/ecl"},
+          {"$ref": "#/components/parameters/format"},
+          {"$ref": "#/components/parameters/border"},
+          {"$ref": "#/components/parameters/scale"},
+          {"$ref": "#/components/parameters/boost"}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"type": "object", "description": "The fields of the payload builder."}}}
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Code"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "413": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/payloads": {
+      "get": {
+        "summary": "List the available payload kinds.",
+        "operationId": "listPayloads",
+        "responses": {
+          "200": {
+            "description": "The payload kinds.",
+            "content": {"application/json": {"schema": {
+              "type": "object",
+              "properties": {"kinds": {"type": "array", "items": {"type": "string"}}}
+            }}}
+          }
+        }
+      }
+    },
+    "/v1/validate": {
+      "post": {
+        "summary": "Check whether text fits in a QR code under the given constraints.",
+        "operationId": "validate",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {
+            "type": "object",
+            "required": ["text"],
+            "properties": {
+              "text": {"type": "string"},
+              "ecl": {"type": "string", "enum": ["L", "M", "Q", "H"], "default": "M"},
+              "minVersion": {"type": "integer", "minimum": 1, "maximum": 40, "default": 1},
+              "maxVersion": {"type": "integer", "minimum": 1, "maximum": 40, "default": 40},
+              "profile": {"type": "string", "description": "Name of a scanner profile the symbol must be readable by, such as generic-smartphone."}
+            }
+          }}}
+        },
+        "responses": {
+          "200": {
+            "description": "The validation result.",
+            "content": {"application/json": {"schema": {
+              "type": "object",
+              "properties": {
+                "valid": {"type": "boolean"},
+                "version": {"type": "integer"},
+                "ecl": {"type": "string"},
+                "error": {"type": "string"}
+              }
+            }}}
+          },
+          "400": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/generate/expiring": {
+      "post": {
+        "summary": "Encode a signed payload that stops verifying after ttl seconds. Only served when the server has an expiring key and an issuer token, which the request must carry as a bearer token.",
+        "operationId": "generateExpiring",
+        "parameters": [
+          {"$ref": "#/components/parameters/ecl"},
+          {"$ref": "#/components/parameters/format"},
+          {"$ref": "#/components/parameters/border"},
+          {"$ref": "#/components/parameters/scale"},
+          {"$ref": "#/components/parameters/boost"}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {
+            "type": "object",
+            "properties": {
+              "data": {"type": "string"},
+              "ttl": {"type": "integer", "minimum": 1, "maximum": 86400, "default": 300}
+            }
+          }}}
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Code"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "413": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/verify/expiring": {
+      "post": {
+        "summary": "Check a scanned expiring payload. Only served when the server has an expiring key.",
+        "operationId": "verifyExpiring",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {
+            "type": "object",
+            "required": ["token"],
+            "properties": {"token": {"type": "string"}}
+          }}}
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Verify"},
+          "403": {"$ref": "#/components/responses/Verify"},
+          "400": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/decode": {
+      "post": {
+        "summary": "Decode a clean, axis-aligned QR code image.",
+        "operationId": "decode",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "image/png": {"schema": {"type": "string", "format": "binary"}},
+            "image/gif": {"schema": {"type": "string", "format": "binary"}},
+            "image/jpeg": {"schema": {"type": "string", "format": "binary"}}
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "The decoded content.",
+            "content": {"application/json": {"schema": {
+              "type": "object",
+              "properties": {
+                "text": {"type": "string"},
+                "data": {"type": "string", "format": "byte"},
+                "version": {"type": "integer"},
+                "ecl": {"type": "string"},
+                "mask": {"type": "integer"},
+                "correctedErrors": {"type": "integer"}
+              }
+            }}}
+          },
+          "413": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "ecl": {"name": "ecl", "in": "query", "schema": {"type": "string", "enum": ["L", "M", "Q", "H"], "default": "M"}},
+      "format": {"name": "format", "in": "query", "description": "Output format. Without it, the format is negotiated from the Accept header (SVG if it is absent).", "schema": {"type": "string", "enum": ["svg", "png", "json"]}},
+      "border": {"name": "border", "in": "query", "schema": {"type": "integer", "minimum": 0, "maximum": 64, "default": 4}},
+      "scale": {"name": "scale", "in": "query", "description": "Pixels per module for PNG output.", "schema": {"type": "integer", "minimum": 1, "default": 8}},
+      "boost": {"name": "boost", "in": "query", "description": "Raise the error correction level when it does not increase the version.", "schema": {"type": "boolean", "default": true}}
+    },
+    "responses": {
+      "Health": {
+        "description": "The self-test report.",
+        "content": {"application/json": {"schema": {
+          "type": "object",
+          "properties": {
+            "ok": {"type": "boolean"},
+            "version": {"type": "string"},
+            "tableChecksums": {"type": "object", "additionalProperties": {"type": "string"}},
+            "renderers": {"type": "object", "additionalProperties": {"type": "string"}},
+            "problems": {"type": "array", "items": {"type": "string"}}
+          }
+        }}}
+      },
+      "Code": {
+        "description": "The rendered QR code.",
+        "content": {
+          "image/svg+xml": {"schema": {"type": "string"}},
+          "image/png": {"schema": {"type": "string", "format": "binary"}},
+          "application/json": {"schema": {"$ref": "#/components/schemas/Matrix"}}
+        }
+      },
+      "Error": {
+        "description": "The request failed.",
+        "content": {"application/json": {"schema": {
+          "type": "object",
+          "properties": {"error": {"type": "string"}}
+        }}}
+      },
+      "Verify": {
+        "description": "The verification result.",
+        "content": {"application/json": {"schema": {
+          "type": "object",
+          "properties": {
+            "valid": {"type": "boolean"},
+            "data": {"type": "string"},
+            "expires": {"type": "string", "format": "date-time"},
+            "error": {"type": "string"}
+          }
+        }}}
+      }
+    },
+    "schemas": {
+      "Matrix": {
+        "type": "object",
+        "properties": {
+          "version": {"type": "integer"},
+          "size": {"type": "integer"},
+          "ecl": {"type": "string"},
+          "mask": {"type": "integer"},
+          "modules": {"type": "array", "items": {"type": "string", "pattern": "^[01]+$"}}
+        }
+      }
+    }
+  }
+}
+`
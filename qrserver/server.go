@@ -0,0 +1,534 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package qrserver provides an HTTP service (described by an OpenAPI 3
+// document served at /openapi.json) that generates, validates, and decodes QR
+// codes.
+package qrserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // Register decoders for the decode endpoint.
+	_ "image/jpeg" // Register decoders for the decode endpoint.
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grkuntzmd/qrcodegen"
+	"github.com/grkuntzmd/qrcodegen/payload"
+)
+
+// maxDecodePixels bounds the width×height of images accepted by the decode
+// endpoint, so that a small compressed body cannot claim a huge canvas.
+const maxDecodePixels = 4096 * 4096
+
+// Server is an http.Handler serving the QR code API.
+type Server struct {
+	maxBodyBytes   int64
+	maxScale       int
+	expiringKey    []byte
+	expiringPrefix string
+	issuerToken    string
+	signingKey     []byte
+	mux            *http.ServeMux
+}
+
+// New creates a Server with the given options.
+func New(options ...func(*Server)) *Server {
+	s := &Server{
+		maxBodyBytes: 1 << 20,
+		maxScale:     32,
+		mux:          http.NewServeMux(),
+	}
+	for _, o := range options {
+		o(s)
+	}
+
+	s.mux.HandleFunc("/openapi.json", s.handleOpenAPI)
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.HandleFunc("/v1/generate", s.handleGenerate)
+	if len(s.signingKey) == 0 {
+		s.mux.HandleFunc("/v1/generate/binary", s.handleGenerateBinary)
+		s.mux.HandleFunc("/v1/generate/payload/", s.handleGeneratePayload)
+	}
+	s.mux.HandleFunc("/v1/payloads", s.handlePayloads)
+	s.mux.HandleFunc("/v1/validate", s.handleValidate)
+	s.mux.HandleFunc("/v1/decode", s.handleDecode)
+	if len(s.expiringKey) > 0 {
+		if s.issuerToken != "" {
+			s.mux.HandleFunc("/v1/generate/expiring", s.handleGenerateExpiring)
+		}
+		s.mux.HandleFunc("/v1/verify/expiring", s.handleVerifyExpiring)
+	}
+
+	return s
+}
+
+// WithMaxBodyBytes sets the largest request body the server accepts (default
+// 1 MiB).
+func WithMaxBodyBytes(n int64) func(*Server) {
+	return func(s *Server) {
+		s.maxBodyBytes = n
+	}
+}
+
+// WithMaxScale sets the largest pixels-per-module scale accepted for PNG
+// output (default 32).
+func WithMaxScale(n int) func(*Server) {
+	return func(s *Server) {
+		s.maxScale = n
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// renderOptions are the query parameters shared by the generate endpoints.
+type renderOptions struct {
+	ecl        qrcodegen.ECL
+	format     string
+	negotiated bool // The format was chosen from the Accept header.
+	border     int
+	scale      int
+	boost      bool
+	maxAge     time.Duration // Lifetime of GET responses in caches (0 for no caching).
+}
+
+func (s *Server) parseRenderOptions(r *http.Request) (renderOptions, error) {
+	query := r.URL.Query()
+	opts := renderOptions{
+		ecl:    qrcodegen.Medium,
+		format: "svg",
+		border: 4,
+		scale:  8,
+		boost:  true,
+	}
+
+	if v := query.Get("ecl"); v != "" {
+		ecl, err := qrcodegen.ParseECL(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.ecl = ecl
+	}
+	if v := query.Get("format"); v != "" {
+		switch v {
+		case "svg", "png", "json":
+			opts.format = v
+		default:
+			return opts, fmt.Errorf("unknown format %q", v)
+		}
+	} else {
+		format, err := negotiateFormat(r.Header.Get("Accept"))
+		if err != nil {
+			return opts, err
+		}
+		opts.format, opts.negotiated = format, true
+	}
+	for _, p := range []struct {
+		name     string
+		dst      *int
+		min, max int
+	}{
+		{"border", &opts.border, 0, 64},
+		{"scale", &opts.scale, 1, s.maxScale},
+	} {
+		v := query.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < p.min || n > p.max {
+			return opts, fmt.Errorf("%s must be an integer in [%d, %d]", p.name, p.min, p.max)
+		}
+		*p.dst = n
+	}
+	if v := query.Get("boost"); v != "" {
+		boost, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("boost must be a boolean")
+		}
+		opts.boost = boost
+	}
+
+	return opts, nil
+}
+
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, "GET, HEAD")
+		return
+	}
+	maxAge := cacheMaxAge
+	if len(s.signingKey) > 0 {
+		now := time.Now()
+		expires, err := s.checkSignature(r.URL.Query(), now)
+		if err != nil {
+			writeError(w, http.StatusForbidden, err)
+			return
+		}
+		// Caches must not serve the symbol after the signature expires.
+		if left := expires.Sub(now).Truncate(time.Second); left < maxAge {
+			maxAge = left
+		}
+	}
+
+	opts, err := s.parseRenderOptions(r)
+	if err != nil {
+		writeOptionsError(w, err)
+		return
+	}
+	opts.maxAge = maxAge
+
+	s.encodeAndWrite(w, r, qrcodegen.MakeSegments(r.URL.Query().Get("text")), opts)
+}
+
+func (s *Server) handleGenerateBinary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	opts, err := s.parseRenderOptions(r)
+	if err != nil {
+		writeOptionsError(w, err)
+		return
+	}
+	data, err := s.readBody(w, r)
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+
+	s.encodeAndWrite(w, r, []*qrcodegen.QRSegment{qrcodegen.MakeBytes(data)}, opts)
+}
+
+// renderParameters are the query parameters read by parseRenderOptions.
+var renderParameters = []string{"ecl", "format", "border", "scale", "boost"}
+
+// handleGeneratePayload builds a payload from the fields in a POST body (as
+// JSON) or in the GET query (see payload.SetFromQuery), and encodes it.
+func (s *Server) handleGeneratePayload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, "GET, HEAD, POST")
+		return
+	}
+
+	builder, err := payload.New(strings.TrimPrefix(r.URL.Path, "/v1/generate/payload/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	opts, err := s.parseRenderOptions(r)
+	if err != nil {
+		writeOptionsError(w, err)
+		return
+	}
+	if r.Method == http.MethodPost {
+		body, err := s.readBody(w, r)
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		if err := json.Unmarshal(body, builder); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		fields := r.URL.Query()
+		for _, name := range renderParameters {
+			delete(fields, name)
+		}
+		if err := payload.SetFromQuery(builder, fields); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		opts.maxAge = cacheMaxAge
+	}
+	text, err := builder.Payload()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.encodeAndWrite(w, r, qrcodegen.MakeSegments(text), opts)
+}
+
+func (s *Server) handlePayloads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]string{"kinds": payload.Kinds()})
+}
+
+// validateRequest is the body of a validate request.
+type validateRequest struct {
+	Text       string `json:"text"`
+	ECL        string `json:"ecl"`
+	MinVersion int    `json:"minVersion"`
+	MaxVersion int    `json:"maxVersion"`
+	Profile    string `json:"profile"` // Scanner profile the symbol must be readable by (empty for none).
+}
+
+// validateResponse is the body of a validate response.
+type validateResponse struct {
+	Valid   bool   `json:"valid"`
+	Version int    `json:"version,omitempty"`
+	ECL     string `json:"ecl,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := s.readBody(w, r)
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	req := validateRequest{ECL: "M", MinVersion: int(qrcodegen.MinVersion), MaxVersion: int(qrcodegen.MaxVersion)}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ecl, err := qrcodegen.ParseECL(req.ECL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var profile *qrcodegen.ScannerProfile
+	if req.Profile != "" {
+		p, err := qrcodegen.LookupScannerProfile(req.Profile)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		profile = &p
+	}
+
+	q, err := qrcodegen.EncodeSegments(qrcodegen.MakeSegments(req.Text), ecl,
+		qrcodegen.WithMinVersion(qrcodegen.Version(req.MinVersion)),
+		qrcodegen.WithMaxVersion(qrcodegen.Version(req.MaxVersion)))
+	if err == nil && profile != nil {
+		err = profile.Check(q, nil, 0)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusOK, validateResponse{Error: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, validateResponse{
+		Valid:   true,
+		Version: int(q.Version),
+		ECL:     q.ErrorCorrectionLevel.String(),
+	})
+}
+
+// decodeResponse is the body of a decode response.
+type decodeResponse struct {
+	Text            string `json:"text"`
+	Data            string `json:"data"` // Base64.
+	Version         int    `json:"version"`
+	ECL             string `json:"ecl"`
+	Mask            int    `json:"mask"`
+	CorrectedErrors int    `json:"correctedErrors"`
+}
+
+func (s *Server) handleDecode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	body, err := s.readBody(w, r)
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err)
+		return
+	}
+	if int64(config.Width)*int64(config.Height) > maxDecodePixels {
+		writeError(w, http.StatusRequestEntityTooLarge,
+			fmt.Errorf("image is %dx%d pixels; at most %d are allowed", config.Width, config.Height, maxDecodePixels))
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err)
+		return
+	}
+	result, err := qrcodegen.DecodeImage(img)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, decodeResponse{
+		Text:            string(result.Data),
+		Data:            base64.StdEncoding.EncodeToString(result.Data),
+		Version:         int(result.Version),
+		ECL:             result.ErrorCorrectionLevel.String(),
+		Mask:            int(result.Mask),
+		CorrectedErrors: result.CorrectedErrors,
+	})
+}
+
+// handleHealthz runs the library self-test, answering 503 if it fails so that
+// load balancers take a misbuilt instance out of service.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, "GET, HEAD")
+		return
+	}
+
+	report := qrcodegen.SelfTest()
+	status := http.StatusOK
+	if !report.OK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, report)
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, openAPISpec)
+}
+
+// matrixResponse is the JSON rendering of a QR code.
+type matrixResponse struct {
+	Version int      `json:"version"`
+	Size    int      `json:"size"`
+	ECL     string   `json:"ecl"`
+	Mask    int      `json:"mask"`
+	Modules []string `json:"modules"` // One string of '0' and '1' per row.
+}
+
+// encodeAndWrite encodes the segments and writes the symbol in the chosen
+// format. Responses to GET and HEAD requests carry an entity tag and caching
+// headers, and conditional requests for an unchanged symbol get 304 Not
+// Modified without the symbol being encoded.
+func (s *Server) encodeAndWrite(w http.ResponseWriter, r *http.Request, segs []*qrcodegen.QRSegment, opts renderOptions) {
+	if opts.negotiated {
+		w.Header().Add("Vary", "Accept")
+	}
+	// Only successful responses are cacheable.
+	setCacheHeaders := func() {}
+	if opts.maxAge > 0 && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		etag := opts.etag(segs)
+		setCacheHeaders = func() {
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(opts.maxAge.Seconds())))
+		}
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			setCacheHeaders()
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	q, err := qrcodegen.EncodeSegments(segs, opts.ecl, qrcodegen.WithBoostECL(opts.boost), qrcodegen.WithRejectEmpty())
+	if err != nil {
+		var tooLong *qrcodegen.DataTooLongError
+		if errors.As(err, &tooLong) {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	setCacheHeaders()
+
+	switch opts.format {
+	case "svg":
+		border := opts.border
+		if border == 0 {
+			border = -1 // SVGOptions takes 0 as the default border.
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		q.WriteSVG(w, qrcodegen.SVGOptions{Border: border})
+	case "png":
+		img, err := q.ToImage(opts.scale, opts.border)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		png.Encode(w, img)
+	case "json":
+		rows := make([]string, q.Size)
+		for y, row := range q.Modules {
+			var sb strings.Builder
+			for _, m := range row {
+				sb.WriteByte('0' + byte(m))
+			}
+			rows[y] = sb.String()
+		}
+		writeJSON(w, http.StatusOK, matrixResponse{
+			Version: int(q.Version),
+			Size:    q.Size,
+			ECL:     q.ErrorCorrectionLevel.String(),
+			Mask:    int(q.Mask),
+			Modules: rows,
+		})
+	}
+}
+
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	return ioutil.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodyBytes))
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
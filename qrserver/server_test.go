@@ -0,0 +1,332 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grkuntzmd/qrcodegen"
+	"github.com/stretchr/testify/assert"
+)
+
+func serve(s http.Handler, method, target string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestGenerate(t *testing.T) {
+	s := New()
+
+	w := serve(s, http.MethodGet, "/v1/generate?text=HELLO&ecl=H", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<svg")
+
+	w = serve(s, http.MethodGet, "/v1/generate?text=HELLO&format=json", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var matrix matrixResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &matrix))
+	assert.Equal(t, 21, matrix.Size)
+
+	w = serve(s, http.MethodGet, "/v1/generate?text=HELLO&ecl=X", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(s, http.MethodGet, "/v1/generate?text="+strings.Repeat("x", 3000), "")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = serve(s, http.MethodPost, "/v1/generate/payload/wifi?format=json", `{"ssid":"home","password":"secret"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(s, http.MethodPost, "/v1/generate/payload/nope", `{}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(s, http.MethodGet, "/v1/generate?text=", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestValidate(t *testing.T) {
+	s := New()
+
+	w := serve(s, http.MethodPost, "/v1/validate", `{"text":"HELLO","ecl":"L"}`)
+	var resp validateResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Valid)
+	assert.Equal(t, 1, resp.Version)
+
+	w = serve(s, http.MethodPost, "/v1/validate", `{"text":"`+strings.Repeat("x", 100)+`","ecl":"H","maxVersion":5}`)
+	resp = validateResponse{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.Valid)
+	assert.Contains(t, resp.Error, "needs version")
+
+	w = serve(s, http.MethodPost, "/v1/validate", `{"text":"`+strings.Repeat("x", 200)+`","profile":"embedded-ccd"}`)
+	resp = validateResponse{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.Valid)
+	assert.Contains(t, resp.Error, "exceeds the maximum of 7")
+
+	w = serve(s, http.MethodPost, "/v1/validate", `{"text":"HELLO","profile":"no-such-scanner"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDecode(t *testing.T) {
+	s := New()
+
+	w := serve(s, http.MethodPost, "/v1/generate/binary?format=png&scale=4", "round trip")
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	assert.NoError(t, err)
+
+	w = serve(s, http.MethodPost, "/v1/decode", w.Body.String())
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp decodeResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "round trip", resp.Text)
+	assert.Equal(t, qrcodegen.Quartile.String(), resp.ECL)
+
+	// A GIF header claiming a 65535×65535 canvas is refused before decoding.
+	huge := "GIF89a\xff\xff\xff\xff\x00\x00\x00"
+	w = serve(s, http.MethodPost, "/v1/decode", huge)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), "65535x65535")
+}
+
+func TestHealthz(t *testing.T) {
+	w := serve(New(WithSigningKey([]byte("key"))), http.MethodGet, "/healthz", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var report qrcodegen.SelfTestReport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.True(t, report.OK)
+	assert.Equal(t, "ok", report.Renderers["png"])
+	assert.Len(t, report.TableChecksums["numDataCodewords"], 16)
+
+	w = serve(New(), http.MethodPost, "/healthz", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestOpenAPI(t *testing.T) {
+	w := serve(New(), http.MethodGet, "/openapi.json", "")
+	var spec map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	assert.Equal(t, "3.0.3", spec["openapi"])
+}
+
+func TestLambdaHandler(t *testing.T) {
+	handler := LambdaHandler(New())
+
+	req := Request{HTTPMethod: http.MethodGet, Path: "/v1/generate", QueryStringParameters: map[string]string{"text": "HELLO", "format": "png"}}
+	resp, err := handler(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/png", resp.Headers["Content-Type"])
+	assert.True(t, resp.IsBase64Encoded)
+
+	req = Request{RawPath: "/v1/validate", Body: `{"text":"HELLO"}`}
+	req.RequestContext.HTTP.Method = http.MethodPost
+	resp, err = handler(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, resp.IsBase64Encoded)
+	assert.Contains(t, resp.Body, `"valid":true`)
+
+	req = Request{HTTPMethod: http.MethodHead, Path: "/v1/generate", QueryStringParameters: map[string]string{"text": "HELLO", "format": "png"}}
+	resp, err = handler(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/png", resp.Headers["Content-Type"])
+	assert.Empty(t, resp.Body)
+	assert.False(t, resp.IsBase64Encoded)
+}
+
+func TestExpiring(t *testing.T) {
+	key := []byte("secret")
+	assert.Equal(t, http.StatusNotFound, serve(New(), http.MethodPost, "/v1/verify/expiring", `{}`).Code)
+
+	// Without an issuer token the public server only verifies.
+	s := New(WithExpiringKey(key, "https://door.example/c/"))
+	assert.Equal(t, http.StatusNotFound, serve(s, http.MethodPost, "/v1/generate/expiring", `{"data":"x"}`).Code)
+
+	s = New(WithExpiringKey(key, "https://door.example/c/"), WithExpiringIssuer("issuer"))
+	w := serve(s, http.MethodPost, "/v1/generate/expiring", `{"data":"room-42","ttl":60}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	w = issue(s, "/v1/generate/expiring", `{"data":"room-42","ttl":60}`, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = issue(s, "/v1/generate/expiring?format=png&scale=2", `{"data":"room-42","ttl":60}`, "issuer")
+	assert.Equal(t, http.StatusOK, w.Code)
+	img, err := png.Decode(w.Body)
+	assert.NoError(t, err)
+	decoded, err := qrcodegen.DecodeImage(img)
+	assert.NoError(t, err)
+	token := string(decoded.Data)
+	assert.True(t, strings.HasPrefix(token, "https://door.example/c/"))
+
+	w = serve(s, http.MethodPost, "/v1/verify/expiring", `{"token":"`+token+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp verifyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Valid)
+	assert.Equal(t, "room-42", resp.Data)
+
+	w = serve(s, http.MethodPost, "/v1/verify/expiring", `{"token":"`+token+`x"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = issue(s, "/v1/generate/expiring", `{"data":"x","ttl":0}`, "issuer")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// issue posts body to target with the given issuer token.
+func issue(s http.Handler, target, body, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestSignedRequests(t *testing.T) {
+	key := []byte("secret")
+	s := New(WithSigningKey(key))
+	future := time.Now().Add(time.Hour)
+
+	query := SignedQuery(key, "https://example.com/", future)
+	w := serve(s, http.MethodGet, "/v1/generate?format=png&"+query.Encode(), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	img, err := png.Decode(w.Body)
+	assert.NoError(t, err)
+	decoded, err := qrcodegen.DecodeImage(img)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/", string(decoded.Data))
+
+	for _, target := range []string{
+		"/v1/generate?text=https://evil.example/",
+		"/v1/generate?" + strings.Replace(query.Encode(), "example.com", "evil.example", 1),
+		"/v1/generate?" + SignedQuery([]byte("other"), "https://example.com/", future).Encode(),
+		"/v1/generate?" + SignedQuery(key, "https://example.com/", time.Now().Add(-time.Second)).Encode(),
+		"/v1/generate?" + strings.Replace(query.Encode(), "expires=", "expires=1", 1),
+	} {
+		w = serve(s, http.MethodGet, target, "")
+		assert.Equal(t, http.StatusForbidden, w.Code, target)
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(s, http.MethodPost, "/v1/generate/binary", "x").Code)
+	assert.Equal(t, http.StatusNotFound, serve(s, http.MethodPost, "/v1/generate/payload/url", `{}`).Code)
+	assert.Equal(t, http.StatusOK, serve(New(), http.MethodGet, "/v1/generate?text=x", "").Code)
+}
+
+func TestNegotiation(t *testing.T) {
+	s := New()
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	for accept, want := range map[string]string{
+		"":                                       "image/svg+xml",
+		"*/*":                                    "image/svg+xml",
+		"image/png":                              "image/png",
+		"image/*;q=0.5, application/json":        "application/json",
+		"image/webp, image/png;q=0.8, */*;q=0.1": "image/png",
+		"image/svg+xml;q=0, image/*":             "image/png",
+	} {
+		w := get("/v1/generate?text=HELLO", http.Header{"Accept": {accept}})
+		assert.Equal(t, http.StatusOK, w.Code, accept)
+		assert.Equal(t, want, w.Header().Get("Content-Type"), accept)
+		assert.Equal(t, "Accept", w.Header().Get("Vary"))
+	}
+	w := get("/v1/generate?text=HELLO", http.Header{"Accept": {"text/html"}})
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	w = get("/v1/generate?text=HELLO&format=png", http.Header{"Accept": {"text/html"}})
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("Vary"))
+
+	// Entity tags differ between representations and support conditional
+	// requests.
+	w = get("/v1/generate?text=HELLO", nil)
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, "public, max-age=86400", w.Header().Get("Cache-Control"))
+	assert.NotEqual(t, etag, get("/v1/generate?text=HELLO", http.Header{"Accept": {"image/png"}}).Header().Get("ETag"))
+	assert.NotEqual(t, etag, get("/v1/generate?text=HELLO&border=2", nil).Header().Get("ETag"))
+	w = get("/v1/generate?text=HELLO", http.Header{"If-None-Match": {`"other", W/` + etag}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, http.StatusOK, get("/v1/generate?text=HELLO", http.Header{"If-None-Match": {`"other"`}}).Code)
+	assert.Empty(t, get("/v1/generate?text=", nil).Header().Get("Cache-Control"))
+
+	head := serve(s, http.MethodHead, "/v1/generate?text=HELLO", "")
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Equal(t, etag, head.Header().Get("ETag"))
+	assert.Equal(t, "GET, HEAD", serve(s, http.MethodPut, "/v1/generate?text=HELLO", "").Header().Get("Allow"))
+
+	// POST responses are not cached, and signed ones only until they expire.
+	assert.Empty(t, serve(s, http.MethodPost, "/v1/generate/binary", "x").Header().Get("ETag"))
+	key := []byte("secret")
+	query := SignedQuery(key, "HELLO", time.Now().Add(time.Minute))
+	w = serve(New(WithSigningKey(key)), http.MethodGet, "/v1/generate?"+query.Encode(), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Regexp(t, `^public, max-age=(59|60)$`, w.Header().Get("Cache-Control"))
+}
+
+func TestGeneratePayloadQuery(t *testing.T) {
+	s := New()
+	w := serve(s, http.MethodGet, "/v1/generate/payload/wifi?ssid=Home%3BNet&password=secret&hidden=true&format=png&scale=2", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+	img, err := png.Decode(w.Body)
+	assert.NoError(t, err)
+	decoded, err := qrcodegen.DecodeImage(img)
+	assert.NoError(t, err)
+	assert.Equal(t, `WIFI:T:WPA;S:Home\;Net;P:secret;H:true;;`, string(decoded.Data))
+
+	for _, target := range []string{
+		"/v1/generate/payload/wifi?ssid=Home&pass=secret",
+		"/v1/generate/payload/wifi?ssid=Home&hidden=maybe",
+		"/v1/generate/payload/wifi?ssid=a&ssid=b",
+		"/v1/generate/payload/geo?latitude=north&longitude=0",
+		"/v1/generate/payload/geo?latitude=95&longitude=0",
+	} {
+		assert.Equal(t, http.StatusBadRequest, serve(s, http.MethodGet, target, "").Code, target)
+	}
+	assert.Equal(t, http.StatusNotFound, serve(s, http.MethodGet, "/v1/generate/payload/fax?number=1", "").Code)
+	assert.Equal(t, http.StatusOK, serve(s, http.MethodGet, "/v1/generate/payload/geo?latitude=40.5&longitude=-74.25&format=json", "").Code)
+}
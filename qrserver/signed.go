@@ -0,0 +1,92 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// WithSigningKey puts the server in signed-request mode: /v1/generate only
+// renders text whose expires and sig query parameters were produced with key
+// by SignedQuery, so a public image endpoint cannot be used to render
+// arbitrary (for example phishing) links. The endpoints that render content
+// chosen in the request body, /v1/generate/binary and /v1/generate/payload/,
+// are not served in this mode.
+func WithSigningKey(key []byte) func(*Server) {
+	return func(s *Server) {
+		s.signingKey = key
+	}
+}
+
+// SignedQuery returns the text, expires, and sig query parameters of a
+// /v1/generate request that a server with the signing key will honor until
+// expires. The rendering parameters (ecl, format, etc.) are not signed and may
+// be added freely.
+func SignedQuery(key []byte, text string, expires time.Time) url.Values {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+
+	return url.Values{
+		"text":    {text},
+		"expires": {exp},
+		"sig":     {base64.RawURLEncoding.EncodeToString(requestMAC(key, text, exp))},
+	}
+}
+
+// requestMAC returns the HMAC-SHA256 authenticating text until exp.
+func requestMAC(key []byte, text, exp string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("qrserver/generate\x00" + exp + "\x00" + text))
+
+	return mac.Sum(nil)
+}
+
+// checkSignature verifies the signed parameters of a request at now and
+// returns the time they expire.
+func (s *Server) checkSignature(query url.Values, now time.Time) (time.Time, error) {
+	exp, sig := query.Get("expires"), query.Get("sig")
+	if exp == "" || sig == "" {
+		return time.Time{}, errors.New("request is not signed")
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("invalid expires parameter")
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, requestMAC(s.signingKey, query.Get("text"), exp)) {
+		return time.Time{}, errors.New("invalid signature")
+	}
+	expires := time.Unix(unix, 0)
+	if !now.Before(expires) {
+		return time.Time{}, errors.New("signed request has expired")
+	}
+
+	return expires, nil
+}
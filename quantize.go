@@ -0,0 +1,203 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// PaletteColor is a named color available for stitching or printing, such as
+// a yarn, floss, or filament.
+type PaletteColor struct {
+	Name  string
+	Color color.Color
+}
+
+// QuantizeOptions configures Quantize.
+type QuantizeOptions struct {
+	Palette        []PaletteColor // The available colors.
+	Artwork        image.Image    // Optional artwork stretched over the symbol (including the border) that guides the color choice of each module.
+	Border         int            // Quiet zone in modules.
+	DarkThreshold  float64        // Maximum relative luminance of a color used for dark modules (0 is treated as 0.25).
+	LightThreshold float64        // Minimum relative luminance of a color used for light modules (0 is treated as 0.5).
+}
+
+// Quantized assigns a palette color to every module of a symbol.
+type Quantized struct {
+	Palette []PaletteColor
+	Size    int     // Width and height in modules, including the border.
+	Cells   [][]int // Palette index of each module, indexed by row and column.
+	Counts  []int   // Number of modules assigned to each palette color.
+}
+
+// Quantize assigns a color from the caller's palette to every module (for
+// cross-stitch, pixel-art, or multi-filament prints). Dark modules only
+// receive colors at or below the dark luminance threshold, and light modules
+// only colors at or above the light threshold, so the result keeps the
+// contrast a scanner needs. Without artwork, dark modules get the darkest
+// color and light modules the lightest; with artwork, each module gets the
+// eligible color nearest to the average artwork color under it.
+func (q *QRCode) Quantize(opts QuantizeOptions) (*Quantized, error) {
+	if opts.Border < 0 {
+		return nil, fmt.Errorf("border must be non-negative")
+	}
+	darkThreshold := opts.DarkThreshold
+	if darkThreshold == 0 {
+		darkThreshold = 0.25
+	}
+	lightThreshold := opts.LightThreshold
+	if lightThreshold == 0 {
+		lightThreshold = 0.5
+	}
+	if darkThreshold >= lightThreshold {
+		return nil, fmt.Errorf("dark threshold must be below light threshold")
+	}
+
+	var darkColors, lightColors []int
+	darkest, lightest := -1, -1
+	for i, p := range opts.Palette {
+		l := relativeLuminance(p.Color)
+		if l <= darkThreshold {
+			darkColors = append(darkColors, i)
+			if darkest == -1 || l < relativeLuminance(opts.Palette[darkest].Color) {
+				darkest = i
+			}
+		}
+		if l >= lightThreshold {
+			lightColors = append(lightColors, i)
+			if lightest == -1 || l > relativeLuminance(opts.Palette[lightest].Color) {
+				lightest = i
+			}
+		}
+	}
+	if len(darkColors) == 0 || len(lightColors) == 0 {
+		return nil, fmt.Errorf("palette needs at least one color with luminance <= %g and one >= %g", darkThreshold, lightThreshold)
+	}
+
+	n := q.Size + opts.Border*2
+	result := &Quantized{
+		Palette: opts.Palette,
+		Size:    n,
+		Cells:   make([][]int, n),
+		Counts:  make([]int, len(opts.Palette)),
+	}
+	for y := 0; y < n; y++ {
+		result.Cells[y] = make([]int, n)
+		for x := 0; x < n; x++ {
+			dark := q.chartCell(x, y, opts.Border)
+			index := lightest
+			candidates := lightColors
+			if dark {
+				index = darkest
+				candidates = darkColors
+			}
+			if opts.Artwork != nil {
+				index = nearestColor(averageColor(opts.Artwork, x, y, n), opts.Palette, candidates)
+			}
+			result.Cells[y][x] = index
+			result.Counts[index]++
+		}
+	}
+
+	return result, nil
+}
+
+// ToImage renders the quantized symbol with scale pixels per module.
+func (qz *Quantized) ToImage(scale int) (*image.Paletted, error) {
+	if scale < 1 {
+		return nil, fmt.Errorf("scale must be positive")
+	}
+
+	palette := make(color.Palette, len(qz.Palette))
+	for i, p := range qz.Palette {
+		palette[i] = p.Color
+	}
+	pixels := qz.Size * scale
+	img := image.NewPaletted(image.Rect(0, 0, pixels, pixels), palette)
+	for py := 0; py < pixels; py++ {
+		row := qz.Cells[py/scale]
+		for px := 0; px < pixels; px++ {
+			img.Pix[py*img.Stride+px] = uint8(row[px/scale])
+		}
+	}
+
+	return img, nil
+}
+
+// averageColor returns the average color of the part of img under module
+// (x, y) of an n*n grid stretched over the image, sampled on a 4*4 grid of
+// points.
+func averageColor(img image.Image, x, y, n int) [3]float64 {
+	const samples = 4
+
+	b := img.Bounds()
+	var sum [3]float64
+	for sy := 0; sy < samples; sy++ {
+		for sx := 0; sx < samples; sx++ {
+			fx := (float64(x) + (float64(sx)+0.5)/samples) / float64(n)
+			fy := (float64(y) + (float64(sy)+0.5)/samples) / float64(n)
+			r, g, bl, _ := img.At(b.Min.X+int(fx*float64(b.Dx())), b.Min.Y+int(fy*float64(b.Dy()))).RGBA()
+			sum[0] += float64(r)
+			sum[1] += float64(g)
+			sum[2] += float64(bl)
+		}
+	}
+
+	return [3]float64{sum[0] / samples / samples, sum[1] / samples / samples, sum[2] / samples / samples}
+}
+
+// nearestColor returns the candidate palette index whose color is closest to
+// c, using a weighted RGB distance that approximates perceived difference.
+func nearestColor(c [3]float64, palette []PaletteColor, candidates []int) int {
+	best, bestDistance := candidates[0], math.Inf(1)
+	for _, i := range candidates {
+		r, g, b, _ := palette[i].Color.RGBA()
+		dr, dg, db := c[0]-float64(r), c[1]-float64(g), c[2]-float64(b)
+		d := 2*dr*dr + 4*dg*dg + 3*db*db
+		if d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+
+	return best
+}
+
+// relativeLuminance returns the WCAG relative luminance of a color, from 0
+// (black) to 1 (white).
+func relativeLuminance(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+	linear := func(v uint32) float64 {
+		s := float64(v) / 0xFFFF
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+
+	return 0.2126*linear(r) + 0.7152*linear(g) + 0.0722*linear(b)
+}
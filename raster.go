@@ -0,0 +1,337 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+)
+
+// ScaledImage is one raster rendition produced by RenderScales.
+type ScaledImage struct {
+	Width   int             // The requested width (and height) in CSS pixels.
+	Density int             // The pixel density multiplier (1 for 1x, 2 for @2x, etc.).
+	Image   *image.Paletted // The rendered image, Width*Density pixels square.
+}
+
+var monochromePalette = color.Palette{color.White, color.Black}
+
+// ToImage returns a raster image of the QR code where each module is scale
+// pixels square and the symbol is surrounded by a border (quiet zone) of the
+// given number of modules. Dark modules use palette index 1 (black) and light
+// modules use palette index 0 (white).
+func (q *QRCode) ToImage(scale, border int) (*image.Paletted, error) {
+	if scale < 1 {
+		return nil, fmt.Errorf("scale must be positive")
+	}
+	if border < 0 {
+		return nil, fmt.Errorf("border must be non-negative")
+	}
+
+	grid := q.borderedGrid(border)
+	return grid.render(grid.size * scale), nil
+}
+
+// PNGOptions controls WritePNG.
+type PNGOptions struct {
+	Scale  int // Pixels per module (default 4).
+	Border int // Quiet zone in modules (default 4; negative for none).
+
+	// Size, if positive, replaces Scale with the largest whole number of
+	// pixels per module at which the image is at most Size pixels wide (or
+	// one, if even that is wider), so that modules are never blurred by
+	// fractional scaling. The image is then smaller than Size unless Size is
+	// a multiple of the modules; SnapScale reports its actual width.
+	Size int
+
+	Dark  color.Color // Color of dark modules (default black).
+	Light color.Color // Color of light modules and the quiet zone (default white).
+
+	// MaxBytes, if positive, is the largest image to write. An image over
+	// the limit is compressed harder, then rendered at ever smaller scales
+	// down to one pixel per module; if it is still too large, nothing is
+	// written and an *OutputTooLargeError is returned.
+	MaxBytes int
+
+	CompressionLevel png.CompressionLevel // zlib effort (default png.DefaultCompression).
+	Filter           PNGFilter            // Row filter (default as image/png).
+
+	// Deflate, if not nil, writes the zlib stream of the filtered image data
+	// in place of compress/zlib, so that a slower, denser compressor such as
+	// zopfli can be plugged in when images are stored or served in bulk.
+	Deflate func(w io.Writer, data []byte) error
+}
+
+// WritePNG writes the QR code to w as a two-color indexed PNG image.
+func (q *QRCode) WritePNG(w io.Writer, opts PNGOptions) error {
+	if err := opts.normalize(q.Size); err != nil {
+		return err
+	}
+
+	return opts.writeWithinBudget(w, func(w io.Writer, enc *pngEncoder, scale int) error {
+		img, err := q.ToImage(scale, opts.Border)
+		if err != nil {
+			return err
+		}
+		img.Palette = color.Palette{opts.Light, opts.Dark}
+		return enc.Encode(w, img)
+	})
+}
+
+// writeWithinBudget writes the image drawn by encode at the scale of the
+// options, degrading the compression and scale as needed to fit MaxBytes.
+func (opts *PNGOptions) writeWithinBudget(w io.Writer, encode func(w io.Writer, enc *pngEncoder, scale int) error) error {
+	return writeWithinBudget(w, opts.MaxBytes, 1+opts.Scale, func(w io.Writer, level int) error {
+		enc := &pngEncoder{level: opts.CompressionLevel, filter: opts.Filter, deflate: opts.Deflate}
+		if level > 0 {
+			enc.level = png.BestCompression
+		}
+		return encode(w, enc, opts.Scale-max(0, level-1))
+	})
+}
+
+// normalize fills in the defaults and checks the scale, snapping it to Size
+// for a symbol of the given number of modules.
+func (opts *PNGOptions) normalize(modules int) error {
+	if opts.Border == 0 {
+		opts.Border = 4
+	} else if opts.Border < 0 {
+		opts.Border = 0
+	}
+	if opts.Size > 0 {
+		if opts.Scale != 0 {
+			return fmt.Errorf("set either the scale or the size")
+		}
+		opts.Scale = max(1, opts.Size/(modules+2*opts.Border))
+	}
+	if opts.Scale == 0 {
+		opts.Scale = 4
+	}
+	if opts.Dark == nil {
+		opts.Dark = color.Black
+	}
+	if opts.Light == nil {
+		opts.Light = color.White
+	}
+	if opts.Scale < 1 {
+		return fmt.Errorf("scale must be positive")
+	}
+	if opts.Filter < PNGFilterDefault || opts.Filter > PNGFilterAdaptive {
+		return fmt.Errorf("unknown PNG filter %d", opts.Filter)
+	}
+
+	return nil
+}
+
+// SnapScale returns the whole number of pixels per module that PNGOptions.Size
+// chooses for a target of pixels, with a border of the given number of
+// modules, and the width and height of the resulting image.
+func (q *QRCode) SnapScale(pixels, border int) (scale, side int) {
+	modules := q.Size + 2*max(border, 0)
+	scale = max(1, pixels/modules)
+
+	return scale, scale * modules
+}
+
+// DeviceImage is a raster rendition produced by RenderForDevice.
+type DeviceImage struct {
+	Image        *image.Paletted // The rendered image, DevicePixels square.
+	Scale        int             // Device pixels per module.
+	DevicePixels int             // Width and height of the image in device (physical) pixels.
+	CSSPixels    float64         // Width and height at which to display the image, in CSS pixels.
+}
+
+// RenderForDevice renders the QR code for display at about cssPixels CSS
+// pixels on a screen with the given device pixel ratio (window.devicePixelRatio,
+// such as 2 or 1.5), with a border of the given number of modules. The image
+// has a whole number of device pixels per module, at most cssPixels*ratio
+// wide, and should be displayed at CSSPixels (for a canvas, its style width
+// and height) so that each image pixel lands on exactly one device pixel.
+func (q *QRCode) RenderForDevice(cssPixels int, ratio float64, border int) (*DeviceImage, error) {
+	if cssPixels < 1 || !(ratio > 0) {
+		return nil, fmt.Errorf("CSS pixels and pixel ratio must be positive")
+	}
+	if border < 0 {
+		return nil, fmt.Errorf("border must be non-negative")
+	}
+
+	scale, side := q.SnapScale(int(math.Round(float64(cssPixels)*ratio)), border)
+	img, err := q.ToImage(scale, border)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeviceImage{Image: img, Scale: scale, DevicePixels: side, CSSPixels: float64(side) / ratio}, nil
+}
+
+// RenderScales renders the QR code once per combination of the given widths
+// (in CSS pixels) and pixel densities, sharing the bordered module grid and
+// the per-size coordinate maps between renditions. Each image is exactly
+// width*density pixels square, and must have at least one pixel per module
+// including the border; modules are mapped to pixels with nearest-neighbor
+// sampling, so module sizes may differ by one pixel when the width is not a
+// multiple of the number of modules. Renditions of the same pixel size are
+// rendered once but each gets its own copy, so they may be modified
+// independently. If no densities are given, only 1x images are produced.
+func (q *QRCode) RenderScales(border int, widths []int, densities ...int) ([]ScaledImage, error) {
+	if border < 0 {
+		return nil, fmt.Errorf("border must be non-negative")
+	}
+	if len(densities) == 0 {
+		densities = []int{1}
+	}
+
+	grid := q.borderedGrid(border)
+	cache := make(map[int]*image.Paletted) // Images keyed by pixel size, so 256@1x and 128@2x are rendered once.
+	result := make([]ScaledImage, 0, len(widths)*len(densities))
+	for _, w := range widths {
+		for _, d := range densities {
+			if w < 1 || d < 1 {
+				return nil, fmt.Errorf("width and density must be positive")
+			}
+			pixels := w * d
+			if pixels < grid.size {
+				return nil, fmt.Errorf("%d pixels (%d at %dx) is fewer than the %d modules including the border", pixels, w, d, grid.size)
+			}
+			img, ok := cache[pixels]
+			if ok {
+				img = &image.Paletted{
+					Pix:     append([]uint8(nil), img.Pix...),
+					Stride:  img.Stride,
+					Rect:    img.Rect,
+					Palette: append(color.Palette(nil), img.Palette...),
+				}
+			} else {
+				img = grid.render(pixels)
+				cache[pixels] = img
+			}
+			result = append(result, ScaledImage{Width: w, Density: d, Image: img})
+		}
+	}
+
+	return result, nil
+}
+
+// ToSupersampledImage returns a raster image of the QR code exactly pixels
+// wide, with a border of the given number of modules. Each pixel is the
+// average of samples by samples points, a box filter, so that when the
+// pixels do not divide evenly among the modules the pixels on module edges
+// are gray rather than some modules being a pixel wider than others, which
+// shows as moiré on screens. Palette index i is i/samples² of the way from
+// white to black. Samples must be from 1 to 15.
+func (q *QRCode) ToSupersampledImage(pixels, border, samples int) (*image.Paletted, error) {
+	if pixels < 1 {
+		return nil, fmt.Errorf("pixels must be positive")
+	}
+	if border < 0 {
+		return nil, fmt.Errorf("border must be non-negative")
+	}
+	if samples < 1 || samples > 15 {
+		return nil, fmt.Errorf("samples must be from 1 to 15")
+	}
+
+	return q.borderedGrid(border).supersample(pixels, samples), nil
+}
+
+// moduleGrid is the QR code matrix with its border, flattened into a single
+// slice of palette indices.
+type moduleGrid struct {
+	size  int
+	cells []uint8
+}
+
+func (q *QRCode) borderedGrid(border int) moduleGrid {
+	size := q.Size + border*2
+	cells := make([]uint8, size*size)
+	for y := 0; y < q.Size; y++ {
+		row := cells[(y+border)*size+border:]
+		for x := 0; x < q.Size; x++ {
+			row[x] = uint8(q.Modules[y][x])
+		}
+	}
+
+	return moduleGrid{size: size, cells: cells}
+}
+
+// render draws the grid into a square image of the given number of pixels.
+func (g moduleGrid) render(pixels int) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, pixels, pixels), monochromePalette)
+
+	// Map each pixel coordinate to a module coordinate once.
+	moduleAt := make([]int, pixels)
+	for p := range moduleAt {
+		moduleAt[p] = p * g.size / pixels
+	}
+
+	for py := 0; py < pixels; py++ {
+		if py > 0 && moduleAt[py] == moduleAt[py-1] {
+			copy(img.Pix[py*img.Stride:(py+1)*img.Stride], img.Pix[(py-1)*img.Stride:py*img.Stride])
+			continue
+		}
+		src := g.cells[moduleAt[py]*g.size:]
+		dst := img.Pix[py*img.Stride:]
+		for px := 0; px < pixels; px++ {
+			dst[px] = src[moduleAt[px]]
+		}
+	}
+
+	return img
+}
+
+// supersample draws the grid into a square image of the given number of
+// pixels, counting the dark points among samples by samples in each pixel.
+func (g moduleGrid) supersample(pixels, samples int) *image.Paletted {
+	levels := samples * samples
+	palette := make(color.Palette, levels+1)
+	for i := range palette {
+		palette[i] = color.Gray{uint8(255 - 255*i/levels)}
+	}
+	img := image.NewPaletted(image.Rect(0, 0, pixels, pixels), palette)
+
+	// Map each sample coordinate to a module coordinate once.
+	moduleAt := make([]int, pixels*samples)
+	for p := range moduleAt {
+		moduleAt[p] = p * g.size / len(moduleAt)
+	}
+
+	for py := 0; py < pixels; py++ {
+		for px := 0; px < pixels; px++ {
+			dark := 0
+			for _, my := range moduleAt[py*samples : (py+1)*samples] {
+				row := g.cells[my*g.size:]
+				for _, mx := range moduleAt[px*samples : (px+1)*samples] {
+					dark += int(row[mx])
+				}
+			}
+			img.Pix[py*img.Stride+px] = uint8(dark)
+		}
+	}
+
+	return img
+}
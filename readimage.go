@@ -0,0 +1,106 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// ReadImage samples the modules of a QR code from a clean, axis-aligned
+// raster image, such as one produced by ToImage or a rasterized SVG. It is not
+// a camera scanner: the symbol must not be rotated, skewed, or blurred. The
+// module size is measured from the top-left finder pattern, and the version,
+// error correction level, and mask are taken from the size and format bits.
+func ReadImage(img image.Image) (*QRCode, error) {
+	bounds := img.Bounds()
+	dark := func(x, y int) bool {
+		return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y < 128
+	}
+
+	// Find the bounding box of the dark pixels.
+	minX, minY, maxX, maxY := bounds.Max.X, bounds.Max.Y, bounds.Min.X-1, bounds.Min.Y-1
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if dark(x, y) {
+				minX, minY = min(minX, x), min(minY, y)
+				maxX, maxY = max(maxX, x), max(maxY, y)
+			}
+		}
+	}
+	if maxX < minX {
+		return nil, fmt.Errorf("no symbol found in image")
+	}
+
+	// The top row of the top-left finder pattern is 7 dark modules wide.
+	run := 0
+	for x := minX; x <= maxX && dark(x, minY); x++ {
+		run++
+	}
+	moduleSize := float64(run) / 7
+	width := float64(maxX - minX + 1)
+	version := int(math.Round((width/moduleSize - 17) / 4))
+	if version < int(MinVersion) || int(MaxVersion) < version {
+		return nil, fmt.Errorf("no symbol found in image")
+	}
+	size := version*4 + 17
+	moduleSize = width / float64(size)
+
+	q := &QRCode{
+		Version: Version(version),
+		Size:    size,
+		Modules: make([][]Module, size),
+	}
+	for y := 0; y < size; y++ {
+		q.Modules[y] = make([]Module, size)
+		py := minY + int((float64(y)+0.5)*moduleSize)
+		for x := 0; x < size; x++ {
+			px := minX + int((float64(x)+0.5)*moduleSize)
+			q.Modules[y][x] = bToModule(dark(px, py))
+		}
+	}
+
+	ecl, mask, err := readFormatBits(q.Modules)
+	if err != nil {
+		return nil, err
+	}
+	q.ErrorCorrectionLevel = ecl
+	q.Mask = mask
+
+	return q, nil
+}
+
+// DecodeImage reads a QR code from a clean raster image (see ReadImage) and
+// decodes its data.
+func DecodeImage(img image.Image) (*DecodeResult, error) {
+	q, err := ReadImage(img)
+	if err != nil {
+		return nil, err
+	}
+
+	return Decode(q)
+}
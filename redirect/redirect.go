@@ -0,0 +1,237 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package redirect supports "dynamic" QR codes: the printed symbol holds a
+// short, opaque URL on a server you control, and the server redirects to a
+// target that can be changed later without reprinting.
+//
+//	r := &redirect.Redirector{Store: redirect.NewMemoryStore(), BaseURL: "HTTPS://QR.EXAMPLE.COM/R/"}
+//	_, text, _ := r.Create(ctx, "https://example.com/spring-sale")
+//	q, _ := qrcodegen.EncodeText(text, qrcodegen.Medium)
+//	http.Handle("/R/", r)
+//
+// Tokens use only digits and upper-case letters, so if the base URL is also
+// written in upper case the whole payload fits in the compact alphanumeric
+// mode. The scheme and host are case-insensitive, but the path is not, so the
+// handler must be mounted on the path exactly as the base URL spells it.
+package redirect
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+)
+
+// Errors returned by a Store.
+var (
+	ErrNotFound = errors.New("redirect: token not found")
+	ErrExists   = errors.New("redirect: token already exists")
+)
+
+// Store persists the mapping from tokens to targets. Implementations must be
+// safe for concurrent use.
+type Store interface {
+	// Get returns the target of token, or ErrNotFound.
+	Get(ctx context.Context, token string) (string, error)
+	// Create adds a new token, or returns ErrExists if it is already in use.
+	Create(ctx context.Context, token, target string) error
+	// Update changes the target of an existing token, or returns ErrNotFound.
+	Update(ctx context.Context, token, target string) error
+}
+
+// MemoryStore is a Store kept in memory, for tests and single-process
+// deployments.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	targets map[string]string
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{targets: make(map[string]string)}
+}
+
+// Get implements Store.
+func (m *MemoryStore) Get(_ context.Context, token string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	target, ok := m.targets[token]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return target, nil
+}
+
+// Create implements Store.
+func (m *MemoryStore) Create(_ context.Context, token, target string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.targets[token]; ok {
+		return ErrExists
+	}
+	m.targets[token] = target
+
+	return nil
+}
+
+// Update implements Store.
+func (m *MemoryStore) Update(_ context.Context, token, target string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.targets[token]; !ok {
+		return ErrNotFound
+	}
+	m.targets[token] = target
+
+	return nil
+}
+
+// tokenAlphabet is a subset of the QR alphanumeric character set.
+const tokenAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// Redirector issues tokens and resolves them. It is an http.Handler that
+// redirects a request whose last path element is a token to the token's
+// target.
+type Redirector struct {
+	Store       Store  // Token storage; required.
+	BaseURL     string // Text placed before each token in the payload, such as "HTTPS://QR.EXAMPLE.COM/R/".
+	TokenLength int    // Number of characters in new tokens (default 8, about 41 bits).
+	// Rand is the source of token randomness (default crypto/rand.Reader).
+	// Tests may substitute a fixed reader for reproducible tokens; production
+	// code should keep a cryptographically secure source so tokens cannot be
+	// guessed.
+	Rand io.Reader
+}
+
+// Create stores target under a new random token, returning the token and the
+// payload text to encode.
+func (r *Redirector) Create(ctx context.Context, target string) (token, payload string, err error) {
+	if err := checkTarget(target); err != nil {
+		return "", "", err
+	}
+
+	// Collisions are rare; retry a few times before giving up.
+	for i := 0; i < 5; i++ {
+		if token, err = r.newToken(); err != nil {
+			return "", "", err
+		}
+		err = r.Store.Create(ctx, token, target)
+		if err == nil {
+			return token, r.BaseURL + token, nil
+		}
+		if !errors.Is(err, ErrExists) {
+			return "", "", err
+		}
+	}
+
+	return "", "", fmt.Errorf("redirect: could not allocate a unique token")
+}
+
+// Update points an existing token at a new target.
+func (r *Redirector) Update(ctx context.Context, token, target string) error {
+	if err := checkTarget(target); err != nil {
+		return err
+	}
+
+	return r.Store.Update(ctx, token, target)
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Redirector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	target, err := r.Store.Get(req.Context(), path.Base(req.URL.Path))
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.NotFound(w, req)
+	case err != nil:
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	default:
+		// The target may change at any time, so the redirect must not be
+		// cached.
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, req, target, http.StatusFound)
+	}
+}
+
+func (r *Redirector) newToken() (string, error) {
+	n := r.TokenLength
+	if n <= 0 {
+		n = 8
+	}
+
+	return randomToken(r.Rand, n)
+}
+
+// randomToken returns n characters drawn uniformly from tokenAlphabet, using
+// crypto/rand.Reader if random is nil.
+func randomToken(random io.Reader, n int) (string, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(random, buf); err != nil {
+		return "", err
+	}
+	// 252 is the largest multiple of 36 below 256; rejecting larger bytes
+	// keeps the distribution uniform.
+	for i := 0; i < n; {
+		if buf[i] < 252 {
+			buf[i] = tokenAlphabet[buf[i]%36]
+			i++
+			continue
+		}
+		if _, err := io.ReadFull(random, buf[i:i+1]); err != nil {
+			return "", err
+		}
+	}
+
+	return string(buf), nil
+}
+
+// checkTarget rejects anything but absolute http and https URLs, so that a
+// token can never redirect to a javascript: or data: URL.
+func checkTarget(target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("redirect: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("redirect: target must be an absolute http or https URL")
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package redirect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grkuntzmd/qrcodegen"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirector(t *testing.T) {
+	ctx := context.Background()
+	r := &Redirector{Store: NewMemoryStore(), BaseURL: "HTTPS://QR.EXAMPLE.COM/R/"}
+
+	token, text, err := r.Create(ctx, "https://example.com/a")
+	assert.NoError(t, err)
+	assert.Len(t, token, 8)
+	assert.Equal(t, "HTTPS://QR.EXAMPLE.COM/R/"+token, text)
+	seg := qrcodegen.MakeSegments(text)
+	assert.Len(t, seg, 1)
+	assert.Equal(t, qrcodegen.Alphanumeric, seg[0].Mode)
+
+	// Mounted as in the package example, the scanned payload resolves.
+	mux := http.NewServeMux()
+	mux.Handle("/R/", r)
+	resolve := func(p string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		return w
+	}
+
+	w := resolve(text)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://example.com/a", w.Header().Get("Location"))
+
+	assert.NoError(t, r.Update(ctx, token, "https://example.com/b"))
+	assert.Equal(t, "https://example.com/b", resolve("/R/"+token).Header().Get("Location"))
+
+	assert.Equal(t, http.StatusNotFound, resolve("/R/NOPE").Code)
+	assert.Equal(t, http.StatusNotFound, resolve("/r/"+token).Code)
+	assert.True(t, errors.Is(r.Update(ctx, "NOPE", "https://example.com/"), ErrNotFound))
+
+	_, _, err = r.Create(ctx, "javascript:alert(1)")
+	assert.Error(t, err)
+	assert.Error(t, r.Update(ctx, token, "/relative"))
+	assert.False(t, strings.ContainsAny(token, "abcdefghijklmnopqrstuvwxyz"))
+}
+
+func TestRedirectorRand(t *testing.T) {
+	ctx := context.Background()
+	newRedirector := func() *Redirector {
+		return &Redirector{Store: NewMemoryStore(), Rand: strings.NewReader("\x00\x01\x23\xFF\x24\x25\x26\x27\x28")}
+	}
+
+	a, _, err := newRedirector().Create(ctx, "https://example.com/")
+	assert.NoError(t, err)
+	b, _, err := newRedirector().Create(ctx, "https://example.com/")
+	assert.NoError(t, err)
+	assert.Equal(t, a, b)
+	assert.Equal(t, "01Z40123", a) // 0xFF is rejected and replaced by the next byte.
+
+	_, _, err = (&Redirector{Store: NewMemoryStore(), Rand: strings.NewReader("short")}).Create(ctx, "https://example.com/")
+	assert.Error(t, err)
+}
+
+func TestCodeGenerator(t *testing.T) {
+	ctx := context.Background()
+	taken := map[string]bool{}
+	g := &CodeGenerator{
+		BaseURL:    "HTTPS://Q.CO/",
+		MaxVersion: 1,
+		ECL:        qrcodegen.Medium,
+		Unique: func(_ context.Context, code string) (bool, error) {
+			return !taken[code], nil
+		},
+	}
+
+	code, text, err := g.Generate(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, code, 7) // Version 1-M holds 20 alphanumeric characters.
+	q, err := qrcodegen.EncodeText(text, qrcodegen.Medium)
+	assert.NoError(t, err)
+	assert.Equal(t, qrcodegen.Version(1), q.Version)
+
+	// Collisions are retried, growing the code when the policy allows.
+	var tried []string
+	g = &CodeGenerator{
+		Retry: RetryPolicy{Attempts: 4, GrowAfter: 2},
+		Unique: func(_ context.Context, code string) (bool, error) {
+			tried = append(tried, code)
+			return len(tried) == 4, nil
+		},
+	}
+	code, _, err = g.Generate(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, code, 9)
+	assert.Len(t, tried, 4)
+
+	g.Unique = func(context.Context, string) (bool, error) { return false, nil }
+	_, _, err = g.Generate(ctx)
+	assert.Error(t, err)
+
+	g.Unique = func(context.Context, string) (bool, error) { return false, errors.New("db down") }
+	_, _, err = g.Generate(ctx)
+	assert.EqualError(t, err, "db down")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	g = &CodeGenerator{Retry: RetryPolicy{Backoff: time.Hour}, Unique: func(context.Context, string) (bool, error) { return false, nil }}
+	_, _, err = g.Generate(canceled)
+	assert.Equal(t, context.Canceled, err)
+
+	_, _, err = (&CodeGenerator{BaseURL: "HTTPS://Q.CO/", MaxVersion: 1, Length: 10, Unique: g.Unique}).Generate(ctx)
+	assert.Error(t, err)
+	_, _, err = (&CodeGenerator{}).Generate(ctx)
+	assert.Error(t, err)
+}
@@ -0,0 +1,144 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package redirect
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/grkuntzmd/qrcodegen"
+)
+
+// RetryPolicy controls how a CodeGenerator reacts to collisions.
+type RetryPolicy struct {
+	Attempts  int           // Codes to try before giving up (default 5).
+	GrowAfter int           // Lengthen the code by one character after this many collisions in a row, if it still fits (0 never).
+	Backoff   time.Duration // Wait before the first retry, doubled for each later one (0 retries at once).
+}
+
+// CodeGenerator issues short codes for stores other than a Store, such as an
+// existing database table, asking Unique whether each candidate is free.
+// Unique is only advisory, so the caller should still insert the code under a
+// unique constraint and call Generate again if that fails.
+type CodeGenerator struct {
+	BaseURL string // Text placed before each code in the payload, as for Redirector.
+
+	// Length is the number of characters in a code. If it is 0 and
+	// MaxVersion is set, it is the longest code (up to 12 characters) whose
+	// payload still fits in MaxVersion at ECL; otherwise it is 8.
+	Length     int
+	MaxVersion qrcodegen.Version
+	ECL        qrcodegen.ECL
+
+	Unique func(ctx context.Context, code string) (bool, error) // Reports whether code is unused; required.
+	Retry  RetryPolicy
+	Rand   io.Reader // Source of randomness (default crypto/rand.Reader), as for Redirector.
+}
+
+// Generate returns a new code that Unique accepted and the payload text to
+// encode.
+func (g *CodeGenerator) Generate(ctx context.Context) (code, payload string, err error) {
+	if g.Unique == nil {
+		return "", "", fmt.Errorf("redirect: no uniqueness check")
+	}
+	length, err := g.length()
+	if err != nil {
+		return "", "", err
+	}
+	attempts := g.Retry.Attempts
+	if attempts <= 0 {
+		attempts = 5
+	}
+
+	backoff := g.Retry.Backoff
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if g.Retry.GrowAfter > 0 && i%g.Retry.GrowAfter == 0 && g.fits(length+1) {
+				length++
+			}
+			if backoff > 0 {
+				timer := time.NewTimer(backoff)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return "", "", ctx.Err()
+				case <-timer.C:
+				}
+				backoff *= 2
+			}
+		}
+
+		if code, err = randomToken(g.Rand, length); err != nil {
+			return "", "", err
+		}
+		unique, err := g.Unique(ctx, code)
+		if err != nil {
+			return "", "", err
+		}
+		if unique {
+			return code, g.BaseURL + code, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("redirect: could not allocate a unique code in %d attempts", attempts)
+}
+
+// length returns the starting code length.
+func (g *CodeGenerator) length() (int, error) {
+	switch {
+	case g.Length > 0:
+		if !g.fits(g.Length) {
+			return 0, fmt.Errorf("redirect: %d character codes do not fit in version %d", g.Length, g.MaxVersion)
+		}
+		return g.Length, nil
+	case g.MaxVersion == 0:
+		return 8, nil
+	}
+
+	length := 12
+	for length > 0 && !g.fits(length) {
+		length--
+	}
+	if length < 4 {
+		return 0, fmt.Errorf("redirect: base URL leaves no room for a code in version %d", g.MaxVersion)
+	}
+
+	return length, nil
+}
+
+// fits reports whether a payload with a code of n characters fits in
+// MaxVersion, if set. The letters in the sample code keep the estimate from
+// assuming the denser numeric mode.
+func (g *CodeGenerator) fits(n int) bool {
+	if g.MaxVersion == 0 {
+		return true
+	}
+	version, err := qrcodegen.EstimateVersion(g.BaseURL+strings.Repeat("Z", n), g.ECL)
+
+	return err == nil && version <= g.MaxVersion
+}
@@ -24,12 +24,33 @@
 
 package qrcodegen
 
+import "math/rand"
+
 // segmentEncoder contains options for EncodeSegments.
 type segmentEncoder struct {
-	boostECL   bool // Boost error correction level if there is still room in the QR code version that has been chosen.
-	mask       Mask
-	maxVersion Version
-	minVersion Version
+	boostECL           bool // Boost error correction level if there is still room in the QR code version that has been chosen.
+	mask               Mask
+	maxInput           int // Largest input, in bytes, accepted by EncodeText and EncodeBinary (0 for no limit).
+	maxVersion         Version
+	minVersion         Version
+	normalize          *NormalizeOptions  // Normalization applied by EncodeText before segmentation (nil for none).
+	normalizeReport    *NormalizeReport   // Receives the normalization report, if not nil.
+	padding            rand.Source        // Source of random pad codewords (nil for the standard 0xEC, 0x11 sequence).
+	privacyCheck       bool               // Reject text that ScanPrivacy flags.
+	privacyIgnore      []PrivacyKind      // Finding kinds allowed by the privacy check.
+	spoofCheck         bool               // Reject text that ScanSpoofing flags.
+	audit              AuditHook          // Receives a record of every successful encode, if not nil.
+	auditTag           string             // Caller tag passed to the audit hook.
+	eccParallelism     int                // Goroutines used to compute error correction blocks (0 or 1 for none).
+	fastMask           bool               // Choose the automatic mask with the sampled penalty estimate.
+	forcedMode         *Mode              // Mode EncodeText must use for the whole text (nil to choose the densest).
+	alphanumericPolicy AlphanumericPolicy // Treatment of text that is alphanumeric except for lowercase letters.
+	modeReport         *ModeReport        // Receives the mode decision of EncodeText, if not nil.
+	tracer             Tracer             // Receives the pipeline stages, if not nil.
+	rejectEmpty        bool               // Fail with ErrEmptyPayload instead of encoding an empty symbol.
+	optimalSegments    bool               // Split EncodeText input with MakeSegmentsOptimally.
+
+	rowCallback func(y int, row []Module) error // Receives the rows of the final symbol, if not nil.
 }
 
 // WithAutoMask sets the mask value to automatic selection on a segment
@@ -48,6 +69,44 @@ func WithBoostECL(boost bool) func(*segmentEncoder) {
 	}
 }
 
+// WithECCParallelism computes the Reed-Solomon error correction of the
+// symbol's blocks on up to n goroutines. It only takes effect for symbols with
+// many blocks (large versions at the higher error correction levels, which
+// have up to 81), and lowers latency at the cost of some throughput, so it
+// suits latency-sensitive services rather than bulk generation.
+func WithECCParallelism(n int) func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.eccParallelism = n
+	}
+}
+
+// WithFastMask trades scan quality for speed when choosing the automatic
+// mask. It scores each mask with a sampled estimate of the penalty, applying
+// the run-length and finder-like pattern rules to every 8th row and column
+// only, which takes about a quarter of the time (roughly 65 µs instead of
+// 240 µs per mask for a version 40 symbol). The chosen mask is often not the
+// best one: measured over 400 random byte payloads of 10 to 800 bytes at
+// Medium, it matched the optimal mask about a quarter of the time and its full
+// penalty score was on average 3% higher, so the symbols scan somewhat less
+// reliably. Every mask still produces a valid symbol. Use it only for bulk
+// generation where throughput matters more than scanning margin. It has no
+// effect when a mask is given with WithMask.
+func WithFastMask() func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.fastMask = true
+	}
+}
+
+// WithForcedMode makes EncodeText encode the whole text as a single segment in
+// the given mode (Numeric, Alphanumeric, or Byte) instead of the densest mode
+// that can hold it; some strict verifiers require byte mode. EncodeText fails
+// if the text cannot be represented in the mode.
+func WithForcedMode(mode Mode) func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.forcedMode = &mode
+	}
+}
+
 // WithMask sets the mask value on a segment encoding.
 func WithMask(mask Mask) func(*segmentEncoder) {
 	return func(s *segmentEncoder) {
@@ -55,10 +114,20 @@ func WithMask(mask Mask) func(*segmentEncoder) {
 	}
 }
 
+// WithMaxInput limits the size, in bytes, of the text or data accepted by
+// EncodeText and EncodeBinary; larger input fails with an InputTooLargeError
+// before any segmentation or normalization work is done. Zero removes the
+// limit. It has no effect on EncodeSegments.
+func WithMaxInput(n int) func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.maxInput = n
+	}
+}
+
 // WithMaxVersion sets the maximum allows version on a segment encoding.
 func WithMaxVersion(version Version) func(*segmentEncoder) {
 	return func(s *segmentEncoder) {
-		s.minVersion = version
+		s.maxVersion = version
 	}
 }
 
@@ -68,3 +137,34 @@ func WithMinVersion(version Version) func(*segmentEncoder) {
 		s.minVersion = version
 	}
 }
+
+// WithOptimalSegments makes EncodeText split the text with
+// MakeSegmentsOptimally, mixing modes within the text where that saves bits,
+// instead of encoding it in the single densest mode that holds all of it. It
+// has no effect with WithForcedMode.
+func WithOptimalSegments() func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.optimalSegments = true
+	}
+}
+
+// WithRandomPadding fills the unused data capacity with random bytes from src
+// instead of the standard alternating 0xEC, 0x11 pad codewords. Decoders stop
+// reading at the terminator, so the content is unchanged, but the module
+// pattern (and therefore the look of the symbol) differs. The same source
+// state always yields the same padding, so a seeded source
+// (rand.NewSource(seed)) gives reproducible output. Sources from math/rand are
+// not safe for concurrent use.
+func WithRandomPadding(src rand.Source) func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.padding = src
+	}
+}
+
+// WithRejectEmpty makes encoding fail with ErrEmptyPayload when the segments
+// hold no characters, instead of producing a symbol with no content.
+func WithRejectEmpty() func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.rejectEmpty = true
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// segmentModes are the modes considered by the optimal segmenter, indexed as
+// in its cost tables.
+var segmentModes = [4]Mode{Byte, Alphanumeric, Numeric, kanji}
+
+// MakeSegmentsOptimally splits text into segments of any mix of the byte,
+// alphanumeric, numeric, and kanji modes, switching modes mid-string wherever
+// that saves bits, for example for digits in Japanese addresses or for an
+// uppercase code inside lowercase text. Characters outside the other modes are
+// encoded in byte mode as UTF-8. Kanji segments hold the double-byte Shift JIS
+// form of their characters, which is what scanners expect.
+//
+// The best split depends on the widths of the character count fields, which
+// grow at versions 10 and 27, so the segments returned are the ones that fit
+// the smallest version in [minVersion, maxVersion] at the error correction
+// level. If the text fits no version in the range, a *DataTooLongError is
+// returned.
+func MakeSegmentsOptimally(text string, ecl ECL, minVersion, maxVersion Version) ([]*QRSegment, error) {
+	if minVersion < MinVersion || MaxVersion < maxVersion || maxVersion < minVersion {
+		return nil, fmt.Errorf("invalid segment versions")
+	}
+
+	var segs []*QRSegment
+	for version := minVersion; ; version++ {
+		if version == minVersion || version == 10 || version == 27 {
+			segs = makeSegmentsOptimally(text, version)
+		}
+		dataCapacityBits := numDataCodewords[ecl][version] * 8
+		dataUsedBits := getTotalBits(segs, version)
+		if dataUsedBits != -1 && dataUsedBits <= dataCapacityBits {
+			return segs, nil
+		}
+		if version >= maxVersion {
+			return nil, newDataTooLongError(segs, ecl, minVersion, maxVersion, dataUsedBits, dataCapacityBits)
+		}
+	}
+}
+
+// makeSegmentsOptimally returns the segments of text with the fewest bits at
+// the given version.
+func makeSegmentsOptimally(text string, version Version) []*QRSegment {
+	if text == "" {
+		return []*QRSegment{}
+	}
+
+	// Split into characters, keeping the bytes of invalid UTF-8 as they are.
+	var chars []string
+	offsets := []int{0}
+	for rest := text; rest != ""; {
+		_, n := utf8.DecodeRuneInString(rest)
+		chars = append(chars, rest[:n])
+		offsets = append(offsets, offsets[len(offsets)-1]+n)
+		rest = rest[n:]
+	}
+
+	modes := computeCharacterModes(chars, version)
+
+	var segs []*QRSegment
+	start := 0
+	for i := 1; i <= len(chars); i++ {
+		if i < len(chars) && modes[i] == modes[start] {
+			continue
+		}
+		run := text[offsets[start]:offsets[i]]
+		switch modes[start] {
+		case Numeric:
+			segs = append(segs, MakeNumeric(run))
+		case Alphanumeric:
+			segs = append(segs, MakeAlphanumeric(run))
+		case kanji:
+			segs = append(segs, makeKanji(run))
+		default:
+			segs = append(segs, MakeBytes([]byte(run)))
+		}
+		start = i
+	}
+
+	return segs
+}
+
+// computeCharacterModes returns the mode of each character in the cheapest
+// encoding of chars at the given version. It is a shortest path search over
+// the characters where the state is the mode of the current segment: costs
+// are in sixths of a bit (a numeric digit costs 10/3 bits and an alphanumeric
+// character 11/2), switching modes costs the new segment's header, and a
+// segment's partial bits are rounded up when it ends.
+func computeCharacterModes(chars []string, version Version) []Mode {
+	const none = -1
+
+	var headCosts [4]int
+	for j, m := range segmentModes {
+		headCosts[j] = (4 + int(m.numCharCountBits(version))) * 6
+	}
+
+	// charModes[i][j] is the mode index, at character i, of the cheapest path
+	// that is in mode j after character i.
+	charModes := make([][4]int, len(chars))
+	prevCosts := headCosts
+	encoder := japanese.ShiftJIS.NewEncoder()
+	for i, c := range chars {
+		charModes[i] = [4]int{none, none, none, none}
+		var curCosts [4]int
+
+		curCosts[0] = prevCosts[0] + len(c)*8*6 // Byte mode takes anything.
+		charModes[i][0] = 0
+		if CanEncodeAlphanumeric(c) {
+			curCosts[1] = prevCosts[1] + 33
+			charModes[i][1] = 1
+		}
+		if CanEncodeNumeric(c) {
+			curCosts[2] = prevCosts[2] + 20
+			charModes[i][2] = 2
+		}
+		if r := []rune(c); len(r) == 1 {
+			if _, ok := kanjiCode(encoder, r[0]); ok {
+				curCosts[3] = prevCosts[3] + 78
+				charModes[i][3] = 3
+			}
+		}
+
+		// Try ending the segment in mode k after this character and starting
+		// one in mode j.
+		for j := range segmentModes {
+			for k := range segmentModes {
+				if charModes[i][k] == none {
+					continue
+				}
+				cost := (curCosts[k]+5)/6*6 + headCosts[j]
+				if charModes[i][j] == none || cost < curCosts[j] {
+					curCosts[j] = cost
+					charModes[i][j] = k
+				}
+			}
+		}
+
+		prevCosts = curCosts
+	}
+
+	// Follow the cheapest path back from the end.
+	cur := 0
+	for j := range segmentModes {
+		if prevCosts[j] < prevCosts[cur] {
+			cur = j
+		}
+	}
+	result := make([]Mode, len(chars))
+	for i := len(chars) - 1; i >= 0; i-- {
+		cur = charModes[i][cur]
+		result[i] = segmentModes[cur]
+	}
+
+	return result
+}
+
+// makeKanji creates a kanji segment from text, each character of which must
+// have a double-byte Shift JIS encoding in kanji mode's range.
+func makeKanji(text string) *QRSegment {
+	encoder := japanese.ShiftJIS.NewEncoder()
+	bb := make(bitBuffer, 0, len(text)/3*13)
+	n := 0
+	for _, r := range text {
+		code, ok := kanjiCode(encoder, r)
+		if !ok {
+			panic("string contains non-kanji characters")
+		}
+		if code <= 0x9FFC {
+			code -= 0x8140
+		} else {
+			code -= 0xC140
+		}
+		bb.appendBits(code>>8*0xC0+code&0xFF, 13)
+		n++
+	}
+
+	return &QRSegment{
+		Mode:     kanji,
+		NumChars: n,
+		Data:     bb,
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/png"
+	"runtime/debug"
+	"strings"
+)
+
+// selfTestText is encoded by SelfTest. It mixes modes so that the numeric,
+// alphanumeric, and byte encoders all take part.
+const selfTestText = "SELFTEST 0123456789 self-test"
+
+// SelfTestReport is the result of SelfTest.
+type SelfTestReport struct {
+	OK             bool              `json:"ok"`             // Every check passed.
+	Version        string            `json:"version"`        // The version of this module in the running binary, or "(devel)".
+	TableChecksums map[string]string `json:"tableChecksums"` // SHA-256 prefixes of the encoding tables, keyed by table.
+	Renderers      map[string]string `json:"renderers"`      // "ok" or the error of each renderer, keyed by name.
+	Problems       []string          `json:"problems,omitempty"`
+}
+
+// SelfTest encodes and decodes a small symbol, renders it with each renderer
+// (reading the raster renderings back), and checksums the lookup tables, so
+// that a deployed service can show that the library it was built with works
+// and is the one expected. The checksums depend only on the QR code standard,
+// so they are the same in every correct build.
+func SelfTest() *SelfTestReport {
+	r := &SelfTestReport{
+		Version:        moduleVersion(),
+		TableChecksums: tableChecksums(),
+		Renderers:      make(map[string]string),
+	}
+
+	q, err := EncodeText(selfTestText, Medium)
+	if err != nil {
+		r.Problems = append(r.Problems, fmt.Sprintf("encode: %v", err))
+	} else if result, err := Decode(q); err != nil {
+		r.Problems = append(r.Problems, fmt.Sprintf("decode: %v", err))
+	} else if string(result.Data) != selfTestText {
+		r.Problems = append(r.Problems, "decode: round trip returned different data")
+	}
+
+	if q != nil {
+		for name, render := range map[string]func() error{
+			"svg": func() error {
+				var buf bytes.Buffer
+				if err := q.WriteSVG(&buf, SVGOptions{}); err != nil {
+					return err
+				}
+				if !strings.Contains(buf.String(), "<path d=\"M") {
+					return fmt.Errorf("no modules drawn")
+				}
+				return nil
+			},
+			"png": func() error {
+				var buf bytes.Buffer
+				if err := q.WritePNG(&buf, PNGOptions{}); err != nil {
+					return err
+				}
+				img, err := png.Decode(&buf)
+				if err != nil {
+					return err
+				}
+				return checkSelfTestImage(DecodeImage(img))
+			},
+			"theme": func() error {
+				img, err := ThemeClassic.ToImage(q, 4)
+				if err != nil {
+					return err
+				}
+				return checkSelfTestImage(DecodeImage(img))
+			},
+		} {
+			r.Renderers[name] = "ok"
+			if err := render(); err != nil {
+				r.Renderers[name] = err.Error()
+				r.Problems = append(r.Problems, fmt.Sprintf("%s renderer: %v", name, err))
+			}
+		}
+	}
+	r.OK = len(r.Problems) == 0
+
+	return r
+}
+
+// checkSelfTestImage checks that a rendering read back to the self-test text.
+func checkSelfTestImage(result *DecodeResult, err error) error {
+	if err != nil {
+		return err
+	}
+	if string(result.Data) != selfTestText {
+		return fmt.Errorf("rendering reads back as different data")
+	}
+
+	return nil
+}
+
+// moduleVersion returns the version of this module recorded in the build
+// information of the running binary.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(unknown)"
+	}
+	const path = "github.com/grkuntzmd/qrcodegen"
+	if info.Main.Path == path {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == path {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+
+	return "(devel)"
+}
+
+// tableChecksums returns the first 16 hex digits of the SHA-256 of each
+// lookup table.
+func tableChecksums() map[string]string {
+	checksum := func(tables ...interface{}) string {
+		h := sha256.New()
+		fmt.Fprint(h, tables...)
+		return hex.EncodeToString(h.Sum(nil))[:16]
+	}
+
+	return map[string]string{
+		"alignmentPatternPositions": checksum(alignmentPatternPositions),
+		"eccCodeWordsPerBlock":      checksum(eccCodeWordsPerBlock),
+		"numDataCodewords":          checksum(numDataCodewords),
+		"numErrorCorrectionBlocks":  checksum(numErrorCorrectionBlocks),
+		"numRawDataModules":         checksum(numRawDataModules),
+		"reedSolomonDivisors":       checksum(reedSolomonDivisors),
+		"galoisField":               checksum(gfExp, gfLog),
+	}
+}
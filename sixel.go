@@ -0,0 +1,119 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+)
+
+// SixelOptions controls Sixel.
+type SixelOptions struct {
+	Scale  int         // Pixels per module (default 4).
+	Border int         // Quiet zone in modules (default 4; negative for none).
+	Dark   color.Color // Color of dark modules (default black).
+	Light  color.Color // Color of light modules and the quiet zone (default white).
+}
+
+// Sixel writes the QR code to w as DEC Sixel graphics, which terminals such
+// as xterm (started with -ti vt340), mlterm, and foot draw as real pixels,
+// so that a code shown over SSH scans as well as an image would.
+func (q *QRCode) Sixel(w io.Writer, opts SixelOptions) error {
+	if opts.Scale == 0 {
+		opts.Scale = 4
+	}
+	if opts.Border == 0 {
+		opts.Border = 4
+	} else if opts.Border < 0 {
+		opts.Border = 0
+	}
+	if opts.Dark == nil {
+		opts.Dark = color.Black
+	}
+	if opts.Light == nil {
+		opts.Light = color.White
+	}
+	if opts.Scale < 1 {
+		return fmt.Errorf("scale must be positive")
+	}
+
+	grid := q.borderedGrid(opts.Border)
+	side := grid.size * opts.Scale
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "\x1bPq\"1;1;%d;%d", side, side)
+	for i, c := range []color.Color{opts.Light, opts.Dark} {
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(bw, "#%d;2;%d;%d;%d", i, r*100/0xFFFF, g*100/0xFFFF, b*100/0xFFFF)
+	}
+
+	// Each band is six pixel rows, drawn once per color; "$" returns to the
+	// start of the band and "-" moves to the next.
+	sixels := make([]byte, side)
+	for top := 0; top < side; top += 6 {
+		if top > 0 {
+			bw.WriteByte('-')
+		}
+		for c := uint8(0); c < 2; c++ {
+			for x := range sixels {
+				bits := byte(0)
+				for i := 0; i < 6 && top+i < side; i++ {
+					if grid.cells[(top+i)/opts.Scale*grid.size+x/opts.Scale] == c {
+						bits |= 1 << i
+					}
+				}
+				sixels[x] = '?' + bits
+			}
+			if c > 0 {
+				bw.WriteByte('$')
+			}
+			fmt.Fprintf(bw, "#%d", c)
+			writeSixelRuns(bw, sixels)
+		}
+	}
+	bw.WriteString("\x1b\\")
+
+	return bw.Flush()
+}
+
+// writeSixelRuns writes the sixel characters, compressing runs of more than
+// three with the "!count" repeat introducer.
+func writeSixelRuns(bw *bufio.Writer, sixels []byte) {
+	for x := 0; x < len(sixels); {
+		n := 1
+		for x+n < len(sixels) && sixels[x+n] == sixels[x] {
+			n++
+		}
+		if n > 3 {
+			fmt.Fprintf(bw, "!%d%c", n, sixels[x])
+		} else {
+			for i := 0; i < n; i++ {
+				bw.WriteByte(sixels[x])
+			}
+		}
+		x += n
+	}
+}
@@ -0,0 +1,242 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// SpoofKind identifies how a host found by ScanSpoofing imitates another.
+type SpoofKind string
+
+// The kinds of lookalike hosts recognized by ScanSpoofing.
+const (
+	SpoofMixedScript SpoofKind = "mixed-script" // A label mixes Latin letters with Cyrillic or Greek ones, or Cyrillic with Greek.
+	SpoofWholeScript SpoofKind = "whole-script" // A label is spelled entirely with Cyrillic or Greek lookalikes of Latin letters.
+)
+
+// SpoofFinding is one URL host in a payload that may imitate another host.
+type SpoofFinding struct {
+	Kind     SpoofKind
+	Start    int    // Byte offset of the host in the text.
+	End      int    // Byte offset just past the host.
+	Host     string // The host as written (punycode labels are decoded for the check).
+	Skeleton string // The host with lookalikes replaced by the Latin letters they imitate, such as "paypal.com".
+}
+
+// urlHost matches the authority of URLs with a scheme; the host is what
+// follows any user information and precedes any port.
+var urlHost = regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.-]*://(?:[^\s/?#@]*@)?([^\s/?#:@]+)`)
+
+// confusables maps Cyrillic and Greek letters (lowercase, as hosts are
+// compared without case) to the Latin letters they are indistinguishable
+// from in common fonts.
+var confusables = map[rune]rune{
+	'а': 'a', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j',
+	'к': 'k', 'ӏ': 'l', 'м': 'm', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'т': 't',
+	'у': 'y', 'ԝ': 'w', 'х': 'x', 'ѵ': 'v',
+	'α': 'a', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't',
+	'υ': 'u', 'χ': 'x', 'γ': 'y',
+}
+
+// ScanSpoofing looks for URLs whose hosts use confusable Unicode to imitate
+// other hosts, such as "pаypal.com" with a Cyrillic "а", as platforms that
+// turn user-submitted links into QR codes should not issue them. Hosts in
+// punycode ("xn--...") are decoded first. The findings are sorted by position.
+// Hosts written in a single non-Latin script that do not spell Latin letters
+// are not flagged.
+func ScanSpoofing(text string) []SpoofFinding {
+	var findings []SpoofFinding
+	for _, loc := range urlHost.FindAllStringSubmatchIndex(text, -1) {
+		start, end := loc[2], loc[3]
+		host := text[start:end]
+		labels := strings.Split(strings.ToLower(host), ".")
+		var kind SpoofKind
+		for i, label := range labels {
+			if strings.HasPrefix(label, "xn--") {
+				decoded, ok := punycodeDecode(label[4:])
+				if !ok {
+					continue
+				}
+				labels[i] = decoded
+			}
+			if k := spoofKind(labels[i]); kind == "" {
+				kind = k
+			}
+		}
+		if kind == "" {
+			continue
+		}
+		for i, label := range labels {
+			labels[i] = skeleton(label)
+		}
+		findings = append(findings, SpoofFinding{Kind: kind, Start: start, End: end, Host: host, Skeleton: strings.Join(labels, ".")})
+	}
+
+	return findings
+}
+
+// WithSpoofCheck makes EncodeText scan the text with ScanSpoofing and fail
+// with a *SpoofError if any lookalike host is found.
+func WithSpoofCheck() func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.spoofCheck = true
+	}
+}
+
+// spoofKind returns how a lowercase host label imitates Latin text, or "" if
+// it does not.
+func spoofKind(label string) SpoofKind {
+	var latin, cyrillic, greek, other bool
+	for _, r := range label {
+		switch {
+		case r < unicode.MaxASCII:
+			latin = latin || unicode.IsLetter(r)
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic = true
+		case unicode.Is(unicode.Greek, r):
+			greek = true
+		case unicode.IsLetter(r):
+			other = true
+		}
+	}
+
+	switch {
+	case cyrillic && greek || latin && (cyrillic || greek):
+		return SpoofMixedScript
+	case (cyrillic || greek) && !other && isASCIIString(skeleton(label)):
+		return SpoofWholeScript
+	default:
+		return ""
+	}
+}
+
+// skeleton replaces the confusable letters of a lowercase label with the
+// Latin letters they imitate.
+func skeleton(label string) string {
+	return strings.Map(func(r rune) rune {
+		if l, ok := confusables[r]; ok {
+			return l
+		}
+		return r
+	}, label)
+}
+
+func isASCIIString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] > unicode.MaxASCII {
+			return false
+		}
+	}
+
+	return true
+}
+
+// punycodeDecode decodes the part of an internationalized domain label after
+// the "xn--" prefix (RFC 3492), reporting false if it is not valid punycode.
+func punycodeDecode(s string) (string, bool) {
+	const (
+		base        = 36
+		tMin        = 1
+		tMax        = 26
+		skew        = 38
+		damp        = 700
+		initialBias = 72
+		initialN    = 128
+		limit       = 1 << 30 // Guards against overflow on hostile input.
+	)
+
+	var output []rune
+	if i := strings.LastIndexByte(s, '-'); i >= 0 {
+		for _, r := range s[:i] {
+			if r > unicode.MaxASCII {
+				return "", false
+			}
+			output = append(output, r)
+		}
+		s = s[i+1:]
+	}
+
+	adapt := func(delta, numPoints int, first bool) int {
+		if first {
+			delta /= damp
+		} else {
+			delta /= 2
+		}
+		delta += delta / numPoints
+		k := 0
+		for delta > (base-tMin)*tMax/2 {
+			delta /= base - tMin
+			k += base
+		}
+		return k + (base-tMin+1)*delta/(delta+skew)
+	}
+
+	n, bias, i := initialN, initialBias, 0
+	for s != "" {
+		oldI, w := i, 1
+		for k := base; ; k += base {
+			if s == "" {
+				return "", false
+			}
+			c := s[0]
+			s = s[1:]
+			var digit int
+			switch {
+			case 'a' <= c && c <= 'z':
+				digit = int(c - 'a')
+			case 'A' <= c && c <= 'Z':
+				digit = int(c - 'A')
+			case '0' <= c && c <= '9':
+				digit = int(c-'0') + 26
+			default:
+				return "", false
+			}
+			i += digit * w
+			t := min(max(k-bias, tMin), tMax)
+			if digit < t {
+				break
+			}
+			w *= base - t
+			if i > limit || w > limit {
+				return "", false
+			}
+		}
+		bias = adapt(i-oldI, len(output)+1, oldI == 0)
+		n += i / (len(output) + 1)
+		i %= len(output) + 1
+		if n > unicode.MaxRune || i > limit {
+			return "", false
+		}
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+
+	return string(output), true
+}
@@ -0,0 +1,92 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// SpriteEntry is one QR code in an SVG sprite sheet.
+type SpriteEntry struct {
+	ID     string // The symbol's id attribute; must be a valid, unique XML name.
+	QRCode *QRCode
+}
+
+// spriteID matches the ids accepted by WriteSVGSprite: XML names restricted
+// to ASCII, which are also valid URL fragments.
+var spriteID = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// WriteSVGSprite writes a hidden SVG document holding one <symbol> per entry,
+// so a page that shows many codes can load them in a single request and
+// place each with SpriteUse. Dark modules are filled with currentColor, so
+// the CSS color of the referencing element sets their color; light modules
+// and the border are white.
+func WriteSVGSprite(w io.Writer, entries []SpriteEntry, border int) error {
+	if border < 0 {
+		return fmt.Errorf("border must be non-negative")
+	}
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if !spriteID.MatchString(e.ID) {
+			return fmt.Errorf("invalid sprite id %q", e.ID)
+		}
+		if seen[e.ID] {
+			return fmt.Errorf("duplicate sprite id %q", e.ID)
+		}
+		seen[e.ID] = true
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<svg xmlns=\"http://www.w3.org/2000/svg\" style=\"display:none\">\n")
+	for _, e := range entries {
+		size := e.QRCode.Size + border*2
+		fmt.Fprintf(&sb, "\t<symbol id=\"%s\" viewBox=\"0 0 %[2]d %[2]d\">\n", e.ID, size)
+		fmt.Fprintf(&sb, "\t\t<rect width=\"%[1]d\" height=\"%[1]d\" fill=\"#FFFFFF\"/>\n", size)
+		sb.WriteString("\t\t<path d=\"")
+		e.QRCode.writeSVGPath(&sb, border)
+		sb.WriteString("\" fill=\"currentColor\"/>\n")
+		sb.WriteString("\t</symbol>\n")
+
+		// Flush each symbol so large sheets are not held in memory.
+		if _, err := io.WriteString(w, sb.String()); err != nil {
+			return err
+		}
+		sb.Reset()
+	}
+	sb.WriteString("</svg>\n")
+	_, err := io.WriteString(w, sb.String())
+
+	return err
+}
+
+// SpriteUse returns the markup displaying the sprite symbol with the given id
+// at the given size, for example SpriteUse("order-42", "8em").
+func SpriteUse(id, size string) string {
+	return fmt.Sprintf("<svg width=\"%[2]s\" height=\"%[2]s\"><use href=\"#%[1]s\"/></svg>", html.EscapeString(id), html.EscapeString(size))
+}
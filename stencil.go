@@ -0,0 +1,300 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+// StencilOptions configures Stencil.
+type StencilOptions struct {
+	Border      int     // Quiet zone in modules (the frame of the stencil sheet).
+	BridgeWidth float64 // Width of each bridge as a fraction of a module (0 is treated as 0.2; at most 0.4).
+}
+
+// Bridge is a strip of stencil material joining the centers of two adjacent
+// modules, drawn across a cut-out (dark) module.
+type Bridge struct {
+	From, To image.Point // Module coordinates (without the border) of the two ends.
+}
+
+// Stencil is a QR code prepared for cutting as a physical stencil, where dark
+// modules are cut out of the sheet. Light regions that would be completely
+// surrounded by cut-outs (such as the ring inside each finder pattern) are
+// held in place by thin bridges.
+type Stencil struct {
+	*QRCode
+	Border      int
+	BridgeWidth float64
+	Bridges     []Bridge
+	Islands     int // The number of light regions that needed a bridge.
+}
+
+// Stencil detects the light regions of the symbol that are not connected to
+// the quiet zone, adds the shortest bridge that connects each one to material
+// that is held, and verifies that the bridged symbol still decodes to the same
+// data.
+func (q *QRCode) Stencil(opts StencilOptions) (*Stencil, error) {
+	if opts.Border < 0 {
+		return nil, fmt.Errorf("border must be non-negative")
+	}
+	width := opts.BridgeWidth
+	if width == 0 {
+		width = 0.2
+	}
+	if width < 0 || width > 0.4 {
+		return nil, fmt.Errorf("bridge width must be in (0, 0.4]")
+	}
+
+	s := &Stencil{QRCode: q, Border: opts.Border, BridgeWidth: width}
+
+	// Label the 4-connected light regions. Diagonal contact does not hold
+	// material together, so it does not join regions.
+	label := make([][]int, q.Size)
+	for y := range label {
+		label[y] = make([]int, q.Size)
+	}
+	var regions [][]image.Point
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.Modules[y][x] != 0 || label[y][x] != 0 {
+				continue
+			}
+			regions = append(regions, q.floodLight(x, y, len(regions)+1, label))
+		}
+	}
+
+	// A region is held if it touches the edge of the symbol (and so the quiet
+	// zone); other regions are held once a bridge joins them to a held one.
+	held := make([]bool, len(regions)+1)
+	for i, cells := range regions {
+		for _, c := range cells {
+			if c.X == 0 || c.Y == 0 || c.X == q.Size-1 || c.Y == q.Size-1 {
+				held[i+1] = true
+				break
+			}
+		}
+	}
+	for {
+		progress, pending := false, false
+		for i, cells := range regions {
+			if held[i+1] {
+				continue
+			}
+			path := q.bridgePath(cells, label, held)
+			if path == nil {
+				pending = true
+				continue
+			}
+			for k := 1; k < len(path); k++ {
+				s.Bridges = append(s.Bridges, Bridge{From: path[k-1], To: path[k]})
+			}
+			held[i+1] = true
+			s.Islands++
+			progress = true
+		}
+		if !pending {
+			break
+		}
+		if !progress {
+			return nil, fmt.Errorf("cannot bridge all light regions")
+		}
+	}
+
+	if err := s.verify(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// floodLight labels the light region containing (x, y) and returns its cells.
+func (q *QRCode) floodLight(x, y, id int, label [][]int) []image.Point {
+	var cells []image.Point
+	stack := []image.Point{{x, y}}
+	label[y][x] = id
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		cells = append(cells, c)
+		for _, d := range [4]image.Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			n := c.Add(d)
+			if n.X >= 0 && n.Y >= 0 && n.X < q.Size && n.Y < q.Size &&
+				q.Modules[n.Y][n.X] == 0 && label[n.Y][n.X] == 0 {
+				label[n.Y][n.X] = id
+				stack = append(stack, n)
+			}
+		}
+	}
+
+	return cells
+}
+
+// bridgePath returns the shortest straight-step path from a cell of the
+// region, across dark modules only, to a light module of a held region, or
+// nil if there is none.
+func (q *QRCode) bridgePath(cells []image.Point, label [][]int, held []bool) []image.Point {
+	prev := make(map[image.Point]image.Point)
+	queue := make([]image.Point, 0, len(cells))
+	for _, c := range cells {
+		prev[c] = c
+		queue = append(queue, c)
+	}
+
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		for _, d := range [4]image.Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			n := c.Add(d)
+			if n.X < 0 || n.Y < 0 || n.X >= q.Size || n.Y >= q.Size {
+				continue
+			}
+			if _, seen := prev[n]; seen {
+				continue
+			}
+			if q.Modules[n.Y][n.X] == 0 {
+				if !held[label[n.Y][n.X]] {
+					continue
+				}
+				path := []image.Point{n}
+				for p := c; ; p = prev[p] {
+					path = append(path, p)
+					if prev[p] == p {
+						break
+					}
+				}
+				return path
+			}
+			prev[n] = c
+			queue = append(queue, n)
+		}
+	}
+
+	return nil
+}
+
+// verify renders the stencil, samples each module by the fraction of its area
+// that is cut out, and checks that the result decodes to the original data.
+func (s *Stencil) verify() error {
+	const scale = 10
+
+	want, err := Decode(s.QRCode)
+	if err != nil {
+		return err
+	}
+	img, err := s.ToImage(scale)
+	if err != nil {
+		return err
+	}
+
+	sampled := &QRCode{Size: s.Size, Modules: make([][]Module, s.Size)}
+	for y := 0; y < s.Size; y++ {
+		sampled.Modules[y] = make([]Module, s.Size)
+		for x := 0; x < s.Size; x++ {
+			dark := 0
+			for py := 0; py < scale; py++ {
+				offset := ((y+s.Border)*scale+py)*img.Stride + (x+s.Border)*scale
+				dark += bytes.Count(img.Pix[offset:offset+scale], []byte{1})
+			}
+			sampled.Modules[y][x] = bToModule(dark*2 > scale*scale)
+		}
+	}
+
+	got, err := Decode(sampled)
+	if err != nil {
+		return fmt.Errorf("bridged stencil does not decode: %w", err)
+	}
+	if !bytes.Equal(got.Data, want.Data) {
+		return fmt.Errorf("bridged stencil decodes to different data")
+	}
+
+	return nil
+}
+
+// bridgeRect returns the rectangle covered by a bridge in bordered module
+// units.
+func (s *Stencil) bridgeRect(b Bridge) (x0, y0, x1, y1 float64) {
+	half := s.BridgeWidth / 2
+	ax, ay := float64(b.From.X+s.Border)+0.5, float64(b.From.Y+s.Border)+0.5
+	bx, by := float64(b.To.X+s.Border)+0.5, float64(b.To.Y+s.Border)+0.5
+	x0, x1 = math.Min(ax, bx), math.Max(ax, bx)
+	y0, y1 = math.Min(ay, by), math.Max(ay, by)
+	if ay == by { // Horizontal.
+		return x0, y0 - half, x1, y1 + half
+	}
+
+	return x0 - half, y0, x1 + half, y1
+}
+
+// ToSVGString returns an SVG of the stencil: the cut-outs are filled black and
+// the bridges are drawn over them in white.
+func (s *Stencil) ToSVGString(includeDocType bool) (string, error) {
+	svg, err := s.QRCode.ToSVGString(s.Border, includeDocType)
+	if err != nil {
+		return "", err
+	}
+	if len(s.Bridges) == 0 {
+		return svg, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\t<path d=\"")
+	for i, b := range s.Bridges {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		x0, y0, x1, y1 := s.bridgeRect(b)
+		fmt.Fprintf(&sb, "M%s,%sH%sV%sH%sz", formatFloat(x0, 3), formatFloat(y0, 3),
+			formatFloat(x1, 3), formatFloat(y1, 3), formatFloat(x0, 3))
+	}
+	sb.WriteString("\" fill=\"#FFFFFF\"/>\n</svg>\n")
+
+	return strings.TrimSuffix(svg, "</svg>\n") + sb.String(), nil
+}
+
+// ToImage returns a raster image of the stencil with scale pixels per module.
+func (s *Stencil) ToImage(scale int) (*image.Paletted, error) {
+	img, err := s.QRCode.ToImage(scale, s.Border)
+	if err != nil {
+		return nil, err
+	}
+
+	f := float64(scale)
+	for _, b := range s.Bridges {
+		x0, y0, x1, y1 := s.bridgeRect(b)
+		r := image.Rect(int(math.Round(x0*f)), int(math.Round(y0*f)), int(math.Round(x1*f)), int(math.Round(y1*f)))
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.Pix[y*img.Stride+x] = 0
+			}
+		}
+	}
+
+	return img, nil
+}
@@ -0,0 +1,131 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import "fmt"
+
+// WithRowCallback calls fn with each row of the final, masked symbol, from top
+// to bottom, so that devices with little memory can push rows straight to a
+// display or printer. The row is only valid during the call, and must not be
+// modified or retained. If fn returns an error, the encode fails with it.
+//
+// With a mask given by WithMask, the rows are produced one at a time from the
+// codewords and the cached function patterns, and the full matrix is never
+// built, so a successful encode returns a nil QRCode; the number of rows is
+// the size, and WithAudit records the version, level and mask. With automatic
+// masking, every mask must be scored on the whole matrix, so the symbol is
+// built as usual, its rows are passed to fn afterwards, and it is returned.
+func WithRowCallback(fn func(y int, row []Module) error) func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.rowCallback = fn
+	}
+}
+
+// encodeStreaming finishes an encode with a fixed mask by passing the rows of
+// the symbol to the row callback without building the matrix. It returns no
+// QRCode, since a symbol without modules cannot be rendered.
+func (s *segmentEncoder) encodeStreaming(version Version, ecl ECL, dataCodeWords []byte, data bitBuffer) (*QRCode, error) {
+	t := layout(version)
+	qrCode := &QRCode{
+		Version:              version,
+		Size:                 t.Size,
+		ErrorCorrectionLevel: ecl,
+		Mask:                 s.mask,
+	}
+	endECC := s.trace(StageECC)
+	allCodeWords := qrCode.addECCAndInterleave(dataCodeWords, s.eccParallelism)
+	endECC()
+
+	var h *moduleHasher
+	if s.audit != nil {
+		h = newModuleHasher(version, ecl, s.mask)
+	}
+
+	endMask := s.trace(StageMask)
+	err := streamRows(qrCode, allCodeWords, func(y int, row []Module) error {
+		if h != nil {
+			h.writeRow(row)
+		}
+		if err := s.rowCallback(y, row); err != nil {
+			return fmt.Errorf("row %d: %w", y, err)
+		}
+		return nil
+	})
+	endMask()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auditEncode(qrCode, func() [32]byte { return h.sum() }, data); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// streamRows builds each row of the symbol described by q (which has no
+// modules) holding the given codewords, and passes it to fn. A single row
+// buffer is reused: the function patterns are copied from the cached template,
+// the format bits of q's error correction level and mask are placed, and the
+// data modules are looked up in the codewords through codewordIndex and
+// masked.
+func streamRows(q *QRCode, codewords []byte, fn func(y int, row []Module) error) error {
+	if len(codewords) != numRawDataModules[q.Version]/8 {
+		panic("incorrect data length")
+	}
+
+	t := layout(q.Version)
+	index := codewordIndex(q.Version)
+	bits := formatBits(q.ErrorCorrectionLevel, q.Mask)
+	format := formatBitPositions(q.Size)
+	dataBits := len(codewords) * 8
+
+	row := make([]Module, q.Size)
+	for y := 0; y < q.Size; y++ {
+		copy(row, t.Modules[y])
+		for i, pair := range format {
+			for _, p := range pair {
+				if int(p.y) == y {
+					row[p.x] = Module(getBit(bits, i))
+				}
+			}
+		}
+		for x := 0; x < q.Size; x++ {
+			if t.isFunction[y][x] {
+				continue
+			}
+			var m Module
+			if i := int(index[y*q.Size+x]); i < dataBits { // Remainder bits are white.
+				m = Module(getBit(int(codewords[i>>3]), 7-(i&7)))
+			}
+			row[x] = m ^ Module(bToI(maskBit(q.Mask, x, y)))
+		}
+		if err := fn(y, row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
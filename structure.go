@@ -0,0 +1,127 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import "fmt"
+
+// CheckStructure verifies the internal consistency of a QR code: the size
+// matches the version, the matrix is square and holds only 0 and 1, the error
+// correction level and mask are in range, and every function module (finder,
+// separator, timing, and alignment patterns, both copies of the format bits,
+// the version blocks, and the dark module) is exactly as the specification
+// requires. It does not check the data, so it is cheap enough to call in
+// tests of code that post-processes matrices (styling, overlays, and so on)
+// to catch corruption early. Micro QR symbols (Micro set) are checked against
+// the Micro QR layout: the single finder pattern, its separator, the timing
+// patterns along the top and left edges, and the format bits.
+func CheckStructure(q *QRCode) error {
+	if q.Micro {
+		return checkMicroStructure(q)
+	}
+
+	if q.Version < MinVersion || MaxVersion < q.Version {
+		return fmt.Errorf("version %d out of range", q.Version)
+	}
+	if want := int(q.Version)*4 + 17; q.Size != want {
+		return fmt.Errorf("size %d does not match version %d (want %d)", q.Size, q.Version, want)
+	}
+	if q.ErrorCorrectionLevel < Low || High < q.ErrorCorrectionLevel {
+		return fmt.Errorf("error correction level %d out of range", q.ErrorCorrectionLevel)
+	}
+	if q.Mask < 0 || 7 < q.Mask {
+		return fmt.Errorf("mask %d out of range", q.Mask)
+	}
+	if err := checkMatrix(q); err != nil {
+		return err
+	}
+
+	want := newQRCodeFromTemplate(q.Version, q.ErrorCorrectionLevel)
+	want.drawFormatBits(q.Mask)
+	return compareFunctionModules(q, want)
+}
+
+// checkMicroStructure implements CheckStructure for Micro QR symbols.
+func checkMicroStructure(q *QRCode) error {
+	if q.Version < 1 || MaxMicroVersion < q.Version {
+		return fmt.Errorf("micro QR version %d out of range", q.Version)
+	}
+	if want := int(q.Version)*2 + 9; q.Size != want {
+		return fmt.Errorf("size %d does not match micro QR version %d (want %d)", q.Size, q.Version, want)
+	}
+	if q.ErrorCorrectionLevel < Low || Quartile < q.ErrorCorrectionLevel || microDataBits[q.Version][q.ErrorCorrectionLevel] == 0 {
+		return fmt.Errorf("error correction level %d not available in micro QR version %d", q.ErrorCorrectionLevel, q.Version)
+	}
+	if q.Mask < 0 || 3 < q.Mask {
+		return fmt.Errorf("micro QR mask %d out of range", q.Mask)
+	}
+	if err := checkMatrix(q); err != nil {
+		return err
+	}
+
+	want := newMicroQRCode(q.Version, q.ErrorCorrectionLevel)
+	want.drawMicroFormatBits(q.Mask)
+	return compareFunctionModules(q, want)
+}
+
+// checkMatrix verifies that the matrix is square, of the symbol's size, and
+// holds only 0 and 1.
+func checkMatrix(q *QRCode) error {
+	if len(q.Modules) != q.Size {
+		return fmt.Errorf("matrix has %d rows, want %d", len(q.Modules), q.Size)
+	}
+	for y, row := range q.Modules {
+		if len(row) != q.Size {
+			return fmt.Errorf("row %d has %d modules, want %d", y, len(row), q.Size)
+		}
+		for x, m := range row {
+			if m > 1 {
+				return fmt.Errorf("module (%d, %d) has invalid value %d", x, y, m)
+			}
+		}
+	}
+
+	return nil
+}
+
+// compareFunctionModules reports the function modules of q that differ from
+// those of want, a template of the same version and level.
+func compareFunctionModules(q, want *QRCode) error {
+	bad, firstX, firstY := 0, -1, -1
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if want.isFunction[y][x] && q.Modules[y][x] != want.Modules[y][x] {
+				if bad == 0 {
+					firstX, firstY = x, y
+				}
+				bad++
+			}
+		}
+	}
+	if bad > 0 {
+		return fmt.Errorf("%d function modules differ from the specification, first at (%d, %d)", bad, firstX, firstY)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+)
+
+// TerminalOptions controls Terminal.
+type TerminalOptions struct {
+	Border int         // Quiet zone in modules (default 4; negative for none).
+	Dark   color.Color // Color of dark modules (default the standard black background).
+	Light  color.Color // Color of light modules and the quiet zone (default the standard bright white background).
+
+	// Compact draws two rows of modules per line of text with upper half
+	// blocks, halving the height, for small terminals. It needs a font in
+	// which the block fills the whole cell.
+	Compact bool
+}
+
+// Terminal writes the QR code to w for display in a terminal, painting each
+// module as two spaces with an ANSI background color, so that it appears
+// roughly square and scans from the screen whatever the terminal's own
+// colors. Colors given in the options are written as 24-bit color, which
+// most terminals support; the defaults use the basic 16-color codes.
+func (q *QRCode) Terminal(w io.Writer, opts TerminalOptions) error {
+	if opts.Border == 0 {
+		opts.Border = 4
+	} else if opts.Border < 0 {
+		opts.Border = 0
+	}
+	dark, light := "40", "107"
+	if opts.Dark != nil {
+		dark = ansiColor(opts.Dark)
+	}
+	if opts.Light != nil {
+		light = ansiColor(opts.Light)
+	}
+	backgrounds := [2]string{light, dark}
+
+	grid := q.borderedGrid(opts.Border)
+	bw := bufio.NewWriter(w)
+	if !opts.Compact {
+		for y := 0; y < grid.size; y++ {
+			last := -1
+			for _, c := range grid.cells[y*grid.size : (y+1)*grid.size] {
+				if int(c) != last {
+					fmt.Fprintf(bw, "\x1b[%sm", backgrounds[c])
+					last = int(c)
+				}
+				bw.WriteString("  ")
+			}
+			bw.WriteString("\x1b[0m\n")
+		}
+		return bw.Flush()
+	}
+
+	// The foreground color paints the upper half of each cell and the
+	// background the lower half; below the last row the terminal's own
+	// background shows.
+	for y := 0; y < grid.size; y += 2 {
+		for x := 0; x < grid.size; x++ {
+			bottom := "49"
+			if y+1 < grid.size {
+				bottom = backgrounds[grid.cells[(y+1)*grid.size+x]]
+			}
+			fmt.Fprintf(bw, "\x1b[%s;%sm▀", foreground(backgrounds[grid.cells[y*grid.size+x]]), bottom)
+		}
+		bw.WriteString("\x1b[0m\n")
+	}
+
+	return bw.Flush()
+}
+
+// ansiColor returns the SGR parameters setting c as the 24-bit background
+// color.
+func ansiColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("48;2;%d;%d;%d", n.R, n.G, n.B)
+}
+
+// foreground turns SGR parameters that set a background color into those
+// setting the same foreground color.
+func foreground(background string) string {
+	switch {
+	case background[0] == '4':
+		return "3" + background[1:]
+	case background[:2] == "10":
+		return "9" + background[2:]
+	}
+
+	return background
+}
@@ -0,0 +1,676 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ModuleShape is the shape drawn for each dark data module of a Theme.
+type ModuleShape string
+
+// Module shapes.
+const (
+	ShapeSquare  ModuleShape = "square"
+	ShapeDot     ModuleShape = "dot"
+	ShapeRounded ModuleShape = "rounded"
+)
+
+// EyeShape is the shape drawn for the three finder patterns ("eyes") of a
+// Theme.
+type EyeShape string
+
+// Eye shapes.
+const (
+	EyeSquare  EyeShape = "square"
+	EyeRounded EyeShape = "rounded"
+	EyeCircle  EyeShape = "circle"
+)
+
+// ThemeStrictness selects what a Theme does when a rendering would fail its
+// scannability checks.
+type ThemeStrictness string
+
+// Theme strictness levels.
+const (
+	StrictnessRefuse ThemeStrictness = "refuse" // Fail with a ScannabilityError (the default).
+	StrictnessWarn   ThemeStrictness = "warn"   // Render anyway, passing the ScannabilityError to Theme.Warn.
+	StrictnessOff    ThemeStrictness = "off"    // Skip the checks.
+)
+
+// Scannability thresholds applied by Theme.CheckScannability.
+const (
+	MinThemeContrast = 3.0 // Minimum WCAG contrast ratio between the light color and the dark and eye colors.
+	MinThemeBorder   = 2   // Minimum quiet zone in modules; 4 is standard but most scanners cope with 2.
+)
+
+// ThemeFrame is a solid band drawn around the quiet zone.
+type ThemeFrame struct {
+	Color string `json:"color" yaml:"color"` // Color of the frame as #RGB or #RRGGBB.
+	Width int    `json:"width" yaml:"width"` // Width of the frame in modules.
+}
+
+// Theme is a serializable description of the styling of a symbol, so that
+// branding can be kept in a JSON or YAML file and changed without code
+// changes. Colors are written as #RGB or #RRGGBB.
+type Theme struct {
+	Name     string      `json:"name" yaml:"name"`
+	Dark     string      `json:"dark" yaml:"dark"`                             // Color of dark modules.
+	Light    string      `json:"light" yaml:"light"`                           // Color of light modules and the quiet zone.
+	EyeColor string      `json:"eyeColor,omitempty" yaml:"eyeColor,omitempty"` // Color of the finder patterns (default Dark).
+	Shape    ModuleShape `json:"shape" yaml:"shape"`                           // Shape of dark data modules.
+	Eye      EyeShape    `json:"eye" yaml:"eye"`                               // Shape of the finder patterns.
+	Border   int         `json:"border" yaml:"border"`                         // Quiet zone in modules.
+	Frame    *ThemeFrame `json:"frame,omitempty" yaml:"frame,omitempty"`       // Optional frame around the quiet zone.
+	Logo     string      `json:"logo,omitempty" yaml:"logo,omitempty"`         // URL of a logo placed in the center of SVG output.
+	LogoSize float64     `json:"logoSize,omitempty" yaml:"logoSize,omitempty"` // Width of the logo as a fraction of the symbol width (default 0.2).
+
+	// Strictness selects what rendering does when the theme fails the
+	// scannability checks for a symbol (default StrictnessRefuse).
+	Strictness ThemeStrictness `json:"strictness,omitempty" yaml:"strictness,omitempty"`
+	// Warn, if not nil, receives the ScannabilityError of renderings allowed
+	// by StrictnessWarn.
+	Warn func(error) `json:"-" yaml:"-"`
+
+	// LogoImage, if not nil, is drawn in the center of raster output. The
+	// caller resolves the Logo reference, since this package does no I/O
+	// on its behalf.
+	LogoImage image.Image `json:"-" yaml:"-"`
+}
+
+// Built-in themes.
+var (
+	ThemeClassic = Theme{Name: "classic", Dark: "#000000", Light: "#FFFFFF", Shape: ShapeSquare, Eye: EyeSquare, Border: 4}
+	ThemeRounded = Theme{Name: "rounded", Dark: "#1B2A49", Light: "#FFFFFF", Shape: ShapeRounded, Eye: EyeRounded, Border: 4}
+	ThemeDots    = Theme{Name: "dots", Dark: "#000000", Light: "#FFFFFF", Shape: ShapeDot, Eye: EyeCircle, Border: 4}
+	ThemeFramed  = Theme{
+		Name: "framed", Dark: "#1E4D2B", Light: "#F4F1E8", Shape: ShapeSquare, Eye: EyeRounded, Border: 3,
+		Frame: &ThemeFrame{Color: "#1E4D2B", Width: 2},
+	}
+)
+
+var themes = map[string]Theme{
+	ThemeClassic.Name: ThemeClassic,
+	ThemeRounded.Name: ThemeRounded,
+	ThemeDots.Name:    ThemeDots,
+	ThemeFramed.Name:  ThemeFramed,
+}
+
+// LookupTheme returns the named built-in theme.
+func LookupTheme(name string) (Theme, error) {
+	t, ok := themes[name]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme %q", name)
+	}
+
+	return t, nil
+}
+
+// ThemeNames returns the names of the built-in themes in sorted order.
+func ThemeNames() []string {
+	result := make([]string, 0, len(themes))
+	for name := range themes {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// ParseTheme reads a theme from JSON (if data starts with '{') or YAML.
+// Fields that are not given keep the values of ThemeClassic; unknown fields
+// are errors in either format, so that misspelled settings are not ignored.
+func ParseTheme(data []byte) (Theme, error) {
+	t := ThemeClassic
+	t.Name = ""
+	var err error
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		dec.DisallowUnknownFields()
+		if err = dec.Decode(&t); err == nil {
+			if _, after := dec.Token(); after != io.EOF {
+				err = fmt.Errorf("unexpected data after the theme")
+			}
+		}
+	} else {
+		err = yaml.UnmarshalStrict(data, &t)
+	}
+	if err != nil {
+		return Theme{}, fmt.Errorf("theme: %w", err)
+	}
+	if err := t.Validate(); err != nil {
+		return Theme{}, err
+	}
+
+	return t, nil
+}
+
+// LoadTheme reads a theme file with ParseTheme.
+func LoadTheme(path string) (Theme, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Theme{}, err
+	}
+
+	return ParseTheme(data)
+}
+
+// Validate reports whether the theme is well formed.
+func (t Theme) Validate() error {
+	colors := []string{t.Dark, t.Light}
+	if t.EyeColor != "" {
+		colors = append(colors, t.EyeColor)
+	}
+	for _, c := range colors {
+		if _, err := parseHexColor(c); err != nil {
+			return err
+		}
+	}
+	switch t.Shape {
+	case ShapeSquare, ShapeDot, ShapeRounded:
+	default:
+		return fmt.Errorf("theme: unknown module shape %q", t.Shape)
+	}
+	switch t.Eye {
+	case EyeSquare, EyeRounded, EyeCircle:
+	default:
+		return fmt.Errorf("theme: unknown eye shape %q", t.Eye)
+	}
+	if t.Border < 0 {
+		return fmt.Errorf("theme: border must be non-negative")
+	}
+	if t.Frame != nil {
+		if _, err := parseHexColor(t.Frame.Color); err != nil {
+			return err
+		}
+		if t.Frame.Width < 0 {
+			return fmt.Errorf("theme: frame width must be non-negative")
+		}
+	}
+	if t.LogoSize < 0 || t.LogoSize > 0.5 {
+		return fmt.Errorf("theme: logo size must be in [0, 0.5]")
+	}
+	switch t.Strictness {
+	case "", StrictnessRefuse, StrictnessWarn, StrictnessOff:
+	default:
+		return fmt.Errorf("theme: unknown strictness %q", t.Strictness)
+	}
+
+	return nil
+}
+
+// ThemeFile is a theme file that is read again whenever it changes, so that a
+// long-running service picks up new branding without a restart.
+type ThemeFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	theme   Theme
+	loaded  bool
+}
+
+// NewThemeFile returns a ThemeFile for the file at path. The file is not read
+// until Theme is called.
+func NewThemeFile(path string) *ThemeFile {
+	return &ThemeFile{path: path}
+}
+
+// Theme returns the current theme, reading the file again if its size or
+// modification time has changed. If the file cannot be read or parsed after a
+// successful load, the previous theme is returned together with the error.
+func (f *ThemeFile) Theme() (Theme, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return f.theme, err
+	}
+	if f.loaded && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.theme, nil
+	}
+	t, err := LoadTheme(f.path)
+	if err != nil {
+		return f.theme, err
+	}
+	f.theme, f.modTime, f.size, f.loaded = t, info.ModTime(), info.Size(), true
+
+	return t, nil
+}
+
+// parseHexColor parses #RGB or #RRGGBB.
+func parseHexColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 || !strings.HasPrefix(s, "#") {
+		return color.NRGBA{}, fmt.Errorf("theme: invalid color %q", s)
+	}
+
+	return color.NRGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xFF}, nil
+}
+
+// themeColors holds the parsed colors of a theme.
+type themeColors struct {
+	dark, light, eye, frame color.NRGBA
+}
+
+func (t Theme) colors() (themeColors, error) {
+	if err := t.Validate(); err != nil {
+		return themeColors{}, err
+	}
+	var c themeColors
+	c.dark, _ = parseHexColor(t.Dark)
+	c.light, _ = parseHexColor(t.Light)
+	c.eye = c.dark
+	if t.EyeColor != "" {
+		c.eye, _ = parseHexColor(t.EyeColor)
+	}
+	if t.Frame != nil {
+		c.frame, _ = parseHexColor(t.Frame.Color)
+	}
+
+	return c, nil
+}
+
+// margin returns the distance in modules from the edge of the output to the
+// symbol.
+func (t Theme) margin() int {
+	m := t.Border
+	if t.Frame != nil {
+		m += t.Frame.Width
+	}
+
+	return m
+}
+
+// logoSide returns the side of the logo area in modules, or 0 for no logo.
+// The logo reference is used by SVG output and the logo image by raster
+// output.
+func (t Theme) logoSide(q *QRCode, raster bool) float64 {
+	if (raster && t.LogoImage == nil) || (!raster && t.Logo == "") {
+		return 0
+	}
+	size := t.LogoSize
+	if size == 0 {
+		size = 0.2
+	}
+
+	return math.Round(size * float64(q.Size))
+}
+
+// eyeOrigins returns the top left corners of the finder patterns.
+func eyeOrigins(q *QRCode) []image.Point {
+	if q.Micro {
+		return []image.Point{{0, 0}}
+	}
+
+	return []image.Point{{0, 0}, {q.Size - 7, 0}, {0, q.Size - 7}}
+}
+
+// inEye reports whether module (x, y) is part of a finder pattern.
+func inEye(q *QRCode, x, y int) bool {
+	if q.Micro {
+		return x < 7 && y < 7
+	}
+
+	return (x < 7 && y < 7) || (x >= q.Size-7 && y < 7) || (x < 7 && y >= q.Size-7)
+}
+
+// ToSVGString renders q with the theme as a standalone SVG document.
+func (t Theme) ToSVGString(q *QRCode, includeDocType bool) (string, error) {
+	c, err := t.colors()
+	if err != nil {
+		return "", err
+	}
+	if err := t.enforceScannability(q, c, t.logoSide(q, false)); err != nil {
+		return "", err
+	}
+
+	m := t.margin()
+	var sb strings.Builder
+	if includeDocType {
+		sb.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+		sb.WriteString("<!DOCTYPE svg PUBLIC \"-//W3C//DTD SVG 1.1//EN\" \"http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd\">\n")
+	}
+	fmt.Fprintf(&sb, "<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\" version=\"1.1\" viewBox=\"0 0 %[1]d %[1]d\" stroke=\"none\">\n", q.Size+2*m)
+	if t.Frame != nil && t.Frame.Width > 0 {
+		fmt.Fprintf(&sb, "\t<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", hexColor(c.frame))
+		fmt.Fprintf(&sb, "\t<rect x=\"%[1]d\" y=\"%[1]d\" width=\"%[2]d\" height=\"%[2]d\" fill=\"%[3]s\"/>\n", t.Frame.Width, q.Size+2*t.Border, hexColor(c.light))
+	} else {
+		fmt.Fprintf(&sb, "\t<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", hexColor(c.light))
+	}
+
+	sb.WriteString("\t<path d=\"")
+	dataModule := func(x, y int) bool {
+		return q.Modules[y][x] == 1 && !inEye(q, x, y)
+	}
+	if t.Shape == ShapeDot || t.Shape == ShapeRounded {
+		for y := 0; y < q.Size; y++ {
+			for x := 0; x < q.Size; x++ {
+				if !dataModule(x, y) {
+					continue
+				}
+				fx, fy := float64(x+m), float64(y+m)
+				if t.Shape == ShapeDot {
+					writeCirclePath(&sb, fx+0.5, fy+0.5, 0.45)
+				} else {
+					writeRoundedRectPath(&sb, fx, fy, 1, 1, 0.3)
+				}
+			}
+		}
+	} else {
+		writeRectPath(&sb, q.Size, m, dataModule)
+	}
+	fmt.Fprintf(&sb, "\" fill=\"%s\"/>\n", hexColor(c.dark))
+
+	sb.WriteString("\t<path d=\"")
+	for _, o := range eyeOrigins(q) {
+		ex, ey := float64(o.X+m), float64(o.Y+m)
+		switch t.Eye {
+		case EyeCircle:
+			writeCirclePath(&sb, ex+3.5, ey+3.5, 3.5)
+			writeCirclePath(&sb, ex+3.5, ey+3.5, 2.5)
+			writeCirclePath(&sb, ex+3.5, ey+3.5, 1.5)
+		case EyeRounded:
+			writeRoundedRectPath(&sb, ex, ey, 7, 7, 1.5)
+			writeRoundedRectPath(&sb, ex+1, ey+1, 5, 5, 1)
+			writeRoundedRectPath(&sb, ex+2, ey+2, 3, 3, 0.75)
+		default:
+			writeRoundedRectPath(&sb, ex, ey, 7, 7, 0)
+			writeRoundedRectPath(&sb, ex+1, ey+1, 5, 5, 0)
+			writeRoundedRectPath(&sb, ex+2, ey+2, 3, 3, 0)
+		}
+	}
+	fmt.Fprintf(&sb, "\" fill=\"%s\" fill-rule=\"evenodd\"/>\n", hexColor(c.eye))
+
+	if side := t.logoSide(q, false); side > 0 {
+		pos := formatFloat(float64(m)+(float64(q.Size)-side)/2, -1)
+		fmt.Fprintf(&sb, "\t<rect x=\"%[1]s\" y=\"%[1]s\" width=\"%[2]s\" height=\"%[2]s\" fill=\"%[3]s\"/>\n", pos, formatFloat(side, -1), hexColor(c.light))
+		fmt.Fprintf(&sb, "\t<image x=\"%[1]s\" y=\"%[1]s\" width=\"%[2]s\" height=\"%[2]s\" xlink:href=\"%[3]s\" preserveAspectRatio=\"xMidYMid meet\"/>\n", pos, formatFloat(side, -1), html.EscapeString(t.Logo))
+	}
+	sb.WriteString("</svg>\n")
+
+	return sb.String(), nil
+}
+
+// ToImage renders q with the theme, each module scale pixels square.
+func (t Theme) ToImage(q *QRCode, scale int) (*image.NRGBA, error) {
+	if scale <= 0 {
+		return nil, fmt.Errorf("scale must be positive")
+	}
+	c, err := t.colors()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.enforceScannability(q, c, t.logoSide(q, true)); err != nil {
+		return nil, err
+	}
+
+	m := t.margin()
+	side := (q.Size + 2*m) * scale
+	img := image.NewNRGBA(image.Rect(0, 0, side, side))
+	frame := 0
+	if t.Frame != nil {
+		frame = t.Frame.Width
+	}
+	for py := 0; py < side; py++ {
+		for px := 0; px < side; px++ {
+			// Sample at the center of the pixel, in module units.
+			u := (float64(px)+0.5)/float64(scale) - float64(m)
+			v := (float64(py)+0.5)/float64(scale) - float64(m)
+			col := c.light
+			switch {
+			case px < frame*scale || py < frame*scale || px >= side-frame*scale || py >= side-frame*scale:
+				col = c.frame
+			case u >= 0 && v >= 0 && u < float64(q.Size) && v < float64(q.Size):
+				col = t.symbolColor(q, c, u, v)
+			}
+			img.SetNRGBA(px, py, col)
+		}
+	}
+
+	if logoSide := t.logoSide(q, true); logoSide > 0 {
+		pixels := int(logoSide) * scale
+		origin := (side - pixels) / 2
+		bounds := t.LogoImage.Bounds()
+		for y := 0; y < pixels; y++ {
+			for x := 0; x < pixels; x++ {
+				img.SetNRGBA(origin+x, origin+y, c.light)
+				sx := bounds.Min.X + x*bounds.Dx()/pixels
+				sy := bounds.Min.Y + y*bounds.Dy()/pixels
+				if _, _, _, a := t.LogoImage.At(sx, sy).RGBA(); a > 0x7FFF {
+					img.Set(origin+x, origin+y, t.LogoImage.At(sx, sy))
+				}
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// CheckScannability reports whether q, rendered with the theme, is likely to
+// scan: the colors must have enough contrast with the dark modules darker than
+// the light ones, the quiet zone must be wide enough, and the symbol, sampled
+// at the module centers of the styled rendering (with the logo area blanked),
+// must still decode to the same data. It returns nil or a
+// *ScannabilityError, regardless of Strictness.
+func (t Theme) CheckScannability(q *QRCode) error {
+	c, err := t.colors()
+	if err != nil {
+		return err
+	}
+
+	return t.scannability(q, c, math.Max(t.logoSide(q, false), t.logoSide(q, true)))
+}
+
+// enforceScannability applies the checks to a rendering according to the
+// theme's strictness.
+func (t Theme) enforceScannability(q *QRCode, c themeColors, logoSide float64) error {
+	if t.Strictness == StrictnessOff {
+		return nil
+	}
+	err := t.scannability(q, c, logoSide)
+	if err != nil && t.Strictness == StrictnessWarn {
+		if t.Warn != nil {
+			t.Warn(err)
+		}
+		return nil
+	}
+
+	return err
+}
+
+func (t Theme) scannability(q *QRCode, c themeColors, logoSide float64) error {
+	var problems []string
+	if relativeLuminance(c.dark) >= relativeLuminance(c.light) {
+		problems = append(problems, "dark color is not darker than the light color")
+	}
+	if r := contrastRatio(c.dark, c.light); r < MinThemeContrast {
+		problems = append(problems, fmt.Sprintf("contrast ratio %.2f between dark and light is below %.1f", r, MinThemeContrast))
+	}
+	if r := contrastRatio(c.eye, c.light); t.EyeColor != "" && r < MinThemeContrast {
+		problems = append(problems, fmt.Sprintf("contrast ratio %.2f between eye and light is below %.1f", r, MinThemeContrast))
+	}
+	if t.Border < MinThemeBorder {
+		problems = append(problems, fmt.Sprintf("quiet zone of %d modules is narrower than %d", t.Border, MinThemeBorder))
+	}
+
+	if len(problems) == 0 && q.Micro {
+		// There is no Micro QR decoder, so every module outside the finder
+		// pattern must read back unchanged.
+		sampled := t.sampleModules(q, c, logoSide)
+		for y := 0; y < q.Size && len(problems) == 0; y++ {
+			for x := 0; x < q.Size; x++ {
+				if !inEye(q, x, y) && sampled.Modules[y][x] != q.Modules[y][x] {
+					problems = append(problems, "styled micro QR symbol does not read back")
+					break
+				}
+			}
+		}
+	} else if len(problems) == 0 {
+		want, err := Decode(q)
+		if err != nil {
+			return err
+		}
+		if got, err := Decode(t.sampleModules(q, c, logoSide)); err != nil {
+			problems = append(problems, fmt.Sprintf("styled symbol does not decode: %v", err))
+		} else if !bytes.Equal(got.Data, want.Data) {
+			problems = append(problems, "styled symbol decodes to different data")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ScannabilityError{Theme: t.Name, Problems: problems}
+	}
+
+	return nil
+}
+
+// sampleModules reads the modules of the styled rendering of q back at their
+// centers, treating the logo area as light.
+func (t Theme) sampleModules(q *QRCode, c themeColors, logoSide float64) *QRCode {
+	threshold := (relativeLuminance(c.dark) + relativeLuminance(c.light)) / 2
+	logoMin := (float64(q.Size) - logoSide) / 2
+	logoMax := logoMin + logoSide
+	sampled := &QRCode{Size: q.Size, Modules: make([][]Module, q.Size)}
+	for y := range sampled.Modules {
+		sampled.Modules[y] = make([]Module, q.Size)
+		for x := range sampled.Modules[y] {
+			u, v := float64(x)+0.5, float64(y)+0.5
+			if logoSide > 0 && u > logoMin && u < logoMax && v > logoMin && v < logoMax {
+				continue
+			}
+			sampled.Modules[y][x] = bToModule(relativeLuminance(t.symbolColor(q, c, u, v)) < threshold)
+		}
+	}
+
+	return sampled
+}
+
+// symbolColor returns the color of the point (u, v) of the symbol, in module
+// units, ignoring any logo.
+func (t Theme) symbolColor(q *QRCode, c themeColors, u, v float64) color.NRGBA {
+	x, y := int(u), int(v)
+	switch {
+	case inEye(q, x, y):
+		if t.eyeCovers(q.Size, u, v) {
+			return c.eye
+		}
+	case q.Modules[y][x] == 1 && t.moduleCovers(u-math.Floor(u)-0.5, v-math.Floor(v)-0.5):
+		return c.dark
+	}
+
+	return c.light
+}
+
+// moduleCovers reports whether the point (u, v), relative to the center of a
+// dark module, is inside the module shape.
+func (t Theme) moduleCovers(u, v float64) bool {
+	switch t.Shape {
+	case ShapeDot:
+		return u*u+v*v <= 0.45*0.45
+	case ShapeRounded:
+		return inRoundedRect(u, v, 0.5, 0.3)
+	default:
+		return true
+	}
+}
+
+// eyeCovers reports whether the point (u, v) of the symbol, which lies in a
+// finder pattern, is inside the eye shape.
+func (t Theme) eyeCovers(size int, u, v float64) bool {
+	cx, cy := 3.5, 3.5
+	if u >= 7 {
+		cx = float64(size) - 3.5
+	}
+	if v >= 7 {
+		cy = float64(size) - 3.5
+	}
+	dx, dy := u-cx, v-cy
+	switch t.Eye {
+	case EyeCircle:
+		r := math.Hypot(dx, dy)
+		return r <= 1.5 || (r >= 2.5 && r <= 3.5)
+	case EyeRounded:
+		return inRoundedRect(dx, dy, 1.5, 0.75) || (inRoundedRect(dx, dy, 3.5, 1.5) && !inRoundedRect(dx, dy, 2.5, 1))
+	default:
+		d := math.Max(math.Abs(dx), math.Abs(dy))
+		return d <= 1.5 || d >= 2.5
+	}
+}
+
+// inRoundedRect reports whether (dx, dy), relative to the center of a square
+// with the given half side and corner radius, is inside it.
+func inRoundedRect(dx, dy, half, radius float64) bool {
+	dx, dy = math.Abs(dx), math.Abs(dy)
+	if dx > half || dy > half {
+		return false
+	}
+	qx, qy := dx-(half-radius), dy-(half-radius)
+	if qx <= 0 || qy <= 0 {
+		return true
+	}
+
+	return qx*qx+qy*qy <= radius*radius
+}
+
+// writeCirclePath writes a circle as two arcs.
+func writeCirclePath(sb *strings.Builder, cx, cy, r float64) {
+	fmt.Fprintf(sb, "M%s,%sa%[3]s,%[3]s 0 1,0 %[4]s,0a%[3]s,%[3]s 0 1,0 -%[4]s,0z",
+		formatFloat(cx-r, 4), formatFloat(cy, 4), formatFloat(r, 4), formatFloat(2*r, 4))
+}
+
+// writeRoundedRectPath writes a rectangle with rounded corners (square ones
+// if r is 0).
+func writeRoundedRectPath(sb *strings.Builder, x, y, w, h, r float64) {
+	if r == 0 {
+		fmt.Fprintf(sb, "M%s,%sh%sv%sh-%[3]sz", formatFloat(x, 4), formatFloat(y, 4), formatFloat(w, 4), formatFloat(h, 4))
+		return
+	}
+	f := func(v float64) string { return formatFloat(v, 4) }
+	fmt.Fprintf(sb, "M%s,%sh%sa%[4]s,%[4]s 0 0 1 %[4]s,%[4]sv%[5]sa%[4]s,%[4]s 0 0 1 -%[4]s,%[4]sh-%[3]sa%[4]s,%[4]s 0 0 1 -%[4]s,-%[4]sv-%[5]sa%[4]s,%[4]s 0 0 1 %[4]s,-%[4]sz",
+		f(x+r), f(y), f(w-2*r), f(r), f(h-2*r))
+}
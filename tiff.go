@@ -0,0 +1,258 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// TIFFOptions controls WriteTIFF.
+type TIFFOptions struct {
+	Scale        int  // Pixels per module (default 4).
+	Border       int  // Quiet zone in modules (default 4; negative for none).
+	DPI          int  // Resolution recorded in the file (default 300).
+	Uncompressed bool // Store the bits as they are instead of compressing them with CCITT Group 4.
+}
+
+// WriteTIFF writes the QR code to w as a bilevel (1 bit per pixel) TIFF
+// image compressed with CCITT Group 4, the form document imaging, fax, and
+// archival systems expect.
+func (q *QRCode) WriteTIFF(w io.Writer, opts TIFFOptions) error {
+	if opts.Scale == 0 {
+		opts.Scale = 4
+	}
+	if opts.Border == 0 {
+		opts.Border = 4
+	} else if opts.Border < 0 {
+		opts.Border = 0
+	}
+	if opts.DPI == 0 {
+		opts.DPI = 300
+	}
+	if opts.Scale < 1 || opts.DPI < 1 {
+		return fmt.Errorf("scale and DPI must be positive")
+	}
+
+	grid := q.borderedGrid(opts.Border)
+	side := grid.size * opts.Scale
+	rows := make([][]uint8, side)
+	for y := range rows {
+		rows[y] = make([]uint8, side)
+		for x := range rows[y] {
+			rows[y][x] = grid.cells[y/opts.Scale*grid.size+x/opts.Scale]
+		}
+	}
+
+	var data []byte
+	compression := uint32(4)
+	if opts.Uncompressed {
+		compression = 1
+		rowBytes := (side + 7) / 8
+		data = make([]byte, side*rowBytes)
+		for y, row := range rows {
+			for x, c := range row {
+				data[y*rowBytes+x/8] |= c << (7 - x%8)
+			}
+		}
+	} else {
+		data = encodeGroup4(rows, side)
+	}
+
+	// The header, the strip, the IFD (on a word boundary), and the
+	// resolution values it points to.
+	const numEntries = 12
+	ifdOffset := uint32(8+len(data)+1) &^ 1
+	rationals := ifdOffset + 2 + numEntries*12 + 4
+	entries := []struct {
+		tag, typ uint16
+		value    uint32
+	}{
+		{256, 4, uint32(side)},      // ImageWidth
+		{257, 4, uint32(side)},      // ImageLength
+		{258, 3, 1},                 // BitsPerSample
+		{259, 3, compression},       // Compression
+		{262, 3, 0},                 // PhotometricInterpretation: WhiteIsZero
+		{273, 4, 8},                 // StripOffsets
+		{277, 3, 1},                 // SamplesPerPixel
+		{278, 4, uint32(side)},      // RowsPerStrip
+		{279, 4, uint32(len(data))}, // StripByteCounts
+		{282, 5, rationals},         // XResolution
+		{283, 5, rationals + 8},     // YResolution
+		{296, 3, 2},                 // ResolutionUnit: inch
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("II*\x00")
+	binary.Write(&buf, binary.LittleEndian, uint32(ifdOffset))
+	buf.Write(data)
+	if buf.Len() < int(ifdOffset) {
+		buf.WriteByte(0)
+	}
+	binary.Write(&buf, binary.LittleEndian, uint16(numEntries))
+	for _, e := range entries {
+		binary.Write(&buf, binary.LittleEndian, []uint16{e.tag, e.typ})
+		binary.Write(&buf, binary.LittleEndian, uint32(1))
+		binary.Write(&buf, binary.LittleEndian, e.value) // Shorts fill the low half, which comes first.
+	}
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // No further IFDs.
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(opts.DPI), 1, uint32(opts.DPI), 1})
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// encodeGroup4 compresses bilevel rows (1 for black) of the given width with
+// the two-dimensional coding of ITU-T T.6, each row coded against the one
+// above it, the first against an imaginary white row.
+func encodeGroup4(rows [][]uint8, width int) []byte {
+	var bb bitBuffer
+	ref := make([]uint8, width)
+	for _, row := range rows {
+		a0, color := -1, uint8(0)
+		for a0 < width {
+			b1 := nextChange(ref, a0, width)
+			if b1 < width && ref[b1] == color {
+				b1 = nextChange(ref, b1, width)
+			}
+			b2 := nextChange(ref, b1, width)
+			a1 := nextChange(row, a0, width)
+
+			switch {
+			case b2 < a1: // Pass mode.
+				bb.appendCode("0001")
+				a0 = b2
+			case a1-b1 >= -3 && a1-b1 <= 3: // Vertical mode.
+				bb.appendCode(verticalCodes[a1-b1+3])
+				a0, color = a1, 1-color
+			default: // Horizontal mode.
+				a2 := nextChange(row, a1, width)
+				bb.appendCode("001")
+				bb.appendRun(a1-max(a0, 0), color)
+				bb.appendRun(a2-a1, 1-color)
+				a0 = a2
+			}
+		}
+		ref = row
+	}
+	bb.appendCode("000000000001000000000001") // End of facsimile block.
+
+	data := make([]byte, (len(bb)+7)/8)
+	for i, bit := range bb {
+		data[i/8] |= bit << (7 - i%8)
+	}
+
+	return data
+}
+
+// nextChange returns the position of the first pixel after x whose color
+// differs from the pixel before it (white, before the first), or width if
+// there is none.
+func nextChange(row []uint8, x, width int) int {
+	for x++; x < width; x++ {
+		before := uint8(0)
+		if x > 0 {
+			before = row[x-1]
+		}
+		if row[x] != before {
+			return x
+		}
+	}
+
+	return width
+}
+
+// appendCode appends a code written as binary digits.
+func (bb *bitBuffer) appendCode(code string) {
+	for i := 0; i < len(code); i++ {
+		*bb = append(*bb, code[i]-'0')
+	}
+}
+
+// appendRun appends the codes for a run of n pixels of a color (1 for
+// black): makeup codes for the multiples of 64, then a terminating code.
+func (bb *bitBuffer) appendRun(n int, color uint8) {
+	terminating, makeup := whiteTerminatingCodes, whiteMakeupCodes
+	if color == 1 {
+		terminating, makeup = blackTerminatingCodes, blackMakeupCodes
+	}
+	for n >= 64 {
+		m := min(n, 2560) / 64
+		if m <= len(makeup) {
+			bb.appendCode(makeup[m-1])
+		} else {
+			bb.appendCode(extendedMakeupCodes[m-len(makeup)-1])
+		}
+		n -= m * 64
+	}
+	bb.appendCode(terminating[n])
+}
+
+// verticalCodes are the codes of vertical mode for a1-b1 from -3 to 3.
+var verticalCodes = [7]string{"0000010", "000010", "010", "1", "011", "000011", "0000011"}
+
+// The run length codes of ITU-T T.4, indexed by the length for terminating
+// codes and by the length/64-1 for makeup codes.
+var (
+	whiteTerminatingCodes = [64]string{
+		"00110101", "000111", "0111", "1000", "1011", "1100", "1110", "1111",
+		"10011", "10100", "00111", "01000", "001000", "000011", "110100", "110101",
+		"101010", "101011", "0100111", "0001100", "0001000", "0010111", "0000011", "0000100",
+		"0101000", "0101011", "0010011", "0100100", "0011000", "00000010", "00000011", "00011010",
+		"00011011", "00010010", "00010011", "00010100", "00010101", "00010110", "00010111", "00101000",
+		"00101001", "00101010", "00101011", "00101100", "00101101", "00000100", "00000101", "00001010",
+		"00001011", "01010010", "01010011", "01010100", "01010101", "00100100", "00100101", "01011000",
+		"01011001", "01011010", "01011011", "01001010", "01001011", "00110010", "00110011", "00110100",
+	}
+	whiteMakeupCodes = []string{
+		"11011", "10010", "010111", "0110111", "00110110", "00110111", "01100100", "01100101",
+		"01101000", "01100111", "011001100", "011001101", "011010010", "011010011", "011010100", "011010101",
+		"011010110", "011010111", "011011000", "011011001", "011011010", "011011011", "010011000", "010011001",
+		"010011010", "011000", "010011011",
+	}
+	blackTerminatingCodes = [64]string{
+		"0000110111", "010", "11", "10", "011", "0011", "0010", "00011",
+		"000101", "000100", "0000100", "0000101", "0000111", "00000100", "00000111", "000011000",
+		"0000010111", "0000011000", "0000001000", "00001100111", "00001101000", "00001101100", "00000110111", "00000101000",
+		"00000010111", "00000011000", "000011001010", "000011001011", "000011001100", "000011001101", "000001101000", "000001101001",
+		"000001101010", "000001101011", "000011010010", "000011010011", "000011010100", "000011010101", "000011010110", "000011010111",
+		"000001101100", "000001101101", "000011011010", "000011011011", "000001010100", "000001010101", "000001010110", "000001010111",
+		"000001100100", "000001100101", "000001010010", "000001010011", "000000100100", "000000110111", "000000111000", "000000100111",
+		"000000101000", "000001011000", "000001011001", "000000101011", "000000101100", "000001011010", "000001100110", "000001100111",
+	}
+	blackMakeupCodes = []string{
+		"0000001111", "000011001000", "000011001001", "000001011011", "000000110011", "000000110100", "000000110101", "0000001101100",
+		"0000001101101", "0000001001010", "0000001001011", "0000001001100", "0000001001101", "0000001110010", "0000001110011", "0000001110100",
+		"0000001110101", "0000001110110", "0000001110111", "0000001010010", "0000001010011", "0000001010100", "0000001010101", "0000001011010",
+		"0000001011011", "0000001100100", "0000001100101",
+	}
+	// extendedMakeupCodes, for 1792 to 2560, are shared by both colors.
+	extendedMakeupCodes = []string{
+		"00000001000", "00000001100", "00000001101", "000000010010", "000000010011", "000000010100", "000000010101",
+		"000000010110", "000000010111", "000000011100", "000000011101", "000000011110", "000000011111",
+	}
+)
@@ -0,0 +1,109 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"regexp"
+)
+
+// TikZOptions controls WriteTikZ.
+type TikZOptions struct {
+	ModuleSize string      // TeX length of the side of a module (default "1mm").
+	Border     int         // Quiet zone in modules (default 4; negative for none).
+	Dark       color.Color // Color of dark modules (default black).
+	Light      color.Color // Color of the background, or fully transparent for none (default white).
+	Standalone bool        // Wrap the picture in a complete document of the standalone class.
+}
+
+var texLength = regexp.MustCompile(`^[0-9]*\.?[0-9]+ ?(pt|mm|cm|in|bp|pc|dd|cc|sp|em|ex)$`)
+
+// WriteTikZ writes the QR code to w as a TikZ picture, so that LaTeX
+// documents can include it as vector graphics with \input. The dark modules
+// of each row are merged into runs and drawn as rectangles of a single fill
+// path; the picture needs the tikz package (and xcolor, which it loads).
+func (q *QRCode) WriteTikZ(w io.Writer, opts TikZOptions) error {
+	if opts.ModuleSize == "" {
+		opts.ModuleSize = "1mm"
+	}
+	if opts.Border == 0 {
+		opts.Border = 4
+	} else if opts.Border < 0 {
+		opts.Border = 0
+	}
+	if opts.Dark == nil {
+		opts.Dark = color.Black
+	}
+	if opts.Light == nil {
+		opts.Light = color.White
+	}
+	if !texLength.MatchString(opts.ModuleSize) {
+		return fmt.Errorf("module size %q is not a TeX length", opts.ModuleSize)
+	}
+
+	grid := q.borderedGrid(opts.Border)
+	bw := bufio.NewWriter(w)
+	if opts.Standalone {
+		bw.WriteString("\\documentclass[tikz]{standalone}\n\\begin{document}\n")
+	}
+	fmt.Fprintf(bw, "%% QR code version %d, error correction %s, mask %d\n", q.Version, q.ErrorCorrectionLevel, q.Mask)
+	fmt.Fprintf(bw, "\\begin{tikzpicture}[x=%[1]s,y=-%[1]s]\n", opts.ModuleSize)
+	for _, c := range []struct {
+		name string
+		color.Color
+	}{{"qrdark", opts.Dark}, {"qrlight", opts.Light}} {
+		n := color.NRGBAModel.Convert(c.Color).(color.NRGBA)
+		fmt.Fprintf(bw, "\\definecolor{%s}{RGB}{%d,%d,%d}\n", c.name, n.R, n.G, n.B)
+	}
+	if _, _, _, a := opts.Light.RGBA(); a == 0 {
+		fmt.Fprintf(bw, "\\useasboundingbox (0,0) rectangle (%[1]d,%[1]d);\n", grid.size)
+	} else {
+		fmt.Fprintf(bw, "\\fill[qrlight] (0,0) rectangle (%[1]d,%[1]d);\n", grid.size)
+	}
+
+	bw.WriteString("\\fill[qrdark]")
+	lineStart := true
+	grid.runs(func(x, y, n int, c uint8) {
+		if c == 0 {
+			return
+		}
+		if lineStart {
+			bw.WriteString("\n ")
+			lineStart = false
+		}
+		fmt.Fprintf(bw, " (%d,%d) rectangle ++(%d,1)", x, y, n)
+	}, func() {
+		lineStart = true
+	})
+	bw.WriteString(";\n\\end{tikzpicture}\n")
+	if opts.Standalone {
+		bw.WriteString("\\end{document}\n")
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,73 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+// A Tracer is called at the start of each stage of the encoding pipeline and
+// returns a function that is called when the stage ends. It lets operators
+// see where time goes without this package depending on a tracing library.
+// With OpenTelemetry, for example:
+//
+//	tracer := otel.Tracer("qrcodegen")
+//	trace := func(stage string) func() {
+//		_, span := tracer.Start(ctx, "qrcodegen."+stage)
+//		return func() { span.End() }
+//	}
+//	q, err := qrcodegen.EncodeText(text, qrcodegen.Medium, qrcodegen.WithTracer(trace))
+//
+// A Tracer may be called from several goroutines at once when it is shared
+// between concurrent encodes.
+type Tracer func(stage string) (end func())
+
+// Pipeline stages reported to a Tracer.
+const (
+	StageSegment = "segment" // Normalization, checks, and segmentation in EncodeText.
+	StageVersion = "version" // Choosing the version and error correction level.
+	StageECC     = "ecc"     // Computing and interleaving the error correction codewords.
+	StageMask    = "mask"    // Placing the codewords and choosing and applying the mask.
+	StageRender  = "render"  // Rendering by an Encoder.
+)
+
+// WithTracer reports the stages of encoding to t.
+func WithTracer(t Tracer) func(*segmentEncoder) {
+	return func(s *segmentEncoder) {
+		s.tracer = t
+	}
+}
+
+// trace starts a stage, returning the function that ends it.
+func (s *segmentEncoder) trace(stage string) func() {
+	return startStage(s.tracer, stage)
+}
+
+func startStage(t Tracer, stage string) func() {
+	if t == nil {
+		return func() {}
+	}
+	if end := t(stage); end != nil {
+		return end
+	}
+
+	return func() {}
+}
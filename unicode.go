@@ -0,0 +1,139 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnicodeOptions controls ToUnicodeString.
+type UnicodeOptions struct {
+	Dark   string // Glyph(s) for a dark module (default "██", two full blocks, so modules are roughly square).
+	Light  string // Glyph(s) for a light module (default two spaces).
+	Border int    // Quiet zone in modules (default none).
+	Prefix string // Written at the start of every row.
+	Suffix string // Written at the end of every row, before the newline.
+	// Invert swaps the dark and light glyphs, for terminals that draw light
+	// text on a dark background: the "dark" glyph then prints as the light
+	// color.
+	Invert bool
+}
+
+// ShadeGlyphs returns options with the shade characters of earlier debugging
+// output: ░ (light shade) for dark modules and ▓ (dark shade) for light ones.
+// That is the original mapping, which looks inverted on a light background;
+// set Invert in the result for the conventional look.
+func ShadeGlyphs() UnicodeOptions {
+	return UnicodeOptions{Dark: "░", Light: "▓"}
+}
+
+// ToUnicodeString renders the QR code as text, one line per row of modules.
+func (q *QRCode) ToUnicodeString(opts UnicodeOptions) string {
+	if opts.Dark == "" {
+		opts.Dark = "██"
+	}
+	if opts.Light == "" {
+		opts.Light = "  "
+	}
+	if opts.Invert {
+		opts.Dark, opts.Light = opts.Light, opts.Dark
+	}
+	if opts.Border < 0 {
+		opts.Border = 0
+	}
+
+	grid := q.borderedGrid(opts.Border)
+	glyphs := [2]string{opts.Light, opts.Dark}
+	var sb strings.Builder
+	for y := 0; y < grid.size; y++ {
+		sb.WriteString(opts.Prefix)
+		for _, c := range grid.cells[y*grid.size : (y+1)*grid.size] {
+			sb.WriteString(glyphs[c])
+		}
+		sb.WriteString(opts.Suffix)
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+// BrailleOptions controls ToBrailleString.
+type BrailleOptions struct {
+	Border int // Quiet zone in modules (default none).
+	// Invert raises the dots of the light modules instead of the dark ones,
+	// for terminals that draw light text on a dark background.
+	Invert bool
+}
+
+// brailleDots are the bits of the Unicode Braille dots, indexed by row and
+// column within a 2x4 cell.
+var brailleDots = [4][2]rune{{0x01, 0x08}, {0x02, 0x10}, {0x04, 0x20}, {0x40, 0x80}}
+
+// ToBrailleString renders the QR code as Unicode Braille patterns, each
+// character holding 2x4 modules as raised dots, for the most compact text
+// output. Modules beyond the bottom and right edges are light. Braille cells
+// are not square and the dots leave gaps, so the result is meant for logs
+// and previews; whether it scans from a screen depends on the font.
+func (q *QRCode) ToBrailleString(opts BrailleOptions) string {
+	if opts.Border < 0 {
+		opts.Border = 0
+	}
+
+	grid := q.borderedGrid(opts.Border)
+	raised := uint8(1)
+	if opts.Invert {
+		raised = 0
+	}
+	var sb strings.Builder
+	for y := 0; y < grid.size; y += 4 {
+		for x := 0; x < grid.size; x += 2 {
+			r := rune(0x2800)
+			for dy := 0; dy < 4; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					inside := y+dy < grid.size && x+dx < grid.size
+					if (inside && grid.cells[(y+dy)*grid.size+x+dx] == raised) || (!inside && opts.Invert) {
+						r |= brailleDots[dy][dx]
+					}
+				}
+			}
+			sb.WriteRune(r)
+		}
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+// String returns a human-readable description of the QR code, including a
+// drawing of its modules. Use ToUnicodeString for output meant to be scanned
+// from a terminal and DumpMatrix for output meant to be parsed.
+func (q *QRCode) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "QRCode version %d (%d×%d), ECL %s, mask %d\n", q.Version, q.Size, q.Size, q.ErrorCorrectionLevel, q.Mask)
+	sb.WriteString(q.ToUnicodeString(UnicodeOptions{Border: 1, Prefix: "\t"}))
+
+	return sb.String()
+}
@@ -0,0 +1,219 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// VariantStyle is a simple styling preset for GenerateVariants.
+type VariantStyle struct {
+	Name   string
+	Dark   color.Color // Color of dark modules.
+	Light  color.Color // Color of light modules and the border.
+	Border int         // Quiet zone width in modules.
+}
+
+// DefaultVariantStyles are the presets used when VariantOptions.Styles is
+// empty.
+var DefaultVariantStyles = []VariantStyle{
+	{"classic", color.Black, color.White, 4},
+	{"navy", color.RGBA{0x1B, 0x2A, 0x49, 0xFF}, color.White, 4},
+	{"forest", color.RGBA{0x1E, 0x4D, 0x2B, 0xFF}, color.RGBA{0xF4, 0xF1, 0xE8, 0xFF}, 4},
+	{"plum", color.RGBA{0x4A, 0x19, 0x42, 0xFF}, color.RGBA{0xFD, 0xF6, 0xF0, 0xFF}, 3},
+}
+
+// VariantOptions controls GenerateVariants.
+type VariantOptions struct {
+	Count  int            // Number of variants to produce.
+	Styles []VariantStyle // Styling presets to cycle through (default DefaultVariantStyles).
+	// Random, if not nil, randomizes the pad codewords of every variant, which
+	// changes the module pattern and allows more than 8*len(Styles) variants.
+	// It is the only source of randomness, so a seeded source makes the
+	// result reproducible.
+	Random rand.Source
+}
+
+// Variant is one payload-identical design produced by GenerateVariants.
+type Variant struct {
+	*QRCode
+	Style    VariantStyle
+	Penalty  int     // The mask penalty score (lower is easier to scan).
+	Contrast float64 // WCAG contrast ratio between Dark and Light.
+	Score    float64 // Estimated scannability in [0, 1] (higher is better).
+}
+
+// GenerateVariants encodes text count times with different masks, styling
+// presets and, optionally, random padding, and returns the variants sorted by
+// descending scannability score. Every variant decodes to the same text.
+//
+// The score combines the color contrast (full marks at 7:1, zero at or below
+// 3:1 or when dark modules are lighter than light ones) and the mask penalty
+// relative to the best mask. Variants that fail to decode score zero.
+func GenerateVariants(text string, ecl ECL, opts VariantOptions) ([]Variant, error) {
+	styles := opts.Styles
+	if len(styles) == 0 {
+		styles = DefaultVariantStyles
+	}
+	if opts.Count < 1 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+	if opts.Random == nil && opts.Count > 8*len(styles) {
+		return nil, fmt.Errorf("at most %d distinct variants without random padding", 8*len(styles))
+	}
+
+	segs := MakeSegments(text)
+	encode := func(mask Mask) (*QRCode, error) {
+		options := []func(*segmentEncoder){WithMask(mask)}
+		if opts.Random != nil {
+			options = append(options, WithRandomPadding(opts.Random))
+		}
+		return EncodeSegments(segs, ecl, options...)
+	}
+
+	// Order the masks from best to worst penalty with the standard padding, so
+	// the first variants use the most scannable masks.
+	masks := make([]Mask, 8)
+	penalties := make([]int, 8)
+	for m := range masks {
+		q, err := encode(Mask(m))
+		if err != nil {
+			return nil, err
+		}
+		masks[m] = Mask(m)
+		penalties[m] = q.getPenaltyScore()
+	}
+	sort.SliceStable(masks, func(i, j int) bool { return penalties[masks[i]] < penalties[masks[j]] })
+
+	result := make([]Variant, 0, opts.Count)
+	decodes := make([]bool, 0, opts.Count)
+	for i := 0; i < opts.Count; i++ {
+		// Each style meets each mask once per round of 8*len(styles).
+		mask := masks[i%8]
+		style := styles[(i%8+i/8)%len(styles)]
+
+		q, err := encode(mask)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := Decode(q)
+		result = append(result, Variant{QRCode: q, Style: style, Penalty: q.getPenaltyScore(), Contrast: contrastRatio(style.Dark, style.Light)})
+		decodes = append(decodes, err == nil && string(decoded.Data) == text)
+	}
+
+	// Random padding can give a variant a lower penalty than any mask with
+	// the standard padding, so the penalties are scored against the lowest
+	// of all.
+	bestPenalty := penalties[masks[0]]
+	for _, v := range result {
+		bestPenalty = min(bestPenalty, v.Penalty)
+	}
+	for i := range result {
+		if decodes[i] {
+			result[i].Score = variantScore(result[i], bestPenalty)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Score > result[j].Score })
+
+	return result, nil
+}
+
+// ToImage renders the variant with its style, each module scale pixels
+// square.
+func (v Variant) ToImage(scale int) (*image.Paletted, error) {
+	img, err := v.QRCode.ToImage(scale, v.Style.Border)
+	if err != nil {
+		return nil, err
+	}
+	img.Palette = color.Palette{v.Style.Light, v.Style.Dark}
+
+	return img, nil
+}
+
+// ToSVGString renders the variant with its style as SVG.
+func (v Variant) ToSVGString(includeDocType bool) (string, error) {
+	border := v.Style.Border
+	if border < 0 {
+		return "", fmt.Errorf("border must be non-negative")
+	}
+	if border == 0 {
+		border = -1 // SVGOptions takes 0 as the default border.
+	}
+
+	var sb strings.Builder
+	err := v.QRCode.WriteSVG(&sb, SVGOptions{
+		Border:  border,
+		DocType: includeDocType,
+		Dark:    hexColor(v.Style.Dark),
+		Light:   hexColor(v.Style.Light),
+	})
+
+	return sb.String(), err
+}
+
+func variantScore(v Variant, bestPenalty int) float64 {
+	if relativeLuminance(v.Style.Dark) >= relativeLuminance(v.Style.Light) {
+		return 0
+	}
+	contrast := (v.Contrast - 3) / (7 - 3)
+	if contrast <= 0 {
+		return 0
+	}
+	if contrast > 1 {
+		contrast = 1
+	}
+	penalty := 1.0
+	if v.Penalty > bestPenalty {
+		penalty = float64(bestPenalty) / float64(v.Penalty)
+	}
+	border := 1.0
+	if v.Style.Border < 4 {
+		border = 0.9 // Many scanners cope with a narrow quiet zone, but not all.
+	}
+
+	return (0.6*contrast + 0.4*penalty) * border
+}
+
+// contrastRatio returns the WCAG contrast ratio between two colors, in
+// [1, 21].
+func contrastRatio(a, b color.Color) float64 {
+	la, lb := relativeLuminance(a), relativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// hexColor formats c as #RRGGBB, ignoring alpha.
+func hexColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02X%02X%02X", r>>8, g>>8, b>>8)
+}
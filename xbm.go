@@ -0,0 +1,94 @@
+/*
+ * MIT LICENSE
+ *
+ * Copyright © 2020, G.Ralph Kuntz, MD.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package qrcodegen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// XBMOptions controls WriteXBM.
+type XBMOptions struct {
+	Name   string // C identifier prefixing the defined names (default "qrcode").
+	Scale  int    // Pixels per module (default 1).
+	Border int    // Quiet zone in modules (default 4; negative for none).
+}
+
+var cIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// WriteXBM writes the QR code to w as an X BitMap: C source defining
+// NAME_width, NAME_height, and the NAME_bits array, in which each row is
+// padded to whole bytes, the least significant bit of each byte is the
+// leftmost pixel, and set bits are dark.
+func (q *QRCode) WriteXBM(w io.Writer, opts XBMOptions) error {
+	if opts.Name == "" {
+		opts.Name = "qrcode"
+	}
+	if opts.Scale == 0 {
+		opts.Scale = 1
+	}
+	if opts.Border == 0 {
+		opts.Border = 4
+	} else if opts.Border < 0 {
+		opts.Border = 0
+	}
+	if !cIdentifier.MatchString(opts.Name) {
+		return fmt.Errorf("XBM name %q is not a C identifier", opts.Name)
+	}
+	if opts.Scale < 1 {
+		return fmt.Errorf("scale must be positive")
+	}
+
+	grid := q.borderedGrid(opts.Border)
+	side := grid.size * opts.Scale
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#define %[1]s_width %[2]d\n#define %[1]s_height %[2]d\nstatic unsigned char %[1]s_bits[] = {", opts.Name, side)
+
+	rowBytes := (side + 7) / 8
+	count := 0
+	for y := 0; y < side; y++ {
+		row := make([]byte, rowBytes)
+		for x := 0; x < side; x++ {
+			row[x/8] |= grid.cells[y/opts.Scale*grid.size+x/opts.Scale] << (x % 8)
+		}
+		for _, b := range row {
+			switch {
+			case count == 0:
+				bw.WriteString("\n   ")
+			case count%12 == 0:
+				bw.WriteString(",\n   ")
+			default:
+				bw.WriteString(",")
+			}
+			fmt.Fprintf(bw, " 0x%02x", b)
+			count++
+		}
+	}
+	bw.WriteString(" };\n")
+
+	return bw.Flush()
+}